@@ -0,0 +1,125 @@
+package blob
+
+import (
+	"errors"
+	"github.com/robsix/golog"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var ErrRangeNotSatisfiable = errors.New("Invalid range: not satisfiable")
+
+func newBlobStore(createBucket createBucket, deleteBucket deleteBucket, put put, get get, delete delete, download download, log golog.Log) BlobStore {
+	return &blobStore{
+		createBucket: createBucket,
+		deleteBucket: deleteBucket,
+		put:          put,
+		get:          get,
+		delete:       delete,
+		download:     download,
+		log:          log,
+	}
+}
+
+type blobStore struct {
+	createBucket createBucket
+	deleteBucket deleteBucket
+	put          put
+	get          get
+	delete       delete
+	download     download
+	log          golog.Log
+}
+
+func (bs *blobStore) CreateBucket(bucket string) error {
+	if err := bs.createBucket(bucket); err != nil {
+		bs.log.Error("BlobStore.CreateBucket error: bucket: %q error: %v", bucket, err)
+		return err
+	}
+	bs.log.Info("BlobStore.CreateBucket success: bucket: %q", bucket)
+	return nil
+}
+
+func (bs *blobStore) DeleteBucket(bucket string) error {
+	if err := bs.deleteBucket(bucket); err != nil {
+		bs.log.Error("BlobStore.DeleteBucket error: bucket: %q error: %v", bucket, err)
+		return err
+	}
+	bs.log.Info("BlobStore.DeleteBucket success: bucket: %q", bucket)
+	return nil
+}
+
+func (bs *blobStore) Put(bucket string, name string, data io.Reader) (string, error) {
+	if objectId, err := bs.put(bucket, name, data); err != nil {
+		bs.log.Error("BlobStore.Put error: bucket: %q name: %q error: %v", bucket, name, err)
+		return "", err
+	} else {
+		bs.log.Info("BlobStore.Put success: bucket: %q name: %q objectId: %q", bucket, name, objectId)
+		return objectId, nil
+	}
+}
+
+func (bs *blobStore) Get(bucket string, name string) (*http.Response, error) {
+	if res, err := bs.get(bucket, name); err != nil {
+		bs.log.Error("BlobStore.Get error: bucket: %q name: %q error: %v", bucket, name, err)
+		return res, err
+	} else {
+		bs.log.Info("BlobStore.Get success: bucket: %q name: %q", bucket, name)
+		return res, nil
+	}
+}
+
+func (bs *blobStore) Delete(bucket string, name string) error {
+	if err := bs.delete(bucket, name); err != nil {
+		bs.log.Error("BlobStore.Delete error: bucket: %q name: %q error: %v", bucket, name, err)
+		return err
+	}
+	bs.log.Info("BlobStore.Delete success: bucket: %q name: %q", bucket, name)
+	return nil
+}
+
+func (bs *blobStore) Download(bucket string, name string, byteRange *ByteRange, ifNoneMatch string) (*Download, error) {
+	if dl, err := bs.download(bucket, name, byteRange, ifNoneMatch); err != nil {
+		bs.log.Error("BlobStore.Download error: bucket: %q name: %q byteRange: %v ifNoneMatch: %q error: %v", bucket, name, byteRange, ifNoneMatch, err)
+		return nil, err
+	} else {
+		bs.log.Info("BlobStore.Download success: bucket: %q name: %q byteRange: %v ifNoneMatch: %q notModified: %t", bucket, name, byteRange, ifNoneMatch, dl.NotModified)
+		return dl, nil
+	}
+}
+
+// resolveRange clamps byteRange to a blob of size bytes, a nil byteRange is the whole blob.
+func resolveRange(byteRange *ByteRange, size int64) (start int64, end int64, err error) {
+	if byteRange == nil {
+		return 0, size - 1, nil
+	}
+	start, end = byteRange.Start, byteRange.End
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+	if start < 0 || start >= size || start > end {
+		return 0, 0, ErrRangeNotSatisfiable
+	}
+	return start, end, nil
+}
+
+// eTagMatches applies If-None-Match semantics, a list of tags or "*", comparing weakly.
+func eTagMatches(ifNoneMatch string, eTag string) bool {
+	if ifNoneMatch == "" || eTag == "" {
+		return false
+	}
+	eTag = strings.TrimPrefix(eTag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == eTag {
+			return true
+		}
+	}
+	return false
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,31 @@
+package blob
+
+import (
+	"io"
+	"time"
+)
+
+// ByteRange is an inclusive range of bytes, an End of -1 reads to the end of the blob.
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// Download is the result of a ranged or conditional get. When NotModified is
+// set Body is nil and only ETag and LastModified are filled in. Body must be
+// closed by the caller otherwise. AcceptRanges is false when the store can't
+// serve a range without reading the whole blob, such stores ignore the
+// requested range and always return the whole blob.
+type Download struct {
+	Body          io.ReadCloser `json:"-"`
+	NotModified   bool          `json:"notModified"`
+	AcceptRanges  bool          `json:"acceptRanges"`
+	Partial       bool          `json:"partial"`
+	Start         int64         `json:"start"`
+	End           int64         `json:"end"`
+	TotalLength   int64         `json:"totalLength"`
+	ContentLength int64         `json:"contentLength"`
+	ContentType   string        `json:"contentType"`
+	ETag          string        `json:"eTag"`
+	LastModified  time.Time     `json:"lastModified"`
+}
@@ -0,0 +1,158 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"github.com/robsix/golog"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// NewFsBlobStore keeps each bucket as a directory under rootDir and each
+// object as a file within it.
+func NewFsBlobStore(rootDir string, log golog.Log) BlobStore {
+
+	path := func(parts ...string) (string, error) {
+		for _, part := range parts {
+			if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+				return "", errors.New("invalid blob path part: " + part)
+			}
+		}
+		return filepath.Join(append([]string{rootDir}, parts...)...), nil
+	}
+
+	createBucket := func(bucket string) error {
+		if dir, err := path(bucket); err != nil {
+			return err
+		} else {
+			return os.MkdirAll(dir, 0750)
+		}
+	}
+
+	deleteBucket := func(bucket string) error {
+		if dir, err := path(bucket); err != nil {
+			return err
+		} else {
+			return os.RemoveAll(dir)
+		}
+	}
+
+	put := func(bucket string, name string, data io.Reader) (string, error) {
+		dir, err := path(bucket)
+		if err != nil {
+			return "", err
+		}
+		file, err := path(bucket, name)
+		if err != nil {
+			return "", err
+		}
+		tmp, err := ioutil.TempFile(dir, ".put-")
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(tmp, data); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", err
+		}
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return "", err
+		}
+		return "", os.Rename(tmp.Name(), file)
+	}
+
+	get := func(bucket string, name string) (*http.Response, error) {
+		file, err := path(bucket, name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		header := http.Header{}
+		header.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+		if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+			header.Set("Content-Type", contentType)
+		} else {
+			header.Set("Content-Type", "application/octet-stream")
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          f,
+			ContentLength: info.Size(),
+		}, nil
+	}
+
+	delete := func(bucket string, name string) error {
+		if file, err := path(bucket, name); err != nil {
+			return err
+		} else if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	download := func(bucket string, name string, byteRange *ByteRange, ifNoneMatch string) (*Download, error) {
+		file, err := path(bucket, name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		dl := &Download{
+			AcceptRanges: true,
+			TotalLength:  info.Size(),
+			ETag:         fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+			LastModified: info.ModTime().UTC(),
+			ContentType:  "application/octet-stream",
+		}
+		if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+			dl.ContentType = contentType
+		}
+		if eTagMatches(ifNoneMatch, dl.ETag) {
+			f.Close()
+			dl.NotModified = true
+			return dl, nil
+		}
+		if dl.Start, dl.End, err = resolveRange(byteRange, info.Size()); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if _, err := f.Seek(dl.Start, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		dl.Partial = byteRange != nil
+		dl.ContentLength = dl.End - dl.Start + 1
+		dl.Body = &limitedReadCloser{Reader: io.LimitReader(f, dl.ContentLength), Closer: f}
+		return dl, nil
+	}
+
+	return newBlobStore(createBucket, deleteBucket, put, get, delete, download, log)
+}
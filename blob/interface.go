@@ -0,0 +1,24 @@
+package blob
+
+import (
+	"io"
+	"net/http"
+)
+
+type createBucket func(bucket string) error
+type deleteBucket func(bucket string) error
+type put func(bucket string, name string, data io.Reader) (string, error)
+type get func(bucket string, name string) (*http.Response, error)
+type delete func(bucket string, name string) error
+type download func(bucket string, name string, byteRange *ByteRange, ifNoneMatch string) (*Download, error)
+
+type BlobStore interface {
+	CreateBucket(bucket string) error
+	DeleteBucket(bucket string) error
+	// Put returns the vada objectId of the stored blob when the store is vada
+	// backed, so it can be translated in place, other stores return "".
+	Put(bucket string, name string, data io.Reader) (string, error)
+	Get(bucket string, name string) (*http.Response, error)
+	Download(bucket string, name string, byteRange *ByteRange, ifNoneMatch string) (*Download, error)
+	Delete(bucket string, name string) error
+}
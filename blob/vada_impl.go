@@ -0,0 +1,69 @@
+package blob
+
+import (
+	"github.com/modelhub/vada"
+	"github.com/robsix/golog"
+	"io"
+	"net/http"
+)
+
+func NewVadaBlobStore(vada vada.VadaClient, ossBucketPolicy vada.BucketPolicy, log golog.Log) BlobStore {
+
+	createBucket := func(bucket string) error {
+		_, err := vada.CreateBucket(bucket, ossBucketPolicy)
+		return err
+	}
+
+	deleteBucket := func(bucket string) error {
+		return vada.DeleteBucket(bucket)
+	}
+
+	put := func(bucket string, name string, data io.Reader) (string, error) {
+		uploadResp, err := vada.UploadFile(name, bucket, data)
+		if err != nil {
+			return "", err
+		}
+		return uploadResp.String("objectId")
+	}
+
+	get := func(bucket string, name string) (*http.Response, error) {
+		return vada.GetFile(name, bucket)
+	}
+
+	delete := func(bucket string, name string) error {
+		return vada.DeleteFile(name, bucket)
+	}
+
+	//vada's GetFile takes no headers so oss can't be asked for a range, rather than
+	//re-transfer everything before the offset the byteRange is ignored and the whole
+	//object returned with AcceptRanges unset so callers don't offer to resume. An
+	//ifNoneMatch hit only reads the headers, closing the body stops the transfer.
+	download := func(bucket string, name string, byteRange *ByteRange, ifNoneMatch string) (*Download, error) {
+		res, err := vada.GetFile(name, bucket)
+		if err != nil {
+			return nil, err
+		}
+		dl := &Download{
+			TotalLength:   res.ContentLength,
+			ContentLength: res.ContentLength,
+			End:           res.ContentLength - 1,
+			ETag:          res.Header.Get("ETag"),
+			ContentType:   res.Header.Get("Content-Type"),
+		}
+		if lastModified, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+			dl.LastModified = lastModified.UTC()
+		}
+		if eTagMatches(ifNoneMatch, dl.ETag) {
+			res.Body.Close()
+			dl.NotModified = true
+			return dl, nil
+		}
+		if res.ContentLength < 0 {
+			dl.End = -1
+		}
+		dl.Body = res.Body
+		return dl, nil
+	}
+
+	return newBlobStore(createBucket, deleteBucket, put, get, delete, download, log)
+}
@@ -0,0 +1,27 @@
+package clashtest
+
+import (
+	"errors"
+	"github.com/modelhub/caca"
+	"github.com/modelhub/core/util"
+	"github.com/robsix/golog"
+)
+
+func NewMemClashTestStore(db *util.MemDb, caca caca.CacaClient, log golog.Log) ClashTestStore {
+
+	getForSheetTransforms := func(forUser string, leftSheetTransform string, rightSheetTransform string) (string, bool, error) {
+		db.RLock()
+		defer db.RUnlock()
+		lstProjectId := db.SheetTransformProject(leftSheetTransform)
+		if lstProjectId != db.SheetTransformProject(rightSheetTransform) {
+			return "", false, errors.New("Unauthorized action: clashTestGetForSheetTransforms cross project")
+		}
+		if _, err := db.Role(forUser, lstProjectId); err != nil {
+			return "", false, err
+		}
+		clashTestId := db.ClashTestId(leftSheetTransform, rightSheetTransform)
+		return clashTestId, clashTestId != "", nil
+	}
+
+	return newClashTestStore(getForSheetTransforms, caca, log)
+}
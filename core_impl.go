@@ -2,6 +2,7 @@ package core
 
 import (
 	"errors"
+	"github.com/modelhub/core/clashtest"
 	"github.com/modelhub/core/documentversion"
 	"github.com/modelhub/core/helper"
 	"github.com/modelhub/core/project"
@@ -9,11 +10,11 @@ import (
 	"github.com/modelhub/core/sheet"
 	"github.com/modelhub/core/sheettransform"
 	"github.com/modelhub/core/treenode"
+	"github.com/modelhub/core/upload"
 	"github.com/modelhub/core/user"
-	"github.com/modelhub/core/clashtest"
 )
 
-func newCoreApi(us user.UserStore, ps project.ProjectStore, tns treenode.TreeNodeStore, dvs documentversion.DocumentVersionStore, psvs projectspaceversion.ProjectSpaceVersionStore, ss sheet.SheetStore, sts sheettransform.SheetTransformStore, cts clashtest.ClashTestStore, h helper.Helper) (CoreApi, error) {
+func newCoreApi(us user.UserStore, ps project.ProjectStore, tns treenode.TreeNodeStore, tp treenode.TrashPurger, dvs documentversion.DocumentVersionStore, tm documentversion.TranslationMonitor, psvs projectspaceversion.ProjectSpaceVersionStore, ss sheet.SheetStore, sts sheettransform.SheetTransformStore, cts clashtest.ClashTestStore, ups upload.UploadStore, up upload.UploadPurger, h helper.Helper) (CoreApi, error) {
 	if us == nil || ps == nil || tns == nil || dvs == nil || ss == nil {
 		return nil, errors.New("nil values to CoreApi parameters or not allowed")
 	}
@@ -21,11 +22,15 @@ func newCoreApi(us user.UserStore, ps project.ProjectStore, tns treenode.TreeNod
 		us:   us,
 		ps:   ps,
 		tns:  tns,
+		tp:   tp,
 		dvs:  dvs,
+		tm:   tm,
 		psvs: psvs,
 		ss:   ss,
 		sts:  sts,
-		cts: cts,
+		cts:  cts,
+		ups:  ups,
+		up:   up,
 		h:    h,
 	}, nil
 }
@@ -34,11 +39,15 @@ type coreApi struct {
 	us   user.UserStore
 	ps   project.ProjectStore
 	tns  treenode.TreeNodeStore
+	tp   treenode.TrashPurger
 	dvs  documentversion.DocumentVersionStore
+	tm   documentversion.TranslationMonitor
 	psvs projectspaceversion.ProjectSpaceVersionStore
 	ss   sheet.SheetStore
 	sts  sheettransform.SheetTransformStore
-	cts clashtest.ClashTestStore
+	cts  clashtest.ClashTestStore
+	ups  upload.UploadStore
+	up   upload.UploadPurger
 	h    helper.Helper
 }
 
@@ -54,10 +63,18 @@ func (ca *coreApi) TreeNode() treenode.TreeNodeStore {
 	return ca.tns
 }
 
+func (ca *coreApi) TrashPurger() treenode.TrashPurger {
+	return ca.tp
+}
+
 func (ca *coreApi) DocumentVersion() documentversion.DocumentVersionStore {
 	return ca.dvs
 }
 
+func (ca *coreApi) TranslationMonitor() documentversion.TranslationMonitor {
+	return ca.tm
+}
+
 func (ca *coreApi) ProjectSpaceVersion() projectspaceversion.ProjectSpaceVersionStore {
 	return ca.psvs
 }
@@ -74,6 +91,14 @@ func (ca *coreApi) ClashTest() clashtest.ClashTestStore {
 	return ca.cts
 }
 
+func (ca *coreApi) Upload() upload.UploadStore {
+	return ca.ups
+}
+
+func (ca *coreApi) UploadPurger() upload.UploadPurger {
+	return ca.up
+}
+
 func (ca *coreApi) Helper() helper.Helper {
 	return ca.h
 }
@@ -0,0 +1,407 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/documentversion"
+	"github.com/modelhub/core/project"
+	"github.com/modelhub/core/treenode"
+	"github.com/modelhub/core/upload"
+	"github.com/modelhub/core/util"
+	"github.com/robsix/golog"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestCoreApi(t *testing.T) CoreApi {
+	return newTestCoreApiAt(t, t.TempDir())
+}
+
+// newTestCoreApiAt is newTestCoreApi keeping its blobs under blobDir, each
+// project's blobs are in the directory "test-<projectId>".
+func newTestCoreApiAt(t *testing.T, blobDir string) CoreApi {
+	log := golog.NewConsoleLog(0)
+	ca, err := NewMemCoreApi(blob.NewFsBlobStore(blobDir, log), nil, nil, nil, Settings{}, "", "test-", log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func newTestUser(t *testing.T, ca CoreApi, name string) string {
+	id, err := ca.User().Login(name, name, name, "", name, name+"@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// newTestProject creates a project owned by owner with every other user a
+// member in the role they are mapped to.
+func newTestProject(t *testing.T, ca CoreApi, owner string, members map[string]string) *project.Project {
+	p, err := ca.Project().Create(owner, "test project", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for user, role := range members {
+		if err := ca.Project().AddUsers(owner, p.Id, project.Role(role), []string{user}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ca.Project().AcceptInvite(user, p.Id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func testFile(content string) io.ReadCloser {
+	return ioutil.NopCloser(strings.NewReader(content))
+}
+
+func TestRoleChecks(t *testing.T) {
+	ca := newTestCoreApi(t)
+	owner, organiser, contributor, observer, outsider := newTestUser(t, ca, "owner"), newTestUser(t, ca, "organiser"), newTestUser(t, ca, "contributor"), newTestUser(t, ca, "observer"), newTestUser(t, ca, "outsider")
+	p := newTestProject(t, ca, owner, map[string]string{organiser: "organiser", contributor: "contributor", observer: "observer"})
+
+	for _, c := range []struct {
+		user    string
+		role    string
+		allowed bool
+	}{{owner, "owner", true}, {organiser, "organiser", true}, {contributor, "contributor", false}, {observer, "observer", false}, {outsider, "outsider", false}} {
+		if _, err := ca.TreeNode().CreateFolder(c.user, p.Id, c.role+" folder"); (err == nil) != c.allowed {
+			t.Errorf("CreateFolder as %s expected allowed %t got error: %v", c.role, c.allowed, err)
+		}
+	}
+
+	for _, c := range []struct {
+		user    string
+		role    string
+		allowed bool
+	}{{owner, "owner", true}, {contributor, "contributor", true}, {observer, "observer", false}, {outsider, "outsider", false}} {
+		if _, err := ca.TreeNode().CreateDocument(c.user, p.Id, c.role+".txt", "", "", c.role+".txt", testFile(c.role), "", nil); (err == nil) != c.allowed {
+			t.Errorf("CreateDocument as %s expected allowed %t got error: %v", c.role, c.allowed, err)
+		}
+	}
+
+	doc, err := ca.TreeNode().CreateDocument(owner, p.Id, "copied.txt", "", "", "copied.txt", testFile("copied"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//observers can read a project but copying a document out of it needs download rights
+	observed := newTestProject(t, ca, observer, nil)
+	if err := ca.TreeNode().Copy(observer, observed.Id, []string{doc.Id}, false); err == nil {
+		t.Error("Copy as observer of the source project expected an error")
+	}
+	contributed := newTestProject(t, ca, contributor, nil)
+	if err := ca.TreeNode().Copy(contributor, contributed.Id, []string{doc.Id}, false); err != nil {
+		t.Errorf("Copy as contributor of the source project expected no error got: %v", err)
+	}
+
+	if tns, err := ca.TreeNode().Get(outsider, []string{doc.Id}); err == nil && len(tns) > 0 {
+		t.Error("Get as outsider expected no treeNodes")
+	}
+	if err := ca.Project().Delete(organiser, p.Id); err == nil {
+		t.Error("project Delete as organiser expected an error")
+	}
+}
+
+func TestDocumentVersionNumbering(t *testing.T) {
+	ca := newTestCoreApi(t)
+	owner := newTestUser(t, ca, "owner")
+	p := newTestProject(t, ca, owner, nil)
+
+	doc, err := ca.TreeNode().CreateDocument(owner, p.Id, "notes.txt", "first", "", "notes.txt", testFile("v1"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := ca.DocumentVersion().Create(owner, doc.Id, "second", "", "notes.txt", testFile("v2"), "", nil, documentversion.RejectDuplicate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.Version != 2 {
+		t.Fatalf("expected version 2 got %d", v2.Version)
+	}
+	//re-uploading the latest content hands back the latest version rather than numbering a new one
+	same, err := ca.DocumentVersion().Create(owner, doc.Id, "again", "", "notes.txt", testFile("v2"), "", nil, documentversion.ReturnExisting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same.Id != v2.Id || same.Version != 2 {
+		t.Fatalf("expected the existing version 2 %q got version %d %q", v2.Id, same.Version, same.Id)
+	}
+	v3, err := ca.DocumentVersion().Create(owner, doc.Id, "third", "", "notes.txt", testFile("v3"), "", nil, documentversion.RejectDuplicate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v3.Version != 3 {
+		t.Fatalf("expected version 3 got %d", v3.Version)
+	}
+
+	docVers, total, err := ca.DocumentVersion().GetForDocument(owner, doc.Id, 0, 10, documentversion.VersionDesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(docVers) != 3 {
+		t.Fatalf("expected 3 versions got %d of %d", len(docVers), total)
+	}
+	for i, dv := range docVers {
+		if dv.Version != 3-i {
+			t.Errorf("expected version %d at %d got %d", 3-i, i, dv.Version)
+		}
+	}
+}
+
+func TestPaginationTotals(t *testing.T) {
+	ca := newTestCoreApi(t)
+	owner := newTestUser(t, ca, "owner")
+	members := map[string]string{}
+	for i := 0; i < 4; i++ {
+		members[newTestUser(t, ca, "member"+strconv.Itoa(i))] = "contributor"
+	}
+	p := newTestProject(t, ca, owner, members)
+
+	for i := 0; i < 5; i++ {
+		if _, err := ca.TreeNode().CreateFolder(owner, p.Id, "folder "+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []struct {
+		offset int
+		limit  int
+		count  int
+	}{{0, 10, 5}, {0, 2, 2}, {4, 2, 1}, {5, 2, 0}} {
+		tns, total, err := ca.TreeNode().GetChildren(owner, p.Id, treenode.Folder, nil, c.offset, c.limit, treenode.NameAsc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 5 || len(tns) != c.count {
+			t.Errorf("GetChildren offset %d limit %d expected %d of 5 got %d of %d", c.offset, c.limit, c.count, len(tns), total)
+		}
+	}
+
+	for _, c := range []struct {
+		offset int
+		limit  int
+		count  int
+	}{{0, 10, 5}, {1, 3, 3}, {3, 3, 2}} {
+		memberships, total, err := ca.Project().GetMemberships(owner, p.Id, project.Any, c.offset, c.limit, project.NameAsc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 5 || len(memberships) != c.count {
+			t.Errorf("GetMemberships offset %d limit %d expected %d of 5 got %d of %d", c.offset, c.limit, c.count, len(memberships), total)
+		}
+	}
+}
+
+func TestLmvUploadWithoutVada(t *testing.T) {
+	ca := newTestCoreApi(t)
+	owner := newTestUser(t, ca, "owner")
+	p := newTestProject(t, ca, owner, nil)
+
+	if _, err := ca.TreeNode().CreateDocument(owner, p.Id, "model.rvt", "", "", "model.rvt", testFile("model"), "", nil); err != util.ErrNoVada {
+		t.Fatalf("expected %v got %v", util.ErrNoVada, err)
+	}
+	if _, err := ca.TreeNode().CreateDocument(owner, p.Id, "notes.txt", "", "", "notes.txt", testFile("notes"), "", nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteRejectsTrashedTreeNodes(t *testing.T) {
+	ca := newTestCoreApi(t)
+	owner := newTestUser(t, ca, "owner")
+	p := newTestProject(t, ca, owner, nil)
+	folder, err := ca.TreeNode().CreateFolder(owner, p.Id, "folder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ca.TreeNode().Delete(owner, []string{folder.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.TreeNode().Delete(owner, []string{folder.Id}); err == nil {
+		t.Fatal("Delete of a trashed treeNode expected an error")
+	}
+}
+
+func TestCompleteUploadOnce(t *testing.T) {
+	ca := newTestCoreApi(t)
+	owner := newTestUser(t, ca, "owner")
+	p := newTestProject(t, ca, owner, nil)
+	us, err := ca.Upload().BeginUpload(owner, p.Id, "notes.txt", "", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.Upload().UploadChunk(owner, us.Id, 0, strings.NewReader("notes")); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := ca.Upload().CompleteUpload(owner, us.Id, "", "")
+			errs <- err
+		}()
+	}
+	completed := 0
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			completed++
+		} else if err != upload.ErrUploadCompleted {
+			t.Fatalf("expected %v got %v", upload.ErrUploadCompleted, err)
+		}
+	}
+	if completed != 1 {
+		t.Fatalf("expected the session to complete once got %d", completed)
+	}
+	if _, err := ca.Upload().CompleteUpload(owner, us.Id, "", ""); err != upload.ErrUploadCompleted {
+		t.Fatalf("expected a retry to get %v got %v", upload.ErrUploadCompleted, err)
+	}
+	if _, total, err := ca.TreeNode().GetChildren(owner, p.Id, treenode.Document, nil, 0, 10, treenode.NameAsc); err != nil || total != 1 {
+		t.Fatalf("expected 1 document got %d error: %v", total, err)
+	}
+}
+
+func testArchive(t *testing.T, files ...string) *zip.Reader {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, name := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func TestImportArchiveWithFoldersNeedsOrganiser(t *testing.T) {
+	ca := newTestCoreApi(t)
+	owner, contributor := newTestUser(t, ca, "owner"), newTestUser(t, ca, "contributor")
+	p := newTestProject(t, ca, owner, map[string]string{contributor: "contributor"})
+
+	if _, err := ca.TreeNode().ImportArchive(contributor, p.Id, testArchive(t, "a.txt", "dir/b.txt"), ""); err == nil {
+		t.Fatal("ImportArchive with folders as contributor expected an error")
+	}
+	if _, total, _ := ca.TreeNode().GetChildren(owner, p.Id, treenode.Any, nil, 0, 10, treenode.NameAsc); total != 0 {
+		t.Fatalf("expected nothing imported got %d treeNodes", total)
+	}
+	if results, err := ca.TreeNode().ImportArchive(contributor, p.Id, testArchive(t, "a.txt", "b.txt"), ""); err != nil || len(results) != 2 {
+		t.Fatalf("expected 2 results got %d error: %v", len(results), err)
+	}
+	if results, err := ca.TreeNode().ImportArchive(owner, p.Id, testArchive(t, "dir/c.txt"), ""); err != nil || len(results) != 1 || results[0].Action != treenode.ArchiveDocumentCreated {
+		t.Fatalf("expected the owner to import dir/c.txt got %v error: %v", results, err)
+	}
+}
+
+func TestFailedCopyIsRemovedWithoutTrash(t *testing.T) {
+	blobDir := t.TempDir()
+	ca := newTestCoreApiAt(t, blobDir)
+	owner := newTestUser(t, ca, "owner")
+	p := newTestProject(t, ca, owner, nil)
+	doc, err := ca.TreeNode().CreateDocument(owner, p.Id, "notes.txt", "", "", "notes.txt", testFile("notes"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docVers, _, err := ca.DocumentVersion().GetForDocument(owner, doc.Id, 0, 1, documentversion.VersionDesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(blobDir, "test-"+p.Id, docVers[0].Id+".txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ca.TreeNode().Copy(owner, p.Id, []string{doc.Id}, false); err == nil {
+		t.Fatal("Copy of a document with a missing blob expected an error")
+	}
+	if _, total, err := ca.TreeNode().GetChildren(owner, p.Id, treenode.Any, nil, 0, 10, treenode.NameAsc); err != nil || total != 1 {
+		t.Fatalf("expected only the original document got %d error: %v", total, err)
+	}
+	if _, total, err := ca.TreeNode().ListTrash(owner, p.Id, 0, 10, treenode.DeletedDesc); err != nil || total != 0 {
+		t.Fatalf("expected nothing in the trash got %d error: %v", total, err)
+	}
+}
+
+func TestExportArchiveSkipsMissingBlobs(t *testing.T) {
+	blobDir := t.TempDir()
+	ca := newTestCoreApiAt(t, blobDir)
+	owner := newTestUser(t, ca, "owner")
+	p := newTestProject(t, ca, owner, nil)
+	lost, err := ca.TreeNode().CreateDocument(owner, p.Id, "lost.txt", "", "", "lost.txt", testFile("lost"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.TreeNode().CreateDocument(owner, p.Id, "kept.txt", "", "", "kept.txt", testFile("kept"), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	docVers, _, err := ca.DocumentVersion().GetForDocument(owner, lost.Id, 0, 1, documentversion.VersionDesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(blobDir, "test-"+p.Id, docVers[0].Id+".txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ca.TreeNode().ExportArchive(owner, p.Id, buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[path.Base(f.Name)] = f
+	}
+	if _, exists := files["lost.txt"]; exists {
+		t.Error("expected lost.txt to be left out of the archive")
+	}
+	if _, exists := files["kept.txt"]; !exists {
+		t.Error("expected kept.txt in the archive")
+	}
+	mf, exists := files["manifest.json"]
+	if !exists {
+		t.Fatal("expected manifest.json in the archive")
+	}
+	mr, err := mf.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	manifest := &treenode.ArchiveManifest{}
+	if err := json.NewDecoder(mr).Decode(manifest); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range manifest.Entries {
+		switch path.Base(e.Path) {
+		case "lost.txt":
+			if e.Error == "" {
+				t.Error("expected an error on the lost.txt manifest entry")
+			}
+		case "kept.txt":
+			if e.Error != "" || e.Uploaded == nil {
+				t.Errorf("expected kept.txt with an upload time and no error got error: %q", e.Error)
+			}
+		default:
+			if e.Uploaded != nil {
+				t.Errorf("expected no upload time on folder %q", e.Path)
+			}
+		}
+	}
+}
@@ -1,16 +1,32 @@
 package documentversion
 
 import (
+	"errors"
 	"strings"
+	"time"
 )
 
 const (
-	VersionAsc                  = sortBy("versionAsc")
-	VersionDesc                 = sortBy("versionDesc")
-	documentVersionJsonProperty = "_modelhub_document_version_"
-	projectJsonProperty         = "_modelhub_project_"
+	VersionAsc                         = sortBy("versionAsc")
+	VersionDesc                        = sortBy("versionDesc")
+	RejectDuplicate                    = duplicateOption("rejectDuplicate")
+	ReturnExisting                     = duplicateOption("returnExisting")
+	documentVersionJsonProperty        = "_modelhub_document_version_"
+	projectJsonProperty                = "_modelhub_project_"
+	translationMonitorBatchSize        = 500
+	translationMonitorMaxBackoff       = 30 * time.Minute
+	translationMaxRetries              = 5
+	translationLastErrorMaxLen         = 1000
+	translationMessagesMaxCount        = 50
+	translationCallbackRetryDelay      = time.Minute
+	translationCallbackMaxBytes        = 10 << 20
+	translationCallbackTolerance       = 5 * time.Minute
+	TranslationCallbackSignatureHeader = "X-Modelhub-Signature"
+	TranslationCallbackTimestampHeader = "X-Modelhub-Timestamp"
 )
 
+var ErrDuplicateContent = errors.New("Invalid action: documentVersion create with the same content as the latest version")
+
 type sortBy string
 
 func SortBy(sb string) sortBy {
@@ -21,3 +37,14 @@ func SortBy(sb string) sortBy {
 		return VersionAsc
 	}
 }
+
+type duplicateOption string
+
+func DuplicateOption(do string) duplicateOption {
+	switch strings.ToLower(do) {
+	case "returnexisting":
+		return ReturnExisting
+	default:
+		return RejectDuplicate
+	}
+}
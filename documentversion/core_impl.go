@@ -1,45 +1,68 @@
 package documentversion
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/sheet"
 	"github.com/modelhub/core/util"
 	"github.com/modelhub/vada"
 	"github.com/robsix/golog"
+	. "github.com/robsix/json"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
 
-func newDocumentVersionStore(create create, get get, getForDocument getForDocument, getRole util.GetRole, bulkSetStatus bulkSetStatus, bulkSaveSheets bulkSaveSheets, statusCheckTimeout time.Duration, vada vada.VadaClient, ossBucketPrefix string, log golog.Log) DocumentVersionStore {
+func newDocumentVersionStore(create create, get get, getForDocument getForDocument, findByHash findByHash, retranslate retranslate, promote promote, deleteVersion deleteVersion, getByUrn getByUrn, getRole util.GetRole, bulkSetStatus bulkSetStatus, bulkSaveSheets bulkSaveSheets, getPdfThumbnailSuffixes sheet.GetPdfThumbnailSuffixes, blobStore blob.BlobStore, vada vada.VadaClient, fileTypes util.FileTypeRegistry, ossBucketPrefix string, translationCallbackSecret string, log golog.Log) DocumentVersionStore {
 	return &documentVersionStore{
-		create:             create,
-		get:                get,
-		getForDocument:     getForDocument,
-		getRole:            getRole,
-		bulkSetStatus:      bulkSetStatus,
-		bulkSaveSheets:     bulkSaveSheets,
-		statusCheckTimeout: statusCheckTimeout,
-		ossBucketPrefix:    ossBucketPrefix,
-		vada:               vada,
-		log:                log,
+		create:                    create,
+		get:                       get,
+		getForDocument:            getForDocument,
+		findByHash:                findByHash,
+		retranslate:               retranslate,
+		promote:                   promote,
+		deleteVersion:             deleteVersion,
+		getByUrn:                  getByUrn,
+		getRole:                   getRole,
+		bulkSetStatus:             bulkSetStatus,
+		bulkSaveSheets:            bulkSaveSheets,
+		getPdfThumbnailSuffixes:   getPdfThumbnailSuffixes,
+		ossBucketPrefix:           ossBucketPrefix,
+		blobStore:                 blobStore,
+		vada:                      vada,
+		fileTypes:                 fileTypes,
+		translationCallbackSecret: translationCallbackSecret,
+		log:                       log,
 	}
 }
 
 type documentVersionStore struct {
-	create             create
-	get                get
-	getForDocument     getForDocument
-	getRole            util.GetRole
-	bulkSetStatus      bulkSetStatus
-	bulkSaveSheets     bulkSaveSheets
-	statusCheckTimeout time.Duration
-	vada               vada.VadaClient
-	ossBucketPrefix    string
-	log                golog.Log
-}
-
-func (dvs *documentVersionStore) Create(forUser string, document string, uploadComment string, fileType string, fileName string, file io.ReadCloser, thumbnailType string, thumbnail io.ReadCloser) (*DocumentVersion, error) {
+	create                    create
+	get                       get
+	getForDocument            getForDocument
+	findByHash                findByHash
+	retranslate               retranslate
+	promote                   promote
+	deleteVersion             deleteVersion
+	getByUrn                  getByUrn
+	getRole                   util.GetRole
+	bulkSetStatus             bulkSetStatus
+	bulkSaveSheets            bulkSaveSheets
+	getPdfThumbnailSuffixes   sheet.GetPdfThumbnailSuffixes
+	blobStore                 blob.BlobStore
+	vada                      vada.VadaClient
+	fileTypes                 util.FileTypeRegistry
+	ossBucketPrefix           string
+	translationCallbackSecret string
+	log                       golog.Log
+}
+
+func (dvs *documentVersionStore) Create(forUser string, document string, uploadComment string, fileType string, fileName string, file io.ReadCloser, thumbnailType string, thumbnail io.ReadCloser, onDuplicate duplicateOption) (*DocumentVersion, error) {
 	if file == nil {
 		err := errors.New("file required")
 		dvs.log.Error("DocumentVersionStore.Create error: forUser: %q document: %q fileType: %q fileName: %q thumbnailType: %q error: %v", forUser, document, fileType, fileName, thumbnailType, err)
@@ -47,16 +70,18 @@ func (dvs *documentVersionStore) Create(forUser string, document string, uploadC
 	}
 	defer file.Close()
 	var projectId string
+	var latest *DocumentVersion
 
 	if thumbnail != nil {
 		defer thumbnail.Close()
 	}
 
-	if docVers, _, err := dvs.getForDocument(forUser, document, 0, 1, VersionAsc); err != nil || docVers == nil || len(docVers) == 0 {
+	if docVers, _, err := dvs.getForDocument(forUser, document, 0, 1, VersionDesc); err != nil || docVers == nil || len(docVers) == 0 {
 		dvs.log.Error("DocumentVersionStore.Create error: forUser: %q document: %q fileType: %q fileName: %q thumbnailType: %q error: %v", forUser, document, fileType, fileName, thumbnailType, err)
 		return nil, err
 	} else {
-		projectId = docVers[0].Project
+		latest = docVers[0]
+		projectId = latest.Project
 		if role, err := dvs.getRole(forUser, projectId); err != nil {
 			dvs.log.Error("DocumentVersionStore.Create error: forUser: %q document: %q fileType: %q fileName: %q thumbnailType: %q error: %v", forUser, document, fileType, fileName, thumbnailType, err)
 			return nil, err
@@ -67,13 +92,33 @@ func (dvs *documentVersionStore) Create(forUser string, document string, uploadC
 		}
 	}
 
-	if newDocVerId, status, urn, fileExtension, fileType, thumbnailType, err := util.DocumentUploadHelper(fileName, fileType, file, thumbnailType, thumbnail, dvs.ossBucketPrefix+projectId, dvs.vada, dvs.log); err != nil {
+	//checked before translation is registered so re-uploading the latest file never starts a translation
+	checkDuplicate := func(contentHash string) error {
+		if latest.ContentHash != "" && latest.ContentHash == contentHash {
+			return ErrDuplicateContent
+		}
+		return nil
+	}
+
+	if newDocVerId, status, urn, fileExtension, fileType, thumbnailType, contentHash, mimeType, imageInfo, err := util.DocumentUploadHelper(fileName, fileType, file, thumbnailType, thumbnail, dvs.ossBucketPrefix+projectId, dvs.blobStore, dvs.vada, dvs.fileTypes, checkDuplicate, dvs.log); err == ErrDuplicateContent && onDuplicate == ReturnExisting {
+		dvs.log.Info("DocumentVersionStore.Create success: forUser: %q document: %q returned existing version: %q with contentHash: %q", forUser, document, latest.Id, contentHash)
+		return latest, nil
+	} else if err != nil {
+		dvs.log.Error("DocumentVersionStore.Create error: forUser: %q document: %q fileType: %q fileName: %q contentHash: %q error: %v", forUser, document, fileType, fileName, contentHash, err)
 		return nil, err
 	} else {
-		if dv, err := dvs.create(forUser, document, newDocVerId, uploadComment, fileType, fileExtension, urn, status, thumbnailType); err != nil {
+		if dv, err := dvs.create(forUser, document, newDocVerId, uploadComment, fileType, fileExtension, urn, status, thumbnailType, contentHash, mimeType, imageInfo); err != nil {
 			dvs.log.Error("DocumentVersionStore.Create error: forUser: %q document: %q uploadComment: %q fileType: %q fileExtension: %q thumbnailType: %q error: %v", forUser, document, fileType, uploadComment, fileExtension, thumbnailType, err)
 			return nil, err
 		} else {
+			if fileType == "pdf" {
+				//a pdf which can't be read is still a valid document so this doesn't fail the upload
+				if count, err := sheet.SavePdfSheetsHelper(newDocVerId, projectId, fileExtension, dvs.ossBucketPrefix+projectId, dvs.blobStore, sheet.SaveSheets(dvs.bulkSaveSheets)); err != nil {
+					dvs.log.Warning("DocumentVersionStore.Create failed to save pdf sheets: documentVersion: %q error: %v", newDocVerId, err)
+				} else {
+					dv.SheetCount = count
+				}
+			}
 			dvs.log.Info("DocumentVersionStore.Create success: forUser: %q document: %q uploadComment: %q fileType: %q fileExtension: %q thumbnailType: %q", forUser, document, fileType, uploadComment, fileExtension, thumbnailType)
 			return dv, nil
 		}
@@ -86,7 +131,6 @@ func (dvs *documentVersionStore) Get(forUser string, ids []string) ([]*DocumentV
 		return nil, err
 	} else {
 		dvs.log.Info("DocumentVersionStore.Get success: forUser: %q ids: %v", forUser, ids)
-		performStatusCheck(docVers, dvs.bulkSetStatus, dvs.bulkSaveSheets, dvs.statusCheckTimeout, dvs.vada, dvs.log)
 		return docVers, nil
 	}
 }
@@ -97,7 +141,6 @@ func (dvs *documentVersionStore) GetForDocument(forUser string, document string,
 		return docVers, totalResults, err
 	} else {
 		dvs.log.Info("DocumentVersionStore.GetForDocument success: forUser: %q document: %q offset: %d limit: %d sortBy: %q totalResults: %d", forUser, document, offset, limit, sortBy, totalResults)
-		performStatusCheck(docVers, dvs.bulkSetStatus, dvs.bulkSaveSheets, dvs.statusCheckTimeout, dvs.vada, dvs.log)
 		return docVers, totalResults, nil
 	}
 }
@@ -116,7 +159,7 @@ func (dvs *documentVersionStore) GetSeedFile(forUser string, id string) (*http.R
 			return nil, err
 		}
 		docVer := docVers[0]
-		if res, err := dvs.vada.GetFile(docVer.Id+"."+docVer.FileExtension, dvs.ossBucketPrefix+docVer.Project); err != nil {
+		if res, err := dvs.blobStore.Get(dvs.ossBucketPrefix+docVer.Project, docVer.Id+"."+docVer.FileExtension); err != nil {
 			dvs.log.Error("DocumentVersionStore.GetSeedFile error: forUser: %q id: %q error: %v", forUser, id, err)
 			return res, err
 		} else {
@@ -133,7 +176,7 @@ func (dvs *documentVersionStore) GetThumbnail(forUser string, id string) (*http.
 	} else {
 		docVer := docVers[0]
 		if strings.HasPrefix(docVer.ThumbnailType, "image/") {
-			if res, err := dvs.vada.GetFile(docVer.Id+".tn.tn", dvs.ossBucketPrefix+docVer.Project); err != nil {
+			if res, err := dvs.blobStore.Get(dvs.ossBucketPrefix+docVer.Project, docVer.Id+".tn.tn"); err != nil {
 				dvs.log.Error("DocumentVersionStore.GetThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
 				return res, err
 			} else {
@@ -147,3 +190,329 @@ func (dvs *documentVersionStore) GetThumbnail(forUser string, id string) (*http.
 		}
 	}
 }
+
+func (dvs *documentVersionStore) DownloadSeedFile(forUser string, id string, byteRange *blob.ByteRange, ifNoneMatch string) (*blob.Download, error) {
+	if docVers, err := dvs.get(forUser, []string{id}); err != nil || docVers == nil || len(docVers) == 0 {
+		if err == nil {
+			err = errors.New("DocumentVersion not found")
+		}
+		dvs.log.Error("DocumentVersionStore.DownloadSeedFile error: forUser: %q id: %q error: %v", forUser, id, err)
+		return nil, err
+	} else {
+		if role, err := dvs.getRole(forUser, docVers[0].Project); err != nil {
+			dvs.log.Error("DocumentVersionStore.DownloadSeedFile error: forUser: %q id: %q error: %v", forUser, id, err)
+			return nil, err
+		} else if !(role == "owner" || role == "admin" || role == "organiser" || role == "contributor") {
+			err := errors.New("Unauthorized Action: documentVersion download seed file")
+			dvs.log.Error("DocumentVersionStore.DownloadSeedFile error: forUser: %q id: %q error: %v", forUser, id, err)
+			return nil, err
+		}
+		docVer := docVers[0]
+		if dl, err := dvs.blobStore.Download(dvs.ossBucketPrefix+docVer.Project, docVer.Id+"."+docVer.FileExtension, byteRange, ifNoneMatch); err != nil {
+			dvs.log.Error("DocumentVersionStore.DownloadSeedFile error: forUser: %q id: %q error: %v", forUser, id, err)
+			return nil, err
+		} else {
+			dvs.log.Info("DocumentVersionStore.DownloadSeedFile success: forUser: %q id: %q notModified: %t", forUser, id, dl.NotModified)
+			return dl, nil
+		}
+	}
+}
+
+func (dvs *documentVersionStore) DownloadThumbnail(forUser string, id string, byteRange *blob.ByteRange, ifNoneMatch string) (*blob.Download, error) {
+	if docVers, err := dvs.get(forUser, []string{id}); err != nil || docVers == nil || len(docVers) == 0 {
+		if err == nil {
+			err = errors.New("DocumentVersion not found")
+		}
+		dvs.log.Error("DocumentVersionStore.DownloadThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
+		return nil, err
+	} else {
+		docVer := docVers[0]
+		if !strings.HasPrefix(docVer.ThumbnailType, "image/") {
+			err = errors.New("DocumentVersion does not have a thumbnail")
+			dvs.log.Error("DocumentVersionStore.DownloadThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
+			return nil, err
+		}
+		if dl, err := dvs.blobStore.Download(dvs.ossBucketPrefix+docVer.Project, docVer.Id+".tn.tn", byteRange, ifNoneMatch); err != nil {
+			dvs.log.Error("DocumentVersionStore.DownloadThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
+			return nil, err
+		} else {
+			dl.ContentType = docVer.ThumbnailType
+			dvs.log.Info("DocumentVersionStore.DownloadThumbnail success: forUser: %q id: %q notModified: %t", forUser, id, dl.NotModified)
+			return dl, nil
+		}
+	}
+}
+
+func (dvs *documentVersionStore) Retranslate(forUser string, id string) error {
+	docVers, err := dvs.get(forUser, []string{id})
+	if err == nil && len(docVers) == 0 {
+		err = errors.New("DocumentVersion not found")
+	}
+	if err != nil {
+		dvs.log.Error("DocumentVersionStore.Retranslate error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	}
+	docVer := docVers[0]
+	if role, err := dvs.getRole(forUser, docVer.Project); err != nil {
+		dvs.log.Error("DocumentVersionStore.Retranslate error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	} else if !(role == "owner" || role == "admin") {
+		err := errors.New("Unauthorized Action: documentVersion retranslate")
+		dvs.log.Error("DocumentVersionStore.Retranslate error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	}
+	if !(docVer.Status == "failed" || docVer.Status == "failed_to_register" || docVer.Status == "timeout") {
+		err := errors.New("Invalid Action: documentVersion retranslate with status " + docVer.Status)
+		dvs.log.Error("DocumentVersionStore.Retranslate error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	}
+
+	if dvs.vada == nil {
+		dvs.log.Error("DocumentVersionStore.Retranslate error: forUser: %q id: %q error: %v", forUser, id, util.ErrNoVada)
+		return util.ErrNoVada
+	}
+
+	status, lastError := "registered", ""
+	if _, err := dvs.vada.RegisterFile(util.ToBase64(docVer.Urn)); err != nil {
+		dvs.log.Warning("DocumentVersionStore.Retranslate re-registering failed, TranslationMonitor will retry: forUser: %q id: %q error: %v", forUser, id, err)
+		status, lastError = "failed_to_register", truncateLastError(err.Error())
+	}
+	if err := dvs.retranslate(forUser, id, status, lastError); err != nil {
+		dvs.log.Error("DocumentVersionStore.Retranslate error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	}
+	dvs.log.Info("DocumentVersionStore.Retranslate success: forUser: %q id: %q status: %q", forUser, id, status)
+	return nil
+}
+
+// Promote makes a copy of an older version the latest one, the seed file and
+// thumbnails are copied within the bucket and the urn and sheets are reused so
+// nothing is uploaded or translated again.
+func (dvs *documentVersionStore) Promote(forUser string, id string, uploadComment string) (*DocumentVersion, error) {
+	docVers, err := dvs.get(forUser, []string{id})
+	if err == nil && len(docVers) == 0 {
+		err = errors.New("DocumentVersion not found")
+	}
+	if err != nil {
+		dvs.log.Error("DocumentVersionStore.Promote error: forUser: %q id: %q error: %v", forUser, id, err)
+		return nil, err
+	}
+	docVer := docVers[0]
+	if role, err := dvs.getRole(forUser, docVer.Project); err != nil {
+		dvs.log.Error("DocumentVersionStore.Promote error: forUser: %q id: %q error: %v", forUser, id, err)
+		return nil, err
+	} else if !(role == "owner" || role == "admin" || role == "organiser" || role == "contributor") {
+		err := errors.New("Unauthorized Action: documentVersion promote")
+		dvs.log.Error("DocumentVersionStore.Promote error: forUser: %q id: %q error: %v", forUser, id, err)
+		return nil, err
+	}
+
+	//blobs are keyed by documentVersion id so they are copied within the bucket before the new version row exists
+	bucket, newId := dvs.ossBucketPrefix+docVer.Project, util.NewId()
+	suffixes := []string{"." + docVer.FileExtension}
+	if docVer.ThumbnailType != "" {
+		suffixes = append(suffixes, ".tn.tn")
+	}
+	if docVer.FileType == "pdf" {
+		pageSuffixes, err := dvs.getPdfThumbnailSuffixes(docVer.Id)
+		if err != nil {
+			dvs.log.Error("DocumentVersionStore.Promote error: forUser: %q id: %q error: %v", forUser, id, err)
+			return nil, err
+		}
+		suffixes = append(suffixes, pageSuffixes...)
+	}
+	copied := make([]string, 0, len(suffixes))
+	undo := func() {
+		for _, name := range copied {
+			if err := dvs.blobStore.Delete(bucket, name); err != nil {
+				dvs.log.Error("DocumentVersionStore.Promote error: forUser: %q id: %q removing blob: %q error: %v", forUser, id, name, err)
+			}
+		}
+	}
+	for _, suffix := range suffixes {
+		if err := dvs.copyBlob(bucket, docVer.Id+suffix, newId+suffix); err != nil {
+			dvs.log.Error("DocumentVersionStore.Promote error: forUser: %q id: %q blob: %q error: %v", forUser, id, docVer.Id+suffix, err)
+			undo()
+			return nil, err
+		}
+		copied = append(copied, newId+suffix)
+	}
+
+	if dv, err := dvs.promote(forUser, id, newId, uploadComment); err != nil {
+		dvs.log.Error("DocumentVersionStore.Promote error: forUser: %q id: %q error: %v", forUser, id, err)
+		undo()
+		return nil, err
+	} else {
+		dvs.log.Info("DocumentVersionStore.Promote success: forUser: %q id: %q newId: %q version: %d", forUser, id, dv.Id, dv.Version)
+		return dv, nil
+	}
+}
+
+// Delete removes a single version along with its sheets, and by cascade their
+// sheetTransforms and clashTests, then its seed file and thumbnails. Versions
+// used by a projectSpaceVersion are only removed when force is set.
+func (dvs *documentVersionStore) Delete(forUser string, id string, force bool) error {
+	docVers, err := dvs.get(forUser, []string{id})
+	if err == nil && len(docVers) == 0 {
+		err = errors.New("DocumentVersion not found")
+	}
+	if err != nil {
+		dvs.log.Error("DocumentVersionStore.Delete error: forUser: %q id: %q force: %t error: %v", forUser, id, force, err)
+		return err
+	}
+	docVer := docVers[0]
+	if role, err := dvs.getRole(forUser, docVer.Project); err != nil {
+		dvs.log.Error("DocumentVersionStore.Delete error: forUser: %q id: %q force: %t error: %v", forUser, id, force, err)
+		return err
+	} else if !(role == "owner" || role == "admin") {
+		err := errors.New("Unauthorized Action: documentVersion delete")
+		dvs.log.Error("DocumentVersionStore.Delete error: forUser: %q id: %q force: %t error: %v", forUser, id, force, err)
+		return err
+	}
+	//the page thumbnails are found through the sheets so they are listed before the sheets are removed
+	pageSuffixes := []string{}
+	if docVer.FileType == "pdf" {
+		if pageSuffixes, err = dvs.getPdfThumbnailSuffixes(docVer.Id); err != nil {
+			dvs.log.Error("DocumentVersionStore.Delete error: forUser: %q id: %q force: %t error: %v", forUser, id, force, err)
+			return err
+		}
+	}
+	if err := dvs.deleteVersion(forUser, id, force); err != nil {
+		dvs.log.Error("DocumentVersionStore.Delete error: forUser: %q id: %q force: %t error: %v", forUser, id, force, err)
+		return err
+	}
+
+	//the row is already gone so blob failures are only logged
+	bucket := dvs.ossBucketPrefix + docVer.Project
+	names := []string{docVer.Id + "." + docVer.FileExtension}
+	if docVer.ThumbnailType != "" {
+		names = append(names, docVer.Id+".tn.tn")
+	}
+	for _, suffix := range pageSuffixes {
+		names = append(names, docVer.Id+suffix)
+	}
+	for _, name := range names {
+		if err := dvs.blobStore.Delete(bucket, name); err != nil {
+			dvs.log.Error("DocumentVersionStore.Delete error: forUser: %q id: %q blob: %q error: %v", forUser, id, name, err)
+		}
+	}
+	dvs.log.Info("DocumentVersionStore.Delete success: forUser: %q id: %q force: %t", forUser, id, force)
+	return nil
+}
+
+func (dvs *documentVersionStore) copyBlob(bucket string, fromName string, toName string) error {
+	res, err := dvs.blobStore.Get(bucket, fromName)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = dvs.blobStore.Put(bucket, toName, res.Body)
+	return err
+}
+
+func (dvs *documentVersionStore) HandleTranslationCallback(payload []byte, timestamp string, signature string) error {
+	if err := dvs.verifyTranslationCallback(payload, timestamp, signature, time.Now()); err != nil {
+		dvs.log.Error("DocumentVersionStore.HandleTranslationCallback error: timestamp: %q signature: %q error: %v", timestamp, signature, err)
+		return err
+	}
+	statusJson, err := FromString(string(payload))
+	if err != nil {
+		dvs.log.Error("DocumentVersionStore.HandleTranslationCallback error: error: %v", err)
+		return err
+	}
+	urn, err := statusJson.String("urn")
+	if err != nil {
+		dvs.log.Error("DocumentVersionStore.HandleTranslationCallback error: error: %v", err)
+		return err
+	}
+	if !strings.HasPrefix(urn, "urn:") {
+		if urn, err = util.FromBase64(urn); err != nil {
+			dvs.log.Error("DocumentVersionStore.HandleTranslationCallback error: urn: %q error: %v", urn, err)
+			return err
+		}
+	}
+	docVers, err := dvs.getByUrn(urn)
+	if err == nil && len(docVers) == 0 {
+		err = errors.New("DocumentVersion not found for urn")
+	}
+	if err != nil {
+		dvs.log.Error("DocumentVersionStore.HandleTranslationCallback error: urn: %q error: %v", urn, err)
+		return err
+	}
+
+	//copies of a documentVersion share its translation so every version with the urn is updated
+	now := time.Now().UTC()
+	retryDelay := translationRetryDelay(translationCallbackRetryDelay)
+	changes := make([]*DocumentVersion, 0, len(docVers))
+	successes := make([]*Json, 0, len(docVers))
+	for _, dv := range docVers {
+		dvJson, _ := FromString(string(payload))
+		if changed, successJson, err := applyTranslationStatus(dv, dvJson, now, retryDelay, dvs.log); err != nil {
+			dvs.log.Error("DocumentVersionStore.HandleTranslationCallback error: urn: %q error: %v", urn, err)
+			return err
+		} else if changed {
+			changes = append(changes, dv)
+			if successJson != nil {
+				successes = append(successes, successJson)
+			}
+		}
+	}
+	if len(changes) > 0 {
+		if err := dvs.bulkSetStatus(changes); err != nil {
+			dvs.log.Error("DocumentVersionStore.HandleTranslationCallback error: urn: %q error: %v", urn, err)
+			return err
+		}
+	}
+	if len(successes) > 0 {
+		if errs := extractAndSaveSheets(successes, dvs.bulkSaveSheets); errs != nil {
+			dvs.log.Error("DocumentVersionStore.HandleTranslationCallback error: urn: %q error: %v", urn, errs)
+			return errs[0]
+		}
+	}
+	dvs.log.Info("DocumentVersionStore.HandleTranslationCallback success: urn: %q changed: %d translated: %d", urn, len(changes), len(successes))
+	return nil
+}
+
+// verifyTranslationCallback checks signature is the hex encoded HMAC-SHA256 of
+// timestamp, a ".", then payload keyed with the shared secret, optionally
+// prefixed with "sha256=". timestamp is in unix seconds and must be within
+// translationCallbackTolerance of now so captured callbacks can't be replayed later.
+func (dvs *documentVersionStore) verifyTranslationCallback(payload []byte, timestamp string, signature string, now time.Time) error {
+	if dvs.translationCallbackSecret == "" {
+		return errors.New("Translation callbacks are not configured")
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return errInvalidCallbackSignature
+	}
+	mac := hmac.New(sha256.New, []byte(dvs.translationCallbackSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return errInvalidCallbackSignature
+	}
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errInvalidCallbackSignature
+	}
+	if skew := now.Sub(time.Unix(secs, 0)); skew > translationCallbackTolerance || skew < -translationCallbackTolerance {
+		return errInvalidCallbackSignature
+	}
+	return nil
+}
+
+func (dvs *documentVersionStore) FindByHash(forUser string, project string, hash string) ([]*DocumentVersion, error) {
+	hash = strings.ToLower(hash)
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != 64 {
+		err := errors.New("Invalid hash: expected hex encoded SHA-256")
+		dvs.log.Error("DocumentVersionStore.FindByHash error: forUser: %q project: %q hash: %q error: %v", forUser, project, hash, err)
+		return nil, err
+	}
+	if docVers, err := dvs.findByHash(forUser, project, hash); err != nil {
+		dvs.log.Error("DocumentVersionStore.FindByHash error: forUser: %q project: %q hash: %q error: %v", forUser, project, hash, err)
+		return nil, err
+	} else {
+		dvs.log.Info("DocumentVersionStore.FindByHash success: forUser: %q project: %q hash: %q results: %d", forUser, project, hash, len(docVers))
+		return docVers, nil
+	}
+}
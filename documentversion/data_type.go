@@ -1,21 +1,36 @@
 package documentversion
 
 import (
+	"github.com/modelhub/core/util"
 	"time"
 )
 
 type DocumentVersion struct {
-	Id            string    `json:"id"`
-	Document      string    `json:"document"`
-	Version       int       `json:"version"`
-	Project       string    `json:"project"`
-	Uploaded      time.Time `json:"uploaded"`
-	UploadComment string    `json:"uploadComment"`
-	UploadedBy    string    `json:"uploadedBy"`
-	FileType      string    `json:"fileType"`
-	FileExtension string    `json:"fileExtension"`
-	Status        string    `json:"status"`
-	ThumbnailType string    `json:"thumbnailType"`
-	SheetCount    int       `json:"sheetCount"`
-	Urn           string    `json:"-"`
+	Id                  string                `json:"id"`
+	Document            string                `json:"document"`
+	Version             int                   `json:"version"`
+	Project             string                `json:"project"`
+	Uploaded            time.Time             `json:"uploaded"`
+	UploadComment       string                `json:"uploadComment"`
+	UploadedBy          string                `json:"uploadedBy"`
+	FileType            string                `json:"fileType"`
+	FileExtension       string                `json:"fileExtension"`
+	Status              string                `json:"status"`
+	ThumbnailType       string                `json:"thumbnailType"`
+	RetryCount          int                   `json:"retryCount"`
+	LastError           string                `json:"lastError"`
+	NextRetry           *time.Time            `json:"nextRetry,omitempty"`
+	Progress            string                `json:"progress"`
+	TranslationMessages []*TranslationMessage `json:"translationMessages,omitempty"`
+	ContentHash         string                `json:"contentHash"`
+	MimeType            string                `json:"mimeType"`
+	ImageInfo           *util.ImageInfo       `json:"imageInfo,omitempty"`
+	SheetCount          int                   `json:"sheetCount"`
+	Urn                 string                `json:"-"`
+}
+
+type TranslationMessage struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
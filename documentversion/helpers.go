@@ -1,6 +1,7 @@
 package documentversion
 
 import (
+	encoding "encoding/json"
 	"errors"
 	"github.com/modelhub/core/sheet"
 	"github.com/modelhub/core/util"
@@ -11,100 +12,167 @@ import (
 	"time"
 )
 
-func performStatusCheck(dvs []*DocumentVersion, bulkStatusUpdate bulkSetStatus, bulkSaveSheets bulkSaveSheets, statusCheckTimeOut time.Duration, vada vada.VadaClient, log golog.Log) []error {
-	errChan := make(chan error)
-	changeChan := make(chan *DocumentVersion)
-	successChan := make(chan *Json)
-	timeOutChan := time.After(statusCheckTimeOut)
-	checkCount := 0
-	for _, e := range dvs {
-		if e.Status == "registered" || e.Status == "pending" || e.Status == "inprogress" || e.Status == "failed_to_register" {
-			go func(dv *DocumentVersion) {
-				log.Info("DocumentVersionStore performStatusCheck for docVer: %q ", dv.Id)
-				if dv.Status == "failed_to_register" {
-					log.Info("DocumentVersionStore attempt re-registering of failed file: %q", dv.Id+"."+dv.FileExtension)
-					b64Urn := util.ToBase64(dv.Urn)
-					_, err := vada.RegisterFile(b64Urn)
-					if err != nil {
-						log.Error("DocumentVersionStore performStatusCheck, re-registering of failed file error: %v", err)
-						errChan <- err
-						return
-					} else {
-						dv.Status = "registered"
-						changeChan <- dv
-						return
-					}
-				}
-				statusJson, err := vada.GetDocumentInfo(util.ToBase64(dv.Urn), "")
-				if err != nil {
-					errChan <- err
-					return
-				}
-				status, err := statusJson.String("status")
-				if err != nil {
-					log.Critical("DocumentVersionStore performStatusCheck, could not read status property error: %v", err)
-					errChan <- err
-					return
-				}
-				if dv.Status != status {
-					dv.Status = status
-					changeChan <- dv
-					if dv.Status == "success" {
-						statusJson.Set(dv.Id, documentVersionJsonProperty)
-						statusJson.Set(dv.Project, projectJsonProperty)
-						successChan <- statusJson
-					}
-				} else {
-					errChan <- nil
-					return
-				}
-			}(e)
-			checkCount++
-		}
+// pollTranslation checks a single non terminal documentVersion against vada,
+// re-registering it first if the previous registration failed, and uploading
+// it through upload first if it never reached vada at all. changed reports
+// whether dv was updated, statusJson is only set once translation succeeds and
+// err is only returned for transient errors that do not use up a retry.
+func pollTranslation(dv *DocumentVersion, now time.Time, retryDelay func(attempt int) time.Duration, upload func(dv *DocumentVersion) (string, error), vada vada.VadaClient, log golog.Log) (changed bool, statusJson *Json, err error) {
+	log.Info("DocumentVersionStore pollTranslation for docVer: %q ", dv.Id)
+	if vada == nil {
+		return false, nil, util.ErrNoVada
 	}
-	errs := make([]error, 0, checkCount)
-	changes := make([]*DocumentVersion, 0, checkCount)
-	successes := make([]*Json, 0, checkCount)
-	for checkCount > 0 {
-		timedOut := false
-		select {
-		case err := <-errChan:
-			checkCount--
+	if dv.Status == "failed_to_register" {
+		if dv.Urn == "" {
+			log.Info("DocumentVersionStore attempt uploading of failed file: %q", dv.Id+"."+dv.FileExtension)
+			urn, err := upload(dv)
 			if err != nil {
-				errs = append(errs, err)
-			}
-		case dv := <-changeChan:
-			if dv.Status != "success" {
-				checkCount--
+				log.Error("DocumentVersionStore pollTranslation, uploading of failed file error: %v", err)
+				recordTranslationFailure(dv, err.Error(), now, retryDelay)
+				return true, nil, nil
 			}
-			changes = append(changes, dv)
-		case statusJson := <-successChan:
-			checkCount--
-			successes = append(successes, statusJson)
-		case <-timeOutChan:
-			log.Warning("DocumentVersionStore performStatusCheck timed out after %v with %d open updates awaiting response", statusCheckTimeOut, checkCount)
-			timedOut = true
+			dv.Urn = urn
 		}
-		if timedOut {
-			break
+		log.Info("DocumentVersionStore attempt re-registering of failed file: %q", dv.Id+"."+dv.FileExtension)
+		if _, err := vada.RegisterFile(util.ToBase64(dv.Urn)); err != nil {
+			log.Error("DocumentVersionStore pollTranslation, re-registering of failed file error: %v", err)
+			recordTranslationFailure(dv, err.Error(), now, retryDelay)
+			return true, nil, nil
 		}
+		dv.Status = "registered"
+		dv.NextRetry = nil
+		return true, nil, nil
 	}
-	if len(changes) > 0 {
-		if err := bulkStatusUpdate(changes); err != nil {
-			errs = append(errs, err)
+	statusJson, err = vada.GetDocumentInfo(util.ToBase64(dv.Urn), "")
+	if err != nil {
+		return false, nil, err
+	}
+	return applyTranslationStatus(dv, statusJson, now, retryDelay, log)
+}
+
+// applyTranslationStatus updates dv from a vada manifest, whether it was polled
+// or posted to HandleTranslationCallback, statusJson is returned tagged with the
+// documentVersion and project ready for extractAndSaveSheets once it succeeds.
+func applyTranslationStatus(dv *DocumentVersion, statusJson *Json, now time.Time, retryDelay func(attempt int) time.Duration, log golog.Log) (changed bool, successJson *Json, err error) {
+	status, err := statusJson.String("status")
+	if err != nil {
+		log.Critical("DocumentVersionStore applyTranslationStatus, could not read status property error: %v", err)
+		return false, nil, err
+	}
+	progress := statusJson.MustString("", "progress")
+	messages := getTranslationMessages(statusJson)
+	if dv.Status == status {
+		if dv.Progress == progress && toTranslationMessagesJson(dv.TranslationMessages) == toTranslationMessagesJson(messages) {
+			return false, nil, nil
 		}
+		dv.Progress = progress
+		dv.TranslationMessages = messages
+		return true, nil, nil
+	}
+	dv.Progress = progress
+	dv.TranslationMessages = messages
+	switch status {
+	case "failed", "timeout":
+		recordTranslationFailure(dv, "vada translation "+status, now, retryDelay)
+		return true, nil, nil
+	case "success":
+		dv.Status = status
+		statusJson.Set(dv.Id, documentVersionJsonProperty)
+		statusJson.Set(dv.Project, projectJsonProperty)
+		return true, statusJson, nil
+	default:
+		dv.Status = status
+		return true, nil, nil
 	}
-	if len(successes) > 0 {
-		if err := extractAndSaveSheets(successes, bulkSaveSheets); err != nil {
-			errs = append(errs, err...)
+}
+
+// translationRetryDelay doubles from base for each attempt, up to translationMonitorMaxBackoff.
+func translationRetryDelay(base time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		if attempt > 30 {
+			return translationMonitorMaxBackoff
+		}
+		if wait := base << uint(attempt); wait > 0 && wait < translationMonitorMaxBackoff {
+			return wait
 		}
+		return translationMonitorMaxBackoff
 	}
-	if len(errs) != 0 {
-		log.Error("DocumentVersionStore performStatusCheck error: %v", errs)
-		return errs
+}
+
+// recordTranslationFailure uses up one retry, leaving dv to be re-registered
+// after retryDelay or in the terminal failed state once the budget is spent.
+func recordTranslationFailure(dv *DocumentVersion, lastError string, now time.Time, retryDelay func(attempt int) time.Duration) {
+	dv.RetryCount++
+	dv.LastError = truncateLastError(lastError)
+	if dv.RetryCount >= translationMaxRetries {
+		dv.Status = "failed"
+		dv.NextRetry = nil
 	} else {
+		dv.Status = "failed_to_register"
+		nextRetry := now.Add(retryDelay(dv.RetryCount))
+		dv.NextRetry = &nextRetry
+	}
+}
+
+// getTranslationMessages collects the warnings and errors vada attaches to any
+// node of the manifest, a message may be a single string or a list of strings.
+func getTranslationMessages(json *Json) []*TranslationMessage {
+	var messages []*TranslationMessage
+	var recurseThroughChildren func(obj *Json)
+	recurseThroughChildren = func(obj *Json) {
+		for _, m := range obj.MustSlice([]interface{}{}, "messages") {
+			if len(messages) == translationMessagesMaxCount {
+				return
+			}
+			msg := FromInterface(m)
+			text := msg.MustString("", "message")
+			if text == "" {
+				parts := make([]string, 0, 2)
+				for _, part := range msg.MustSlice([]interface{}{}, "message") {
+					if str, ok := part.(string); ok {
+						parts = append(parts, str)
+					}
+				}
+				text = strings.Join(parts, " ")
+			}
+			messages = append(messages, &TranslationMessage{
+				Type:    msg.MustString("", "type"),
+				Code:    msg.MustString("", "code"),
+				Message: text,
+			})
+		}
+		for _, child := range obj.MustSlice([]interface{}{}, "children") {
+			recurseThroughChildren(FromInterface(child))
+		}
+	}
+	recurseThroughChildren(json)
+	return messages
+}
+
+func toTranslationMessages(messagesJson string) []*TranslationMessage {
+	var messages []*TranslationMessage
+	if messagesJson != "" {
+		encoding.Unmarshal([]byte(messagesJson), &messages)
+	}
+	if len(messages) == 0 {
 		return nil
 	}
+	return messages
+}
+
+func toTranslationMessagesJson(messages []*TranslationMessage) string {
+	if len(messages) == 0 {
+		return "[]"
+	}
+	bytes, _ := encoding.Marshal(messages)
+	return string(bytes)
+}
+
+func truncateLastError(lastError string) string {
+	if len(lastError) > translationLastErrorMaxLen {
+		return lastError[:translationLastErrorMaxLen]
+	}
+	return lastError
 }
 
 func getObjectsWithProperties(json *Json, matcher map[string]string) []*Json {
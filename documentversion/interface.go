@@ -1,21 +1,44 @@
 package documentversion
 
 import (
+	"github.com/modelhub/core/blob"
 	"github.com/modelhub/core/sheet"
+	"github.com/modelhub/core/util"
 	"io"
 	"net/http"
 )
 
-type create func(forUser string, document string, documentVersionId string, uploadComment string, fileType string, fileExtension string, urn string, status string, thumbnailType string) (*DocumentVersion, error)
+type create func(forUser string, document string, documentVersionId string, uploadComment string, fileType string, fileExtension string, urn string, status string, thumbnailType string, contentHash string, mimeType string, imageInfo *util.ImageInfo) (*DocumentVersion, error)
 type get func(forUser string, ids []string) ([]*DocumentVersion, error)
 type getForDocument func(forUser string, document string, offset int, limit int, sortBy sortBy) ([]*DocumentVersion, int, error)
+type findByHash func(forUser string, project string, hash string) ([]*DocumentVersion, error)
+type promote func(forUser string, id string, newId string, uploadComment string) (*DocumentVersion, error)
+type retranslate func(forUser string, id string, status string, lastError string) error
+type deleteVersion func(forUser string, id string, force bool) error
+type getByUrn func(urn string) ([]*DocumentVersion, error)
 type bulkSetStatus func([]*DocumentVersion) error
 type bulkSaveSheets func([]*sheet.Sheet_) error
+type getPendingTranslations func(limit int) ([]*DocumentVersion, error)
 
 type DocumentVersionStore interface {
-	Create(forUser string, document string, uploadComment string, fileType string, fileName string, file io.ReadCloser, thumbnailType string, thumbnail io.ReadCloser) (*DocumentVersion, error)
+	Create(forUser string, document string, uploadComment string, fileType string, fileName string, file io.ReadCloser, thumbnailType string, thumbnail io.ReadCloser, onDuplicate duplicateOption) (*DocumentVersion, error)
 	Get(forUser string, ids []string) ([]*DocumentVersion, error)
 	GetForDocument(forUser string, document string, offset int, limit int, sortBy sortBy) ([]*DocumentVersion, int, error)
+	FindByHash(forUser string, project string, hash string) ([]*DocumentVersion, error)
 	GetSeedFile(forUser string, id string) (*http.Response, error)
 	GetThumbnail(forUser string, id string) (*http.Response, error)
+	DownloadSeedFile(forUser string, id string, byteRange *blob.ByteRange, ifNoneMatch string) (*blob.Download, error)
+	DownloadThumbnail(forUser string, id string, byteRange *blob.ByteRange, ifNoneMatch string) (*blob.Download, error)
+	Retranslate(forUser string, id string) error
+	Promote(forUser string, id string, uploadComment string) (*DocumentVersion, error)
+	Delete(forUser string, id string, force bool) error
+	HandleTranslationCallback(payload []byte, timestamp string, signature string) error
+}
+
+// TranslationMonitor polls vada in the background for documentVersions that
+// have not finished translating, so DocumentVersionStore reads never block on it.
+// Nothing polls until Start is called, which need only happen in one process.
+type TranslationMonitor interface {
+	Start()
+	Stop()
 }
@@ -0,0 +1,309 @@
+package documentversion
+
+import (
+	"errors"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/sheet"
+	"github.com/modelhub/core/util"
+	"github.com/modelhub/vada"
+	"github.com/robsix/golog"
+	"sort"
+	"time"
+)
+
+func NewMemDocumentVersionStore(db *util.MemDb, blobStore blob.BlobStore, vada vada.VadaClient, fileTypes util.FileTypeRegistry, ossBucketPrefix string, translationCallbackSecret string, log golog.Log) DocumentVersionStore {
+
+	toDocumentVersion := func(dv *util.MemDocumentVersion) *DocumentVersion {
+		return &DocumentVersion{
+			Id:                  dv.Id,
+			Document:            dv.Document,
+			Version:             dv.Version,
+			Project:             dv.Project,
+			Uploaded:            dv.Uploaded,
+			UploadComment:       dv.UploadComment,
+			UploadedBy:          dv.UploadedBy,
+			FileType:            dv.FileType,
+			FileExtension:       dv.FileExtension,
+			Urn:                 dv.Urn,
+			Status:              dv.Status,
+			ThumbnailType:       dv.ThumbnailType,
+			RetryCount:          dv.RetryCount,
+			LastError:           dv.LastError,
+			NextRetry:           dv.NextRetry,
+			Progress:            dv.Progress,
+			TranslationMessages: toTranslationMessages(dv.TranslationMessages),
+			ContentHash:         dv.ContentHash,
+			MimeType:            dv.MimeType,
+			ImageInfo:           dv.ImageInfo,
+			SheetCount:          db.DocumentVersionSheetCount(dv.Id),
+		}
+	}
+
+	create := func(forUser string, document string, documentVersion string, uploadComment, fileType string, fileExtension string, urn string, status string, thumbnailType string, contentHash string, mimeType string, imageInfo *util.ImageInfo) (*DocumentVersion, error) {
+		db.Lock()
+		defer db.Unlock()
+		if dv, err := db.CreateDocumentVersion(forUser, document, documentVersion, uploadComment, fileType, fileExtension, urn, status, thumbnailType, contentHash, mimeType, imageInfo); err != nil {
+			return nil, err
+		} else {
+			return toDocumentVersion(dv), nil
+		}
+	}
+
+	get := func(forUser string, ids []string) ([]*DocumentVersion, error) {
+		db.RLock()
+		defer db.RUnlock()
+		projectId := ""
+		dvs := make([]*DocumentVersion, 0, len(ids))
+		for _, id := range ids {
+			if dv, exists := db.DocumentVersions[id]; exists {
+				if projectId != "" && projectId != dv.Project {
+					return nil, errors.New("Unauthorized action: documentVersion get cross project")
+				}
+				projectId = dv.Project
+				dvs = append(dvs, toDocumentVersion(dv))
+			}
+		}
+		if _, err := db.Role(forUser, projectId); projectId == "" || err != nil {
+			return nil, errors.New("Unauthorized action: documentVersion get cross project")
+		}
+		return dvs, nil
+	}
+
+	getForDocument := func(forUser string, document string, offset int, limit int, sortBy sortBy) ([]*DocumentVersion, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		projectId := ""
+		if tn, exists := db.TreeNodes[document]; exists {
+			projectId = tn.Project
+		}
+		if _, err := db.Role(forUser, projectId); err != nil {
+			return nil, 0, errors.New("Unauthorized action: documentVersion get by document")
+		}
+		matches := make([]*util.MemDocumentVersion, 0, util.DefaultSqlOffsetQueryLimit)
+		for _, dv := range db.DocumentVersions {
+			if dv.Document == document {
+				matches = append(matches, dv)
+			}
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			if sortBy == VersionAsc {
+				return matches[i].Version < matches[j].Version
+			}
+			return matches[j].Version < matches[i].Version
+		})
+		start, end := util.MemOffsetLimit(len(matches), offset, limit)
+		dvs := make([]*DocumentVersion, 0, end-start)
+		for _, dv := range matches[start:end] {
+			dvs = append(dvs, toDocumentVersion(dv))
+		}
+		return dvs, len(matches), nil
+	}
+
+	findByHash := func(forUser string, project string, hash string) ([]*DocumentVersion, error) {
+		db.RLock()
+		defer db.RUnlock()
+		if _, err := db.Role(forUser, project); err != nil {
+			return nil, errors.New("Unauthorized action: documentVersion find by hash")
+		}
+		matches := make([]*util.MemDocumentVersion, 0, 1)
+		for _, dv := range db.DocumentVersions {
+			if dv.Project == project && dv.ContentHash == hash && !db.DocumentVersionTrashed(dv.Id) {
+				matches = append(matches, dv)
+			}
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			return matches[i].Uploaded.Before(matches[j].Uploaded)
+		})
+		dvs := make([]*DocumentVersion, 0, len(matches))
+		for _, dv := range matches {
+			dvs = append(dvs, toDocumentVersion(dv))
+		}
+		return dvs, nil
+	}
+
+	retranslate := func(forUser string, id string, status string, lastError string) error {
+		db.Lock()
+		defer db.Unlock()
+		dv, exists := db.DocumentVersions[id]
+		if !exists {
+			return errors.New("Unauthorized action: documentVersion retranslate")
+		}
+		if role, err := db.Role(forUser, dv.Project); err != nil || !util.MemRoleIn(role, "owner", "admin") {
+			return errors.New("Unauthorized action: documentVersion retranslate")
+		}
+		if !(dv.Status == "failed" || dv.Status == "failed_to_register" || dv.Status == "timeout") {
+			return errors.New("Invalid action: documentVersion retranslate")
+		}
+		dv.Status = status
+		dv.RetryCount = 0
+		dv.LastError = lastError
+		dv.NextRetry = nil
+		dv.Progress = ""
+		dv.TranslationMessages = "[]"
+		return nil
+	}
+
+	promote := func(forUser string, id string, newId string, uploadComment string) (*DocumentVersion, error) {
+		db.Lock()
+		defer db.Unlock()
+		from, exists := db.DocumentVersions[id]
+		if !exists {
+			return nil, errors.New("Unauthorized action: documentVersion promote")
+		}
+		latest := true
+		for _, dv := range db.DocumentVersions {
+			if dv.Document == from.Document && dv.Version > from.Version {
+				latest = false
+				break
+			}
+		}
+		if latest {
+			return nil, errors.New("Invalid action: documentVersion promote latest version")
+		}
+		dv, err := db.CreateDocumentVersion(forUser, from.Document, newId, uploadComment, from.FileType, from.FileExtension, from.Urn, from.Status, from.ThumbnailType, from.ContentHash, from.MimeType, from.ImageInfo)
+		if err != nil {
+			return nil, err
+		}
+		dv.RetryCount = from.RetryCount
+		dv.LastError = from.LastError
+		dv.NextRetry = from.NextRetry
+		dv.Progress = from.Progress
+		dv.TranslationMessages = from.TranslationMessages
+		for _, s := range db.Sheets {
+			if s.DocumentVersion == from.Id {
+				copied := *s
+				copied.Id = util.NewId()
+				copied.DocumentVersion = dv.Id
+				db.Sheets[copied.Id] = &copied
+			}
+		}
+		return toDocumentVersion(dv), nil
+	}
+
+	deleteVersion := func(forUser string, id string, force bool) error {
+		db.Lock()
+		defer db.Unlock()
+		dv, exists := db.DocumentVersions[id]
+		if !exists || db.DocumentVersionTrashed(id) {
+			return errors.New("Unauthorized action: documentVersion delete")
+		}
+		if role, err := db.Role(forUser, dv.Project); err != nil || !util.MemRoleIn(role, "owner", "admin") {
+			return errors.New("Unauthorized action: documentVersion delete")
+		}
+		versionCount := 0
+		for _, other := range db.DocumentVersions {
+			if other.Document == dv.Document {
+				versionCount++
+			}
+		}
+		if versionCount < 2 {
+			return errors.New("Invalid action: documentVersion delete only version")
+		}
+		if !force {
+			for _, sts := range db.ProjectSpaceVersionSheetTransforms {
+				for _, st := range sts {
+					if sheetTransform, exists := db.SheetTransforms[st]; exists {
+						if s, exists := db.Sheets[sheetTransform.Sheet]; exists && s.DocumentVersion == id {
+							return errors.New("Invalid action: documentVersion delete referenced by projectSpaceVersion")
+						}
+					}
+				}
+			}
+		}
+		if dv.Version > db.DeletedDocumentVersions[dv.Document] {
+			db.DeletedDocumentVersions[dv.Document] = dv.Version
+		}
+		db.DeleteDocumentVersion(id)
+		if tn, exists := db.TreeNodes[dv.Document]; exists {
+			tn.Modified = time.Now().UTC()
+			tn.ModifiedBy = forUser
+		}
+		return nil
+	}
+
+	getByUrn := func(urn string) ([]*DocumentVersion, error) {
+		db.RLock()
+		defer db.RUnlock()
+		dvs := make([]*DocumentVersion, 0, 1)
+		for _, dv := range db.DocumentVersions {
+			if dv.Urn == urn {
+				dvs = append(dvs, toDocumentVersion(dv))
+			}
+		}
+		return dvs, nil
+	}
+
+	return newDocumentVersionStore(create, get, getForDocument, findByHash, retranslate, promote, deleteVersion, getByUrn, util.GetMemRoleFunc(db), newMemBulkSetStatus(db), newMemBulkSaveSheets(db), sheet.NewMemGetPdfThumbnailSuffixesFunc(db), blobStore, vada, fileTypes, ossBucketPrefix, translationCallbackSecret, log)
+}
+
+func NewMemTranslationMonitor(db *util.MemDb, interval time.Duration, concurrency int, pollTimeout time.Duration, blobStore blob.BlobStore, vada vada.VadaClient, ossBucketPrefix string, log golog.Log) TranslationMonitor {
+
+	getPendingTranslations := func(limit int) ([]*DocumentVersion, error) {
+		db.RLock()
+		defer db.RUnlock()
+		now := time.Now().UTC()
+		matches := make([]*util.MemDocumentVersion, 0, util.DefaultSqlOffsetQueryLimit)
+		for _, dv := range db.DocumentVersions {
+			if (dv.Status == "registered" || dv.Status == "pending" || dv.Status == "inprogress" || dv.Status == "failed_to_register") && (dv.NextRetry == nil || !dv.NextRetry.After(now)) {
+				matches = append(matches, dv)
+			}
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			return matches[i].Uploaded.Before(matches[j].Uploaded)
+		})
+		if len(matches) > limit {
+			matches = matches[:limit]
+		}
+		dvs := make([]*DocumentVersion, 0, len(matches))
+		for _, dv := range matches {
+			dvs = append(dvs, &DocumentVersion{
+				Id:                  dv.Id,
+				Document:            dv.Document,
+				Version:             dv.Version,
+				Project:             dv.Project,
+				Uploaded:            dv.Uploaded,
+				UploadComment:       dv.UploadComment,
+				UploadedBy:          dv.UploadedBy,
+				FileType:            dv.FileType,
+				FileExtension:       dv.FileExtension,
+				Urn:                 dv.Urn,
+				Status:              dv.Status,
+				ThumbnailType:       dv.ThumbnailType,
+				RetryCount:          dv.RetryCount,
+				LastError:           dv.LastError,
+				NextRetry:           dv.NextRetry,
+				Progress:            dv.Progress,
+				TranslationMessages: toTranslationMessages(dv.TranslationMessages),
+				ContentHash:         dv.ContentHash,
+				MimeType:            dv.MimeType,
+				ImageInfo:           dv.ImageInfo,
+			})
+		}
+		return dvs, nil
+	}
+
+	return newTranslationMonitor(getPendingTranslations, newMemBulkSetStatus(db), newMemBulkSaveSheets(db), interval, concurrency, pollTimeout, blobStore, vada, ossBucketPrefix, log)
+}
+
+func newMemBulkSetStatus(db *util.MemDb) bulkSetStatus {
+	return func(docVers []*DocumentVersion) error {
+		db.Lock()
+		defer db.Unlock()
+		for _, docVer := range docVers {
+			if dv, exists := db.DocumentVersions[docVer.Id]; exists {
+				dv.Urn = docVer.Urn
+				dv.Status = docVer.Status
+				dv.RetryCount = docVer.RetryCount
+				dv.LastError = docVer.LastError
+				dv.NextRetry = docVer.NextRetry
+				dv.Progress = docVer.Progress
+				dv.TranslationMessages = toTranslationMessagesJson(docVer.TranslationMessages)
+			}
+		}
+		return nil
+	}
+}
+
+func newMemBulkSaveSheets(db *util.MemDb) bulkSaveSheets {
+	return bulkSaveSheets(sheet.NewMemSaveSheetsFunc(db))
+}
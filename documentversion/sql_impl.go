@@ -2,7 +2,8 @@ package documentversion
 
 import (
 	"database/sql"
-	"fmt"
+	"errors"
+	"github.com/modelhub/core/blob"
 	"github.com/modelhub/core/sheet"
 	"github.com/modelhub/core/util"
 	"github.com/modelhub/vada"
@@ -11,15 +12,19 @@ import (
 	"time"
 )
 
-func NewSqlDocumentVersionStore(db *sql.DB, statusCheckTimeout time.Duration, vada vada.VadaClient, ossBucketPrefix string, log golog.Log) DocumentVersionStore {
+func NewSqlDocumentVersionStore(db *sql.DB, blobStore blob.BlobStore, vada vada.VadaClient, fileTypes util.FileTypeRegistry, ossBucketPrefix string, translationCallbackSecret string, log golog.Log) DocumentVersionStore {
 
 	getter := func(query string, colLen int, args ...interface{}) ([]*DocumentVersion, error) {
 		dvs := make([]*DocumentVersion, 0, colLen)
 		rowsScan := func(rows *sql.Rows) error {
 			dv := DocumentVersion{}
-			if err := rows.Scan(&dv.Id, &dv.Document, &dv.Version, &dv.Project, &dv.Uploaded, &dv.UploadComment, &dv.UploadedBy, &dv.FileType, &dv.FileExtension, &dv.Urn, &dv.Status, &dv.ThumbnailType, &dv.SheetCount); err != nil {
+			translationMessages := ""
+			imageInfo := ""
+			if err := rows.Scan(&dv.Id, &dv.Document, &dv.Version, &dv.Project, &dv.Uploaded, &dv.UploadComment, &dv.UploadedBy, &dv.FileType, &dv.FileExtension, &dv.Urn, &dv.Status, &dv.ThumbnailType, &dv.RetryCount, &dv.LastError, &dv.NextRetry, &dv.Progress, &translationMessages, &dv.ContentHash, &dv.MimeType, &imageInfo, &dv.SheetCount); err != nil {
 				return err
 			}
+			dv.TranslationMessages = toTranslationMessages(translationMessages)
+			dv.ImageInfo = util.ToImageInfo(imageInfo)
 			dvs = append(dvs, &dv)
 			return nil
 		}
@@ -34,17 +39,21 @@ func NewSqlDocumentVersionStore(db *sql.DB, statusCheckTimeout time.Duration, va
 				return nil
 			}
 			dv := DocumentVersion{}
-			if err := rows.Scan(&totalResults, &dv.Id, &dv.Document, &dv.Version, &dv.Project, &dv.Uploaded, &dv.UploadComment, &dv.UploadedBy, &dv.FileType, &dv.FileExtension, &dv.Urn, &dv.Status, &dv.ThumbnailType, &dv.SheetCount); err != nil {
+			translationMessages := ""
+			imageInfo := ""
+			if err := rows.Scan(&totalResults, &dv.Id, &dv.Document, &dv.Version, &dv.Project, &dv.Uploaded, &dv.UploadComment, &dv.UploadedBy, &dv.FileType, &dv.FileExtension, &dv.Urn, &dv.Status, &dv.ThumbnailType, &dv.RetryCount, &dv.LastError, &dv.NextRetry, &dv.Progress, &translationMessages, &dv.ContentHash, &dv.MimeType, &imageInfo, &dv.SheetCount); err != nil {
 				return err
 			}
+			dv.TranslationMessages = toTranslationMessages(translationMessages)
+			dv.ImageInfo = util.ToImageInfo(imageInfo)
 			dvs = append(dvs, &dv)
 			return nil
 		}
 		return dvs, totalResults, util.SqlQuery(db, rowsScan, query, args...)
 	}
 
-	create := func(forUser string, document string, documentVersion string, uploadComment, fileType string, fileExtension string, urn string, status string, thumbnailType string) (*DocumentVersion, error) {
-		if dvs, err := getter("CALL documentVersionCreate(?, ?, ?, ?, ?, ?, ?, ?, ?)", 1, forUser, document, documentVersion, uploadComment, fileType, fileExtension, urn, status, thumbnailType); len(dvs) == 1 {
+	create := func(forUser string, document string, documentVersion string, uploadComment, fileType string, fileExtension string, urn string, status string, thumbnailType string, contentHash string, mimeType string, imageInfo *util.ImageInfo) (*DocumentVersion, error) {
+		if dvs, err := getter("CALL documentVersionCreate(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", 1, forUser, document, documentVersion, uploadComment, fileType, fileExtension, urn, status, thumbnailType, contentHash, mimeType, util.ToImageInfoJson(imageInfo)); len(dvs) == 1 {
 			return dvs[0], err
 		} else {
 			return nil, err
@@ -59,29 +68,82 @@ func NewSqlDocumentVersionStore(db *sql.DB, statusCheckTimeout time.Duration, va
 		return offsetGetter("CALL documentVersionGetForDocument(?, ?, ?, ?, ?)", forUser, document, offset, limit, string(sortBy))
 	}
 
-	bulkSetStatus := func(docVers []*DocumentVersion) error {
-		if len(docVers) > 0 {
-			query := strings.Repeat("CALL documentVersionSetStatus(%q, %q); ", len(docVers))
-			args := make([]interface{}, 0, len(docVers)*2)
-			for _, docVer := range docVers {
-				args = append(args, docVer.Id, docVer.Status)
+	findByHash := func(forUser string, project string, hash string) ([]*DocumentVersion, error) {
+		return getter("CALL documentVersionFindByHash(?, ?, ?)", 1, forUser, project, hash)
+	}
+
+	retranslate := func(forUser string, id string, status string, lastError string) error {
+		return util.SqlExec(db, "CALL documentVersionRetranslate(?, ?, ?, ?)", forUser, id, status, lastError)
+	}
+
+	promote := func(forUser string, id string, newId string, uploadComment string) (*DocumentVersion, error) {
+		if dvs, err := getter("CALL documentVersionPromote(?, ?, ?, ?)", 1, forUser, id, newId, uploadComment); err != nil {
+			return nil, err
+		} else if len(dvs) == 0 {
+			return nil, errors.New("documentVersion promote failed")
+		} else {
+			return dvs[0], nil
+		}
+	}
+
+	deleteVersion := func(forUser string, id string, force bool) error {
+		return util.SqlExec(db, "CALL documentVersionDelete(?, ?, ?)", forUser, id, force)
+	}
+
+	getByUrn := func(urn string) ([]*DocumentVersion, error) {
+		return getter("CALL documentVersionGetByUrn(?)", 1, urn)
+	}
+
+	return newDocumentVersionStore(create, get, getForDocument, findByHash, retranslate, promote, deleteVersion, getByUrn, util.GetRoleFunc(db), newSqlBulkSetStatus(db), newSqlBulkSaveSheets(db), sheet.NewSqlGetPdfThumbnailSuffixesFunc(db), blobStore, vada, fileTypes, ossBucketPrefix, translationCallbackSecret, log)
+}
+
+func NewSqlTranslationMonitor(db *sql.DB, interval time.Duration, concurrency int, pollTimeout time.Duration, blobStore blob.BlobStore, vada vada.VadaClient, ossBucketPrefix string, log golog.Log) TranslationMonitor {
+
+	getPendingTranslations := func(limit int) ([]*DocumentVersion, error) {
+		dvs := make([]*DocumentVersion, 0, limit)
+		rowsScan := func(rows *sql.Rows) error {
+			dv := DocumentVersion{}
+			translationMessages := ""
+			imageInfo := ""
+			if err := rows.Scan(&dv.Id, &dv.Document, &dv.Version, &dv.Project, &dv.Uploaded, &dv.UploadComment, &dv.UploadedBy, &dv.FileType, &dv.FileExtension, &dv.Urn, &dv.Status, &dv.ThumbnailType, &dv.RetryCount, &dv.LastError, &dv.NextRetry, &dv.Progress, &translationMessages, &dv.ContentHash, &dv.MimeType, &imageInfo, &dv.SheetCount); err != nil {
+				return err
 			}
-			return util.SqlExec(db, fmt.Sprintf(query, args...))
+			dv.TranslationMessages = toTranslationMessages(translationMessages)
+			dv.ImageInfo = util.ToImageInfo(imageInfo)
+			dvs = append(dvs, &dv)
+			return nil
 		}
-		return nil
+		return dvs, util.SqlQuery(db, rowsScan, "CALL documentVersionGetPendingTranslations(?)", limit)
 	}
 
-	bulkSaveSheets := func(sheets []*sheet.Sheet_) error {
-		if len(sheets) > 0 {
-			query := strings.Repeat("CALL sheetCreate(%q, %q, %q, %q, %q, %q, %q); ", len(sheets))
-			args := make([]interface{}, 0, len(sheets)*7)
-			for _, sheet := range sheets {
-				args = append(args, sheet.DocumentVersion, sheet.Project, sheet.Name, sheet.BaseUrn, sheet.Manifest, strings.Join(sheet.Thumbnails, ","), sheet.Role)
+	return newTranslationMonitor(getPendingTranslations, newSqlBulkSetStatus(db), newSqlBulkSaveSheets(db), interval, concurrency, pollTimeout, blobStore, vada, ossBucketPrefix, log)
+}
+
+// newSqlBulkSetStatus updates every documentVersion in one transaction, the
+// values carry vada and webhook text so they are only ever passed as parameters.
+func newSqlBulkSetStatus(db *sql.DB) bulkSetStatus {
+	return func(docVers []*DocumentVersion) error {
+		if len(docVers) == 0 {
+			return nil
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, docVer := range docVers {
+			nextRetry := ""
+			if docVer.NextRetry != nil {
+				nextRetry = docVer.NextRetry.UTC().Format("2006-01-02 15:04:05")
+			}
+			if _, err := tx.Exec("CALL documentVersionSetStatus(?, ?, ?, ?, ?, ?, ?, ?)", docVer.Id, docVer.Urn, docVer.Status, docVer.RetryCount, docVer.LastError, nextRetry, docVer.Progress, toTranslationMessagesJson(docVer.TranslationMessages)); err != nil {
+				tx.Rollback()
+				return err
 			}
-			return util.SqlExec(db, fmt.Sprintf(query, args...))
 		}
-		return nil
+		return tx.Commit()
 	}
+}
 
-	return newDocumentVersionStore(create, get, getForDocument, util.GetRoleFunc(db), bulkSetStatus, bulkSaveSheets, statusCheckTimeout, vada, ossBucketPrefix, log)
+func newSqlBulkSaveSheets(db *sql.DB) bulkSaveSheets {
+	return bulkSaveSheets(sheet.NewSqlSaveSheetsFunc(db))
 }
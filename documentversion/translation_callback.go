@@ -0,0 +1,36 @@
+package documentversion
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+var errInvalidCallbackSignature = errors.New("Unauthorized action: documentVersion translation callback invalid signature")
+
+// NewTranslationCallbackHandler exposes DocumentVersionStore.HandleTranslationCallback
+// over http, the manifest is the POST body and its timestamp and signature are
+// read from the TranslationCallbackTimestampHeader and
+// TranslationCallbackSignatureHeader headers.
+func NewTranslationCallbackHandler(dvs DocumentVersionStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+		payload, err := ioutil.ReadAll(io.LimitReader(r.Body, translationCallbackMaxBytes))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := dvs.HandleTranslationCallback(payload, r.Header.Get(TranslationCallbackTimestampHeader), r.Header.Get(TranslationCallbackSignatureHeader)); err == errInvalidCallbackSignature {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package documentversion
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/modelhub/core/util"
+	"github.com/robsix/golog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	testCallbackSecret = "callback secret"
+	testCallbackUrn    = "urn:adsk.objects:os.object:bucket/model.rvt"
+)
+
+func newTestCallbackServer(t *testing.T) (*httptest.Server, *util.MemDocumentVersion) {
+	db := util.NewMemDb()
+	dv := &util.MemDocumentVersion{
+		Id:                  util.NewId(),
+		Document:            util.NewId(),
+		Version:             1,
+		Project:             util.NewId(),
+		Uploaded:            time.Now().UTC(),
+		FileType:            "lmv",
+		FileExtension:       "rvt",
+		Urn:                 testCallbackUrn,
+		Status:              "registered",
+		TranslationMessages: "[]",
+	}
+	db.DocumentVersions[dv.Id] = dv
+	dvs := NewMemDocumentVersionStore(db, nil, nil, nil, "", testCallbackSecret, golog.NewConsoleLog(0))
+	srv := httptest.NewServer(NewTranslationCallbackHandler(dvs))
+	t.Cleanup(srv.Close)
+	return srv, dv
+}
+
+func signCallback(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postCallback(t *testing.T, url string, payload []byte, timestamp string, signature string) int {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(TranslationCallbackTimestampHeader, timestamp)
+	req.Header.Set(TranslationCallbackSignatureHeader, signature)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestTranslationCallbackHandlerAppliesSignedManifest(t *testing.T) {
+	srv, dv := newTestCallbackServer(t)
+	payload := []byte(`{"urn":"` + util.ToBase64(testCallbackUrn) + `","status":"inprogress","progress":"50% complete"}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	if code := postCallback(t, srv.URL, payload, timestamp, signCallback(testCallbackSecret, timestamp, payload)); code != http.StatusNoContent {
+		t.Fatalf("expected %d got %d", http.StatusNoContent, code)
+	}
+	if dv.Status != "inprogress" || dv.Progress != "50% complete" {
+		t.Fatalf("expected status inprogress at 50%% complete got %q at %q", dv.Status, dv.Progress)
+	}
+}
+
+func TestTranslationCallbackHandlerRejectsReplayedManifest(t *testing.T) {
+	srv, dv := newTestCallbackServer(t)
+	payload := []byte(`{"urn":"` + testCallbackUrn + `","status":"failed","progress":"complete"}`)
+	stale := strconv.FormatInt(time.Now().Add(-2*translationCallbackTolerance).Unix(), 10)
+
+	if code := postCallback(t, srv.URL, payload, stale, signCallback(testCallbackSecret, stale, payload)); code != http.StatusUnauthorized {
+		t.Fatalf("expected %d for a stale timestamp got %d", http.StatusUnauthorized, code)
+	}
+	//moving the timestamp on without re-signing must not work either
+	fresh := strconv.FormatInt(time.Now().Unix(), 10)
+	if code := postCallback(t, srv.URL, payload, fresh, signCallback(testCallbackSecret, stale, payload)); code != http.StatusUnauthorized {
+		t.Fatalf("expected %d for a re-stamped manifest got %d", http.StatusUnauthorized, code)
+	}
+	if dv.Status != "registered" || dv.RetryCount != 0 {
+		t.Fatalf("expected the documentVersion to be untouched got status %q retryCount %d", dv.Status, dv.RetryCount)
+	}
+
+	if code := postCallback(t, srv.URL, payload, fresh, signCallback(testCallbackSecret, fresh, payload)); code != http.StatusNoContent {
+		t.Fatalf("expected %d got %d", http.StatusNoContent, code)
+	}
+	if dv.Status != "failed_to_register" || dv.RetryCount != 1 {
+		t.Fatalf("expected status failed_to_register with retryCount 1 got %q with %d", dv.Status, dv.RetryCount)
+	}
+}
+
+func TestTranslationCallbackHandlerRejectsBadRequests(t *testing.T) {
+	srv, _ := newTestCallbackServer(t)
+	payload := []byte(`{"urn":"` + testCallbackUrn + `","status":"success"}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	if code := postCallback(t, srv.URL, payload, timestamp, signCallback("wrong secret", timestamp, payload)); code != http.StatusUnauthorized {
+		t.Fatalf("expected %d for a bad signature got %d", http.StatusUnauthorized, code)
+	}
+	if code := postCallback(t, srv.URL, payload, "", signCallback(testCallbackSecret, "", payload)); code != http.StatusUnauthorized {
+		t.Fatalf("expected %d for a missing timestamp got %d", http.StatusUnauthorized, code)
+	}
+	unknown := []byte(`{"urn":"urn:adsk.objects:os.object:bucket/unknown.rvt","status":"success"}`)
+	if code := postCallback(t, srv.URL, unknown, timestamp, signCallback(testCallbackSecret, timestamp, unknown)); code != http.StatusBadRequest {
+		t.Fatalf("expected %d for an unknown urn got %d", http.StatusBadRequest, code)
+	}
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected %d for a GET got %d", http.StatusMethodNotAllowed, res.StatusCode)
+	}
+}
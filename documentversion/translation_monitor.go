@@ -0,0 +1,225 @@
+package documentversion
+
+import (
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/util"
+	"github.com/modelhub/vada"
+	"github.com/robsix/golog"
+	. "github.com/robsix/json"
+	"sync"
+	"time"
+)
+
+func newTranslationMonitor(getPendingTranslations getPendingTranslations, bulkSetStatus bulkSetStatus, bulkSaveSheets bulkSaveSheets, interval time.Duration, concurrency int, pollTimeout time.Duration, blobStore blob.BlobStore, vada vada.VadaClient, ossBucketPrefix string, log golog.Log) TranslationMonitor {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &translationMonitor{
+		getPendingTranslations: getPendingTranslations,
+		bulkSetStatus:          bulkSetStatus,
+		bulkSaveSheets:         bulkSaveSheets,
+		interval:               interval,
+		concurrency:            concurrency,
+		pollTimeout:            pollTimeout,
+		blobStore:              blobStore,
+		vada:                   vada,
+		ossBucketPrefix:        ossBucketPrefix,
+		log:                    log,
+		retryDelay:             translationRetryDelay(interval),
+		backoffs:               map[string]*translationBackoff{},
+	}
+}
+
+type translationMonitor struct {
+	getPendingTranslations getPendingTranslations
+	bulkSetStatus          bulkSetStatus
+	bulkSaveSheets         bulkSaveSheets
+	interval               time.Duration
+	concurrency            int
+	pollTimeout            time.Duration
+	blobStore              blob.BlobStore
+	vada                   vada.VadaClient
+	ossBucketPrefix        string
+	log                    golog.Log
+	retryDelay             func(attempt int) time.Duration
+	mtx                    sync.Mutex
+	stop                   chan struct{}
+	stopped                chan struct{}
+	backoffs               map[string]*translationBackoff //only touched by the scan loop
+}
+
+type translationBackoff struct {
+	attempts int
+	nextPoll time.Time
+}
+
+type translationPollResult struct {
+	docVer     *DocumentVersion
+	changed    bool
+	statusJson *Json
+	err        error
+}
+
+func (tm *translationMonitor) Start() {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	if tm.stop != nil {
+		return
+	}
+	if tm.interval <= 0 {
+		tm.log.Warning("TranslationMonitor.Start not started: interval: %v", tm.interval)
+		return
+	}
+	tm.stop = make(chan struct{})
+	tm.stopped = make(chan struct{})
+	go tm.run(tm.stop, tm.stopped)
+	tm.log.Info("TranslationMonitor.Start success: interval: %v concurrency: %d", tm.interval, tm.concurrency)
+}
+
+func (tm *translationMonitor) Stop() {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	if tm.stop == nil {
+		return
+	}
+	close(tm.stop)
+	<-tm.stopped
+	tm.stop = nil
+	tm.stopped = nil
+	tm.log.Info("TranslationMonitor.Stop success")
+}
+
+func (tm *translationMonitor) run(stop chan struct{}, stopped chan struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(tm.interval)
+	defer ticker.Stop()
+	tm.scan(stop)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			tm.scan(stop)
+		}
+	}
+}
+
+// scan polls every pending documentVersion whose backoff has elapsed, at most
+// concurrency at a time, then persists status changes and any newly translated sheets.
+func (tm *translationMonitor) scan(stop chan struct{}) {
+	docVers, err := tm.getPendingTranslations(translationMonitorBatchSize)
+	if err != nil {
+		tm.log.Error("TranslationMonitor scan error: %v", err)
+		return
+	}
+	now := time.Now().UTC()
+	pending := make(map[string]bool, len(docVers))
+	due := make([]*DocumentVersion, 0, len(docVers))
+	for _, dv := range docVers {
+		pending[dv.Id] = true
+		if b, exists := tm.backoffs[dv.Id]; !exists || !now.Before(b.nextPoll) {
+			due = append(due, dv)
+		}
+	}
+	for id := range tm.backoffs {
+		if !pending[id] {
+			delete(tm.backoffs, id)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	jobs := make(chan *DocumentVersion, len(due))
+	for _, dv := range due {
+		jobs <- dv
+	}
+	close(jobs)
+	abandon := make(chan struct{})
+	results := make(chan *translationPollResult, len(due))
+	workers := tm.concurrency
+	if workers > len(due) {
+		workers = len(due)
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for dv := range jobs {
+				select {
+				case <-abandon:
+					return
+				default:
+				}
+				changed, statusJson, err := pollTranslation(dv, now, tm.retryDelay, tm.upload, tm.vada, tm.log)
+				results <- &translationPollResult{docVer: dv, changed: changed, statusJson: statusJson, err: err}
+			}
+		}()
+	}
+
+	var timeOutChan <-chan time.Time
+	if tm.pollTimeout > 0 {
+		timeOutChan = time.After(tm.pollTimeout)
+	}
+	errs := make([]error, 0, len(due))
+	changes := make([]*DocumentVersion, 0, len(due))
+	successes := make([]*Json, 0, len(due))
+	for remaining := len(due); remaining > 0; remaining-- {
+		var res *translationPollResult
+		select {
+		case res = <-results:
+		case <-timeOutChan:
+			tm.log.Warning("TranslationMonitor scan timed out after %v with %d open polls awaiting response", tm.pollTimeout, remaining)
+		case <-stop:
+		}
+		if res == nil {
+			close(abandon)
+			break
+		}
+		if res.err != nil {
+			errs = append(errs, res.err)
+			tm.backOff(res.docVer.Id, now)
+			continue
+		}
+		if res.changed {
+			delete(tm.backoffs, res.docVer.Id)
+			changes = append(changes, res.docVer)
+			if res.statusJson != nil {
+				successes = append(successes, res.statusJson)
+			}
+		} else {
+			tm.backOff(res.docVer.Id, now)
+		}
+	}
+
+	if len(changes) > 0 {
+		if err := tm.bulkSetStatus(changes); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(successes) > 0 {
+		if err := extractAndSaveSheets(successes, tm.bulkSaveSheets); err != nil {
+			errs = append(errs, err...)
+		}
+	}
+	if len(errs) > 0 {
+		tm.log.Error("TranslationMonitor scan error: %v", errs)
+	} else {
+		tm.log.Info("TranslationMonitor scan success: polled: %d changed: %d translated: %d", len(due), len(changes), len(successes))
+	}
+}
+
+// upload copies the seed file of a documentVersion whose first upload to vada failed.
+func (tm *translationMonitor) upload(dv *DocumentVersion) (string, error) {
+	return util.TranslationUploadHelper(dv.Id+"."+dv.FileExtension, "", tm.ossBucketPrefix+dv.Project, tm.blobStore, tm.vada)
+}
+
+// backOff doubles the wait before a documentVersion is polled again, from one
+// interval up to translationMonitorMaxBackoff, resetting once its status moves.
+func (tm *translationMonitor) backOff(id string, now time.Time) {
+	b, exists := tm.backoffs[id]
+	if !exists {
+		b = &translationBackoff{}
+		tm.backoffs[id] = b
+	}
+	b.nextPoll = now.Add(tm.retryDelay(b.attempts))
+	b.attempts++
+}
@@ -30,7 +30,7 @@ type helper struct {
 }
 
 func (h *helper) GetChildrenDocumentsWithLatestVersionAndFirstSheetInfo(forUser string, folder string, offset int, limit int, sortBy sortBy) ([]*DocumentNode, int, error) {
-	if docs, totalResults, err := h.tns.GetChildren(forUser, folder, "document", offset, limit, treenode.SortBy(string(sortBy))); err != nil {
+	if docs, totalResults, err := h.tns.GetChildren(forUser, folder, "document", nil, offset, limit, treenode.SortBy(string(sortBy))); err != nil {
 		return nil, totalResults, err
 	} else {
 		countDown := len(docs)
@@ -59,14 +59,17 @@ func (h *helper) GetChildrenDocumentsWithLatestVersionAndFirstSheetInfo(forUser
 				if vers != nil && len(vers) > 0 {
 					ver := vers[0]
 					resVer.latestVersion = &latestVersion{
-						Id:            ver.Id,
-						FileType:      ver.FileType,
-						FileExtension: ver.FileExtension,
-						Status:        ver.Status,
-						ThumbnailType: ver.ThumbnailType,
-						SheetCount:    ver.SheetCount,
+						Id:                  ver.Id,
+						FileType:            ver.FileType,
+						FileExtension:       ver.FileExtension,
+						Status:              ver.Status,
+						Progress:            ver.Progress,
+						TranslationMessages: ver.TranslationMessages,
+						ThumbnailType:       ver.ThumbnailType,
+						SheetCount:          ver.SheetCount,
+						ImageInfo:           ver.ImageInfo,
 					}
-					if ver.FileType == "lmv" && ver.Status == "success" {
+					if ver.FileType == "lmv" && ver.Status == "success" || ver.FileType == "pdf" && ver.SheetCount > 0 {
 						sheets, _, _ := h.ss.GetForDocumentVersion(forUser, ver.Id, 0, 1, sheet.NameAsc)
 						if sheets != nil && len(sheets) > 0 {
 							sheet := sheets[0]
@@ -118,7 +121,7 @@ func (h *helper) GetDocumentVersionsWithFirstSheetInfo(forUser string, document
 			res = append(res, &DocumentVersion{
 				DocumentVersion: docVer,
 			})
-			if docVer.FileType == "lmv" && docVer.Status == "success" {
+			if docVer.FileType == "lmv" && docVer.Status == "success" || docVer.FileType == "pdf" && docVer.SheetCount > 0 {
 				go func(idx int, docVer *documentversion.DocumentVersion) {
 					sheets, _, er := h.ss.GetForDocumentVersion(forUser, docVer.Id, 0, 1, sheet.NameAsc)
 					resSheet := &struct {
@@ -166,7 +169,7 @@ func (h *helper) GetDocumentVersionsWithFirstSheetInfo(forUser string, document
 }
 
 func (h *helper) GetChildrenProjectSpacesWithLatestVersion(forUser string, folder string, offset int, limit int, sortBy sortBy) ([]*ProjectSpaceNode, int, error) {
-	if projSpaces, totalResults, err := h.tns.GetChildren(forUser, folder, "projectSpace", offset, limit, treenode.SortBy(string(sortBy))); err != nil {
+	if projSpaces, totalResults, err := h.tns.GetChildren(forUser, folder, "projectSpace", nil, offset, limit, treenode.SortBy(string(sortBy))); err != nil {
 		return nil, totalResults, err
 	} else {
 		countDown := len(projSpaces)
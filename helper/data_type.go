@@ -4,6 +4,7 @@ import (
 	"github.com/modelhub/core/documentversion"
 	"github.com/modelhub/core/projectspaceversion"
 	"github.com/modelhub/core/treenode"
+	"github.com/modelhub/core/util"
 )
 
 type DocumentNode struct {
@@ -12,13 +13,16 @@ type DocumentNode struct {
 }
 
 type latestVersion struct {
-	Id            string      `json:"id"`
-	FileType      string      `json:"fileType"`
-	FileExtension string      `json:"fileExtension"`
-	Status        string      `json:"status"`
-	ThumbnailType string      `json:"thumbnailType"`
-	SheetCount    int         `json:"sheetCount"`
-	FirstSheet    *firstSheet `json:"firstSheet,omitempty"`
+	Id                  string                                `json:"id"`
+	FileType            string                                `json:"fileType"`
+	FileExtension       string                                `json:"fileExtension"`
+	Status              string                                `json:"status"`
+	Progress            string                                `json:"progress"`
+	TranslationMessages []*documentversion.TranslationMessage `json:"translationMessages,omitempty"`
+	ThumbnailType       string                                `json:"thumbnailType"`
+	SheetCount          int                                   `json:"sheetCount"`
+	ImageInfo           *util.ImageInfo                       `json:"imageInfo,omitempty"`
+	FirstSheet          *firstSheet                           `json:"firstSheet,omitempty"`
 }
 
 type firstSheet struct {
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"github.com/modelhub/core/clashtest"
 	"github.com/modelhub/core/documentversion"
 	"github.com/modelhub/core/helper"
 	"github.com/modelhub/core/project"
@@ -8,18 +9,22 @@ import (
 	"github.com/modelhub/core/sheet"
 	"github.com/modelhub/core/sheettransform"
 	"github.com/modelhub/core/treenode"
+	"github.com/modelhub/core/upload"
 	"github.com/modelhub/core/user"
-	"github.com/modelhub/core/clashtest"
 )
 
 type CoreApi interface {
 	User() user.UserStore
 	Project() project.ProjectStore
 	TreeNode() treenode.TreeNodeStore
+	TrashPurger() treenode.TrashPurger
 	DocumentVersion() documentversion.DocumentVersionStore
+	TranslationMonitor() documentversion.TranslationMonitor
 	ProjectSpaceVersion() projectspaceversion.ProjectSpaceVersionStore
 	Sheet() sheet.SheetStore
 	SheetTransform() sheettransform.SheetTransformStore
 	ClashTest() clashtest.ClashTestStore
+	Upload() upload.UploadStore
+	UploadPurger() upload.UploadPurger
 	Helper() helper.Helper
 }
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"github.com/modelhub/caca"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/clashtest"
+	"github.com/modelhub/core/documentversion"
+	"github.com/modelhub/core/helper"
+	"github.com/modelhub/core/project"
+	"github.com/modelhub/core/projectspaceversion"
+	"github.com/modelhub/core/sheet"
+	"github.com/modelhub/core/sheettransform"
+	"github.com/modelhub/core/treenode"
+	"github.com/modelhub/core/upload"
+	"github.com/modelhub/core/user"
+	"github.com/modelhub/core/util"
+	"github.com/modelhub/vada"
+	"github.com/robsix/golog"
+)
+
+func NewMemCoreApi(blobStore blob.BlobStore, vada vada.VadaClient, caca caca.CacaClient, fileTypes util.FileTypeRegistry, settings Settings, translationCallbackSecret string, ossBucketPrefix string, log golog.Log) (CoreApi, error) {
+	settings = settings.withDefaults()
+	if fileTypes == nil {
+		fileTypes = util.NewFileTypeRegistry()
+	}
+	db := util.NewMemDb()
+	us := user.NewMemUserStore(db, log)
+	ps := project.NewMemProjectStore(db, blobStore, ossBucketPrefix, log)
+	tns := treenode.NewMemTreeNodeStore(db, settings.SubTaskTimeout, blobStore, vada, fileTypes, caca, settings.TrashRetention, ossBucketPrefix, log)
+	tp := treenode.NewMemTrashPurger(db, blobStore, settings.TrashRetention, settings.TrashPurgeInterval, ossBucketPrefix, log)
+	dvs := documentversion.NewMemDocumentVersionStore(db, blobStore, vada, fileTypes, ossBucketPrefix, translationCallbackSecret, log)
+	psvs := projectspaceversion.NewMemProjectSpaceVersionStore(db, settings.SubTaskTimeout, blobStore, caca, ossBucketPrefix, log)
+	ss := sheet.NewMemSheetStore(db, blobStore, vada, ossBucketPrefix, log)
+	sts := sheettransform.NewMemSheetTransformStore(db, log)
+	cts := clashtest.NewMemClashTestStore(db, caca, log)
+	tm := documentversion.NewMemTranslationMonitor(db, settings.TranslationPollInterval, settings.TranslationPollConcurrency, settings.SubTaskTimeout, blobStore, vada, ossBucketPrefix, log)
+	ups := upload.NewMemUploadStore(db, tns, dvs, blobStore, ossBucketPrefix, log)
+	up := upload.NewMemUploadPurger(db, blobStore, settings.UploadExpiry, settings.UploadPurgeInterval, ossBucketPrefix, log)
+	h := helper.NewHelper(tns, dvs, psvs, ss, settings.BatchGetTimeout, log)
+	return newCoreApi(us, ps, tns, tp, dvs, tm, psvs, ss, sts, cts, ups, up, h)
+}
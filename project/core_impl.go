@@ -2,15 +2,15 @@ package project
 
 import (
 	"errors"
+	"github.com/modelhub/core/blob"
 	"github.com/modelhub/core/util"
-	"github.com/modelhub/vada"
 	"github.com/robsix/golog"
 	"io"
 	"net/http"
 	"strings"
 )
 
-func newProjectStore(create create, delete delete, setName setName, setDescription setDescription, setThumbnailType setThumbnailType, addUsers addUsers, removeUsers removeUsers, acceptInvite processInvite, declineInvite processInvite, getRole util.GetRole, getMemberships getMemberships, getMembershipInvites getMemberships, get get, getInUserContext getInUserContext, getInUserInviteContext getInUserContext, search search, vada vada.VadaClient, ossBucketPrefix string, ossBucketPolicy vada.BucketPolicy, log golog.Log) ProjectStore {
+func newProjectStore(create create, delete delete, setName setName, setDescription setDescription, setThumbnailType setThumbnailType, addUsers addUsers, removeUsers removeUsers, acceptInvite processInvite, declineInvite processInvite, getRole util.GetRole, getMemberships getMemberships, getMembershipInvites getMemberships, get get, getInUserContext getInUserContext, getInUserInviteContext getInUserContext, search search, blobStore blob.BlobStore, ossBucketPrefix string, log golog.Log) ProjectStore {
 	return &projectStore{
 		create:                 create,
 		delete:                 delete,
@@ -28,9 +28,8 @@ func newProjectStore(create create, delete delete, setName setName, setDescripti
 		getInUserContext:       getInUserContext,
 		getInUserInviteContext: getInUserInviteContext,
 		search:                 search,
-		vada:                   vada,
+		blobStore:              blobStore,
 		ossBucketPrefix:        ossBucketPrefix,
-		ossBucketPolicy:        ossBucketPolicy,
 		log:                    log,
 	}
 }
@@ -52,24 +51,22 @@ type projectStore struct {
 	getInUserContext       getInUserContext
 	getInUserInviteContext getInUserContext
 	search                 search
-	vada                   vada.VadaClient
+	blobStore              blob.BlobStore
 	ossBucketPrefix        string
-	ossBucketPolicy        vada.BucketPolicy
 	log                    golog.Log
 }
 
 func (ps *projectStore) Create(forUser string, name string, thumbnailType string, thumbnail io.ReadCloser) (*Project, error) {
 	newProjectId := util.NewId()
 
-	json, err := ps.vada.CreateBucket(ps.ossBucketPrefix+newProjectId, ps.ossBucketPolicy)
-	if err != nil {
-		ps.log.Error("ProjectStore.Create error: forUser: %q name: %q thumbnailType: %q createBucketJson: %v error: %v", forUser, name, thumbnailType, json, err)
+	if err := ps.blobStore.CreateBucket(ps.ossBucketPrefix + newProjectId); err != nil {
+		ps.log.Error("ProjectStore.Create error: forUser: %q name: %q thumbnailType: %q error: %v", forUser, name, thumbnailType, err)
 		return nil, err
 	}
 
 	if thumbnail != nil && strings.HasPrefix(thumbnailType, "image/") {
-		if json, err := ps.vada.UploadFile(newProjectId, ps.ossBucketPrefix+newProjectId, thumbnail); err != nil {
-			ps.log.Error("ProjectStore.Create error: forUser: %q name: %q thumbnailType: %q imageUploadJson: %v error: %v", forUser, name, thumbnailType, json, err)
+		if _, err := ps.blobStore.Put(ps.ossBucketPrefix+newProjectId, newProjectId, thumbnail); err != nil {
+			ps.log.Error("ProjectStore.Create error: forUser: %q name: %q thumbnailType: %q error: %v", forUser, name, thumbnailType, err)
 			thumbnailType = ""
 		}
 	} else {
@@ -91,7 +88,7 @@ func (ps *projectStore) Delete(forUser string, id string) error {
 		return err
 	}
 
-	if err := ps.vada.DeleteBucket(ps.ossBucketPrefix + id); err != nil {
+	if err := ps.blobStore.DeleteBucket(ps.ossBucketPrefix + id); err != nil {
 		ps.log.Error("ProjectStore.Delete error: forUser: %q id: %q error: %v", forUser, id, err)
 	}
 
@@ -138,15 +135,15 @@ func (ps *projectStore) SetThumbnail(forUser string, id string, thumbnailType st
 		ps.log.Error("ProjectStore.SetThumbnail error: forUser: %q id: %q thumbnailType: %q thumbnail: %v error: %v", forUser, id, thumbnailType, thumbnail, err)
 		return err
 	} else if projects[0].ThumbnailType != "" {
-		if err := ps.vada.DeleteFile(id, ps.ossBucketPrefix+id); err != nil {
+		if err := ps.blobStore.Delete(ps.ossBucketPrefix+id, id); err != nil {
 			ps.log.Error("ProjectStore.SetThumbnail error: forUser: %q id: %q thumbnailType: %q thumbnail: %v error: %v", forUser, id, thumbnailType, thumbnail, err)
 			return err
 		}
 	}
 
 	if thumbnail != nil && strings.HasPrefix(thumbnailType, "image/") {
-		if json, err := ps.vada.UploadFile(id, ps.ossBucketPrefix+id, thumbnail); err != nil {
-			ps.log.Error("ProjectStore.SetThumbnail error: forUser: %q id: %q thumbnailType: %q thumbnail: %v imageUploadJson: %v error: %v", forUser, id, thumbnailType, thumbnail, json, err)
+		if _, err := ps.blobStore.Put(ps.ossBucketPrefix+id, id, thumbnail); err != nil {
+			ps.log.Error("ProjectStore.SetThumbnail error: forUser: %q id: %q thumbnailType: %q thumbnail: %v error: %v", forUser, id, thumbnailType, thumbnail, err)
 			return err
 		} else {
 			newThumbnailType = thumbnailType
@@ -233,7 +230,7 @@ func (ps *projectStore) GetThumbnail(forUser string, id string) (*http.Response,
 		ps.log.Error("ProjectStore.GetThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
 		return nil, err
 	} else {
-		if res, err := ps.vada.GetFile(id, ps.ossBucketPrefix+id); err != nil {
+		if res, err := ps.blobStore.Get(ps.ossBucketPrefix+id, id); err != nil {
 			ps.log.Error("ProjectStore.GetThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
 			return res, err
 		} else {
@@ -243,6 +240,27 @@ func (ps *projectStore) GetThumbnail(forUser string, id string) (*http.Response,
 	}
 }
 
+func (ps *projectStore) DownloadThumbnail(forUser string, id string, byteRange *blob.ByteRange, ifNoneMatch string) (*blob.Download, error) {
+	if projects, err := ps.get(forUser, []string{id}); err != nil || len(projects) == 0 {
+		if err == nil {
+			err = errors.New("Project not found")
+		}
+		ps.log.Error("ProjectStore.DownloadThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
+		return nil, err
+	} else {
+		if dl, err := ps.blobStore.Download(ps.ossBucketPrefix+id, id, byteRange, ifNoneMatch); err != nil {
+			ps.log.Error("ProjectStore.DownloadThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
+			return nil, err
+		} else {
+			if projects[0].ThumbnailType != "" {
+				dl.ContentType = projects[0].ThumbnailType
+			}
+			ps.log.Info("ProjectStore.DownloadThumbnail success: forUser: %q id: %q notModified: %t", forUser, id, dl.NotModified)
+			return dl, nil
+		}
+	}
+}
+
 func (ps *projectStore) Get(forUser string, ids []string) ([]*Project, error) {
 	if projects, err := ps.get(forUser, ids); err != nil {
 		ps.log.Error("ProjectStore.Get error: forUser: %q ids: %v error: %v", forUser, ids, err)
@@ -1,6 +1,7 @@
 package project
 
 import (
+	"github.com/modelhub/core/blob"
 	"io"
 	"net/http"
 )
@@ -35,6 +36,7 @@ type ProjectStore interface {
 	GetMembershipInvites(forUser string, id string, role role, offset int, limit int, sortBy sortBy) ([]*Membership, int, error)
 	//gets
 	GetThumbnail(forUser string, id string) (*http.Response, error)
+	DownloadThumbnail(forUser string, id string, byteRange *blob.ByteRange, ifNoneMatch string) (*blob.Download, error)
 	Get(forUser string, ids []string) ([]*Project, error)
 	GetInUserContext(forUser string, user string, role role, offset int, limit int, sortBy sortBy) ([]*ProjectInUserContext, int, error)
 	GetInUserInviteContext(forUser string, user string, role role, offset int, limit int, sortBy sortBy) ([]*ProjectInUserContext, int, error)
@@ -0,0 +1,323 @@
+package project
+
+import (
+	"errors"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/util"
+	"github.com/robsix/golog"
+	"sort"
+	"time"
+)
+
+func NewMemProjectStore(db *util.MemDb, blobStore blob.BlobStore, ossBucketPrefix string, log golog.Log) ProjectStore {
+
+	toProject := func(p *util.MemProject) *Project {
+		return &Project{
+			Id:            p.Id,
+			Name:          p.Name,
+			Created:       p.Created,
+			ThumbnailType: p.ThumbnailType,
+		}
+	}
+
+	offsetProjects := func(ps []*ProjectInUserContext, offset int, limit int, sortBy sortBy) ([]*ProjectInUserContext, int) {
+		sort.Slice(ps, func(i, j int) bool {
+			switch sortBy {
+			case RoleDesc:
+				return ps[j].Role < ps[i].Role
+			case RoleAsc:
+				return ps[i].Role < ps[j].Role
+			case CreatedDesc:
+				return ps[j].Created.Before(ps[i].Created)
+			case CreatedAsc:
+				return ps[i].Created.Before(ps[j].Created)
+			case NameDesc:
+				return util.MemLessFold(ps[j].Name, ps[i].Name)
+			default:
+				return util.MemLessFold(ps[i].Name, ps[j].Name)
+			}
+		})
+		start, end := util.MemOffsetLimit(len(ps), offset, limit)
+		return ps[start:end], len(ps)
+	}
+
+	offsetMemberships := func(members map[string]string, filterRole role, offset int, limit int, sortBy sortBy) ([]*Membership, int) {
+		ms := make([]*util.MemUser, 0, len(members))
+		for user, r := range members {
+			if u, exists := db.Users[user]; exists && (filterRole == "" || filterRole == Any || string(filterRole) == r) {
+				ms = append(ms, u)
+			}
+		}
+		sort.Slice(ms, func(i, j int) bool {
+			switch sortBy {
+			case RoleDesc:
+				if members[ms[i].Id] != members[ms[j].Id] {
+					return members[ms[j].Id] < members[ms[i].Id]
+				}
+				return util.MemLessFold(ms[i].FullName, ms[j].FullName)
+			case RoleAsc:
+				if members[ms[i].Id] != members[ms[j].Id] {
+					return members[ms[i].Id] < members[ms[j].Id]
+				}
+				return util.MemLessFold(ms[i].FullName, ms[j].FullName)
+			case FullNameDesc:
+				return util.MemLessFold(ms[j].FullName, ms[i].FullName)
+			default:
+				return util.MemLessFold(ms[i].FullName, ms[j].FullName)
+			}
+		})
+		start, end := util.MemOffsetLimit(len(ms), offset, limit)
+		res := make([]*Membership, 0, end-start)
+		for _, u := range ms[start:end] {
+			res = append(res, &Membership{
+				User: u.Id,
+				Role: members[u.Id],
+			})
+		}
+		return res, len(ms)
+	}
+
+	ownerOnly := func(forUser string, id string, action string) (*util.MemProject, error) {
+		if role, err := db.Role(forUser, id); err != nil {
+			return nil, err
+		} else if role != string(Owner) {
+			return nil, errors.New("Unauthorized action: " + action)
+		}
+		return db.Projects[id], nil
+	}
+
+	setPermissions := func(forUser string, id string, users []string, addRole string) error {
+		if addRole != "" && !util.MemRoleIn(addRole, string(Owner), string(Admin), string(Organiser), string(Contributor), string(Observer)) {
+			return errors.New("Invalid action: set permissions with unknown role")
+		}
+		forUserRole := db.Permissions[id][forUser]
+		if !util.MemRoleIn(forUserRole, string(Owner), string(Admin)) || (forUserRole == string(Admin) && util.MemRoleIn(addRole, string(Owner), string(Admin))) {
+			return errors.New("Unauthorized action: set permissions")
+		}
+		for _, user := range users {
+			currentUserRole, isMember := db.Permissions[id][user]
+			if !isMember {
+				if addRole == "" {
+					db.DeleteInvitation(id, user)
+				} else {
+					if db.Invitations[id] == nil {
+						db.Invitations[id] = map[string]string{}
+					}
+					db.Invitations[id][user] = addRole
+				}
+				continue
+			}
+			ownerCount := 0
+			for _, r := range db.Permissions[id] {
+				if r == string(Owner) {
+					ownerCount++
+				}
+			}
+			if (forUserRole == string(Admin) && util.MemRoleIn(currentUserRole, string(Owner), string(Admin))) || (currentUserRole == string(Owner) && addRole == "" && ownerCount <= 1) {
+				return errors.New("Unauthorized action: set permissions")
+			}
+			if addRole == "" {
+				db.DeletePermission(id, user)
+			} else {
+				db.Permissions[id][user] = addRole
+			}
+		}
+		return nil
+	}
+
+	create := func(forUser string, id string, name string, thumbnailType string) (*Project, error) {
+		db.Lock()
+		defer db.Unlock()
+		p := &util.MemProject{
+			Id:            id,
+			Name:          name,
+			Created:       time.Now().UTC(),
+			ThumbnailType: thumbnailType,
+		}
+		db.Projects[id] = p
+		db.TreeNodes[id] = &util.MemTreeNode{
+			Id:         id,
+			Parent:     util.EmptyUuid,
+			Project:    id,
+			Name:       "root",
+			NodeType:   "folder",
+			Created:    p.Created,
+			CreatedBy:  forUser,
+			Modified:   p.Created,
+			ModifiedBy: forUser,
+		}
+		db.Permissions[id] = map[string]string{forUser: string(Owner)}
+		return toProject(p), nil
+	}
+
+	delete := func(forUser string, id string) error {
+		db.Lock()
+		defer db.Unlock()
+		if _, err := ownerOnly(forUser, id, "project delete"); err != nil {
+			return err
+		}
+		db.DeleteProject(id)
+		return nil
+	}
+
+	setName := func(forUser string, id string, newName string) error {
+		db.Lock()
+		defer db.Unlock()
+		if p, err := ownerOnly(forUser, id, "project set name"); err != nil {
+			return err
+		} else {
+			p.Name = newName
+			return nil
+		}
+	}
+
+	setDescription := func(forUser string, id string, newDescription string) error {
+		db.Lock()
+		defer db.Unlock()
+		if p, err := ownerOnly(forUser, id, "project set description"); err != nil {
+			return err
+		} else {
+			p.Description = newDescription
+			return nil
+		}
+	}
+
+	setThumbnailType := func(forUser string, id string, newThumbnailType string) error {
+		db.Lock()
+		defer db.Unlock()
+		if p, err := ownerOnly(forUser, id, "project set thumbnail type"); err != nil {
+			return err
+		} else {
+			p.ThumbnailType = newThumbnailType
+			return nil
+		}
+	}
+
+	addUsers := func(forUser string, id string, role role, users []string) error {
+		db.Lock()
+		defer db.Unlock()
+		if role == "" {
+			return errors.New("Invalid action: set permissions with unknown role")
+		}
+		return setPermissions(forUser, id, users, string(role))
+	}
+
+	removeUsers := func(forUser string, id string, users []string) error {
+		db.Lock()
+		defer db.Unlock()
+		return setPermissions(forUser, id, users, "")
+	}
+
+	acceptInvite := func(forUser string, id string) error {
+		db.Lock()
+		defer db.Unlock()
+		if r, exists := db.Invitations[id][forUser]; exists {
+			if db.Permissions[id] == nil {
+				db.Permissions[id] = map[string]string{}
+			}
+			db.Permissions[id][forUser] = r
+			db.DeleteInvitation(id, forUser)
+		}
+		return nil
+	}
+
+	declineInvite := func(forUser string, id string) error {
+		db.Lock()
+		defer db.Unlock()
+		db.DeleteInvitation(id, forUser)
+		return nil
+	}
+
+	getMemberships := func(forUser string, id string, role role, offset int, limit int, sortBy sortBy) ([]*Membership, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		if forUserRole, err := db.Role(forUser, id); err != nil {
+			return nil, 0, err
+		} else if !util.MemRoleIn(forUserRole, string(Owner), string(Admin)) {
+			return nil, 0, errors.New("Unauthorized action: get memberships")
+		}
+		ms, totalResults := offsetMemberships(db.Permissions[id], role, offset, limit, sortBy)
+		return ms, totalResults, nil
+	}
+
+	getMembershipInvites := func(forUser string, id string, role role, offset int, limit int, sortBy sortBy) ([]*Membership, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		if forUserRole, err := db.Role(forUser, id); err != nil {
+			return nil, 0, err
+		} else if !util.MemRoleIn(forUserRole, string(Owner), string(Admin)) {
+			return nil, 0, errors.New("Unauthorized action: get membership invites")
+		}
+		ms, totalResults := offsetMemberships(db.Invitations[id], role, offset, limit, sortBy)
+		return ms, totalResults, nil
+	}
+
+	get := func(forUser string, ids []string) ([]*Project, error) {
+		db.RLock()
+		defer db.RUnlock()
+		ps := make([]*Project, 0, len(ids))
+		for _, id := range ids {
+			p, exists := db.Projects[id]
+			if _, isMember := db.Permissions[id][forUser]; !exists || !isMember {
+				return nil, errors.New("Unauthorized action: get projects")
+			}
+			ps = append(ps, toProject(p))
+		}
+		return ps, nil
+	}
+
+	inUserContext := func(forUser string, user string, role role, invites bool) []*ProjectInUserContext {
+		relationships := db.Permissions
+		if invites {
+			relationships = db.Invitations
+		}
+		ps := make([]*ProjectInUserContext, 0, util.DefaultSqlOffsetQueryLimit)
+		for id, p := range db.Projects {
+			forUserRole := db.Permissions[id][forUser]
+			userRole, isRelated := relationships[id][user]
+			if !isRelated || (role != "" && role != Any && string(role) != userRole) {
+				continue
+			}
+			if util.MemRoleIn(forUserRole, string(Owner), string(Admin)) || (invites && forUser == user) {
+				ps = append(ps, &ProjectInUserContext{
+					Project: *toProject(p),
+					Role:    userRole,
+				})
+			}
+		}
+		return ps
+	}
+
+	getInUserContext := func(forUser string, user string, role role, offset int, limit int, sortBy sortBy) ([]*ProjectInUserContext, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		ps, totalResults := offsetProjects(inUserContext(forUser, user, role, false), offset, limit, sortBy)
+		return ps, totalResults, nil
+	}
+
+	getInUserInviteContext := func(forUser string, user string, role role, offset int, limit int, sortBy sortBy) ([]*ProjectInUserContext, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		ps, totalResults := offsetProjects(inUserContext(forUser, user, role, true), offset, limit, sortBy)
+		return ps, totalResults, nil
+	}
+
+	search := func(forUser string, search string, offset int, limit int, sortBy sortBy) ([]*Project, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		matches := make([]*ProjectInUserContext, 0, util.DefaultSqlOffsetQueryLimit)
+		for id, p := range db.Projects {
+			if _, isMember := db.Permissions[id][forUser]; isMember && util.MemMatch(search, p.Name) {
+				matches = append(matches, &ProjectInUserContext{Project: *toProject(p)})
+			}
+		}
+		page, totalResults := offsetProjects(matches, offset, limit, sortBy)
+		ps := make([]*Project, 0, len(page))
+		for _, p := range page {
+			ps = append(ps, &p.Project)
+		}
+		return ps, totalResults, nil
+	}
+
+	return newProjectStore(create, delete, setName, setDescription, setThumbnailType, addUsers, removeUsers, acceptInvite, declineInvite, util.GetMemRoleFunc(db), getMemberships, getMembershipInvites, get, getInUserContext, getInUserInviteContext, search, blobStore, ossBucketPrefix, log)
+}
@@ -2,13 +2,13 @@ package project
 
 import (
 	"database/sql"
+	"github.com/modelhub/core/blob"
 	"github.com/modelhub/core/util"
-	"github.com/modelhub/vada"
 	"github.com/robsix/golog"
 	"strings"
 )
 
-func NewSqlProjectStore(db *sql.DB, vada vada.VadaClient, ossBucketPrefix string, ossBucketPolicy vada.BucketPolicy, log golog.Log) ProjectStore {
+func NewSqlProjectStore(db *sql.DB, blobStore blob.BlobStore, ossBucketPrefix string, log golog.Log) ProjectStore {
 
 	getter := func(query string, colLen int, args ...interface{}) ([]*Project, error) {
 		ps := make([]*Project, 0, colLen)
@@ -138,5 +138,5 @@ func NewSqlProjectStore(db *sql.DB, vada vada.VadaClient, ossBucketPrefix string
 		return offsetGetter("CALL projectSearch(?, ?, ?, ?, ?)", forUser, search, offset, limit, string(sortBy))
 	}
 
-	return newProjectStore(create, delete, setName, setDescription, setThumbnailType, addUsers, removeUsers, acceptInvite, declineInvite, util.GetRoleFunc(db), getMemberships, getMembershipInvites, get, getInUserContext, getInUserInviteContext, search, vada, ossBucketPrefix, ossBucketPolicy, log)
+	return newProjectStore(create, delete, setName, setDescription, setThumbnailType, addUsers, removeUsers, acceptInvite, declineInvite, util.GetRoleFunc(db), getMemberships, getMembershipInvites, get, getInUserContext, getInUserInviteContext, search, blobStore, ossBucketPrefix, log)
 }
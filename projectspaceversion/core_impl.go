@@ -2,9 +2,9 @@ package projectspaceversion
 
 import (
 	"errors"
+	"github.com/modelhub/core/blob"
 	"github.com/modelhub/core/sheettransform"
 	"github.com/modelhub/core/util"
-	"github.com/modelhub/vada"
 	"github.com/robsix/golog"
 	"github.com/robsix/json"
 	"io"
@@ -12,16 +12,16 @@ import (
 	"strings"
 )
 
-func newProjectSpaceVersionStore(create create, get get, getForProjectSpace getForProjectSpace, saveSheetTransformsForProjectSpace sheettransform.SaveSheetTransformsForProjectSpace, getRole util.GetRole, vada vada.VadaClient, ossBucketPrefix string, log golog.Log) ProjectSpaceVersionStore {
+func newProjectSpaceVersionStore(create create, get get, getForProjectSpace getForProjectSpace, saveSheetTransformsForProjectSpace sheettransform.SaveSheetTransformsForProjectSpace, getRole util.GetRole, blobStore blob.BlobStore, ossBucketPrefix string, log golog.Log) ProjectSpaceVersionStore {
 	return &projectSpaceVersionStore{
 		create:                             create,
 		get:                                get,
 		getForProjectSpace:                 getForProjectSpace,
 		saveSheetTransformsForProjectSpace: saveSheetTransformsForProjectSpace,
-		getRole:         getRole,
-		vada:            vada,
-		ossBucketPrefix: ossBucketPrefix,
-		log:             log,
+		getRole:                            getRole,
+		blobStore:                          blobStore,
+		ossBucketPrefix:                    ossBucketPrefix,
+		log:                                log,
 	}
 }
 
@@ -31,7 +31,7 @@ type projectSpaceVersionStore struct {
 	getForProjectSpace                 getForProjectSpace
 	saveSheetTransformsForProjectSpace sheettransform.SaveSheetTransformsForProjectSpace
 	getRole                            util.GetRole
-	vada                               vada.VadaClient
+	blobStore                          blob.BlobStore
 	ossBucketPrefix                    string
 	log                                golog.Log
 }
@@ -68,7 +68,7 @@ func (psvs *projectSpaceVersionStore) Create(forUser string, projectSpace string
 	}
 
 	newProjVerId := util.NewId()
-	thumbnailType, _ = util.ThumbnailUploadHelper(newProjVerId, thumbnailType, thumbnail, psvs.ossBucketPrefix+projectId, psvs.vada)
+	thumbnailType, _ = util.ThumbnailUploadHelper(newProjVerId, thumbnailType, thumbnail, psvs.ossBucketPrefix+projectId, psvs.blobStore)
 	if treeNode, err := psvs.create(forUser, projectSpace, newProjVerId, createComment, sheetTransformIds, camera, thumbnailType); err != nil {
 		psvs.log.Error("ProjectSpaceVersionStore.Create error: forUser: %q projectSpace: %q createComment: %q thumbnailType: %q error: %v", forUser, projectSpace, createComment, thumbnailType, err)
 		return treeNode, err
@@ -105,7 +105,7 @@ func (psvs *projectSpaceVersionStore) GetThumbnail(forUser string, id string) (*
 	} else {
 		projectSpaceVer := projectSpaceVers[0]
 		if strings.HasPrefix(projectSpaceVer.ThumbnailType, "image/") {
-			if res, err := psvs.vada.GetFile(projectSpaceVer.Id+".tn.tn", psvs.ossBucketPrefix+projectSpaceVer.Project); err != nil {
+			if res, err := psvs.blobStore.Get(psvs.ossBucketPrefix+projectSpaceVer.Project, projectSpaceVer.Id+".tn.tn"); err != nil {
 				psvs.log.Error("ProjectSpaceVersionStore.GetThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
 				return res, err
 			} else {
@@ -119,3 +119,28 @@ func (psvs *projectSpaceVersionStore) GetThumbnail(forUser string, id string) (*
 		}
 	}
 }
+
+func (psvs *projectSpaceVersionStore) DownloadThumbnail(forUser string, id string, byteRange *blob.ByteRange, ifNoneMatch string) (*blob.Download, error) {
+	if projectSpaceVers, err := psvs.get(forUser, []string{id}); err != nil || projectSpaceVers == nil || len(projectSpaceVers) == 0 {
+		if err == nil {
+			err = errors.New("ProjectSpaceVersion not found")
+		}
+		psvs.log.Error("ProjectSpaceVersionStore.DownloadThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
+		return nil, err
+	} else {
+		projectSpaceVer := projectSpaceVers[0]
+		if !strings.HasPrefix(projectSpaceVer.ThumbnailType, "image/") {
+			err = errors.New("ProjectSpaceVersion does not have a thumbnail")
+			psvs.log.Error("ProjectSpaceVersionStore.DownloadThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
+			return nil, err
+		}
+		if dl, err := psvs.blobStore.Download(psvs.ossBucketPrefix+projectSpaceVer.Project, projectSpaceVer.Id+".tn.tn", byteRange, ifNoneMatch); err != nil {
+			psvs.log.Error("ProjectSpaceVersionStore.DownloadThumbnail error: forUser: %q id: %q error: %v", forUser, id, err)
+			return nil, err
+		} else {
+			dl.ContentType = projectSpaceVer.ThumbnailType
+			psvs.log.Info("ProjectSpaceVersionStore.DownloadThumbnail success: forUser: %q id: %q notModified: %t", forUser, id, dl.NotModified)
+			return dl, nil
+		}
+	}
+}
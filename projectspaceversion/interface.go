@@ -1,6 +1,7 @@
 package projectspaceversion
 
 import (
+	"github.com/modelhub/core/blob"
 	"github.com/modelhub/core/sheettransform"
 	"github.com/robsix/json"
 	"io"
@@ -16,4 +17,5 @@ type ProjectSpaceVersionStore interface {
 	Get(forUser string, ids []string) ([]*ProjectSpaceVersion, error)
 	GetForProjectSpace(forUser string, projectSpace string, offset int, limit int, sortBy sortBy) ([]*ProjectSpaceVersion, int, error)
 	GetThumbnail(forUser string, id string) (*http.Response, error)
+	DownloadThumbnail(forUser string, id string, byteRange *blob.ByteRange, ifNoneMatch string) (*blob.Download, error)
 }
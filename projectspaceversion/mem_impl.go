@@ -0,0 +1,96 @@
+package projectspaceversion
+
+import (
+	"errors"
+	"github.com/modelhub/caca"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/sheettransform"
+	"github.com/modelhub/core/util"
+	"github.com/robsix/golog"
+	"github.com/robsix/json"
+	"sort"
+	"time"
+)
+
+func NewMemProjectSpaceVersionStore(db *util.MemDb, subTaskTimeout time.Duration, blobStore blob.BlobStore, caca caca.CacaClient, ossBucketPrefix string, log golog.Log) ProjectSpaceVersionStore {
+
+	toProjectSpaceVersion := func(psv *util.MemProjectSpaceVersion) *ProjectSpaceVersion {
+		camera, _ := json.FromString(psv.CameraJson)
+		return &ProjectSpaceVersion{
+			Id:                  psv.Id,
+			ProjectSpace:        psv.ProjectSpace,
+			Version:             psv.Version,
+			Project:             psv.Project,
+			Created:             psv.Created,
+			CreateComment:       psv.CreateComment,
+			CreatedBy:           psv.CreatedBy,
+			Camera:              camera,
+			ThumbnailType:       psv.ThumbnailType,
+			SheetTransformCount: len(db.ProjectSpaceVersionSheetTransforms[psv.Id]),
+		}
+	}
+
+	create := func(forUser string, projectSpace string, projectSpaceVersion string, createComment string, sheetTransforms []string, camera *json.Json, thumbnailType string) (*ProjectSpaceVersion, error) {
+		cameraStr, _ := camera.ToString()
+		db.Lock()
+		defer db.Unlock()
+		if psv, err := db.CreateProjectSpaceVersion(forUser, projectSpace, projectSpaceVersion, createComment, cameraStr, thumbnailType); err != nil {
+			return nil, err
+		} else {
+			err = db.CreateProjectSpaceVersionSheetTransforms(projectSpaceVersion, sheetTransforms)
+			return toProjectSpaceVersion(psv), err
+		}
+	}
+
+	get := func(forUser string, ids []string) ([]*ProjectSpaceVersion, error) {
+		db.RLock()
+		defer db.RUnlock()
+		projectId := ""
+		psvs := make([]*ProjectSpaceVersion, 0, len(ids))
+		for _, id := range ids {
+			if psv, exists := db.ProjectSpaceVersions[id]; exists {
+				if projectId != "" && projectId != psv.Project {
+					return nil, errors.New("Unauthorized action: projectSpaceVersion get cross project")
+				}
+				projectId = psv.Project
+				psvs = append(psvs, toProjectSpaceVersion(psv))
+			}
+		}
+		if _, err := db.Role(forUser, projectId); projectId == "" || err != nil {
+			return nil, errors.New("Unauthorized action: projectSpaceVersion get cross project")
+		}
+		return psvs, nil
+	}
+
+	getForProjectSpace := func(forUser string, projectSpace string, offset int, limit int, sortBy sortBy) ([]*ProjectSpaceVersion, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		projectId := ""
+		if tn, exists := db.TreeNodes[projectSpace]; exists {
+			projectId = tn.Project
+		}
+		if _, err := db.Role(forUser, projectId); err != nil {
+			return nil, 0, errors.New("Unauthorized action: projectSpaceVersion get by projectSpace")
+		}
+		matches := make([]*util.MemProjectSpaceVersion, 0, util.DefaultSqlOffsetQueryLimit)
+		for _, psv := range db.ProjectSpaceVersions {
+			if psv.ProjectSpace == projectSpace {
+				matches = append(matches, psv)
+			}
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			if sortBy == VersionAsc {
+				return matches[i].Version < matches[j].Version
+			}
+			return matches[j].Version < matches[i].Version
+		})
+		start, end := util.MemOffsetLimit(len(matches), offset, limit)
+		psvs := make([]*ProjectSpaceVersion, 0, end-start)
+		for _, psv := range matches[start:end] {
+			psvs = append(psvs, toProjectSpaceVersion(psv))
+		}
+		return psvs, len(matches), nil
+	}
+
+	return newProjectSpaceVersionStore(create, get, getForProjectSpace, sheettransform.NewMemSaveSheetTransformsFunc(subTaskTimeout, db, caca, log), util.GetMemRoleFunc(db), blobStore, ossBucketPrefix, log)
+}
@@ -2,17 +2,17 @@ package projectspaceversion
 
 import (
 	"database/sql"
+	"github.com/modelhub/caca"
+	"github.com/modelhub/core/blob"
 	"github.com/modelhub/core/sheettransform"
 	"github.com/modelhub/core/util"
-	"github.com/modelhub/vada"
 	"github.com/robsix/golog"
 	"github.com/robsix/json"
 	"strings"
 	"time"
-	"github.com/modelhub/caca"
 )
 
-func NewSqlProjectSpaceVersionStore(db *sql.DB, subTaskTimeout time.Duration, vada vada.VadaClient, caca caca.CacaClient, ossBucketPrefix string, log golog.Log) ProjectSpaceVersionStore {
+func NewSqlProjectSpaceVersionStore(db *sql.DB, subTaskTimeout time.Duration, blobStore blob.BlobStore, caca caca.CacaClient, ossBucketPrefix string, log golog.Log) ProjectSpaceVersionStore {
 
 	getter := func(query string, colLen int, args ...interface{}) ([]*ProjectSpaceVersion, error) {
 		psvs := make([]*ProjectSpaceVersion, 0, colLen)
@@ -66,5 +66,5 @@ func NewSqlProjectSpaceVersionStore(db *sql.DB, subTaskTimeout time.Duration, va
 		return offsetGetter("CALL projectSpaceVersionGetForProjectSpace(?, ?, ?, ?, ?)", forUser, document, offset, limit, string(sortBy))
 	}
 
-	return newProjectSpaceVersionStore(create, get, getForProjectSpace, sheettransform.NewSqlSaveSheetTransformsFunc(subTaskTimeout, db, caca, log), util.GetRoleFunc(db), vada, ossBucketPrefix, log)
+	return newProjectSpaceVersionStore(create, get, getForProjectSpace, sheettransform.NewSqlSaveSheetTransformsFunc(subTaskTimeout, db, caca, log), util.GetRoleFunc(db), blobStore, ossBucketPrefix, log)
 }
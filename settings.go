@@ -0,0 +1,58 @@
+package core
+
+import (
+	"time"
+)
+
+const (
+	defaultSubTaskTimeout             = 5 * time.Second
+	defaultBatchGetTimeout            = 5 * time.Second
+	defaultTrashRetention             = 30 * 24 * time.Hour
+	defaultTrashPurgeInterval         = time.Hour
+	defaultUploadExpiry               = 24 * time.Hour
+	defaultUploadPurgeInterval        = time.Hour
+	defaultTranslationPollInterval    = 30 * time.Second
+	defaultTranslationPollConcurrency = 4
+)
+
+// Settings tunes the timeouts and background workers of a CoreApi, any field
+// left at its zero value takes the default given beside it. The workers only
+// run once started through CoreApi.TrashPurger, UploadPurger and TranslationMonitor.
+type Settings struct {
+	SubTaskTimeout             time.Duration //5 seconds, how long to wait on caca and other sub tasks
+	BatchGetTimeout            time.Duration //5 seconds, how long Helper waits on each batch of gets
+	TrashRetention             time.Duration //30 days, how long trashed treeNodes can be restored for
+	TrashPurgeInterval         time.Duration //1 hour
+	UploadExpiry               time.Duration //24 hours, how long an unfinished upload session is kept
+	UploadPurgeInterval        time.Duration //1 hour
+	TranslationPollInterval    time.Duration //30 seconds
+	TranslationPollConcurrency int           //4, how many translations are polled at once
+}
+
+func (s Settings) withDefaults() Settings {
+	if s.SubTaskTimeout <= 0 {
+		s.SubTaskTimeout = defaultSubTaskTimeout
+	}
+	if s.BatchGetTimeout <= 0 {
+		s.BatchGetTimeout = defaultBatchGetTimeout
+	}
+	if s.TrashRetention <= 0 {
+		s.TrashRetention = defaultTrashRetention
+	}
+	if s.TrashPurgeInterval <= 0 {
+		s.TrashPurgeInterval = defaultTrashPurgeInterval
+	}
+	if s.UploadExpiry <= 0 {
+		s.UploadExpiry = defaultUploadExpiry
+	}
+	if s.UploadPurgeInterval <= 0 {
+		s.UploadPurgeInterval = defaultUploadPurgeInterval
+	}
+	if s.TranslationPollInterval <= 0 {
+		s.TranslationPollInterval = defaultTranslationPollInterval
+	}
+	if s.TranslationPollConcurrency <= 0 {
+		s.TranslationPollConcurrency = defaultTranslationPollConcurrency
+	}
+	return s
+}
@@ -4,6 +4,12 @@ import (
 	"strings"
 )
 
+const (
+	// PdfRole marks sheets created locally from the pages of a pdf rather
+	// than from an lmv translation, they have no baseUrn.
+	PdfRole = "pdf"
+)
+
 const (
 	NameAsc  = sortBy("nameAsc")
 	NameDesc = sortBy("nameDesc")
@@ -1,19 +1,23 @@
 package sheet
 
 import (
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/util"
 	"github.com/modelhub/vada"
 	"github.com/robsix/golog"
 	"net/http"
 )
 
-func newSheetStore(setName setName, get get, getForDocumentVersion getForDocumentVersion, globalSearch globalSearch, projectSearch projectSearch, vada vada.VadaClient, log golog.Log) SheetStore {
+func newSheetStore(setName setName, get get, getForDocumentVersion getForDocumentVersion, globalSearch globalSearch, projectSearch projectSearch, blobStore blob.BlobStore, vada vada.VadaClient, ossBucketPrefix string, log golog.Log) SheetStore {
 	return &sheetStore{
-		setName: setName,
-		get:     get,
+		setName:               setName,
+		get:                   get,
 		getForDocumentVersion: getForDocumentVersion,
 		globalSearch:          globalSearch,
 		projectSearch:         projectSearch,
+		blobStore:             blobStore,
 		vada:                  vada,
+		ossBucketPrefix:       ossBucketPrefix,
 		log:                   log,
 	}
 }
@@ -24,7 +28,9 @@ type sheetStore struct {
 	getForDocumentVersion getForDocumentVersion
 	globalSearch          globalSearch
 	projectSearch         projectSearch
+	blobStore             blob.BlobStore
 	vada                  vada.VadaClient
+	ossBucketPrefix       string
 	log                   golog.Log
 }
 
@@ -42,6 +48,17 @@ func (ss *sheetStore) GetItem(forUser string, id string, path string) (*http.Res
 	if sheets, err := ss.get(forUser, []string{id}); err != nil || len(sheets) == 0 {
 		ss.log.Error("SheetStore.GetItem error: forUser: %q id: %q path: %q error: %v", forUser, id, path, err)
 		return nil, "", err
+	} else if sheets[0].Role == PdfRole {
+		if res, err := ss.getPdfItem(sheets[0], path); err != nil {
+			ss.log.Error("SheetStore.GetItem error: forUser: %q id: %q path: %q error: %v", forUser, id, path, err)
+			return nil, "", err
+		} else {
+			ss.log.Info("SheetStore.GetItem success: forUser: %q id: %q path: %q", forUser, id, path)
+			return res, "", nil
+		}
+	} else if ss.vada == nil {
+		ss.log.Error("SheetStore.GetItem error: forUser: %q id: %q path: %q error: %v", forUser, id, path, util.ErrNoVada)
+		return nil, sheets[0].BaseUrn, util.ErrNoVada
 	} else {
 		if res, err := ss.vada.GetSheetItem(sheets[0].BaseUrn + path); err != nil {
 			ss.log.Error("SheetStore.GetItem error: forUser: %q id: %q baseUrn: %q path: %q error: %v", forUser, id, sheets[0].BaseUrn, path, err)
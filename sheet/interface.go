@@ -10,6 +10,15 @@ type getForDocumentVersion func(forUser string, documentVersion string, offset i
 type globalSearch func(forUser string, search string, offset int, limit int, sortBy sortBy) ([]*Sheet_, int, error)
 type projectSearch func(forUser string, project string, search string, offset int, limit int, sortBy sortBy) ([]*Sheet_, int, error)
 
+// SaveSheets stores new sheets, it is used by the stores which create sheets
+// as documentVersions are translated or uploaded.
+type SaveSheets func(sheets []*Sheet_) error
+
+// GetPdfThumbnailSuffixes lists the blob name suffixes of the stored page
+// thumbnails of a pdf documentVersion, it is used by the stores which copy or
+// remove documentVersion blobs.
+type GetPdfThumbnailSuffixes func(documentVersion string) ([]string, error)
+
 type SheetStore interface {
 	SetName(forUser string, id string, newName string) error
 	GetItem(forUser string, id string, path string) (*http.Response, string, error)
@@ -0,0 +1,174 @@
+package sheet
+
+import (
+	"errors"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/util"
+	"github.com/modelhub/vada"
+	"github.com/robsix/golog"
+	"sort"
+	"strings"
+)
+
+func NewMemSheetStore(db *util.MemDb, blobStore blob.BlobStore, vada vada.VadaClient, ossBucketPrefix string, log golog.Log) SheetStore {
+
+	toSheet := func(s *util.MemSheet) *Sheet_ {
+		return &Sheet_{
+			Sheet: Sheet{
+				Id:              s.Id,
+				DocumentVersion: s.DocumentVersion,
+				Project:         s.Project,
+				Name:            s.Name,
+				Thumbnails:      strings.Split(s.Thumbnails, ","),
+				Manifest:        s.Manifest,
+				Role:            s.Role,
+			},
+			BaseUrn: s.BaseUrn,
+		}
+	}
+
+	offsetSheets := func(matches []*util.MemSheet, offset int, limit int, sortBy sortBy) ([]*Sheet_, int) {
+		sort.Slice(matches, func(i, j int) bool {
+			if sortBy == NameDesc {
+				return util.MemLessFold(matches[j].Name, matches[i].Name)
+			}
+			return util.MemLessFold(matches[i].Name, matches[j].Name)
+		})
+		start, end := util.MemOffsetLimit(len(matches), offset, limit)
+		ss := make([]*Sheet_, 0, end-start)
+		for _, s := range matches[start:end] {
+			ss = append(ss, toSheet(s))
+		}
+		return ss, len(matches)
+	}
+
+	setName := func(forUser string, id string, newName string) error {
+		db.Lock()
+		defer db.Unlock()
+		s, exists := db.Sheets[id]
+		if !exists {
+			return errors.New("Unauthorized action: sheet set name")
+		}
+		if role, _ := db.Role(forUser, s.Project); !util.MemRoleIn(role, "owner", "admin", "organiser") {
+			return errors.New("Unauthorized action: sheet set name")
+		}
+		s.Name = newName
+		return nil
+	}
+
+	get := func(forUser string, ids []string) ([]*Sheet_, error) {
+		db.RLock()
+		defer db.RUnlock()
+		projectId := ""
+		if len(ids) > 0 {
+			if s, exists := db.Sheets[ids[0]]; exists {
+				projectId = s.Project
+			}
+		}
+		if _, err := db.Role(forUser, projectId); err != nil {
+			return nil, errors.New("Unauthorized action: sheet get")
+		}
+		ss := make([]*Sheet_, 0, len(ids))
+		for _, id := range ids {
+			if s, exists := db.Sheets[id]; exists {
+				if s.Project != projectId {
+					return nil, errors.New("Unauthorized action: sheet get cross project")
+				}
+				ss = append(ss, toSheet(s))
+			}
+		}
+		return ss, nil
+	}
+
+	getForDocumentVersion := func(forUser string, documentVersion string, offset int, limit int, sortBy sortBy) ([]*Sheet_, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		projectId := ""
+		if dv, exists := db.DocumentVersions[documentVersion]; exists {
+			projectId = dv.Project
+		}
+		if _, err := db.Role(forUser, projectId); err != nil {
+			return nil, 0, errors.New("Unauthorized action: sheet get by documentVersion")
+		}
+		matches := make([]*util.MemSheet, 0, util.DefaultSqlOffsetQueryLimit)
+		for _, s := range db.Sheets {
+			if s.DocumentVersion == documentVersion {
+				matches = append(matches, s)
+			}
+		}
+		ss, totalResults := offsetSheets(matches, offset, limit, sortBy)
+		return ss, totalResults, nil
+	}
+
+	globalSearch := func(forUser string, search string, offset int, limit int, sortBy sortBy) ([]*Sheet_, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		matches := make([]*util.MemSheet, 0, util.DefaultSqlOffsetQueryLimit)
+		for _, s := range db.Sheets {
+			if _, isMember := db.Permissions[s.Project][forUser]; isMember && !db.DocumentVersionTrashed(s.DocumentVersion) && util.MemMatch(search, s.Name) {
+				matches = append(matches, s)
+			}
+		}
+		ss, totalResults := offsetSheets(matches, offset, limit, sortBy)
+		return ss, totalResults, nil
+	}
+
+	projectSearch := func(forUser string, project string, search string, offset int, limit int, sortBy sortBy) ([]*Sheet_, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		matches := make([]*util.MemSheet, 0, util.DefaultSqlOffsetQueryLimit)
+		if _, err := db.Role(forUser, project); err == nil {
+			for _, s := range db.Sheets {
+				if s.Project == project && !db.DocumentVersionTrashed(s.DocumentVersion) && util.MemMatch(search, s.Name) {
+					matches = append(matches, s)
+				}
+			}
+		}
+		ss, totalResults := offsetSheets(matches, offset, limit, sortBy)
+		return ss, totalResults, nil
+	}
+
+	return newSheetStore(setName, get, getForDocumentVersion, globalSearch, projectSearch, blobStore, vada, ossBucketPrefix, log)
+}
+
+func NewMemSaveSheetsFunc(db *util.MemDb) SaveSheets {
+	return func(sheets []*Sheet_) error {
+		db.Lock()
+		defer db.Unlock()
+		for _, sheet := range sheets {
+			for _, existing := range db.Sheets {
+				if existing.DocumentVersion == sheet.DocumentVersion && existing.BaseUrn == sheet.BaseUrn && existing.Manifest == sheet.Manifest {
+					return errors.New("Duplicate entry: sheet documentVersion baseUrn manifest")
+				}
+			}
+			id := util.NewId()
+			db.Sheets[id] = &util.MemSheet{
+				Id:              id,
+				DocumentVersion: sheet.DocumentVersion,
+				Project:         sheet.Project,
+				Name:            sheet.Name,
+				BaseUrn:         sheet.BaseUrn,
+				Manifest:        sheet.Manifest,
+				Thumbnails:      strings.Join(sheet.Thumbnails, ","),
+				Role:            sheet.Role,
+			}
+		}
+		return nil
+	}
+}
+
+func NewMemGetPdfThumbnailSuffixesFunc(db *util.MemDb) GetPdfThumbnailSuffixes {
+	return func(documentVersion string) ([]string, error) {
+		db.RLock()
+		defer db.RUnlock()
+		suffixes := []string{}
+		for _, s := range db.Sheets {
+			if s.DocumentVersion == documentVersion && s.Role == PdfRole && s.Thumbnails != "" {
+				if suffix := PdfThumbnailSuffix(s.Manifest); suffix != "" {
+					suffixes = append(suffixes, suffix)
+				}
+			}
+		}
+		return suffixes, nil
+	}
+}
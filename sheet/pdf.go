@@ -0,0 +1,95 @@
+package sheet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/util"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// pdf sheets have no translation to point at, their manifest is
+// /<seed file extension>/page/<n> and their only item is the page thumbnail,
+// rendered once on upload into a blob named by PdfThumbnailSuffix.
+const pdfThumbnailItem = "/thumbnail.png"
+
+var errPdfItemNotFound = errors.New("pdf sheet item not found")
+
+// SavePdfSheetsHelper saves a sheet for every page of the pdf seed file of
+// documentVersion, named by the page outline title or label, returning how
+// many were saved. The embedded page thumbnails are stored alongside the seed
+// file, a page whose thumbnail can't be stored is saved without one.
+func SavePdfSheetsHelper(documentVersion string, project string, fileExtension string, ossBucket string, blobStore blob.BlobStore, saveSheets SaveSheets) (int, error) {
+	pages, pngs, err := util.PdfPageThumbnailsHelper(documentVersion+"."+fileExtension, ossBucket, blobStore)
+	if err != nil {
+		return 0, err
+	}
+	sheets := make([]*Sheet_, 0, len(pages))
+	stored := make([]string, 0, len(pngs))
+	for _, page := range pages {
+		manifest := fmt.Sprintf("/%s/page/%d", fileExtension, page.Number)
+		thumbnails := []string{}
+		if png, exists := pngs[page.Number]; exists {
+			name := documentVersion + PdfThumbnailSuffix(manifest)
+			if _, err := blobStore.Put(ossBucket, name, bytes.NewReader(png)); err == nil {
+				stored = append(stored, name)
+				thumbnails = append(thumbnails, manifest+pdfThumbnailItem)
+			}
+		}
+		name := page.Title
+		if name == "" {
+			name = page.Label
+		}
+		if name == "" {
+			name = "Page " + strconv.Itoa(page.Number)
+		}
+		sheets = append(sheets, &Sheet_{
+			Sheet: Sheet{
+				DocumentVersion: documentVersion,
+				Project:         project,
+				Name:            name,
+				Thumbnails:      thumbnails,
+				Manifest:        manifest,
+				Role:            PdfRole,
+			},
+		})
+	}
+	if err := saveSheets(sheets); err != nil {
+		for _, name := range stored {
+			blobStore.Delete(ossBucket, name)
+		}
+		return 0, err
+	}
+	return len(sheets), nil
+}
+
+// PdfThumbnailSuffix returns the suffix, after the documentVersion id, of the
+// blob holding the page thumbnail of the pdf sheet with manifest, or "" when
+// manifest isn't that of a pdf page.
+func PdfThumbnailSuffix(manifest string) string {
+	parts := strings.Split(manifest, "/")
+	if len(parts) != 4 || parts[2] != "page" {
+		return ""
+	}
+	if _, err := strconv.Atoi(parts[3]); err != nil {
+		return ""
+	}
+	return ".page." + parts[3] + ".tn"
+}
+
+// getPdfItem serves the page thumbnail of a pdf sheet from the blob it was
+// rendered into on upload.
+func (ss *sheetStore) getPdfItem(s *Sheet_, path string) (*http.Response, error) {
+	listed := false
+	for _, tn := range s.Thumbnails {
+		listed = listed || tn != "" && tn == path
+	}
+	suffix := PdfThumbnailSuffix(s.Manifest)
+	if !listed || suffix == "" {
+		return nil, errPdfItemNotFound
+	}
+	return ss.blobStore.Get(ss.ossBucketPrefix+s.Project, s.DocumentVersion+suffix)
+}
@@ -2,13 +2,15 @@ package sheet
 
 import (
 	"database/sql"
+	"fmt"
+	"github.com/modelhub/core/blob"
 	"github.com/modelhub/core/util"
 	"github.com/modelhub/vada"
 	"github.com/robsix/golog"
 	"strings"
 )
 
-func NewSqlSheetStore(db *sql.DB, vada vada.VadaClient, log golog.Log) SheetStore {
+func NewSqlSheetStore(db *sql.DB, blobStore blob.BlobStore, vada vada.VadaClient, ossBucketPrefix string, log golog.Log) SheetStore {
 
 	getter := func(query string, colLen int, args ...interface{}) ([]*Sheet_, error) {
 		ss := make([]*Sheet_, 0, colLen)
@@ -64,5 +66,36 @@ func NewSqlSheetStore(db *sql.DB, vada vada.VadaClient, log golog.Log) SheetStor
 		return offsetGetter("CALL sheetProjectSearch(?, ?, ?, ?, ?, ?)", forUser, project, search, offset, limit, string(sortBy))
 	}
 
-	return newSheetStore(setName, get, getForDocumentVersion, globalSearch, projectSearch, vada, log)
+	return newSheetStore(setName, get, getForDocumentVersion, globalSearch, projectSearch, blobStore, vada, ossBucketPrefix, log)
+}
+
+func NewSqlSaveSheetsFunc(db *sql.DB) SaveSheets {
+	return func(sheets []*Sheet_) error {
+		if len(sheets) > 0 {
+			query := strings.Repeat("CALL sheetCreate(%q, %q, %q, %q, %q, %q, %q); ", len(sheets))
+			args := make([]interface{}, 0, len(sheets)*7)
+			for _, sheet := range sheets {
+				args = append(args, sheet.DocumentVersion, sheet.Project, sheet.Name, sheet.BaseUrn, sheet.Manifest, strings.Join(sheet.Thumbnails, ","), sheet.Role)
+			}
+			return util.SqlExec(db, fmt.Sprintf(query, args...))
+		}
+		return nil
+	}
+}
+
+func NewSqlGetPdfThumbnailSuffixesFunc(db *sql.DB) GetPdfThumbnailSuffixes {
+	return func(documentVersion string) ([]string, error) {
+		suffixes := []string{}
+		rowsScan := func(rows *sql.Rows) error {
+			manifest := ""
+			if err := rows.Scan(&manifest); err != nil {
+				return err
+			}
+			if suffix := PdfThumbnailSuffix(manifest); suffix != "" {
+				suffixes = append(suffixes, suffix)
+			}
+			return nil
+		}
+		return suffixes, util.SqlQuery(db, rowsScan, "CALL sheetGetPdfThumbnailManifests(?)", documentVersion)
+	}
 }
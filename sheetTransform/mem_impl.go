@@ -0,0 +1,221 @@
+package sheettransform
+
+import (
+	"errors"
+	"github.com/modelhub/caca"
+	"github.com/modelhub/core/util"
+	"github.com/robsix/golog"
+	"sort"
+	"strings"
+	"time"
+)
+
+func NewMemSheetTransformStore(db *util.MemDb, log golog.Log) SheetTransformStore {
+
+	get := func(forUser string, ids []string) ([]*SheetTransform, error) {
+		db.RLock()
+		defer db.RUnlock()
+		return memGetter(db, forUser, ids)
+	}
+
+	getForProjectSpaceVersion := func(forUser string, projectSpaceVersion string, offset int, limit int, sortBy sortBy) ([]*SheetTransform, int, error) {
+		db.Lock()
+		defer db.Unlock()
+		projectId := ""
+		if psv, exists := db.ProjectSpaceVersions[projectSpaceVersion]; exists {
+			projectId = psv.Project
+		}
+		if _, err := db.Role(forUser, projectId); err != nil {
+			return nil, 0, err
+		}
+		stIds := db.ProjectSpaceVersionSheetTransforms[projectSpaceVersion]
+		if len(stIds) == 0 {
+			if psv, exists := db.ProjectSpaceVersions[projectSpaceVersion]; exists {
+				db.DeleteProjectSpaceVersion(projectSpaceVersion)
+				otherVersionExists := false
+				for _, other := range db.ProjectSpaceVersions {
+					if other.ProjectSpace == psv.ProjectSpace {
+						otherVersionExists = true
+						break
+					}
+				}
+				if !otherVersionExists {
+					db.DeleteTreeNode(psv.ProjectSpace)
+				}
+			}
+		}
+		sts := make([]*SheetTransform, 0, len(stIds))
+		for _, stId := range stIds {
+			if st, err := memToSheetTransform(db, db.SheetTransforms[stId]); err != nil {
+				return nil, 0, err
+			} else if st != nil {
+				sts = append(sts, st)
+			}
+		}
+		sort.Slice(sts, func(i, j int) bool {
+			if sortBy == NameDesc {
+				return util.MemLessFold(sts[j].Name, sts[i].Name)
+			}
+			return util.MemLessFold(sts[i].Name, sts[j].Name)
+		})
+		start, end := util.MemOffsetLimit(len(sts), offset, limit)
+		return sts[start:end], len(sts), nil
+	}
+
+	return newSheetTransformStore(get, getForProjectSpaceVersion, log)
+}
+
+func memToSheetTransform(db *util.MemDb, st *util.MemSheetTransform) (*SheetTransform, error) {
+	if st == nil {
+		return nil, nil
+	}
+	s, exists := db.Sheets[st.Sheet]
+	if !exists {
+		return nil, nil
+	}
+	tranObj, err := getTransformFromHashJson(st.SheetTransformHashJson)
+	if err != nil {
+		return nil, err
+	}
+	return &SheetTransform{
+		Id:               st.Id,
+		Sheet:            st.Sheet,
+		Transform:        *tranObj.Transform,
+		ClashChangeRegId: st.ClashChangeRegId,
+		DocumentVersion:  s.DocumentVersion,
+		Project:          s.Project,
+		Name:             s.Name,
+		Thumbnails:       strings.Split(s.Thumbnails, ","),
+		BaseUrn:          s.BaseUrn,
+		Manifest:         s.Manifest,
+		Role:             s.Role,
+	}, nil
+}
+
+func memGetter(db *util.MemDb, forUser string, ids []string) ([]*SheetTransform, error) {
+	projectId := ""
+	sts := make([]*SheetTransform, 0, len(ids))
+	for _, id := range ids {
+		if st, err := memToSheetTransform(db, db.SheetTransforms[id]); err != nil {
+			return nil, err
+		} else if st != nil {
+			if projectId != "" && projectId != st.Project {
+				return nil, errors.New("Unauthorized action: sheetTransform get cross project")
+			}
+			projectId = st.Project
+			sts = append(sts, st)
+		}
+	}
+	if projectId == "" {
+		return nil, errors.New("Unauthorized action: sheetTransform get cross project")
+	} else if _, err := db.Role(forUser, projectId); err != nil {
+		return nil, errors.New("Unauthorized action: sheetTransform get cross project")
+	}
+	return sts, nil
+}
+
+func NewMemSaveSheetTransformsFunc(subTaskTimeOut time.Duration, db *util.MemDb, caca caca.CacaClient, log golog.Log) func(forUser string, sheetTransforms []*SheetTransform) ([]*SheetTransform, error) {
+	return func(forUser string, sheetTransforms []*SheetTransform) ([]*SheetTransform, error) {
+		if len(sheetTransforms) > 0 {
+			hashes := make([]string, 0, len(sheetTransforms))
+			for _, st := range sheetTransforms {
+				hash, err := getSheetTransformHashJson(st)
+				hashes = append(hashes, hash)
+				if err != nil {
+					return sheetTransforms, err
+				}
+			}
+			db.Lock()
+			for i, st := range sheetTransforms {
+				projectId := ""
+				if s, exists := db.Sheets[st.Sheet]; exists {
+					projectId = s.Project
+				}
+				if role, _ := db.Role(forUser, projectId); !util.MemRoleIn(role, "owner", "admin", "organiser", "contributor") {
+					continue
+				}
+				hashExists := false
+				for _, existing := range db.SheetTransforms {
+					if existing.SheetTransformHashJson == hashes[i] {
+						hashExists = true
+						break
+					}
+				}
+				if !hashExists {
+					id := util.NewId()
+					db.SheetTransforms[id] = &util.MemSheetTransform{
+						Id:                     id,
+						Sheet:                  st.Sheet,
+						SheetTransformHashJson: hashes[i],
+						ClashChangeRegId:       util.EmptyUuid,
+					}
+				}
+			}
+			sheetTransforms = make([]*SheetTransform, 0, len(hashes))
+			for _, existing := range db.SheetTransforms {
+				for _, hash := range hashes {
+					if existing.SheetTransformHashJson == hash {
+						if st, err := memToSheetTransform(db, existing); err != nil {
+							db.Unlock()
+							return sheetTransforms, err
+						} else if st != nil {
+							sheetTransforms = append(sheetTransforms, st)
+						}
+						break
+					}
+				}
+			}
+			db.Unlock()
+			if caca != nil {
+				setClashChangeRegId := func(sheetTransform string, clashChangeRegId string) error {
+					db.Lock()
+					defer db.Unlock()
+					if st, exists := db.SheetTransforms[sheetTransform]; exists {
+						st.ClashChangeRegId = clashChangeRegId
+					}
+					return nil
+				}
+				getClashTest := func(leftSheetTransform string, rightSheetTransform string) (string, error) {
+					db.RLock()
+					defer db.RUnlock()
+					return db.ClashTestId(leftSheetTransform, rightSheetTransform), nil
+				}
+				createClashTest := func(forUser string, clashTestId string, leftSheetTransform string, rightSheetTransform string) error {
+					db.Lock()
+					defer db.Unlock()
+					return memClashTestCreate(db, forUser, clashTestId, leftSheetTransform, rightSheetTransform)
+				}
+				if err := registerAnyUnregisteredSheetTransforms(sheetTransforms, subTaskTimeOut, setClashChangeRegId, caca, log); err != nil {
+					return sheetTransforms, err
+				} else {
+					return sheetTransforms, registerAnyUnregisteredClashTests(forUser, sheetTransforms, subTaskTimeOut, getClashTest, createClashTest, caca, log)
+				}
+			}
+			return sheetTransforms, nil
+		}
+		return sheetTransforms, nil
+	}
+}
+
+// memClashTestCreate mirrors clashTestCreate, callers must hold the lock.
+func memClashTestCreate(db *util.MemDb, forUser string, clashTestId string, leftSheetTransform string, rightSheetTransform string) error {
+	if leftSheetTransform == rightSheetTransform {
+		return errors.New("Invalid action: clashTestCreate same sheetTransform")
+	}
+	lstProjectId := db.SheetTransformProject(leftSheetTransform)
+	if lstProjectId == "" || lstProjectId != db.SheetTransformProject(rightSheetTransform) {
+		return errors.New("Unauthorized action: clashTestCreate cross project")
+	}
+	if _, err := db.Role(forUser, lstProjectId); err != nil {
+		return err
+	}
+	if rightSheetTransform < leftSheetTransform {
+		leftSheetTransform, rightSheetTransform = rightSheetTransform, leftSheetTransform
+	}
+	db.ClashTests[clashTestId] = &util.MemClashTest{
+		Id:                  clashTestId,
+		LeftSheetTransform:  leftSheetTransform,
+		RightSheetTransform: rightSheetTransform,
+	}
+	return nil
+}
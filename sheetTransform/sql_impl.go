@@ -99,10 +99,19 @@ func NewSqlSaveSheetTransformsFunc(subTaskTimeOut time.Duration, db *sql.DB, cac
 			}
 			sheetTransforms, err := getter(db, "CALL sheetTransformGetForHashJsons(?)", len(hashes), strings.Join(hashes, "#"))
 			if caca != nil {
-				if err := registerAnyUnregisteredSheetTransforms(sheetTransforms, subTaskTimeOut, db, caca, log); err != nil {
+				setClashChangeRegId := func(sheetTransform string, clashChangeRegId string) error {
+					return util.SqlExec(db, "CALL sheetTransformSetClashChangeRedId(?, ?)", sheetTransform, clashChangeRegId)
+				}
+				getClashTest := func(leftSheetTransform string, rightSheetTransform string) (string, error) {
+					return _clashTestGetter(db, leftSheetTransform, rightSheetTransform)
+				}
+				createClashTest := func(forUser string, clashTestId string, leftSheetTransform string, rightSheetTransform string) error {
+					return util.SqlExec(db, "CALL clashTestCreate(?, ?, ?, ?)", forUser, clashTestId, leftSheetTransform, rightSheetTransform)
+				}
+				if err := registerAnyUnregisteredSheetTransforms(sheetTransforms, subTaskTimeOut, setClashChangeRegId, caca, log); err != nil {
 					return sheetTransforms, err
 				} else {
-					return sheetTransforms, registerAnyUnregisteredClashTests(forUser, sheetTransforms, subTaskTimeOut, db, caca, log)
+					return sheetTransforms, registerAnyUnregisteredClashTests(forUser, sheetTransforms, subTaskTimeOut, getClashTest, createClashTest, caca, log)
 				}
 			}
 			return sheetTransforms, err
@@ -110,93 +119,3 @@ func NewSqlSaveSheetTransformsFunc(subTaskTimeOut time.Duration, db *sql.DB, cac
 		return sheetTransforms, nil
 	}
 }
-
-func registerAnyUnregisteredSheetTransforms(sheetTransforms []*SheetTransform, registrationTimeOut time.Duration, db *sql.DB, caca caca.CacaClient, log golog.Log) error {
-	registrationsCount := 0
-	var lastErr error
-	errChan := make(chan error)
-	for _, st := range sheetTransforms {
-		if st.ClashChangeRegId == util.EmptyUuid {
-			registrationsCount++
-			go func(st *SheetTransform) {
-				if regId, err := caca.RegisterSheet(st.BaseUrn + st.Manifest); err != nil {
-					errChan <- err
-					return
-				} else {
-					regId = strings.Replace(regId, "-", "", -1)
-					if err := util.SqlExec(db, "CALL sheetTransformSetClashChangeRedId(?, ?)", st.Id, regId); err != nil {
-						errChan <- err
-						return
-					} else {
-						st.ClashChangeRegId = regId
-						errChan <- nil
-						return
-					}
-				}
-			}(st)
-		}
-	}
-	timeOutChan := time.After(registrationTimeOut)
-	for registrationsCount > 0 {
-		timedOut := false
-		select {
-		case err := <-errChan:
-			registrationsCount--
-			if err != nil {
-				lastErr = err
-			}
-		case <-timeOutChan:
-			log.Warning("ClashChangeSheetRegistrarion timed out after %v with %d open requests awaiting response", registrationTimeOut, registrationsCount)
-			timedOut = true
-		}
-		if timedOut {
-			break
-		}
-	}
-	return lastErr
-}
-
-func registerAnyUnregisteredClashTests(forUser string, sheetTransforms []*SheetTransform, clashRegistrationTimeOut time.Duration, db *sql.DB, caca caca.CacaClient, log golog.Log) error {
-	registrationsCount := 0
-	var lastErr error
-	errChan := make(chan error)
-	for i := 0; i < len(sheetTransforms)-1; i++ {
-		for j := i + 1; j < len(sheetTransforms); j++ {
-			registrationsCount++
-			go func(leftSheetTransform *SheetTransform, rightSheetTransform *SheetTransform) {
-				if clashTestId, err := _clashTestGetter(db, leftSheetTransform.Id, rightSheetTransform.Id); err != nil {
-					errChan <- err
-					return
-				} else if clashTestId == "" {
-					if clashTestId, err := caca.RegisterClashTest(util.IdToUuidFormat(leftSheetTransform.ClashChangeRegId), util.IdToUuidFormat(rightSheetTransform.ClashChangeRegId)); err != nil {
-						errChan <- err
-						return
-					} else {
-						clashTestId = strings.Replace(clashTestId, "-", "", -1)
-						errChan <- util.SqlExec(db, "CALL clashTestCreate(?, ?, ?, ?)", forUser, clashTestId, leftSheetTransform.Id, rightSheetTransform.Id)
-					}
-				} else {
-					errChan <- nil
-				}
-			}(sheetTransforms[i], sheetTransforms[j])
-		}
-	}
-	timeOutChan := time.After(clashRegistrationTimeOut)
-	for registrationsCount > 0 {
-		timedOut := false
-		select {
-		case err := <-errChan:
-			registrationsCount--
-			if err != nil {
-				lastErr = err
-			}
-		case <-timeOutChan:
-			log.Warning("ClashTestRegistrarion timed out after %v with %d open requests awaiting response", clashRegistrationTimeOut, registrationsCount)
-			timedOut = true
-		}
-		if timedOut {
-			break
-		}
-	}
-	return lastErr
-}
@@ -2,8 +2,12 @@ package sheettransform
 
 import (
 	"encoding/json"
+	"github.com/modelhub/caca"
+	"github.com/modelhub/core/util"
+	"github.com/robsix/golog"
 	sj "github.com/robsix/json"
 	"strings"
+	"time"
 )
 
 func getSheetTransformHashJson(st *SheetTransform) (string, error) {
@@ -106,3 +110,93 @@ func isDefaultRotate(q *Quaternion) bool {
 func isDefaultTranslate(v *Vector3) bool {
 	return v.X == 0 && v.Y == 0 && v.Z == 0
 }
+
+func registerAnyUnregisteredSheetTransforms(sheetTransforms []*SheetTransform, registrationTimeOut time.Duration, setClashChangeRegId func(sheetTransform string, clashChangeRegId string) error, caca caca.CacaClient, log golog.Log) error {
+	registrationsCount := 0
+	var lastErr error
+	errChan := make(chan error)
+	for _, st := range sheetTransforms {
+		if st.ClashChangeRegId == util.EmptyUuid {
+			registrationsCount++
+			go func(st *SheetTransform) {
+				if regId, err := caca.RegisterSheet(st.BaseUrn + st.Manifest); err != nil {
+					errChan <- err
+					return
+				} else {
+					regId = strings.Replace(regId, "-", "", -1)
+					if err := setClashChangeRegId(st.Id, regId); err != nil {
+						errChan <- err
+						return
+					} else {
+						st.ClashChangeRegId = regId
+						errChan <- nil
+						return
+					}
+				}
+			}(st)
+		}
+	}
+	timeOutChan := time.After(registrationTimeOut)
+	for registrationsCount > 0 {
+		timedOut := false
+		select {
+		case err := <-errChan:
+			registrationsCount--
+			if err != nil {
+				lastErr = err
+			}
+		case <-timeOutChan:
+			log.Warning("ClashChangeSheetRegistrarion timed out after %v with %d open requests awaiting response", registrationTimeOut, registrationsCount)
+			timedOut = true
+		}
+		if timedOut {
+			break
+		}
+	}
+	return lastErr
+}
+
+func registerAnyUnregisteredClashTests(forUser string, sheetTransforms []*SheetTransform, clashRegistrationTimeOut time.Duration, getClashTest func(leftSheetTransform string, rightSheetTransform string) (string, error), createClashTest func(forUser string, clashTestId string, leftSheetTransform string, rightSheetTransform string) error, caca caca.CacaClient, log golog.Log) error {
+	registrationsCount := 0
+	var lastErr error
+	errChan := make(chan error)
+	for i := 0; i < len(sheetTransforms)-1; i++ {
+		for j := i + 1; j < len(sheetTransforms); j++ {
+			registrationsCount++
+			go func(leftSheetTransform *SheetTransform, rightSheetTransform *SheetTransform) {
+				if clashTestId, err := getClashTest(leftSheetTransform.Id, rightSheetTransform.Id); err != nil {
+					errChan <- err
+					return
+				} else if clashTestId == "" {
+					if clashTestId, err := caca.RegisterClashTest(util.IdToUuidFormat(leftSheetTransform.ClashChangeRegId), util.IdToUuidFormat(rightSheetTransform.ClashChangeRegId)); err != nil {
+						errChan <- err
+						return
+					} else {
+						clashTestId = strings.Replace(clashTestId, "-", "", -1)
+						errChan <- createClashTest(forUser, clashTestId, leftSheetTransform.Id, rightSheetTransform.Id)
+					}
+				} else {
+					errChan <- nil
+				}
+			}(sheetTransforms[i], sheetTransforms[j])
+		}
+	}
+	timeOutChan := time.After(clashRegistrationTimeOut)
+	for registrationsCount > 0 {
+		timedOut := false
+		select {
+		case err := <-errChan:
+			registrationsCount--
+			if err != nil {
+				lastErr = err
+			}
+		case <-timeOutChan:
+			log.Warning("ClashTestRegistrarion timed out after %v with %d open requests awaiting response", clashRegistrationTimeOut, registrationsCount)
+			timedOut = true
+		}
+		if timedOut {
+			break
+		}
+	}
+	return lastErr
+}
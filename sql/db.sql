@@ -1,3 +1,5 @@
+# Requires MySQL 8.0 or later for recursive common table expressions (WITH RECURSIVE) and JSON_EXTRACT.
+
 DROP DATABASE IF EXISTS modelhub;
 CREATE DATABASE modelhub;
 USE modelhub;
@@ -178,17 +180,58 @@ CREATE TABLE treeNode(
     project BINARY(16) NOT NULL,
     name VARCHAR(250) NOT NULL,
     nodeType VARCHAR(50) NOT NULL,
+    trash BINARY(16) NULL,
+    created DATETIME NOT NULL,
+    createdBy BINARY(16) NOT NULL,
+    modified DATETIME NOT NULL,
+    modifiedBy BINARY(16) NOT NULL,
     PRIMARY KEY (project, id),
     UNIQUE INDEX (parent, nodeType, id),
     UNIQUE INDEX (nodeType, project, id),
     UNIQUE INDEX (id),
+    INDEX (trash),
     FULLTEXT (name),
     FOREIGN KEY (project) REFERENCES project(id) ON DELETE CASCADE,
     FOREIGN KEY (parent) REFERENCES treeNode(id) ON DELETE CASCADE,
     FOREIGN KEY (nodeType) REFERENCES treeNodeType(id) ON DELETE CASCADE
 );
-INSERT INTO treeNode (id, parent, project, name, nodeType)
-VALUES (UNHEX('00000000000000000000000000000000'), NULL, UNHEX('00000000000000000000000000000000'), '', 'folder');
+INSERT INTO treeNode (id, parent, project, name, nodeType, created, createdBy, modified, modifiedBy)
+VALUES (UNHEX('00000000000000000000000000000000'), NULL, UNHEX('00000000000000000000000000000000'), '', 'folder', UTC_TIMESTAMP(), UNHEX('00000000000000000000000000000000'), UTC_TIMESTAMP(), UNHEX('00000000000000000000000000000000'));
+
+DROP TABLE IF EXISTS treeNodeTrash;
+CREATE TABLE treeNodeTrash(
+	id BINARY(16) NOT NULL,
+    project BINARY(16) NOT NULL,
+    parent BINARY(16) NOT NULL,
+    deleted DATETIME NOT NULL,
+    deletedBy BINARY(16) NOT NULL,
+    PRIMARY KEY (project, deleted, id),
+    UNIQUE INDEX (id),
+    INDEX (deleted),
+    FOREIGN KEY (id) REFERENCES treeNode(id) ON DELETE CASCADE,
+    FOREIGN KEY (project) REFERENCES project(id) ON DELETE CASCADE,
+    FOREIGN KEY (deletedBy) REFERENCES user(id) ON DELETE CASCADE
+);
+
+DROP TABLE IF EXISTS treeNodePropertyDefinition;
+CREATE TABLE treeNodePropertyDefinition(
+	project BINARY(16) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    propertyType VARCHAR(50) NOT NULL,
+    PRIMARY KEY (project, name),
+    FOREIGN KEY (project) REFERENCES project(id) ON DELETE CASCADE
+);
+
+DROP TABLE IF EXISTS treeNodeProperty;
+CREATE TABLE treeNodeProperty(
+	treeNode BINARY(16) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    value VARCHAR(1000) NOT NULL,
+    numberValue DOUBLE NULL,
+    PRIMARY KEY (treeNode, name),
+    INDEX (name, value(100)),
+    FOREIGN KEY (treeNode) REFERENCES treeNode(id) ON DELETE CASCADE
+);
 
 DROP TABLE IF EXISTS documentVersion;
 CREATE TABLE documentVersion(
@@ -204,13 +247,35 @@ CREATE TABLE documentVersion(
     urn VARCHAR(1000) NOT NULL,
     status VARCHAR(50) NOT NULL,
     thumbnailType VARCHAR(50) NOT NULL,
+    retryCount TINYINT UNSIGNED NOT NULL,
+    lastError VARCHAR(1000) NOT NULL,
+    nextRetry DATETIME NULL,
+    progress VARCHAR(50) NOT NULL,
+    translationMessages TEXT NOT NULL,
+    contentHash CHAR(64) NOT NULL,
+    mimeType VARCHAR(100) NOT NULL,
+    imageInfo TEXT NOT NULL,
 	PRIMARY KEY (document, version, id),
     UNIQUE INDEX (id),
+    INDEX (status),
+    INDEX (urn(255)),
+    INDEX (project, contentHash),
     FOREIGN KEY (project) REFERENCES project(id) ON DELETE CASCADE,
     FOREIGN KEY (document) REFERENCES treeNode(id) ON DELETE CASCADE,
     FOREIGN KEY (uploadedBy) REFERENCES user(id) ON DELETE CASCADE
 );
 
+DROP TABLE IF EXISTS documentVersionDeleted;
+CREATE TABLE documentVersionDeleted(
+	document BINARY(16) NOT NULL,
+    version MEDIUMINT NOT NULL,
+    deleted DATETIME NOT NULL,
+    deletedBy BINARY(16) NOT NULL,
+	PRIMARY KEY (document, version),
+    FOREIGN KEY (document) REFERENCES treeNode(id) ON DELETE CASCADE,
+    FOREIGN KEY (deletedBy) REFERENCES user(id) ON DELETE CASCADE
+);
+
 DROP TABLE IF EXISTS projectSpaceVersion;
 CREATE TABLE projectSpaceVersion(
 	id BINARY(16) NOT NULL,
@@ -242,7 +307,7 @@ CREATE TABLE sheet(
 	PRIMARY KEY (documentVersion, id),
     UNIQUE INDEX (id),
     UNIQUE INDEX (project, id),
-    UNIQUE INDEX (baseUrn, manifest),
+    UNIQUE INDEX (documentVersion, baseUrn, manifest),
     FULLTEXT(name),
     FOREIGN KEY (project) REFERENCES project(id) ON DELETE CASCADE,
     FOREIGN KEY (documentVersion) REFERENCES documentVersion(id) ON DELETE CASCADE
@@ -280,6 +345,37 @@ CREATE TABLE clashTest(
     FOREIGN KEY (rightSheetTransform) REFERENCES sheetTransform(id) ON DELETE CASCADE
 );
 
+DROP TABLE IF EXISTS uploadSession;
+CREATE TABLE uploadSession(
+	id BINARY(16) NOT NULL,
+    project BINARY(16) NOT NULL,
+    parent BINARY(16) NOT NULL,
+    createdBy BINARY(16) NOT NULL,
+    fileName VARCHAR(250) NOT NULL,
+    fileType VARCHAR(50) NOT NULL,
+    size BIGINT NOT NULL,
+    received BIGINT NOT NULL,
+    chunkCount INT NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    created DATETIME NOT NULL,
+    updated DATETIME NOT NULL,
+	PRIMARY KEY (id),
+    INDEX (createdBy, updated),
+    INDEX (updated),
+    FOREIGN KEY (project) REFERENCES project(id) ON DELETE CASCADE,
+    FOREIGN KEY (parent) REFERENCES treeNode(id) ON DELETE CASCADE,
+    FOREIGN KEY (createdBy) REFERENCES user(id) ON DELETE CASCADE
+);
+
+DROP TABLE IF EXISTS uploadSessionChunk;
+CREATE TABLE uploadSessionChunk(
+	uploadSession BINARY(16) NOT NULL,
+    chunkIndex INT NOT NULL,
+    id BINARY(16) NOT NULL,
+	PRIMARY KEY (uploadSession, chunkIndex),
+    FOREIGN KEY (uploadSession) REFERENCES uploadSession(id) ON DELETE CASCADE
+);
+
 # END TABLES
 
 # START PERMISSION
@@ -518,9 +614,9 @@ BEGIN
 	
     #create default root folder
 	INSERT INTO treeNode
-		(id, parent, project, name, nodeType)
+		(id, parent, project, name, nodeType, created, createdBy, modified, modifiedBy)
 	VALUES
-		(UNHEX(newProjectId), UNHEX('00000000000000000000000000000000'), UNHEX(newProjectId), 'root', 'folder');
+		(UNHEX(newProjectId), UNHEX('00000000000000000000000000000000'), UNHEX(newProjectId), 'root', 'folder', UTC_TIMESTAMP(), UNHEX(forUserId), UTC_TIMESTAMP(), UNHEX(forUserId));
         
 	# add in owner permission
 	INSERT INTO permission
@@ -995,13 +1091,13 @@ BEGIN
     DECLARE parentNodeType VARCHAR(50) DEFAULT NULL;
 	DECLARE forUserRole VARCHAR(50) DEFAULT NULL;
     
-    SELECT project, nodeType INTO projectId, parentNodeType FROM treeNode WHERE id = UNHEX(parentId);
+    SELECT project, nodeType INTO projectId, parentNodeType FROM treeNode WHERE id = UNHEX(parentId) AND trash IS NULL;
     
     IF parentNodeType = 'folder' THEN
         SET forUserRole = _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
 		IF (newNodeType = 'folder' AND forUserRole IN ('owner', 'admin', 'organiser')) OR (newNodeType != 'folder' AND forUserRole IN ('owner', 'admin', 'organiser', 'contributor')) THEN
-			INSERT INTO treeNode (id, parent, project, name, nodeType) VALUES (newTreeNodeId, UNHEX(parentId), projectId, newNodeName, newNodeType);
-			SELECT lex(newTreeNodeId) AS id, parentId AS parent, lex(projectId) AS project, newNodeName AS name, newNodeType AS nodeType, 0 as children;
+			INSERT INTO treeNode (id, parent, project, name, nodeType, created, createdBy, modified, modifiedBy) VALUES (newTreeNodeId, UNHEX(parentId), projectId, newNodeName, newNodeType, UTC_TIMESTAMP(), UNHEX(forUserId), UTC_TIMESTAMP(), UNHEX(forUserId));
+			SELECT lex(id) AS id, lex(parent) AS parent, lex(project) AS project, name, nodeType, 0 as children, created, lex(createdBy) AS createdBy, modified, lex(modifiedBy) AS modifiedBy, _treeNode_properties(id) AS properties FROM treeNode WHERE id = newTreeNodeId;
 		ELSE 
 			SIGNAL SQLSTATE 
 				'45002'
@@ -1030,11 +1126,11 @@ DELIMITER ;
 
 DROP PROCEDURE IF EXISTS treeNodeCreateDocument;
 DELIMITER $$
-CREATE PROCEDURE treeNodeCreateDocument(forUserId VARCHAR(32), parentId VARCHAR(32), documentName VARCHAR(250), documentVersionId VARCHAR(32), uploadComment VARCHAR(250), fileType VARCHAR(50), fileExtension VARCHAR(10), urn VARCHAR(1000), status VARCHAR(50), thumbnailType VARCHAR(50))
+CREATE PROCEDURE treeNodeCreateDocument(forUserId VARCHAR(32), parentId VARCHAR(32), documentName VARCHAR(250), documentVersionId VARCHAR(32), uploadComment VARCHAR(250), fileType VARCHAR(50), fileExtension VARCHAR(10), urn VARCHAR(1000), status VARCHAR(50), thumbnailType VARCHAR(50), contentHash CHAR(64), mimeType VARCHAR(100), imageInfo TEXT)
 BEGIN
     DECLARE newTreeNodeId BINARY(16) DEFAULT opUuid();
 	CALL _treeNode_createNode(forUserId, newTreeNodeId, parentId, documentName, 'document');
-    CALL documentVersionCreate(forUserId, lex(newTreeNodeId), documentVersionId, uploadComment, fileType, fileExtension, urn, status, thumbnailType);
+    CALL documentVersionCreate(forUserId, lex(newTreeNodeId), documentVersionId, uploadComment, fileType, fileExtension, urn, status, thumbnailType, contentHash, mimeType, imageInfo);
 END$$
 DELIMITER ;
 
@@ -1053,10 +1149,10 @@ DROP PROCEDURE IF EXISTS treeNodeSetName;
 DELIMITER $$
 CREATE PROCEDURE treeNodeSetName(forUserId VARCHAR(32), treeNodeId VARCHAR(32), newName VARCHAR(250))
 BEGIN
-	DECLARE projectId BINARY(16) DEFAULT (SELECT project FROM treeNode WHERE id = UNHEX(treeNodeId));
+	DECLARE projectId BINARY(16) DEFAULT (SELECT project FROM treeNode WHERE id = UNHEX(treeNodeId) AND trash IS NULL);
 	DECLARE forUserRole VARCHAR(50) DEFAULT _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
 	IF forUserRole IN ('owner', 'admin', 'organiser') AND UNHEX(treeNodeId) != projectId THEN
-		UPDATE treeNode SET name = newName WHERE id = UNHEX(treeNodeId);
+		UPDATE treeNode SET name = newName, modified = UTC_TIMESTAMP(), modifiedBy = UNHEX(forUserId) WHERE id = UNHEX(treeNodeId);
 	ELSE 
 		SIGNAL SQLSTATE 
 			'45002'
@@ -1067,6 +1163,109 @@ BEGIN
 END$$
 DELIMITER ;
 
+DROP FUNCTION IF EXISTS _treeNode_properties;
+DELIMITER $$
+CREATE FUNCTION _treeNode_properties(treeNodeId BINARY(16)) RETURNS TEXT NOT DETERMINISTIC
+BEGIN
+	RETURN (SELECT JSON_OBJECTAGG(name, value) FROM treeNodeProperty WHERE treeNode = treeNodeId);
+END$$
+DELIMITER ;
+
+DROP FUNCTION IF EXISTS _treeNode_propertiesMatch;
+DELIMITER $$
+CREATE FUNCTION _treeNode_propertiesMatch(treeNodeId BINARY(16), propertyFilters VARCHAR(5000)) RETURNS BOOL NOT DETERMINISTIC
+BEGIN
+	IF propertyFilters IS NULL OR propertyFilters = '' OR JSON_LENGTH(propertyFilters) = 0 THEN
+		RETURN TRUE;
+	END IF;
+	RETURN (SELECT COUNT(*) FROM treeNodeProperty WHERE treeNode = treeNodeId AND JSON_UNQUOTE(JSON_EXTRACT(propertyFilters, CONCAT('$."', name, '"'))) = value) = JSON_LENGTH(propertyFilters);
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeSetPropertyDefinition;
+DELIMITER $$
+CREATE PROCEDURE treeNodeSetPropertyDefinition(forUserId VARCHAR(32), projectId VARCHAR(32), propertyName VARCHAR(50), newPropertyType VARCHAR(50))
+BEGIN
+	IF _permission_getRole(UNHEX(forUserId), UNHEX(projectId), UNHEX(forUserId)) IN ('owner', 'admin') THEN
+		IF (SELECT propertyType FROM treeNodePropertyDefinition WHERE project = UNHEX(projectId) AND name = propertyName) != newPropertyType THEN
+			DELETE tp FROM treeNodeProperty AS tp INNER JOIN treeNode AS tn ON tp.treeNode = tn.id WHERE tn.project = UNHEX(projectId) AND tp.name = propertyName;
+		END IF;
+		INSERT INTO treeNodePropertyDefinition (project, name, propertyType) VALUES (UNHEX(projectId), propertyName, newPropertyType) ON DUPLICATE KEY UPDATE propertyType = newPropertyType;
+	ELSE 
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: treeNode set property definition',
+			MYSQL_ERRNO = 45002;
+	END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeRemovePropertyDefinition;
+DELIMITER $$
+CREATE PROCEDURE treeNodeRemovePropertyDefinition(forUserId VARCHAR(32), projectId VARCHAR(32), propertyName VARCHAR(50))
+BEGIN
+	IF _permission_getRole(UNHEX(forUserId), UNHEX(projectId), UNHEX(forUserId)) IN ('owner', 'admin') THEN
+		DELETE tp FROM treeNodeProperty AS tp INNER JOIN treeNode AS tn ON tp.treeNode = tn.id WHERE tn.project = UNHEX(projectId) AND tp.name = propertyName;
+		DELETE FROM treeNodePropertyDefinition WHERE project = UNHEX(projectId) AND name = propertyName;
+	ELSE 
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: treeNode remove property definition',
+			MYSQL_ERRNO = 45002;
+	END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeGetPropertyDefinitions;
+DELIMITER $$
+CREATE PROCEDURE treeNodeGetPropertyDefinitions(forUserId VARCHAR(32), projectId VARCHAR(32))
+BEGIN
+	IF _permission_getRole(UNHEX(forUserId), UNHEX(projectId), UNHEX(forUserId)) IS NOT NULL THEN
+		SELECT lex(project) AS project, name, propertyType FROM treeNodePropertyDefinition WHERE project = UNHEX(projectId) ORDER BY name ASC;
+	ELSE 
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: treeNode get property definitions',
+			MYSQL_ERRNO = 45002;
+	END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeSetProperties;
+DELIMITER $$
+CREATE PROCEDURE treeNodeSetProperties(forUserId VARCHAR(32), treeNodeId VARCHAR(32), properties VARCHAR(5000))
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT NULL;
+    DECLARE treeNodeType VARCHAR(50) DEFAULT NULL;
+    
+    SELECT project, nodeType INTO projectId, treeNodeType FROM treeNode WHERE id = UNHEX(treeNodeId) AND trash IS NULL;
+    
+	IF _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId)) IN ('owner', 'admin', 'organiser', 'contributor') THEN
+		IF treeNodeType IN ('document', 'projectSpace') THEN
+			INSERT INTO treeNodeProperty (treeNode, name, value, numberValue) SELECT UNHEX(treeNodeId), d.name, JSON_UNQUOTE(JSON_EXTRACT(properties, CONCAT('$."', d.name, '"'))), IF(d.propertyType = 'number', CAST(JSON_UNQUOTE(JSON_EXTRACT(properties, CONCAT('$."', d.name, '"'))) AS DECIMAL(65, 15)), NULL) FROM treeNodePropertyDefinition AS d WHERE d.project = projectId AND JSON_UNQUOTE(JSON_EXTRACT(properties, CONCAT('$."', d.name, '"'))) != ''
+			ON DUPLICATE KEY UPDATE value = VALUES(value), numberValue = VALUES(numberValue);
+			DELETE FROM treeNodeProperty WHERE treeNode = UNHEX(treeNodeId) AND JSON_UNQUOTE(JSON_EXTRACT(properties, CONCAT('$."', name, '"'))) = '';
+			UPDATE treeNode SET modified = UTC_TIMESTAMP(), modifiedBy = UNHEX(forUserId) WHERE id = UNHEX(treeNodeId);
+		ELSE
+			SIGNAL SQLSTATE 
+				'45003'
+			SET
+				MESSAGE_TEXT = 'Invalid action: set properties on a none document or projectSpace treeNode',
+				MYSQL_ERRNO = 45003;
+		END IF;
+	ELSE 
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: treeNode set properties',
+			MYSQL_ERRNO = 45002;
+	END IF;
+END$$
+DELIMITER ;
+
 DROP PROCEDURE IF EXISTS treeNodeMove;
 DELIMITER $$
 CREATE PROCEDURE treeNodeMove(forUserId VARCHAR(32), newParentId VARCHAR(32), treeNodes VARCHAR(3300))
@@ -1086,14 +1285,14 @@ BEGIN
 		PRIMARY KEY (id)
 	);
     
-    SELECT project, parent, nodeType INTO projectId, currentParent, newParentNodeType FROM treeNode WHERE id = UNHEX(newParentId);
+    SELECT project, parent, nodeType INTO projectId, currentParent, newParentNodeType FROM treeNode WHERE id = UNHEX(newParentId) AND trash IS NULL;
     SET forUserRole = _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
     
 	IF forUserRole IN ('owner', 'admin', 'organiser') THEN
 		IF newParentNodeType = 'folder' THEN
 			IF createTempIdsTable(treeNodes) THEN
 				SELECT COUNT(*) INTO treeNodesCount FROM tempIds;
-                SELECT COUNT(*) INTO treeNodesInSameProjectCount FROM treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id WHERE tn.project = projectId;
+                SELECT COUNT(*) INTO treeNodesInSameProjectCount FROM treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id WHERE tn.project = projectId AND tn.trash IS NULL;
 				IF treeNodesCount = treeNodesInSameProjectCount THEN
 					IF (SELECT COUNT(*) FROM treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id WHERE tn.id = tn.project) = 0 THEN
 						INSERT INTO tempTreeNodeMoveParents (id) VALUES (UNHEX(newParentId));
@@ -1103,7 +1302,7 @@ BEGIN
 						END WHILE;
                         
                         IF (SELECT COUNT(*) FROM tempIds AS t INNER JOIN tempTreeNodeMoveParents AS tp ON t.id = tp.id) = 0 THEN
-							UPDATE treeNode SET parent = UNHEX(newParentId) WHERE id IN (SELECT id FROM tempIds);
+							UPDATE treeNode SET parent = UNHEX(newParentId), modified = UTC_TIMESTAMP(), modifiedBy = UNHEX(forUserId) WHERE id IN (SELECT id FROM tempIds);
 						ELSE
 							SIGNAL SQLSTATE 
 								'45003'
@@ -1145,124 +1344,822 @@ BEGIN
 END$$
 DELIMITER ;
 
-DROP PROCEDURE IF EXISTS treeNodeGet;
+DROP PROCEDURE IF EXISTS _treeNode_createTempMoveTables;
 DELIMITER $$
-CREATE PROCEDURE treeNodeGet(forUserId VARCHAR(32), treeNodes VARCHAR(3300))
+CREATE PROCEDURE _treeNode_createTempMoveTables()
+BEGIN
+	DECLARE currentId BINARY(16) DEFAULT NULL;
+    
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodeMoveSubtree;
+	CREATE TEMPORARY TABLE tempTreeNodeMoveSubtree(
+		id BINARY(16) NOT NULL,
+		PRIMARY KEY (id)
+	);
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodeMoveSubtreeCheck;
+	CREATE TEMPORARY TABLE tempTreeNodeMoveSubtreeCheck(
+		id BINARY(16) NOT NULL,
+		PRIMARY KEY (id)
+	);
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodeMoveBlobs;
+	CREATE TEMPORARY TABLE tempTreeNodeMoveBlobs(
+		name VARCHAR(100) NOT NULL
+	);
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodeMoveRoots;
+	CREATE TEMPORARY TABLE tempTreeNodeMoveRoots(
+		id BINARY(16) NOT NULL,
+		PRIMARY KEY (id)
+	);
+    
+	INSERT INTO tempTreeNodeMoveRoots (id) SELECT id FROM tempIds;
+	WHILE (SELECT COUNT(*) FROM tempTreeNodeMoveRoots) > 0 DO
+		SELECT id INTO currentId FROM tempTreeNodeMoveRoots LIMIT 1;
+		CALL _treeNode_createTempSubtreeTable(currentId);
+		INSERT IGNORE INTO tempTreeNodeMoveSubtree (id) SELECT id FROM tempTreeNodeSubtree;
+		DROP TEMPORARY TABLE IF EXISTS tempTreeNodeSubtree;
+		DELETE FROM tempTreeNodeMoveRoots WHERE id = currentId;
+	END WHILE;
+	INSERT INTO tempTreeNodeMoveSubtreeCheck (id) SELECT id FROM tempTreeNodeMoveSubtree;
+    
+	INSERT INTO tempTreeNodeMoveBlobs (name) SELECT CONCAT(lex(dv.id), '.', dv.fileExtension) FROM documentVersion AS dv INNER JOIN tempTreeNodeMoveSubtree AS ms ON dv.document = ms.id;
+	INSERT INTO tempTreeNodeMoveBlobs (name) SELECT CONCAT(lex(dv.id), '.tn.tn') FROM documentVersion AS dv INNER JOIN tempTreeNodeMoveSubtree AS ms ON dv.document = ms.id WHERE dv.thumbnailType != '';
+	INSERT INTO tempTreeNodeMoveBlobs (name) SELECT CONCAT(lex(s.documentVersion), '.page.', SUBSTRING_INDEX(s.manifest, '/', -1), '.tn') FROM sheet AS s INNER JOIN documentVersion AS dv ON s.documentVersion = dv.id INNER JOIN tempTreeNodeMoveSubtree AS ms ON dv.document = ms.id WHERE s.role = 'pdf' AND s.thumbnails != '';
+	INSERT INTO tempTreeNodeMoveBlobs (name) SELECT CONCAT(lex(psv.id), '.tn.tn') FROM projectSpaceVersion AS psv INNER JOIN tempTreeNodeMoveSubtree AS ms ON psv.projectSpace = ms.id WHERE psv.thumbnailType != '';
+    
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodeMoveRoots;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS _treeNode_dropTempMoveTables;
+DELIMITER $$
+CREATE PROCEDURE _treeNode_dropTempMoveTables()
+BEGIN
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodeMoveSubtree;
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodeMoveSubtreeCheck;
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodeMoveBlobs;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeGetBlobs;
+DELIMITER $$
+CREATE PROCEDURE treeNodeGetBlobs(forUserId VARCHAR(32), treeNodes VARCHAR(3300))
 BEGIN
 	DECLARE projectId BINARY(16) DEFAULT NULL;
-    DECLARE distinctProjectsCount INT DEFAULT 0;
+	DECLARE treeNodesCount INT DEFAULT 0;
+    DECLARE treeNodesInSameProjectCount INT DEFAULT 0;
     
 	IF createTempIdsTable(treeNodes) THEN
-		SELECT project INTO projectId FROM treeNode WHERE id = (SELECT id FROM tempIds LIMIT 1);
-        SELECT COUNT(DISTINCT project) INTO distinctProjectsCount FROM treeNode AS dv INNER JOIN tempIds AS t ON dv.id = t.id;
-        IF distinctProjectsCount = 1 AND projectId IS NOT NULL AND _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId)) IS NOT NULL THEN
-			SELECT lex(tn1.id) AS id, lex(tn1.parent) AS parent, lex(tn1.project) AS project, name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount FROM treeNode AS tn1 INNER JOIN tempIds AS t ON tn1.id = t.id;
-        ELSE
+		SELECT project INTO projectId FROM treeNode WHERE id = (SELECT id FROM tempIds LIMIT 1) AND trash IS NULL;
+		IF _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId)) IN ('owner', 'admin', 'organiser') THEN
+			SELECT COUNT(*) INTO treeNodesCount FROM tempIds;
+			SELECT COUNT(*) INTO treeNodesInSameProjectCount FROM treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id WHERE tn.project = projectId AND tn.trash IS NULL;
+			IF treeNodesCount = treeNodesInSameProjectCount THEN
+				CALL _treeNode_createTempMoveTables();
+				SELECT name FROM tempTreeNodeMoveBlobs;
+				CALL _treeNode_dropTempMoveTables();
+			ELSE
+				SIGNAL SQLSTATE 
+					'45002'
+				SET
+					MESSAGE_TEXT = 'Unauthorized action: treeNode cross project get blobs',
+					MYSQL_ERRNO = 45002;
+			END IF;
+		ELSE 
 			SIGNAL SQLSTATE 
 				'45002'
 			SET
-				MESSAGE_TEXT = 'Unauthorized action: treeNode get cross project',
+				MESSAGE_TEXT = 'Unauthorized action: treeNode get blobs',
 				MYSQL_ERRNO = 45002;
-        END IF;		
-    END IF;
+		END IF;
+	END IF;
     DROP TEMPORARY TABLE IF EXISTS tempIds;
 END$$
 DELIMITER ;
 
-DROP PROCEDURE IF EXISTS treeNodeGetChildren;
+DROP PROCEDURE IF EXISTS treeNodeMoveAcrossProjects;
 DELIMITER $$
-CREATE PROCEDURE treeNodeGetChildren(forUserId VARCHAR(32), parentId VARCHAR(32), childNodeType VARCHAR(50), os INT, l INT, sortBy VARCHAR(50))
+CREATE PROCEDURE treeNodeMoveAcrossProjects(forUserId VARCHAR(32), newParentId VARCHAR(32), treeNodes VARCHAR(3300))
 BEGIN
-	DECLARE projectId BINARY(16) DEFAULT NULL;
-    DECLARE parentNodeType VARCHAR(50) DEFAULT NULL;
-	DECLARE forUserRole VARCHAR(50) DEFAULT NULL;
-    DECLARE totalResults INT DEFAULT 0;
-    
-	IF os < 0 THEN
-		SET os = 0;
-	END IF;
+	DECLARE fromProjectId BINARY(16) DEFAULT NULL;
+	DECLARE toProjectId BINARY(16) DEFAULT NULL;
+    DECLARE newParentNodeType VARCHAR(50) DEFAULT NULL;
+	DECLARE treeNodesCount INT DEFAULT 0;
+    DECLARE treeNodesInSameProjectCount INT DEFAULT 0;
+	DECLARE EXIT HANDLER FOR SQLEXCEPTION
+	BEGIN
+		ROLLBACK;
+		RESIGNAL;
+	END;
     
-	IF l < 0 THEN
-		SET l = 0;
-	END IF;
+    SELECT project, nodeType INTO toProjectId, newParentNodeType FROM treeNode WHERE id = UNHEX(newParentId) AND trash IS NULL;
     
-	IF l > 100 THEN
-		SET l = 100;
+	IF createTempIdsTable(treeNodes) THEN
+		SELECT project INTO fromProjectId FROM treeNode WHERE id = (SELECT id FROM tempIds LIMIT 1) AND trash IS NULL;
+		IF _permission_getRole(UNHEX(forUserId), toProjectId, UNHEX(forUserId)) IN ('owner', 'admin', 'organiser') AND _permission_getRole(UNHEX(forUserId), fromProjectId, UNHEX(forUserId)) IN ('owner', 'admin', 'organiser') THEN
+			IF newParentNodeType = 'folder' THEN
+				SELECT COUNT(*) INTO treeNodesCount FROM tempIds;
+				SELECT COUNT(*) INTO treeNodesInSameProjectCount FROM treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id WHERE tn.project = fromProjectId AND tn.trash IS NULL;
+				IF treeNodesCount = treeNodesInSameProjectCount AND fromProjectId != toProjectId THEN
+					IF (SELECT COUNT(*) FROM treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id WHERE tn.id = tn.project) = 0 THEN
+						CALL _treeNode_createTempMoveTables();
+                        
+						IF (SELECT COUNT(*) FROM projectSpaceVersion AS psv INNER JOIN tempTreeNodeMoveSubtree AS ms ON psv.projectSpace = ms.id INNER JOIN projectSpaceVersionSheetTransform AS pst ON psv.id = pst.projectSpaceVersion INNER JOIN sheetTransform AS st ON pst.sheetTransform = st.id INNER JOIN sheet AS s ON st.sheet = s.id INNER JOIN documentVersion AS dv ON s.documentVersion = dv.id LEFT JOIN tempTreeNodeMoveSubtreeCheck AS msc ON dv.document = msc.id WHERE msc.id IS NULL) > 0
+						OR (SELECT COUNT(*) FROM projectSpaceVersion AS psv LEFT JOIN tempTreeNodeMoveSubtree AS ms ON psv.projectSpace = ms.id INNER JOIN projectSpaceVersionSheetTransform AS pst ON psv.id = pst.projectSpaceVersion INNER JOIN sheetTransform AS st ON pst.sheetTransform = st.id INNER JOIN sheet AS s ON st.sheet = s.id INNER JOIN documentVersion AS dv ON s.documentVersion = dv.id INNER JOIN tempTreeNodeMoveSubtreeCheck AS msc ON dv.document = msc.id WHERE psv.project = fromProjectId AND ms.id IS NULL) > 0 THEN
+							SIGNAL SQLSTATE 
+								'45003'
+							SET
+								MESSAGE_TEXT = 'Invalid action: treeNode cross project move would split a projectSpace from its sheets',
+								MYSQL_ERRNO = 45003;
+						END IF;
+                        
+						START TRANSACTION;
+						DELETE tp FROM treeNodeProperty AS tp INNER JOIN tempTreeNodeMoveSubtree AS ms ON tp.treeNode = ms.id INNER JOIN treeNodePropertyDefinition AS fd ON fd.project = fromProjectId AND fd.name = tp.name LEFT JOIN treeNodePropertyDefinition AS td ON td.project = toProjectId AND td.name = fd.name AND td.propertyType = fd.propertyType WHERE td.name IS NULL;
+						UPDATE treeNode AS tn INNER JOIN tempTreeNodeMoveSubtree AS ms ON tn.id = ms.id SET tn.project = toProjectId;
+						UPDATE treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id SET tn.parent = UNHEX(newParentId), tn.modified = UTC_TIMESTAMP(), tn.modifiedBy = UNHEX(forUserId);
+						UPDATE documentVersion AS dv INNER JOIN tempTreeNodeMoveSubtree AS ms ON dv.document = ms.id SET dv.project = toProjectId;
+						UPDATE sheet AS s INNER JOIN documentVersion AS dv ON s.documentVersion = dv.id INNER JOIN tempTreeNodeMoveSubtreeCheck AS msc ON dv.document = msc.id SET s.project = toProjectId;
+						UPDATE projectSpaceVersion AS psv INNER JOIN tempTreeNodeMoveSubtree AS ms ON psv.projectSpace = ms.id SET psv.project = toProjectId;
+						COMMIT;
+                        
+						SELECT name FROM tempTreeNodeMoveBlobs;
+						CALL _treeNode_dropTempMoveTables();
+					ELSE
+						SIGNAL SQLSTATE 
+							'45003'
+						SET
+							MESSAGE_TEXT = 'Invalid action: treeNode move root folder',
+							MYSQL_ERRNO = 45003;
+					END IF;
+				ELSE
+					SIGNAL SQLSTATE 
+						'45002'
+					SET
+						MESSAGE_TEXT = 'Unauthorized action: treeNode cross project move',
+						MYSQL_ERRNO = 45002;
+				END IF;
+			ELSE
+				SIGNAL SQLSTATE 
+					'45003'
+				SET
+					MESSAGE_TEXT = 'Invalid action: place treeNodes under a none folder parent',
+					MYSQL_ERRNO = 45003;
+			END IF;
+		ELSE 
+			SIGNAL SQLSTATE 
+				'45002'
+			SET
+				MESSAGE_TEXT = 'Unauthorized action: treeNode move',
+				MYSQL_ERRNO = 45002;
+		END IF;
 	END IF;
+    DROP TEMPORARY TABLE IF EXISTS tempIds;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeCopy;
+DELIMITER $$
+CREATE PROCEDURE treeNodeCopy(forUserId VARCHAR(32), newParentId VARCHAR(32), treeNodes VARCHAR(3300), includeAllVersions BOOL)
+BEGIN
+	DECLARE fromProjectId BINARY(16) DEFAULT NULL;
+	DECLARE toProjectId BINARY(16) DEFAULT NULL;
+    DECLARE newParentNodeType VARCHAR(50) DEFAULT NULL;
+	DECLARE treeNodesCount INT DEFAULT 0;
+    DECLARE treeNodesInSameProjectCount INT DEFAULT 0;
+    DECLARE currentId BINARY(16) DEFAULT NULL;
+	DECLARE EXIT HANDLER FOR SQLEXCEPTION
+	BEGIN
+		ROLLBACK;
+		RESIGNAL;
+	END;
     
-    SELECT project, nodeType INTO projectId, parentNodeType FROM treeNode WHERE id = UNHEX(parentId);
-    SET forUserRole = _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
+    SELECT project, nodeType INTO toProjectId, newParentNodeType FROM treeNode WHERE id = UNHEX(newParentId) AND trash IS NULL;
     
-    IF parentNodeType = 'folder' THEN
-		IF forUserRole IS NOT NULL THEN
-			IF childNodeType = '' OR childNodeType = 'any' THEN
-				SELECT COUNT(*) INTO totalResults FROM treeNode WHERE parent = UNHEX(parentId);
-			ELSE
-				SELECT COUNT(*) INTO totalResults FROM treeNode WHERE parent = UNHEX(parentId) AND nodeType = childNodeType;
-			END IF;
-            
-			IF os >= totalResults OR l = 0 THEN
-				SELECT totalResults;
-            ELSE IF sortBy = 'nameDesc' THEN
-				IF childNodeType = '' OR childNodeType = 'any' THEN
-					SELECT totalResults, lex(tn1.id) AS id, lex(tn1.parent) AS parent, lex(tn1.project) AS project, name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount FROM treeNode AS tn1 WHERE tn1.parent = UNHEX(parentId) ORDER BY name DESC LIMIT os, l;
-				ELSE
-					SELECT totalResults, lex(tn1.id) AS id, lex(tn1.parent) AS parent, lex(tn1.project) AS project, name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount FROM treeNode AS tn1 WHERE tn1.parent = UNHEX(parentId) AND tn1.nodeType = childNodeType ORDER BY name DESC LIMIT os, l;
+    IF newParentNodeType = 'folder' THEN
+		IF _permission_getRole(UNHEX(forUserId), toProjectId, UNHEX(forUserId)) IN ('owner', 'admin', 'organiser') THEN
+			IF createTempIdsTable(treeNodes) THEN
+				SELECT project INTO fromProjectId FROM treeNode WHERE id = (SELECT id FROM tempIds LIMIT 1) AND trash IS NULL;
+				IF _permission_getRole(UNHEX(forUserId), fromProjectId, UNHEX(forUserId)) IN ('owner', 'admin', 'organiser', 'contributor') THEN
+					SELECT COUNT(*) INTO treeNodesCount FROM tempIds;
+					SELECT COUNT(*) INTO treeNodesInSameProjectCount FROM treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id WHERE tn.project = fromProjectId AND tn.trash IS NULL;
+					IF treeNodesCount = treeNodesInSameProjectCount THEN
+						IF (SELECT COUNT(*) FROM treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id WHERE tn.id = tn.project) = 0 THEN
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopy;
+							CREATE TEMPORARY TABLE tempTreeNodeCopy(
+								id BINARY(16) NOT NULL,
+								newId BINARY(16) NOT NULL,
+								depth INT NOT NULL,
+								root BINARY(16) NOT NULL,
+								PRIMARY KEY (id),
+								INDEX (root, depth)
+							);
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopyParents;
+							CREATE TEMPORARY TABLE tempTreeNodeCopyParents(
+								id BINARY(16) NOT NULL,
+								newId BINARY(16) NOT NULL,
+								PRIMARY KEY (id)
+							);
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopyDocumentVersions;
+							CREATE TEMPORARY TABLE tempTreeNodeCopyDocumentVersions(
+								id BINARY(16) NOT NULL,
+								newId BINARY(16) NOT NULL,
+								PRIMARY KEY (id)
+							);
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopyProjectSpaceVersions;
+							CREATE TEMPORARY TABLE tempTreeNodeCopyProjectSpaceVersions(
+								id BINARY(16) NOT NULL,
+								newId BINARY(16) NOT NULL,
+								PRIMARY KEY (id)
+							);
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopySheets;
+							CREATE TEMPORARY TABLE tempTreeNodeCopySheets(
+								id BINARY(16) NOT NULL,
+								newId BINARY(16) NOT NULL,
+								PRIMARY KEY (id)
+							);
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopySheetTransforms;
+							CREATE TEMPORARY TABLE tempTreeNodeCopySheetTransforms(
+								id BINARY(16) NOT NULL,
+								newId BINARY(16) NOT NULL,
+								PRIMARY KEY (id)
+							);
+                            
+							START TRANSACTION;
+                            
+							WHILE (SELECT COUNT(*) FROM tempIds) > 0 DO
+								SELECT id INTO currentId FROM tempIds LIMIT 1;
+								IF (SELECT COUNT(*) FROM tempTreeNodeCopy WHERE id = currentId) = 0 THEN
+									CALL _treeNode_createTempSubtreeTable(currentId);
+									INSERT IGNORE INTO tempTreeNodeCopy (id, newId, depth, root) SELECT id, opUuid(), depth, currentId FROM tempTreeNodeSubtree;
+									INSERT IGNORE INTO tempTreeNodeCopyParents (id, newId) SELECT id, newId FROM tempTreeNodeCopy WHERE root = currentId;
+									INSERT INTO treeNode (id, parent, project, name, nodeType, created, createdBy, modified, modifiedBy) SELECT c.newId, IF(c.depth = 0, UNHEX(newParentId), p.newId), toProjectId, tn.name, tn.nodeType, UTC_TIMESTAMP(), UNHEX(forUserId), UTC_TIMESTAMP(), UNHEX(forUserId) FROM tempTreeNodeCopy AS c INNER JOIN treeNode AS tn ON c.id = tn.id LEFT JOIN tempTreeNodeCopyParents AS p ON tn.parent = p.id WHERE c.root = currentId ORDER BY c.depth ASC;
+									DROP TEMPORARY TABLE IF EXISTS tempTreeNodeSubtree;
+								END IF;
+								DELETE FROM tempIds WHERE id = currentId;
+							END WHILE;
+                            
+							INSERT INTO treeNodeProperty (treeNode, name, value, numberValue) SELECT c.newId, tp.name, tp.value, tp.numberValue FROM tempTreeNodeCopy AS c INNER JOIN treeNodeProperty AS tp ON c.id = tp.treeNode INNER JOIN treeNodePropertyDefinition AS fd ON fd.project = fromProjectId AND fd.name = tp.name INNER JOIN treeNodePropertyDefinition AS td ON td.project = toProjectId AND td.name = fd.name AND td.propertyType = fd.propertyType;
+                            
+							INSERT INTO tempTreeNodeCopyDocumentVersions (id, newId) SELECT dv.id, opUuid() FROM documentVersion AS dv INNER JOIN tempTreeNodeCopy AS c ON dv.document = c.id WHERE includeAllVersions OR dv.version = (SELECT MAX(version) FROM documentVersion WHERE document = dv.document);
+							INSERT INTO documentVersion (id, document, version, project, uploaded, uploadComment, uploadedBy, fileType, fileExtension, urn, status, thumbnailType, retryCount, lastError, nextRetry, progress, translationMessages, contentHash, mimeType, imageInfo) SELECT cdv.newId, c.newId, IF(includeAllVersions, dv.version, 1), toProjectId, dv.uploaded, dv.uploadComment, dv.uploadedBy, dv.fileType, dv.fileExtension, dv.urn, dv.status, dv.thumbnailType, dv.retryCount, dv.lastError, dv.nextRetry, dv.progress, dv.translationMessages, dv.contentHash, dv.mimeType, dv.imageInfo FROM tempTreeNodeCopyDocumentVersions AS cdv INNER JOIN documentVersion AS dv ON cdv.id = dv.id INNER JOIN tempTreeNodeCopy AS c ON dv.document = c.id;
+                            
+							INSERT INTO tempTreeNodeCopySheets (id, newId) SELECT s.id, opUuid() FROM sheet AS s INNER JOIN tempTreeNodeCopyDocumentVersions AS cdv ON s.documentVersion = cdv.id;
+							INSERT INTO sheet (id, documentVersion, project, name, baseUrn, manifest, thumbnails, role) SELECT cs.newId, cdv.newId, toProjectId, s.name, s.baseUrn, s.manifest, s.thumbnails, s.role FROM tempTreeNodeCopySheets AS cs INNER JOIN sheet AS s ON cs.id = s.id INNER JOIN tempTreeNodeCopyDocumentVersions AS cdv ON s.documentVersion = cdv.id;
+                            
+							INSERT INTO tempTreeNodeCopyProjectSpaceVersions (id, newId) SELECT psv.id, opUuid() FROM projectSpaceVersion AS psv INNER JOIN tempTreeNodeCopy AS c ON psv.projectSpace = c.id WHERE includeAllVersions OR psv.version = (SELECT MAX(version) FROM projectSpaceVersion WHERE projectSpace = psv.projectSpace);
+							INSERT INTO projectSpaceVersion (id, projectSpace, version, project, created, createComment, createdBy, thumbnailType, cameraJson) SELECT cpsv.newId, c.newId, IF(includeAllVersions, psv.version, 1), toProjectId, psv.created, psv.createComment, psv.createdBy, psv.thumbnailType, psv.cameraJson FROM tempTreeNodeCopyProjectSpaceVersions AS cpsv INNER JOIN projectSpaceVersion AS psv ON cpsv.id = psv.id INNER JOIN tempTreeNodeCopy AS c ON psv.projectSpace = c.id;
+                            
+							INSERT IGNORE INTO tempTreeNodeCopySheetTransforms (id, newId) SELECT st.id, opUuid() FROM projectSpaceVersionSheetTransform AS pst INNER JOIN tempTreeNodeCopyProjectSpaceVersions AS cpsv ON pst.projectSpaceVersion = cpsv.id INNER JOIN sheetTransform AS st ON pst.sheetTransform = st.id INNER JOIN tempTreeNodeCopySheets AS cs ON st.sheet = cs.id;
+							INSERT INTO sheetTransform (id, sheet, sheetTransformHashJson, clashChangeRegId) SELECT cst.newId, cs.newId, REPLACE(st.sheetTransformHashJson, lex(st.sheet), lex(cs.newId)), st.clashChangeRegId FROM tempTreeNodeCopySheetTransforms AS cst INNER JOIN sheetTransform AS st ON cst.id = st.id INNER JOIN tempTreeNodeCopySheets AS cs ON st.sheet = cs.id;
+                            
+							IF fromProjectId != toProjectId AND (SELECT COUNT(*) FROM projectSpaceVersionSheetTransform AS pst INNER JOIN tempTreeNodeCopyProjectSpaceVersions AS cpsv ON pst.projectSpaceVersion = cpsv.id LEFT JOIN tempTreeNodeCopySheetTransforms AS cst ON pst.sheetTransform = cst.id WHERE cst.id IS NULL) > 0 THEN
+								SIGNAL SQLSTATE 
+									'45003'
+								SET
+									MESSAGE_TEXT = 'Invalid action: treeNode cross project copy of projectSpace with sheets outside the copy',
+									MYSQL_ERRNO = 45003;
+							END IF;
+							INSERT INTO projectSpaceVersionSheetTransform (projectSpaceVersion, sheetTransform) SELECT cpsv.newId, IFNULL(cst.newId, pst.sheetTransform) FROM projectSpaceVersionSheetTransform AS pst INNER JOIN tempTreeNodeCopyProjectSpaceVersions AS cpsv ON pst.projectSpaceVersion = cpsv.id LEFT JOIN tempTreeNodeCopySheetTransforms AS cst ON pst.sheetTransform = cst.id;
+                            
+							COMMIT;
+                            
+							SELECT 'documentVersion' AS versionType, lex(cdv.id) AS fromId, lex(cdv.newId) AS toId, dv.fileType, dv.fileExtension, dv.urn, dv.status, dv.thumbnailType FROM tempTreeNodeCopyDocumentVersions AS cdv INNER JOIN documentVersion AS dv ON cdv.newId = dv.id
+							UNION ALL
+							SELECT 'projectSpaceVersion' AS versionType, lex(cpsv.id) AS fromId, lex(cpsv.newId) AS toId, '', '', '', '', psv.thumbnailType FROM tempTreeNodeCopyProjectSpaceVersions AS cpsv INNER JOIN projectSpaceVersion AS psv ON cpsv.newId = psv.id
+							UNION ALL
+							SELECT 'treeNode' AS versionType, lex(c.id) AS fromId, lex(c.newId) AS toId, '', '', '', '', '' FROM tempTreeNodeCopy AS c WHERE c.depth = 0;
+                            
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopy;
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopyParents;
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopyDocumentVersions;
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopyProjectSpaceVersions;
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopySheets;
+							DROP TEMPORARY TABLE IF EXISTS tempTreeNodeCopySheetTransforms;
+						ELSE
+							SIGNAL SQLSTATE 
+								'45003'
+							SET
+								MESSAGE_TEXT = 'Invalid action: treeNode copy root folder',
+								MYSQL_ERRNO = 45003;
+						END IF;
+					ELSE
+						SIGNAL SQLSTATE 
+							'45003'
+						SET
+							MESSAGE_TEXT = 'Invalid action: treeNode copy from multiple projects',
+							MYSQL_ERRNO = 45003;
+					END IF;
+				ELSE 
+					SIGNAL SQLSTATE 
+						'45002'
+					SET
+						MESSAGE_TEXT = 'Unauthorized action: treeNode copy',
+						MYSQL_ERRNO = 45002;
 				END IF;
-            ELSE
-				IF childNodeType = '' OR childNodeType = 'any' THEN
-					SELECT totalResults, lex(tn1.id) AS id, lex(tn1.parent) AS parent, lex(tn1.project) AS project, name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount FROM treeNode AS tn1 WHERE tn1.parent = UNHEX(parentId) ORDER BY name ASC LIMIT os, l;
-				ELSE
-					SELECT totalResults, lex(tn1.id) AS id, lex(tn1.parent) AS parent, lex(tn1.project) AS project, name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount FROM treeNode AS tn1 WHERE tn1.parent = UNHEX(parentId) AND tn1.nodeType = childNodeType ORDER BY name ASC LIMIT os, l;
-				END IF;			
-            END IF;
-            END IF;
+			END IF;
 		ELSE 
 			SIGNAL SQLSTATE 
 				'45002'
 			SET
-				MESSAGE_TEXT = 'Unauthorized action: treeNode get children',
+				MESSAGE_TEXT = 'Unauthorized action: treeNode copy',
 				MYSQL_ERRNO = 45002;
 		END IF;
 	ELSE
 		SIGNAL SQLSTATE 
 			'45003'
 		SET
-			MESSAGE_TEXT = 'Invalid action: get treeNodes from a none folder parent',
+			MESSAGE_TEXT = 'Invalid action: place treeNodes under a none folder parent',
             MYSQL_ERRNO = 45003;
 	END IF;
+    DROP TEMPORARY TABLE IF EXISTS tempIds;
 END$$
 DELIMITER ;
 
-DROP PROCEDURE IF EXISTS treeNodeGetParents;
+DROP PROCEDURE IF EXISTS treeNodeRemoveCopy;
 DELIMITER $$
-CREATE PROCEDURE treeNodeGetParents(forUserId VARCHAR(32), treeNodeId VARCHAR(32))
+CREATE PROCEDURE treeNodeRemoveCopy(forUserId VARCHAR(32), treeNodes VARCHAR(3300))
 BEGIN
 	DECLARE projectId BINARY(16) DEFAULT NULL;
-	DECLARE forUserRole VARCHAR(50) DEFAULT NULL;
-	DECLARE rootParent BINARY(16) DEFAULT UNHEX('00000000000000000000000000000000');
-    DECLARE currentParent BINARY(16) DEFAULT NULL;
-    DECLARE currentName VARCHAR(250) DEFAULT NULL;
+    DECLARE currentId BINARY(16) DEFAULT NULL;
     DECLARE depthCounter INT DEFAULT 0;
+	DECLARE EXIT HANDLER FOR SQLEXCEPTION
+	BEGIN
+		ROLLBACK;
+		RESIGNAL;
+	END;
     
-    SELECT project, parent INTO projectId, currentParent  FROM treeNode WHERE id = UNHEX(treeNodeId);
-    SET forUserRole = _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
-    
-	IF forUserRole IS NOT NULL THEN
-		DROP TEMPORARY TABLE IF EXISTS tempTreeNodeGetParents;
-		CREATE TEMPORARY TABLE tempTreeNodeGetParents(
-			depth INT NOT NULL,
-			id VARCHAR(32) NOT NULL,
-			parent VARCHAR(32) NULL,
-			name VARCHAR(250) NULL,
-            PRIMARY KEY (depth)
-		);
+	IF createTempIdsTable(treeNodes) THEN
+		SELECT project INTO projectId FROM treeNode WHERE id = (SELECT id FROM tempIds LIMIT 1);
+		IF _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId)) IN ('owner', 'admin', 'organiser') AND (SELECT COUNT(*) FROM treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id WHERE tn.project != projectId) = 0 THEN
+			START TRANSACTION;
+			WHILE (SELECT COUNT(*) FROM tempIds) > 0 DO
+				SELECT id INTO currentId FROM tempIds LIMIT 1;
+				CALL _treeNode_createTempSubtreeTable(currentId);
+				SELECT MAX(depth) INTO depthCounter FROM tempTreeNodeSubtree;
+				WHILE depthCounter >= 0 DO
+					DELETE FROM treeNode WHERE id IN (SELECT id FROM tempTreeNodeSubtree WHERE depth = depthCounter);
+					SET depthCounter = depthCounter - 1;
+				END WHILE;
+				DROP TEMPORARY TABLE IF EXISTS tempTreeNodeSubtree;
+				DELETE FROM tempIds WHERE id = currentId;
+			END WHILE;
+			COMMIT;
+		ELSE
+			SIGNAL SQLSTATE 
+				'45002'
+			SET
+				MESSAGE_TEXT = 'Unauthorized action: treeNode remove copy',
+				MYSQL_ERRNO = 45002;
+		END IF;
+	END IF;
+    DROP TEMPORARY TABLE IF EXISTS tempIds;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS _treeNode_createTempSubtreeTable;
+DELIMITER $$
+CREATE PROCEDURE _treeNode_createTempSubtreeTable(rootId BINARY(16))
+BEGIN
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodeSubtree;
+	CREATE TEMPORARY TABLE tempTreeNodeSubtree(
+		id BINARY(16) NOT NULL,
+		depth INT NOT NULL,
+		PRIMARY KEY (id),
+		INDEX (depth)
+	);
+    
+	INSERT INTO tempTreeNodeSubtree (id, depth)
+	WITH RECURSIVE subtree (id, depth) AS (
+		SELECT rootId, 0
+		UNION ALL
+		SELECT tn.id, s.depth + 1 FROM treeNode AS tn INNER JOIN subtree AS s ON tn.parent = s.id
+	)
+	SELECT id, depth FROM subtree;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS _treeNode_trash;
+DELIMITER $$
+CREATE PROCEDURE _treeNode_trash(forUserId BINARY(16), treeNodeId BINARY(16))
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT NULL;
+	DECLARE parentId BINARY(16) DEFAULT NULL;
+    
+	SELECT project, parent INTO projectId, parentId FROM treeNode WHERE id = treeNodeId AND trash IS NULL;
+	IF projectId IS NOT NULL THEN
+		CALL _treeNode_createTempSubtreeTable(treeNodeId);
+		INSERT INTO treeNodeTrash (id, project, parent, deleted, deletedBy) VALUES (treeNodeId, projectId, parentId, UTC_TIMESTAMP(), forUserId);
+		UPDATE treeNode SET parent = NULL WHERE id = treeNodeId;
+		UPDATE treeNode AS tn INNER JOIN tempTreeNodeSubtree AS ts ON tn.id = ts.id SET tn.trash = treeNodeId;
+		DROP TEMPORARY TABLE IF EXISTS tempTreeNodeSubtree;
+	END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS _treeNode_purge;
+DELIMITER $$
+CREATE PROCEDURE _treeNode_purge(treeNodeId BINARY(16))
+BEGIN
+    DECLARE depthCounter INT DEFAULT 0;
+	DECLARE projectId BINARY(16) DEFAULT (SELECT project FROM treeNode WHERE id = treeNodeId);
+    
+	CALL _treeNode_createTempSubtreeTable(treeNodeId);
+	INSERT INTO tempTreeNodePurgeBlobs (project, name) SELECT projectId, CONCAT(lex(dv.id), '.', dv.fileExtension) FROM documentVersion AS dv INNER JOIN tempTreeNodeSubtree AS ts ON dv.document = ts.id;
+	INSERT INTO tempTreeNodePurgeBlobs (project, name) SELECT projectId, CONCAT(lex(dv.id), '.tn.tn') FROM documentVersion AS dv INNER JOIN tempTreeNodeSubtree AS ts ON dv.document = ts.id WHERE dv.thumbnailType != '';
+	INSERT INTO tempTreeNodePurgeBlobs (project, name) SELECT projectId, CONCAT(lex(s.documentVersion), '.page.', SUBSTRING_INDEX(s.manifest, '/', -1), '.tn') FROM sheet AS s INNER JOIN documentVersion AS dv ON s.documentVersion = dv.id INNER JOIN tempTreeNodeSubtree AS ts ON dv.document = ts.id WHERE s.role = 'pdf' AND s.thumbnails != '';
+	INSERT INTO tempTreeNodePurgeBlobs (project, name) SELECT projectId, CONCAT(lex(psv.id), '.tn.tn') FROM projectSpaceVersion AS psv INNER JOIN tempTreeNodeSubtree AS ts ON psv.projectSpace = ts.id WHERE psv.thumbnailType != '';
+    
+	SELECT MAX(depth) INTO depthCounter FROM tempTreeNodeSubtree;
+	WHILE depthCounter >= 0 DO
+		DELETE FROM treeNode WHERE id IN (SELECT id FROM tempTreeNodeSubtree WHERE depth = depthCounter);
+		SET depthCounter = depthCounter - 1;
+	END WHILE;
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodeSubtree;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS _treeNode_createTempPurgeBlobsTable;
+DELIMITER $$
+CREATE PROCEDURE _treeNode_createTempPurgeBlobsTable()
+BEGIN
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodePurgeBlobs;
+	CREATE TEMPORARY TABLE tempTreeNodePurgeBlobs(
+		project BINARY(16) NOT NULL,
+		name VARCHAR(100) NOT NULL
+	);
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeDelete;
+DELIMITER $$
+CREATE PROCEDURE treeNodeDelete(forUserId VARCHAR(32), treeNodes VARCHAR(3300))
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT NULL;
+	DECLARE forUserRole VARCHAR(50) DEFAULT NULL;
+	DECLARE treeNodesCount INT DEFAULT 0;
+    DECLARE treeNodesInSameProjectCount INT DEFAULT 0;
+    DECLARE currentId BINARY(16) DEFAULT NULL;
+    
+	IF createTempIdsTable(treeNodes) THEN
+		SELECT project INTO projectId FROM treeNode WHERE id = (SELECT id FROM tempIds LIMIT 1) AND trash IS NULL;
+		SET forUserRole = _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
+		IF forUserRole IN ('owner', 'admin', 'organiser', 'contributor') THEN
+			SELECT COUNT(*) INTO treeNodesCount FROM tempIds;
+			SELECT COUNT(*) INTO treeNodesInSameProjectCount FROM treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id WHERE tn.project = projectId AND tn.trash IS NULL;
+			IF treeNodesCount = treeNodesInSameProjectCount THEN
+				IF (SELECT COUNT(*) FROM treeNode AS tn INNER JOIN tempIds AS t ON tn.id = t.id WHERE tn.id = tn.project) = 0 THEN
+					WHILE (SELECT COUNT(*) FROM tempIds) > 0 DO
+						SELECT id INTO currentId FROM tempIds LIMIT 1;
+						CALL _treeNode_trash(UNHEX(forUserId), currentId);
+						DELETE FROM tempIds WHERE id = currentId;
+					END WHILE;
+				ELSE
+					SIGNAL SQLSTATE 
+						'45003'
+					SET
+						MESSAGE_TEXT = 'Invalid action: treeNode delete root folder',
+						MYSQL_ERRNO = 45003;
+				END IF;
+			ELSE
+				SIGNAL SQLSTATE 
+					'45002'
+				SET
+					MESSAGE_TEXT = 'Unauthorized action: treeNode cross project delete',
+					MYSQL_ERRNO = 45002;
+			END IF;
+		ELSE 
+			SIGNAL SQLSTATE 
+				'45002'
+			SET
+				MESSAGE_TEXT = 'Unauthorized action: treeNode delete',
+				MYSQL_ERRNO = 45002;
+		END IF;
+	END IF;
+    DROP TEMPORARY TABLE IF EXISTS tempIds;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeListTrash;
+DELIMITER $$
+CREATE PROCEDURE treeNodeListTrash(forUserId VARCHAR(32), projectId VARCHAR(32), os INT, l INT, sortBy VARCHAR(50))
+BEGIN
+	DECLARE forUserRole VARCHAR(50) DEFAULT NULL;
+    DECLARE totalResults INT DEFAULT 0;
+    
+	IF os < 0 THEN
+		SET os = 0;
+	END IF;
+    
+	IF l < 0 THEN
+		SET l = 0;
+	END IF;
+    
+	IF l > 100 THEN
+		SET l = 100;
+	END IF;
+    
+    SET forUserRole = _permission_getRole(UNHEX(forUserId), UNHEX(projectId), UNHEX(forUserId));
+    
+	IF forUserRole IS NOT NULL THEN
+		SELECT COUNT(*) INTO totalResults FROM treeNodeTrash WHERE project = UNHEX(projectId);
+        
+		IF os >= totalResults OR l = 0 THEN
+			SELECT totalResults;
+		ELSE
+			SELECT totalResults, lex(tn1.id) AS id, lex(t.parent) AS parent, lex(tn1.project) AS project, tn1.name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount, tn1.created, lex(tn1.createdBy) AS createdBy, tn1.modified, lex(tn1.modifiedBy) AS modifiedBy, _treeNode_properties(tn1.id) AS properties, t.deleted, lex(t.deletedBy) AS deletedBy FROM treeNodeTrash AS t INNER JOIN treeNode AS tn1 ON t.id = tn1.id WHERE t.project = UNHEX(projectId) ORDER BY CASE WHEN sortBy = 'createdAsc' THEN tn1.created END ASC, CASE WHEN sortBy = 'createdDesc' THEN tn1.created END DESC, CASE WHEN sortBy = 'modifiedAsc' THEN tn1.modified END ASC, CASE WHEN sortBy = 'modifiedDesc' THEN tn1.modified END DESC, CASE WHEN sortBy = 'typeAsc' THEN tn1.nodeType END ASC, CASE WHEN sortBy = 'typeDesc' THEN tn1.nodeType END DESC, CASE WHEN sortBy = 'deletedAsc' THEN t.deleted END ASC, CASE WHEN sortBy = 'deletedDesc' OR sortBy NOT IN ('nameAsc', 'nameDesc', 'createdAsc', 'createdDesc', 'modifiedAsc', 'modifiedDesc', 'typeAsc', 'typeDesc') THEN t.deleted END DESC, CASE WHEN sortBy = 'nameDesc' THEN tn1.name END DESC, tn1.name ASC LIMIT os, l;
+		END IF;
+	ELSE 
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: treeNode list trash',
+			MYSQL_ERRNO = 45002;
+	END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeRestore;
+DELIMITER $$
+CREATE PROCEDURE treeNodeRestore(forUserId VARCHAR(32), treeNodes VARCHAR(3300))
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT NULL;
+	DECLARE forUserRole VARCHAR(50) DEFAULT NULL;
+	DECLARE treeNodesCount INT DEFAULT 0;
+    DECLARE treeNodesInSameProjectCount INT DEFAULT 0;
+    DECLARE currentId BINARY(16) DEFAULT NULL;
+    DECLARE originalParent BINARY(16) DEFAULT NULL;
+    DECLARE newParent BINARY(16) DEFAULT NULL;
+    
+	IF createTempIdsTable(treeNodes) THEN
+		SELECT project INTO projectId FROM treeNodeTrash WHERE id = (SELECT id FROM tempIds LIMIT 1);
+		SET forUserRole = _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
+		IF forUserRole IN ('owner', 'admin', 'organiser', 'contributor') THEN
+			SELECT COUNT(*) INTO treeNodesCount FROM tempIds;
+			SELECT COUNT(*) INTO treeNodesInSameProjectCount FROM treeNodeTrash AS tt INNER JOIN tempIds AS t ON tt.id = t.id WHERE tt.project = projectId;
+			IF treeNodesCount = treeNodesInSameProjectCount THEN
+				WHILE (SELECT COUNT(*) FROM tempIds) > 0 DO
+					SELECT tt.id, tt.parent INTO currentId, originalParent FROM treeNodeTrash AS tt INNER JOIN tempIds AS t ON tt.id = t.id ORDER BY tt.deleted DESC LIMIT 1;
+					SET newParent = (SELECT id FROM treeNode WHERE id = originalParent AND project = projectId AND nodeType = 'folder' AND trash IS NULL);
+					IF newParent IS NULL THEN
+						SET newParent = projectId;
+					END IF;
+					UPDATE treeNode SET trash = NULL WHERE trash = currentId;
+					UPDATE treeNode SET parent = newParent, modified = UTC_TIMESTAMP(), modifiedBy = UNHEX(forUserId) WHERE id = currentId;
+					DELETE FROM treeNodeTrash WHERE id = currentId;
+					DELETE FROM tempIds WHERE id = currentId;
+				END WHILE;
+			ELSE
+				SIGNAL SQLSTATE 
+					'45002'
+				SET
+					MESSAGE_TEXT = 'Unauthorized action: treeNode cross project restore',
+					MYSQL_ERRNO = 45002;
+			END IF;
+		ELSE 
+			SIGNAL SQLSTATE 
+				'45002'
+			SET
+				MESSAGE_TEXT = 'Unauthorized action: treeNode restore',
+				MYSQL_ERRNO = 45002;
+		END IF;
+	END IF;
+    DROP TEMPORARY TABLE IF EXISTS tempIds;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodePurge;
+DELIMITER $$
+CREATE PROCEDURE treeNodePurge(forUserId VARCHAR(32), treeNodes VARCHAR(3300))
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT NULL;
+	DECLARE forUserRole VARCHAR(50) DEFAULT NULL;
+	DECLARE treeNodesCount INT DEFAULT 0;
+    DECLARE treeNodesInSameProjectCount INT DEFAULT 0;
+    DECLARE currentId BINARY(16) DEFAULT NULL;
+    
+	IF createTempIdsTable(treeNodes) THEN
+		SELECT project INTO projectId FROM treeNodeTrash WHERE id = (SELECT id FROM tempIds LIMIT 1);
+		SET forUserRole = _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
+		IF forUserRole IN ('owner', 'admin', 'organiser') THEN
+			SELECT COUNT(*) INTO treeNodesCount FROM tempIds;
+			SELECT COUNT(*) INTO treeNodesInSameProjectCount FROM treeNodeTrash AS tt INNER JOIN tempIds AS t ON tt.id = t.id WHERE tt.project = projectId;
+			IF treeNodesCount = treeNodesInSameProjectCount THEN
+				CALL _treeNode_createTempPurgeBlobsTable();
+				WHILE (SELECT COUNT(*) FROM tempIds) > 0 DO
+					SELECT id INTO currentId FROM tempIds LIMIT 1;
+					CALL _treeNode_purge(currentId);
+					DELETE FROM tempIds WHERE id = currentId;
+				END WHILE;
+				SELECT lex(project) AS project, name FROM tempTreeNodePurgeBlobs;
+				DROP TEMPORARY TABLE IF EXISTS tempTreeNodePurgeBlobs;
+			ELSE
+				SIGNAL SQLSTATE 
+					'45002'
+				SET
+					MESSAGE_TEXT = 'Unauthorized action: treeNode cross project purge',
+					MYSQL_ERRNO = 45002;
+			END IF;
+		ELSE 
+			SIGNAL SQLSTATE 
+				'45002'
+			SET
+				MESSAGE_TEXT = 'Unauthorized action: treeNode purge',
+				MYSQL_ERRNO = 45002;
+		END IF;
+	END IF;
+    DROP TEMPORARY TABLE IF EXISTS tempIds;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodePurgeExpiredTrash;
+DELIMITER $$
+CREATE PROCEDURE treeNodePurgeExpiredTrash(deletedBefore DATETIME)
+BEGIN
+    DECLARE currentId BINARY(16) DEFAULT NULL;
+    
+	CALL _treeNode_createTempPurgeBlobsTable();
+	WHILE (SELECT COUNT(*) FROM treeNodeTrash WHERE deleted < deletedBefore) > 0 DO
+		SELECT id INTO currentId FROM treeNodeTrash WHERE deleted < deletedBefore LIMIT 1;
+		CALL _treeNode_purge(currentId);
+	END WHILE;
+	SELECT lex(project) AS project, name FROM tempTreeNodePurgeBlobs;
+	DROP TEMPORARY TABLE IF EXISTS tempTreeNodePurgeBlobs;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeGet;
+DELIMITER $$
+CREATE PROCEDURE treeNodeGet(forUserId VARCHAR(32), treeNodes VARCHAR(3300))
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT NULL;
+    DECLARE distinctProjectsCount INT DEFAULT 0;
+    
+	IF createTempIdsTable(treeNodes) THEN
+		SELECT project INTO projectId FROM treeNode WHERE id = (SELECT id FROM tempIds LIMIT 1) AND trash IS NULL;
+        SELECT COUNT(DISTINCT project) INTO distinctProjectsCount FROM treeNode AS dv INNER JOIN tempIds AS t ON dv.id = t.id;
+        IF distinctProjectsCount = 1 AND projectId IS NOT NULL AND _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId)) IS NOT NULL THEN
+			SELECT lex(tn1.id) AS id, lex(tn1.parent) AS parent, lex(tn1.project) AS project, name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount, tn1.created, lex(tn1.createdBy) AS createdBy, tn1.modified, lex(tn1.modifiedBy) AS modifiedBy, _treeNode_properties(tn1.id) AS properties FROM treeNode AS tn1 INNER JOIN tempIds AS t ON tn1.id = t.id WHERE tn1.trash IS NULL;
+        ELSE
+			SIGNAL SQLSTATE 
+				'45002'
+			SET
+				MESSAGE_TEXT = 'Unauthorized action: treeNode get cross project',
+				MYSQL_ERRNO = 45002;
+        END IF;		
+    END IF;
+    DROP TEMPORARY TABLE IF EXISTS tempIds;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeGetChildren;
+DELIMITER $$
+CREATE PROCEDURE treeNodeGetChildren(forUserId VARCHAR(32), parentId VARCHAR(32), childNodeType VARCHAR(50), propertyFilters VARCHAR(5000), sortProperty VARCHAR(50), os INT, l INT, sortBy VARCHAR(50))
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT NULL;
+    DECLARE parentNodeType VARCHAR(50) DEFAULT NULL;
+	DECLARE forUserRole VARCHAR(50) DEFAULT NULL;
+    DECLARE totalResults INT DEFAULT 0;
+    
+	IF os < 0 THEN
+		SET os = 0;
+	END IF;
+    
+	IF l < 0 THEN
+		SET l = 0;
+	END IF;
+    
+	IF l > 100 THEN
+		SET l = 100;
+	END IF;
+    
+    SELECT project, nodeType INTO projectId, parentNodeType FROM treeNode WHERE id = UNHEX(parentId) AND trash IS NULL;
+    SET forUserRole = _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
+    
+    IF parentNodeType = 'folder' THEN
+		IF forUserRole IS NOT NULL THEN
+			IF childNodeType = '' OR childNodeType = 'any' THEN
+				SELECT COUNT(*) INTO totalResults FROM treeNode WHERE parent = UNHEX(parentId) AND _treeNode_propertiesMatch(id, propertyFilters);
+			ELSE
+				SELECT COUNT(*) INTO totalResults FROM treeNode WHERE parent = UNHEX(parentId) AND nodeType = childNodeType AND _treeNode_propertiesMatch(id, propertyFilters);
+			END IF;
+            
+			IF os >= totalResults OR l = 0 THEN
+				SELECT totalResults;
+            ELSE
+				SELECT totalResults, lex(tn1.id) AS id, lex(tn1.parent) AS parent, lex(tn1.project) AS project, name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount, tn1.created, lex(tn1.createdBy) AS createdBy, tn1.modified, lex(tn1.modifiedBy) AS modifiedBy, _treeNode_properties(tn1.id) AS properties FROM treeNode AS tn1 WHERE tn1.parent = UNHEX(parentId) AND (childNodeType = '' OR childNodeType = 'any' OR tn1.nodeType = childNodeType) AND _treeNode_propertiesMatch(tn1.id, propertyFilters) ORDER BY CASE WHEN sortBy = 'createdAsc' THEN tn1.created END ASC, CASE WHEN sortBy = 'createdDesc' THEN tn1.created END DESC, CASE WHEN sortBy = 'modifiedAsc' THEN tn1.modified END ASC, CASE WHEN sortBy = 'modifiedDesc' THEN tn1.modified END DESC, CASE WHEN sortBy = 'typeAsc' THEN tn1.nodeType END ASC, CASE WHEN sortBy = 'typeDesc' THEN tn1.nodeType END DESC, CASE WHEN sortBy = 'propertyAsc' THEN (SELECT tp.numberValue FROM treeNodeProperty AS tp WHERE tp.treeNode = tn1.id AND tp.name = sortProperty) END ASC, CASE WHEN sortBy = 'propertyAsc' THEN (SELECT tp.value FROM treeNodeProperty AS tp WHERE tp.treeNode = tn1.id AND tp.name = sortProperty) END ASC, CASE WHEN sortBy = 'propertyDesc' THEN (SELECT tp.numberValue FROM treeNodeProperty AS tp WHERE tp.treeNode = tn1.id AND tp.name = sortProperty) END DESC, CASE WHEN sortBy = 'propertyDesc' THEN (SELECT tp.value FROM treeNodeProperty AS tp WHERE tp.treeNode = tn1.id AND tp.name = sortProperty) END DESC, CASE WHEN sortBy = 'nameDesc' THEN tn1.name END DESC, tn1.name ASC LIMIT os, l;
+            END IF;
+		ELSE 
+			SIGNAL SQLSTATE 
+				'45002'
+			SET
+				MESSAGE_TEXT = 'Unauthorized action: treeNode get children',
+				MYSQL_ERRNO = 45002;
+		END IF;
+	ELSE
+		SIGNAL SQLSTATE 
+			'45003'
+		SET
+			MESSAGE_TEXT = 'Invalid action: get treeNodes from a none folder parent',
+            MYSQL_ERRNO = 45003;
+	END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeGetDescendants;
+DELIMITER $$
+CREATE PROCEDURE treeNodeGetDescendants(forUserId VARCHAR(32), treeNodeId VARCHAR(32), maxDepth INT, childNodeType VARCHAR(50))
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT NULL;
+    DECLARE parentNodeType VARCHAR(50) DEFAULT NULL;
+    
+    SELECT project, nodeType INTO projectId, parentNodeType FROM treeNode WHERE id = UNHEX(treeNodeId) AND trash IS NULL;
+    
+    IF parentNodeType = 'folder' THEN
+		IF _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId)) IS NOT NULL THEN
+			WITH RECURSIVE descendant (id, depth) AS (
+				SELECT id, 1 FROM treeNode WHERE parent = UNHEX(treeNodeId)
+				UNION ALL
+				SELECT tn.id, d.depth + 1 FROM treeNode AS tn INNER JOIN descendant AS d ON tn.parent = d.id WHERE maxDepth <= 0 OR d.depth < maxDepth
+			)
+			SELECT lex(tn1.id) AS id, lex(tn1.parent) AS parent, lex(tn1.project) AS project, name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount, tn1.created, lex(tn1.createdBy) AS createdBy, tn1.modified, lex(tn1.modifiedBy) AS modifiedBy, _treeNode_properties(tn1.id) AS properties FROM descendant AS d INNER JOIN treeNode AS tn1 ON d.id = tn1.id WHERE childNodeType = '' OR childNodeType = 'any' OR tn1.nodeType = childNodeType ORDER BY d.depth ASC, tn1.name ASC;
+		ELSE 
+			SIGNAL SQLSTATE 
+				'45002'
+			SET
+				MESSAGE_TEXT = 'Unauthorized action: treeNode get descendants',
+				MYSQL_ERRNO = 45002;
+		END IF;
+	ELSE
+		SIGNAL SQLSTATE 
+			'45003'
+		SET
+			MESSAGE_TEXT = 'Invalid action: get treeNodes from a none folder parent',
+            MYSQL_ERRNO = 45003;
+	END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeGetArchiveVersions;
+DELIMITER $$
+CREATE PROCEDURE treeNodeGetArchiveVersions(forUserId VARCHAR(32), treeNodeId VARCHAR(32), includeAllVersions BOOL)
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT NULL;
+    DECLARE parentNodeType VARCHAR(50) DEFAULT NULL;
+    
+    SELECT project, nodeType INTO projectId, parentNodeType FROM treeNode WHERE id = UNHEX(treeNodeId) AND trash IS NULL;
+    
+    IF parentNodeType = 'folder' THEN
+		IF _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId)) IN ('owner', 'admin', 'organiser', 'contributor') THEN
+			WITH RECURSIVE descendant (id) AS (
+				SELECT id FROM treeNode WHERE parent = UNHEX(treeNodeId)
+				UNION ALL
+				SELECT tn.id FROM treeNode AS tn INNER JOIN descendant AS d ON tn.parent = d.id
+			)
+			SELECT lex(dv.id) AS id, lex(dv.document) AS document, dv.version, dv.uploaded, dv.uploadComment, lex(dv.uploadedBy) AS uploadedBy, dv.fileType, dv.fileExtension, dv.mimeType, dv.contentHash FROM descendant AS d INNER JOIN documentVersion AS dv ON d.id = dv.document WHERE includeAllVersions OR dv.version = (SELECT MAX(version) FROM documentVersion WHERE document = dv.document) ORDER BY dv.document ASC, dv.version ASC;
+		ELSE 
+			SIGNAL SQLSTATE 
+				'45002'
+			SET
+				MESSAGE_TEXT = 'Unauthorized action: treeNode get archive versions',
+				MYSQL_ERRNO = 45002;
+		END IF;
+	ELSE
+		SIGNAL SQLSTATE 
+			'45003'
+		SET
+			MESSAGE_TEXT = 'Invalid action: export archive of a none folder',
+            MYSQL_ERRNO = 45003;
+	END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeGetParents;
+DELIMITER $$
+CREATE PROCEDURE treeNodeGetParents(forUserId VARCHAR(32), treeNodeId VARCHAR(32))
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT NULL;
+	DECLARE forUserRole VARCHAR(50) DEFAULT NULL;
+	DECLARE rootParent BINARY(16) DEFAULT UNHEX('00000000000000000000000000000000');
+    DECLARE currentParent BINARY(16) DEFAULT NULL;
+    DECLARE currentName VARCHAR(250) DEFAULT NULL;
+    DECLARE depthCounter INT DEFAULT 0;
+    
+    SELECT project, parent INTO projectId, currentParent  FROM treeNode WHERE id = UNHEX(treeNodeId) AND trash IS NULL;
+    SET forUserRole = _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
+    
+	IF forUserRole IS NOT NULL THEN
+		DROP TEMPORARY TABLE IF EXISTS tempTreeNodeGetParents;
+		CREATE TEMPORARY TABLE tempTreeNodeGetParents(
+			depth INT NOT NULL,
+			id VARCHAR(32) NOT NULL,
+			parent VARCHAR(32) NULL,
+			name VARCHAR(250) NULL,
+            PRIMARY KEY (depth)
+		);
 		WHILE currentParent != rootParent DO
 			SELECT lex(id), parent, name INTO treeNodeId, currentParent, currentName FROM treeNode WHERE id = currentParent;
 			INSERT INTO tempTreeNodeGetParents (depth, id, parent, name) VALUES (depthCounter, treeNodeId, lex(currentParent), currentName);
             SET depthCounter = depthCounter + 1;
 		END WHILE;
-        SELECT id, parent, lex(projectId) AS project, name, 'folder' AS nodeType, 0 as childCount FROM tempTreeNodeGetParents ORDER BY depth DESC;
+        SELECT t.id, t.parent, lex(projectId) AS project, t.name, 'folder' AS nodeType, 0 as childCount, tn.created, lex(tn.createdBy) AS createdBy, tn.modified, lex(tn.modifiedBy) AS modifiedBy, _treeNode_properties(tn.id) AS properties FROM tempTreeNodeGetParents AS t INNER JOIN treeNode AS tn ON UNHEX(t.id) = tn.id ORDER BY t.depth DESC;
 	ELSE 
 		SIGNAL SQLSTATE 
 			'45002'
@@ -1275,9 +2172,85 @@ BEGIN
 END$$
 DELIMITER ;
 
+DROP FUNCTION IF EXISTS _treeNode_resolvePath;
+DELIMITER $$
+CREATE FUNCTION _treeNode_resolvePath(projectId BINARY(16), path VARCHAR(5000)) RETURNS BINARY(16) NOT DETERMINISTIC
+BEGIN
+	DECLARE currentId BINARY(16) DEFAULT projectId;
+    DECLARE segment VARCHAR(250) DEFAULT '';
+    DECLARE matchesCount INT DEFAULT 0;
+    
+	SET path = TRIM(BOTH '/' FROM path);
+	WHILE path != '' DO
+		SET segment = SUBSTRING_INDEX(path, '/', 1);
+		IF LOCATE('/', path) = 0 THEN
+			SET path = '';
+		ELSE
+			SET path = SUBSTRING(path, LOCATE('/', path) + 1);
+		END IF;
+		IF segment != '' THEN
+			SELECT COUNT(*) INTO matchesCount FROM treeNode WHERE parent = currentId AND name = segment;
+			IF matchesCount = 0 THEN
+				SIGNAL SQLSTATE 
+					'45003'
+				SET
+					MESSAGE_TEXT = 'Invalid action: treeNode path not found',
+					MYSQL_ERRNO = 45003;
+				RETURN NULL;
+			ELSEIF matchesCount > 1 THEN
+				SIGNAL SQLSTATE 
+					'45003'
+				SET
+					MESSAGE_TEXT = 'Invalid action: treeNode path is ambiguous',
+					MYSQL_ERRNO = 45003;
+				RETURN NULL;
+			END IF;
+			SELECT id INTO currentId FROM treeNode WHERE parent = currentId AND name = segment;
+		END IF;
+	END WHILE;
+    
+	RETURN currentId;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeResolvePath;
+DELIMITER $$
+CREATE PROCEDURE treeNodeResolvePath(forUserId VARCHAR(32), projectId VARCHAR(32), path VARCHAR(5000))
+BEGIN
+	DECLARE treeNodeId BINARY(16) DEFAULT NULL;
+    
+	IF _permission_getRole(UNHEX(forUserId), UNHEX(projectId), UNHEX(forUserId)) IS NOT NULL THEN
+		SET treeNodeId = _treeNode_resolvePath(UNHEX(projectId), path);
+		SELECT lex(tn1.id) AS id, lex(tn1.parent) AS parent, lex(tn1.project) AS project, name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount, tn1.created, lex(tn1.createdBy) AS createdBy, tn1.modified, lex(tn1.modifiedBy) AS modifiedBy, _treeNode_properties(tn1.id) AS properties FROM treeNode AS tn1 WHERE tn1.id = treeNodeId AND tn1.project = UNHEX(projectId);
+	ELSE 
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: treeNode resolve path',
+			MYSQL_ERRNO = 45002;
+	END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS treeNodeListPath;
+DELIMITER $$
+CREATE PROCEDURE treeNodeListPath(forUserId VARCHAR(32), projectId VARCHAR(32), path VARCHAR(5000), childNodeType VARCHAR(50), os INT, l INT, sortBy VARCHAR(50))
+BEGIN
+	IF _permission_getRole(UNHEX(forUserId), UNHEX(projectId), UNHEX(forUserId)) IS NOT NULL THEN
+		CALL treeNodeGetChildren(forUserId, lex(_treeNode_resolvePath(UNHEX(projectId), path)), childNodeType, '', '', os, l, sortBy);
+	ELSE 
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: treeNode list path',
+			MYSQL_ERRNO = 45002;
+	END IF;
+END$$
+DELIMITER ;
+
 DROP PROCEDURE IF EXISTS treeNodeGlobalSearch;
 DELIMITER $$
-CREATE PROCEDURE treeNodeGlobalSearch(forUserId VARCHAR(32), search VARCHAR(100), childNodeType VARCHAR(50), os INT, l INT, sortBy VARCHAR(50))
+CREATE PROCEDURE treeNodeGlobalSearch(forUserId VARCHAR(32), search VARCHAR(100), childNodeType VARCHAR(50), propertyFilters VARCHAR(5000), sortProperty VARCHAR(50), os INT, l INT, sortBy VARCHAR(50))
 BEGIN
     DECLARE totalResults INT DEFAULT 0;
     
@@ -1301,23 +2274,24 @@ BEGIN
 		name VARCHAR(250) NULL,
         nodeType VARCHAR(50) NOT NULL,
         childCount INT NOT NULL,
+        created DATETIME NOT NULL,
+        createdBy BINARY(16) NOT NULL,
+        modified DATETIME NOT NULL,
+        modifiedBy BINARY(16) NOT NULL,
         INDEX (name)
 	);
     
 	IF childNodeType = '' OR childNodeType = 'any' THEN
-		INSERT INTO tempTreeNodeGlobalSearch (id, parent, project, name, nodeType, childCount) SELECT tn1.id, tn1.parent, tn1.project, tn1.name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount FROM treeNode AS tn1 INNER JOIN permission AS p ON tn1.project = p.project WHERE p.user = UNHEX(forUserId) AND MATCH(tn1.name) AGAINST(search IN NATURAL LANGUAGE MODE); 
+		INSERT INTO tempTreeNodeGlobalSearch (id, parent, project, name, nodeType, childCount, created, createdBy, modified, modifiedBy) SELECT tn1.id, tn1.parent, tn1.project, tn1.name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount, tn1.created, tn1.createdBy, tn1.modified, tn1.modifiedBy FROM treeNode AS tn1 INNER JOIN permission AS p ON tn1.project = p.project WHERE p.user = UNHEX(forUserId) AND tn1.trash IS NULL AND _treeNode_propertiesMatch(tn1.id, propertyFilters) AND MATCH(tn1.name) AGAINST(search IN NATURAL LANGUAGE MODE); 
     ELSE
-		INSERT INTO tempTreeNodeGlobalSearch (id, parent, project, name, nodeType, childCount) SELECT tn1.id, tn1.parent, tn1.project, tn1.name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount FROM treeNode AS tn1 INNER JOIN permission AS p ON tn1.project = p.project WHERE p.user = UNHEX(forUserId) AND tn1.nodeType = childNodeType AND MATCH(tn1.name) AGAINST(search IN NATURAL LANGUAGE MODE); 
+		INSERT INTO tempTreeNodeGlobalSearch (id, parent, project, name, nodeType, childCount, created, createdBy, modified, modifiedBy) SELECT tn1.id, tn1.parent, tn1.project, tn1.name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount, tn1.created, tn1.createdBy, tn1.modified, tn1.modifiedBy FROM treeNode AS tn1 INNER JOIN permission AS p ON tn1.project = p.project WHERE p.user = UNHEX(forUserId) AND tn1.nodeType = childNodeType AND tn1.trash IS NULL AND _treeNode_propertiesMatch(tn1.id, propertyFilters) AND MATCH(tn1.name) AGAINST(search IN NATURAL LANGUAGE MODE); 
     END IF;
     SELECT COUNT(*) INTO totalResults FROM tempTreeNodeGlobalSearch;
     
     IF os >= totalResults OR l = 0 THEN
 		SELECT totalResults;
-    ELSE IF sortBy = 'nameDesc' THEN
-		SELECT totalResults, lex(id) AS id, lex(parent) AS parent, lex(project) AS project, name, nodeType, childCount FROM tempTreeNodeGlobalSearch ORDER BY name DESC LIMIT os, l;
     ELSE
-		SELECT totalResults, lex(id) AS id, lex(parent) AS parent, lex(project) AS project, name, nodeType, childCount FROM tempTreeNodeGlobalSearch ORDER BY name ASC LIMIT os, l;			
-    END IF;
+		SELECT totalResults, lex(id) AS id, lex(parent) AS parent, lex(project) AS project, name, nodeType, childCount, created, lex(createdBy) AS createdBy, modified, lex(modifiedBy) AS modifiedBy, _treeNode_properties(id) AS properties FROM tempTreeNodeGlobalSearch ORDER BY CASE WHEN sortBy = 'createdAsc' THEN created END ASC, CASE WHEN sortBy = 'createdDesc' THEN created END DESC, CASE WHEN sortBy = 'modifiedAsc' THEN modified END ASC, CASE WHEN sortBy = 'modifiedDesc' THEN modified END DESC, CASE WHEN sortBy = 'typeAsc' THEN nodeType END ASC, CASE WHEN sortBy = 'typeDesc' THEN nodeType END DESC, CASE WHEN sortBy = 'propertyAsc' THEN (SELECT tp.numberValue FROM treeNodeProperty AS tp WHERE tp.treeNode = tempTreeNodeGlobalSearch.id AND tp.name = sortProperty) END ASC, CASE WHEN sortBy = 'propertyAsc' THEN (SELECT tp.value FROM treeNodeProperty AS tp WHERE tp.treeNode = tempTreeNodeGlobalSearch.id AND tp.name = sortProperty) END ASC, CASE WHEN sortBy = 'propertyDesc' THEN (SELECT tp.numberValue FROM treeNodeProperty AS tp WHERE tp.treeNode = tempTreeNodeGlobalSearch.id AND tp.name = sortProperty) END DESC, CASE WHEN sortBy = 'propertyDesc' THEN (SELECT tp.value FROM treeNodeProperty AS tp WHERE tp.treeNode = tempTreeNodeGlobalSearch.id AND tp.name = sortProperty) END DESC, CASE WHEN sortBy = 'nameDesc' THEN name END DESC, name ASC LIMIT os, l;
     END IF;
     
     DROP TEMPORARY TABLE IF EXISTS tempTreeNodeGlobalSearch;
@@ -1326,7 +2300,7 @@ DELIMITER ;
 
 DROP PROCEDURE IF EXISTS treeNodeProjectSearch;
 DELIMITER $$
-CREATE PROCEDURE treeNodeProjectSearch(forUserId VARCHAR(32), projectId VARCHAR(32), search VARCHAR(100), childNodeType VARCHAR(50), os INT, l INT, sortBy VARCHAR(50))
+CREATE PROCEDURE treeNodeProjectSearch(forUserId VARCHAR(32), projectId VARCHAR(32), search VARCHAR(100), childNodeType VARCHAR(50), propertyFilters VARCHAR(5000), sortProperty VARCHAR(50), os INT, l INT, sortBy VARCHAR(50))
 BEGIN
     DECLARE totalResults INT DEFAULT 0;
 	DECLARE forUserRole VARCHAR(50) DEFAULT NULL;
@@ -1351,6 +2325,10 @@ BEGIN
 		name VARCHAR(250) NULL,
         nodeType VARCHAR(50) NOT NULL,
         childCount INT NOT NULL,
+        created DATETIME NOT NULL,
+        createdBy BINARY(16) NOT NULL,
+        modified DATETIME NOT NULL,
+        modifiedBy BINARY(16) NOT NULL,
         INDEX (name)
 	);
     
@@ -1359,20 +2337,17 @@ BEGIN
 	IF forUserRole IS NOT NULL THEN
     
 		IF childNodeType = '' OR childNodeType = 'any' THEN
-			INSERT INTO tempTreeNodeProjectSearch (id, parent, project, name, nodeType, childCount) SELECT tn1.id, tn1.parent, tn1.project, tn1.name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount FROM treeNode AS tn1 WHERE tn1.project = UNHEX(projectId) AND MATCH(tn1.name) AGAINST(search IN NATURAL LANGUAGE MODE); 
+			INSERT INTO tempTreeNodeProjectSearch (id, parent, project, name, nodeType, childCount, created, createdBy, modified, modifiedBy) SELECT tn1.id, tn1.parent, tn1.project, tn1.name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount, tn1.created, tn1.createdBy, tn1.modified, tn1.modifiedBy FROM treeNode AS tn1 WHERE tn1.project = UNHEX(projectId) AND tn1.trash IS NULL AND _treeNode_propertiesMatch(tn1.id, propertyFilters) AND MATCH(tn1.name) AGAINST(search IN NATURAL LANGUAGE MODE); 
 		ELSE
-			INSERT INTO tempTreeNodeProjectSearch (id, parent, project, name, nodeType, childCount) SELECT tn1.id, tn1.parent, tn1.project, tn1.name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount FROM treeNode AS tn1 WHERE tn1.project = UNHEX(projectId) AND tn1.nodeType = childNodeType AND MATCH(tn1.name) AGAINST(search IN NATURAL LANGUAGE MODE);
+			INSERT INTO tempTreeNodeProjectSearch (id, parent, project, name, nodeType, childCount, created, createdBy, modified, modifiedBy) SELECT tn1.id, tn1.parent, tn1.project, tn1.name, tn1.nodeType, (SELECT COUNT(*) + (SELECT COUNT(*) FROM documentVersion WHERE document = tn1.id) + (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = tn1.id) FROM treenode AS tn2 WHERE tn1.id = tn2.parent) AS childCount, tn1.created, tn1.createdBy, tn1.modified, tn1.modifiedBy FROM treeNode AS tn1 WHERE tn1.project = UNHEX(projectId) AND tn1.nodeType = childNodeType AND tn1.trash IS NULL AND _treeNode_propertiesMatch(tn1.id, propertyFilters) AND MATCH(tn1.name) AGAINST(search IN NATURAL LANGUAGE MODE);
 		END IF;
 		SELECT COUNT(*) INTO totalResults FROM tempTreeNodeProjectSearch;
 		
 		IF os >= totalResults OR l = 0 THEN
 			SELECT totalResults;
-		ELSE IF sortBy = 'nameDesc' THEN
-			SELECT totalResults, lex(id) AS id, lex(parent) AS parent, lex(project) AS project, name, nodeType, childCount FROM tempTreeNodeProjectSearch ORDER BY name DESC LIMIT os, l;
 		ELSE
-			SELECT totalResults, lex(id) AS id, lex(parent) AS parent, lex(project) AS project, name, nodeType, childCount FROM tempTreeNodeProjectSearch ORDER BY name ASC LIMIT os, l;		
+			SELECT totalResults, lex(id) AS id, lex(parent) AS parent, lex(project) AS project, name, nodeType, childCount, created, lex(createdBy) AS createdBy, modified, lex(modifiedBy) AS modifiedBy, _treeNode_properties(id) AS properties FROM tempTreeNodeProjectSearch ORDER BY CASE WHEN sortBy = 'createdAsc' THEN created END ASC, CASE WHEN sortBy = 'createdDesc' THEN created END DESC, CASE WHEN sortBy = 'modifiedAsc' THEN modified END ASC, CASE WHEN sortBy = 'modifiedDesc' THEN modified END DESC, CASE WHEN sortBy = 'typeAsc' THEN nodeType END ASC, CASE WHEN sortBy = 'typeDesc' THEN nodeType END DESC, CASE WHEN sortBy = 'propertyAsc' THEN (SELECT tp.numberValue FROM treeNodeProperty AS tp WHERE tp.treeNode = tempTreeNodeProjectSearch.id AND tp.name = sortProperty) END ASC, CASE WHEN sortBy = 'propertyAsc' THEN (SELECT tp.value FROM treeNodeProperty AS tp WHERE tp.treeNode = tempTreeNodeProjectSearch.id AND tp.name = sortProperty) END ASC, CASE WHEN sortBy = 'propertyDesc' THEN (SELECT tp.numberValue FROM treeNodeProperty AS tp WHERE tp.treeNode = tempTreeNodeProjectSearch.id AND tp.name = sortProperty) END DESC, CASE WHEN sortBy = 'propertyDesc' THEN (SELECT tp.value FROM treeNodeProperty AS tp WHERE tp.treeNode = tempTreeNodeProjectSearch.id AND tp.name = sortProperty) END DESC, CASE WHEN sortBy = 'nameDesc' THEN name END DESC, name ASC LIMIT os, l;
 		END IF;
-        END IF;
     END IF;
     
     DROP TEMPORARY TABLE IF EXISTS tempTreeNodeProjectSearch;
@@ -1383,18 +2358,28 @@ DELIMITER ;
 
 # START DOCUMENTVERSION
 
+DROP FUNCTION IF EXISTS _documentVersion_nextVersion;
+DELIMITER $$
+CREATE FUNCTION _documentVersion_nextVersion(documentId BINARY(16)) RETURNS MEDIUMINT NOT DETERMINISTIC
+BEGIN
+	#deleted version numbers are never issued again
+	RETURN GREATEST(IFNULL((SELECT MAX(version) FROM documentVersion WHERE document = documentId), 0), IFNULL((SELECT MAX(version) FROM documentVersionDeleted WHERE document = documentId), 0)) + 1;
+END$$
+DELIMITER ;
+
 DROP PROCEDURE IF EXISTS documentVersionCreate;
 DELIMITER $$
-CREATE PROCEDURE documentVersionCreate(forUserId VARCHAR(32), documentId VARCHAR(32), documentVersionId VARCHAR(32), uploadComment VARCHAR(250), fileType VARCHAR(50), fileExtension VARCHAR(10), urn VARCHAR(1000), status VARCHAR(50), thumbnailType VARCHAR(50))
+CREATE PROCEDURE documentVersionCreate(forUserId VARCHAR(32), documentId VARCHAR(32), documentVersionId VARCHAR(32), uploadComment VARCHAR(250), fileType VARCHAR(50), fileExtension VARCHAR(10), urn VARCHAR(1000), status VARCHAR(50), thumbnailType VARCHAR(50), contentHash CHAR(64), mimeType VARCHAR(100), imageInfo TEXT)
 BEGIN
-	DECLARE projectId BINARY(16) DEFAULT (SELECT project FROM treeNode WHERE id = UNHEX(documentId));
+	DECLARE projectId BINARY(16) DEFAULT (SELECT project FROM treeNode WHERE id = UNHEX(documentId) AND trash IS NULL);
     DECLARE forUserRole VARCHAR(50) DEFAULT _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
-    DECLARE version INT DEFAULT (SELECT COUNT(*) FROM documentVersion WHERE document = UNHEX(documentId)) + 1;
+    DECLARE version INT DEFAULT _documentVersion_nextVersion(UNHEX(documentId));
     
     IF forUserRole IN ('owner', 'admin', 'organiser', 'contributor') THEN
-		INSERT INTO documentVersion (id, document, version, project, uploaded, uploadComment, uploadedBy, fileType, fileExtension, urn, status, thumbnailType)
-        VALUES (UNHEX(documentVersionId), UNHEX(documentId), version, projectId, UTC_TIMESTAMP(), uploadComment, UNHEX(forUserId), fileType, fileExtension, urn, status, thumbnailType);
-        SELECT lex(dv.id) AS id, lex(document) AS document, version, lex(project) AS project, uploaded, uploadComment, lex(uploadedBy) AS uploadedBy, fileType, fileExtension, urn, status, thumbnailType, 0 AS sheetCount FROM documentVersion AS dv WHERE dv.id = UNHEX(documentVersionId);
+		INSERT INTO documentVersion (id, document, version, project, uploaded, uploadComment, uploadedBy, fileType, fileExtension, urn, status, thumbnailType, retryCount, lastError, nextRetry, progress, translationMessages, contentHash, mimeType, imageInfo)
+        VALUES (UNHEX(documentVersionId), UNHEX(documentId), version, projectId, UTC_TIMESTAMP(), uploadComment, UNHEX(forUserId), fileType, fileExtension, urn, status, thumbnailType, 0, '', NULL, '', '[]', contentHash, mimeType, imageInfo);
+        UPDATE treeNode SET modified = UTC_TIMESTAMP(), modifiedBy = UNHEX(forUserId) WHERE id = UNHEX(documentId);
+        SELECT lex(dv.id) AS id, lex(document) AS document, version, lex(project) AS project, uploaded, uploadComment, lex(uploadedBy) AS uploadedBy, fileType, fileExtension, urn, status, thumbnailType, retryCount, lastError, nextRetry, progress, translationMessages, contentHash, mimeType, imageInfo, 0 AS sheetCount FROM documentVersion AS dv WHERE dv.id = UNHEX(documentVersionId);
 	ELSE
 		SIGNAL SQLSTATE 
 			'45002'
@@ -1407,9 +2392,128 @@ DELIMITER ;
 
 DROP PROCEDURE IF EXISTS documentVersionSetStatus;
 DELIMITER $$
-CREATE PROCEDURE documentVersionSetStatus(documentVersionId VARCHAR(32), newStatus VARCHAR(50))
+CREATE PROCEDURE documentVersionSetStatus(documentVersionId VARCHAR(32), newUrn VARCHAR(1000), newStatus VARCHAR(50), newRetryCount INT, newLastError VARCHAR(1000), newNextRetry VARCHAR(19), newProgress VARCHAR(50), newTranslationMessages TEXT)
 BEGIN
-	UPDATE documentVersion SET status = newStatus WHERE id = UNHEX(documentVersionId);
+	UPDATE documentVersion SET urn = newUrn, status = newStatus, retryCount = newRetryCount, lastError = newLastError, nextRetry = IF(newNextRetry = '', NULL, newNextRetry), progress = newProgress, translationMessages = newTranslationMessages WHERE id = UNHEX(documentVersionId);
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS documentVersionResetTranslation;
+DELIMITER $$
+CREATE PROCEDURE documentVersionResetTranslation(documentVersionId VARCHAR(32), newUrn VARCHAR(1000), newStatus VARCHAR(50))
+BEGIN
+	UPDATE documentVersion SET urn = newUrn, status = newStatus, retryCount = 0, lastError = '', nextRetry = NULL, progress = '', translationMessages = '[]' WHERE id = UNHEX(documentVersionId);
+	DELETE FROM sheet WHERE documentVersion = UNHEX(documentVersionId);
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS documentVersionRetranslate;
+DELIMITER $$
+CREATE PROCEDURE documentVersionRetranslate(forUserId VARCHAR(32), documentVersionId VARCHAR(32), newStatus VARCHAR(50), newLastError VARCHAR(1000))
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT (SELECT project FROM documentVersion WHERE id = UNHEX(documentVersionId));
+	DECLARE forUserRole VARCHAR(50) DEFAULT _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
+    
+	IF forUserRole IN ('owner', 'admin') THEN
+		IF (SELECT status FROM documentVersion WHERE id = UNHEX(documentVersionId)) IN ('failed', 'failed_to_register', 'timeout') THEN
+			UPDATE documentVersion SET status = newStatus, retryCount = 0, lastError = newLastError, nextRetry = NULL, progress = '', translationMessages = '[]' WHERE id = UNHEX(documentVersionId);
+		ELSE
+			SIGNAL SQLSTATE 
+				'45003'
+			SET
+				MESSAGE_TEXT = 'Invalid action: documentVersion retranslate',
+				MYSQL_ERRNO = 45003;
+		END IF;
+	ELSE
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: documentVersion retranslate',
+			MYSQL_ERRNO = 45002;
+    END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS documentVersionPromote;
+DELIMITER $$
+CREATE PROCEDURE documentVersionPromote(forUserId VARCHAR(32), documentVersionId VARCHAR(32), newDocumentVersionId VARCHAR(32), uploadComment VARCHAR(250))
+BEGIN
+	DECLARE documentId BINARY(16) DEFAULT (SELECT document FROM documentVersion WHERE id = UNHEX(documentVersionId));
+	DECLARE projectId BINARY(16) DEFAULT (SELECT project FROM treeNode WHERE id = documentId AND trash IS NULL);
+    DECLARE forUserRole VARCHAR(50) DEFAULT _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
+    DECLARE version INT DEFAULT _documentVersion_nextVersion(documentId);
+	DECLARE EXIT HANDLER FOR SQLEXCEPTION
+	BEGIN
+		ROLLBACK;
+		RESIGNAL;
+	END;
+    
+    IF forUserRole IN ('owner', 'admin', 'organiser', 'contributor') THEN
+		IF (SELECT COUNT(*) FROM documentVersion AS dv1 INNER JOIN documentVersion AS dv2 ON dv1.document = dv2.document WHERE dv1.id = UNHEX(documentVersionId) AND dv2.version > dv1.version) > 0 THEN
+			START TRANSACTION;
+			INSERT INTO documentVersion (id, document, version, project, uploaded, uploadComment, uploadedBy, fileType, fileExtension, urn, status, thumbnailType, retryCount, lastError, nextRetry, progress, translationMessages, contentHash, mimeType, imageInfo)
+			SELECT UNHEX(newDocumentVersionId), document, version, project, UTC_TIMESTAMP(), uploadComment, UNHEX(forUserId), fileType, fileExtension, urn, status, thumbnailType, retryCount, lastError, nextRetry, progress, translationMessages, contentHash, mimeType, imageInfo FROM documentVersion WHERE id = UNHEX(documentVersionId);
+			INSERT INTO sheet (id, documentVersion, project, name, baseUrn, manifest, thumbnails, role) SELECT opUuid(), UNHEX(newDocumentVersionId), project, name, baseUrn, manifest, thumbnails, role FROM sheet WHERE documentVersion = UNHEX(documentVersionId);
+			UPDATE treeNode SET modified = UTC_TIMESTAMP(), modifiedBy = UNHEX(forUserId) WHERE id = documentId;
+			COMMIT;
+			SELECT lex(dv.id) AS id, lex(document) AS document, version, lex(project) AS project, uploaded, uploadComment, lex(uploadedBy) AS uploadedBy, fileType, fileExtension, urn, status, thumbnailType, retryCount, lastError, nextRetry, progress, translationMessages, contentHash, mimeType, imageInfo, (SELECT COUNT(*) FROM sheet AS s WHERE s.documentVersion = dv.id) AS sheetCount FROM documentVersion AS dv WHERE dv.id = UNHEX(newDocumentVersionId);
+		ELSE
+			SIGNAL SQLSTATE 
+				'45003'
+			SET
+				MESSAGE_TEXT = 'Invalid action: documentVersion promote latest version',
+				MYSQL_ERRNO = 45003;
+		END IF;
+	ELSE
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: documentVersion promote',
+			MYSQL_ERRNO = 45002;
+    END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS documentVersionDelete;
+DELIMITER $$
+CREATE PROCEDURE documentVersionDelete(forUserId VARCHAR(32), documentVersionId VARCHAR(32), forceDelete BOOL)
+BEGIN
+	DECLARE documentId BINARY(16) DEFAULT (SELECT document FROM documentVersion WHERE id = UNHEX(documentVersionId));
+	DECLARE projectId BINARY(16) DEFAULT (SELECT project FROM treeNode WHERE id = documentId AND trash IS NULL);
+	DECLARE EXIT HANDLER FOR SQLEXCEPTION
+	BEGIN
+		ROLLBACK;
+		RESIGNAL;
+	END;
+    
+    IF _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId)) IN ('owner', 'admin') THEN
+		IF (SELECT COUNT(*) FROM documentVersion WHERE document = documentId) < 2 THEN
+			SIGNAL SQLSTATE 
+				'45003'
+			SET
+				MESSAGE_TEXT = 'Invalid action: documentVersion delete only version',
+				MYSQL_ERRNO = 45003;
+		ELSEIF NOT forceDelete AND (SELECT COUNT(*) FROM sheet AS s INNER JOIN sheetTransform AS st ON s.id = st.sheet INNER JOIN projectSpaceVersionSheetTransform AS pst ON st.id = pst.sheetTransform WHERE s.documentVersion = UNHEX(documentVersionId)) > 0 THEN
+			SIGNAL SQLSTATE 
+				'45003'
+			SET
+				MESSAGE_TEXT = 'Invalid action: documentVersion delete referenced by projectSpaceVersion',
+				MYSQL_ERRNO = 45003;
+		ELSE
+			START TRANSACTION;
+			INSERT INTO documentVersionDeleted (document, version, deleted, deletedBy) SELECT document, version, UTC_TIMESTAMP(), UNHEX(forUserId) FROM documentVersion WHERE id = UNHEX(documentVersionId);
+			#sheets, sheetTransforms, projectSpaceVersion links and clashTests go with it by cascade
+			DELETE FROM documentVersion WHERE id = UNHEX(documentVersionId);
+			UPDATE treeNode SET modified = UTC_TIMESTAMP(), modifiedBy = UNHEX(forUserId) WHERE id = documentId;
+			COMMIT;
+		END IF;
+	ELSE
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: documentVersion delete',
+			MYSQL_ERRNO = 45002;
+    END IF;
 END$$
 DELIMITER ;
 
@@ -1424,7 +2528,7 @@ BEGIN
 		SELECT project INTO projectId FROM documentVersion WHERE id = (SELECT id FROM tempIds LIMIT 1) LIMIT 1;
         SELECT COUNT(DISTINCT project) INTO distinctProjectsCount FROM documentVersion AS dv INNER JOIN tempIds AS t ON dv.id = t.id;
         IF distinctProjectsCount = 1 AND projectId IS NOT NULL AND _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId)) IS NOT NULL THEN
-			SELECT lex(dv.id) AS id, lex(document) AS document, version, lex(project) AS project, uploaded, uploadComment, lex(uploadedBy) AS uploadedBy, fileType, fileExtension, urn, status, thumbnailType, (SELECT COUNT(*) FROM sheet AS s WHERE s.documentVersion = dv.id) AS sheetCount FROM documentVersion AS dv INNER JOIN tempIds AS t ON dv.id = t.id;
+			SELECT lex(dv.id) AS id, lex(document) AS document, version, lex(project) AS project, uploaded, uploadComment, lex(uploadedBy) AS uploadedBy, fileType, fileExtension, urn, status, thumbnailType, retryCount, lastError, nextRetry, progress, translationMessages, contentHash, mimeType, imageInfo, (SELECT COUNT(*) FROM sheet AS s WHERE s.documentVersion = dv.id) AS sheetCount FROM documentVersion AS dv INNER JOIN tempIds AS t ON dv.id = t.id;
         ELSE
 			SIGNAL SQLSTATE 
 				'45002'
@@ -1462,9 +2566,9 @@ BEGIN
         IF os >= totalResults OR l = 0 THEN
 			SELECT totalResults;
 		ELSE IF sortBy = 'versionAsc' THEN
-			SELECT totalResults, lex(dv.id) AS id, lex(dv.document) AS document, dv.version, lex(dv.project) AS project, dv.uploaded, dv.uploadComment, lex(dv.uploadedBy) AS uploadedBy, dv.fileType, dv.fileExtension, dv.urn, dv.status, dv.thumbnailType, (SELECT COUNT(*) FROM sheet AS s WHERE s.documentVersion = dv.id) AS sheetCount FROM documentVersion AS dv WHERE dv.document = UNHEX(documentId) ORDER BY version ASC LIMIT os, l;
+			SELECT totalResults, lex(dv.id) AS id, lex(dv.document) AS document, dv.version, lex(dv.project) AS project, dv.uploaded, dv.uploadComment, lex(dv.uploadedBy) AS uploadedBy, dv.fileType, dv.fileExtension, dv.urn, dv.status, dv.thumbnailType, dv.retryCount, dv.lastError, dv.nextRetry, dv.progress, dv.translationMessages, dv.contentHash, dv.mimeType, dv.imageInfo, (SELECT COUNT(*) FROM sheet AS s WHERE s.documentVersion = dv.id) AS sheetCount FROM documentVersion AS dv WHERE dv.document = UNHEX(documentId) ORDER BY version ASC LIMIT os, l;
 		ELSE
-			SELECT totalResults, lex(dv.id) AS id, lex(dv.document) AS document, dv.version, lex(dv.project) AS project, dv.uploaded, dv.uploadComment, lex(dv.uploadedBy) AS uploadedBy, dv.fileType, dv.fileExtension, dv.urn, dv.status, dv.thumbnailType, (SELECT COUNT(*) FROM sheet AS s WHERE s.documentVersion = dv.id) AS sheetCount FROM documentVersion AS dv WHERE dv.document = UNHEX(documentId) ORDER BY version DESC LIMIT os, l;
+			SELECT totalResults, lex(dv.id) AS id, lex(dv.document) AS document, dv.version, lex(dv.project) AS project, dv.uploaded, dv.uploadComment, lex(dv.uploadedBy) AS uploadedBy, dv.fileType, dv.fileExtension, dv.urn, dv.status, dv.thumbnailType, dv.retryCount, dv.lastError, dv.nextRetry, dv.progress, dv.translationMessages, dv.contentHash, dv.mimeType, dv.imageInfo, (SELECT COUNT(*) FROM sheet AS s WHERE s.documentVersion = dv.id) AS sheetCount FROM documentVersion AS dv WHERE dv.document = UNHEX(documentId) ORDER BY version DESC LIMIT os, l;
         END IF;
         END IF;
     ELSE 
@@ -1477,6 +2581,42 @@ BEGIN
 END$$
 DELIMITER ;
 
+DROP PROCEDURE IF EXISTS documentVersionFindByHash;
+DELIMITER $$
+CREATE PROCEDURE documentVersionFindByHash(forUserId VARCHAR(32), projectId VARCHAR(32), hash CHAR(64))
+BEGIN
+	IF _permission_getRole(UNHEX(forUserId), UNHEX(projectId), UNHEX(forUserId)) IS NOT NULL THEN
+		SELECT lex(dv.id) AS id, lex(dv.document) AS document, dv.version, lex(dv.project) AS project, dv.uploaded, dv.uploadComment, lex(dv.uploadedBy) AS uploadedBy, dv.fileType, dv.fileExtension, dv.urn, dv.status, dv.thumbnailType, dv.retryCount, dv.lastError, dv.nextRetry, dv.progress, dv.translationMessages, dv.contentHash, dv.mimeType, dv.imageInfo, (SELECT COUNT(*) FROM sheet AS s WHERE s.documentVersion = dv.id) AS sheetCount FROM documentVersion AS dv INNER JOIN treeNode AS tn ON dv.document = tn.id WHERE dv.project = UNHEX(projectId) AND dv.contentHash = LOWER(hash) AND tn.trash IS NULL ORDER BY dv.uploaded ASC;
+	ELSE
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: documentVersion find by hash',
+			MYSQL_ERRNO = 45002;
+    END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS documentVersionGetByUrn;
+DELIMITER $$
+CREATE PROCEDURE documentVersionGetByUrn(documentVersionUrn VARCHAR(1000))
+BEGIN
+	SELECT lex(dv.id) AS id, lex(dv.document) AS document, dv.version, lex(dv.project) AS project, dv.uploaded, dv.uploadComment, lex(dv.uploadedBy) AS uploadedBy, dv.fileType, dv.fileExtension, dv.urn, dv.status, dv.thumbnailType, dv.retryCount, dv.lastError, dv.nextRetry, dv.progress, dv.translationMessages, dv.contentHash, dv.mimeType, dv.imageInfo, (SELECT COUNT(*) FROM sheet AS s WHERE s.documentVersion = dv.id) AS sheetCount FROM documentVersion AS dv WHERE dv.urn = documentVersionUrn;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS documentVersionGetPendingTranslations;
+DELIMITER $$
+CREATE PROCEDURE documentVersionGetPendingTranslations(l INT)
+BEGIN
+	IF l < 0 THEN
+		SET l = 0;
+	END IF;
+    
+	SELECT lex(dv.id) AS id, lex(dv.document) AS document, dv.version, lex(dv.project) AS project, dv.uploaded, dv.uploadComment, lex(dv.uploadedBy) AS uploadedBy, dv.fileType, dv.fileExtension, dv.urn, dv.status, dv.thumbnailType, dv.retryCount, dv.lastError, dv.nextRetry, dv.progress, dv.translationMessages, dv.contentHash, dv.mimeType, dv.imageInfo, 0 AS sheetCount FROM documentVersion AS dv WHERE dv.status IN ('registered', 'pending', 'inprogress', 'failed_to_register') AND (dv.nextRetry IS NULL OR dv.nextRetry <= UTC_TIMESTAMP()) ORDER BY dv.uploaded ASC LIMIT l;
+END$$
+DELIMITER ;
+
 # END DOCUMENTVERSION
 
 # START PROJECTSPACEVERSION
@@ -1485,13 +2625,14 @@ DROP PROCEDURE IF EXISTS projectSpaceVersionCreate;
 DELIMITER $$
 CREATE PROCEDURE projectSpaceVersionCreate(forUserId VARCHAR(32), projectSpaceId VARCHAR(32), projectSpaceVersionId VARCHAR(32), createComment VARCHAR(250), cameraJson VARCHAR(1000), thumbnailType VARCHAR(50))
 BEGIN
-	DECLARE projectId BINARY(16) DEFAULT (SELECT project FROM treeNode WHERE id = UNHEX(projectSpaceId));
+	DECLARE projectId BINARY(16) DEFAULT (SELECT project FROM treeNode WHERE id = UNHEX(projectSpaceId) AND trash IS NULL);
     DECLARE forUserRole VARCHAR(50) DEFAULT _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
     DECLARE version INT DEFAULT (SELECT COUNT(*) FROM projectSpaceVersion WHERE projectSpace = UNHEX(projectSpaceId)) + 1;
     
     IF forUserRole IN ('owner', 'admin', 'organiser', 'contributor') THEN
 		INSERT INTO projectSpaceVersion (id, projectSpace, version, project, created, createComment, createdBy, cameraJson, thumbnailType)
         VALUES (UNHEX(projectSpaceVersionId), UNHEX(projectSpaceId), version, projectId, UTC_TIMESTAMP(), createComment, UNHEX(forUserId), cameraJson, thumbnailType);
+        UPDATE treeNode SET modified = UTC_TIMESTAMP(), modifiedBy = UNHEX(forUserId) WHERE id = UNHEX(projectSpaceId);
         SELECT lex(psv.id) AS id, lex(projectSpace) AS projectSpace, version, lex(project) AS project, created, createComment, lex(createdBy) AS createdBy, cameraJson, thumbnailType, 0 AS sheetTransformCount FROM projectSpaceVersion AS psv WHERE psv.id = UNHEX(projectSpaceVersionId);
 	ELSE
 		SIGNAL SQLSTATE 
@@ -1580,6 +2721,14 @@ BEGIN
 END$$
 DELIMITER ;
 
+DROP PROCEDURE IF EXISTS sheetGetPdfThumbnailManifests;
+DELIMITER $$
+CREATE PROCEDURE sheetGetPdfThumbnailManifests(documentVersionId VARCHAR(32))
+BEGIN
+	SELECT manifest FROM sheet WHERE documentVersion = UNHEX(documentVersionId) AND role = 'pdf' AND thumbnails != '';
+END$$
+DELIMITER ;
+
 DROP PROCEDURE IF EXISTS sheetSetName;
 DELIMITER $$
 CREATE PROCEDURE sheetSetName(forUserId VARCHAR(32), sheetId VARCHAR(32), newName VARCHAR(250))
@@ -1701,7 +2850,7 @@ BEGIN
         INDEX (name)
 	);
     
-    INSERT INTO tempSheetGlobalSearch (id, documentVersion, project, name, baseUrn, manifest, thumbnails, role) SELECT s.id, s.documentVersion, s.project, s.name, s.baseUrn, s.manifest, s.thumbnails, s.role FROM sheet AS s INNER JOIN permission AS p ON s.project = p.project WHERE p.user = UNHEX(forUserId) AND MATCH(s.name) AGAINST(search IN NATURAL LANGUAGE MODE); 
+    INSERT INTO tempSheetGlobalSearch (id, documentVersion, project, name, baseUrn, manifest, thumbnails, role) SELECT s.id, s.documentVersion, s.project, s.name, s.baseUrn, s.manifest, s.thumbnails, s.role FROM sheet AS s INNER JOIN permission AS p ON s.project = p.project INNER JOIN documentVersion AS dv ON s.documentVersion = dv.id INNER JOIN treeNode AS tn ON dv.document = tn.id WHERE p.user = UNHEX(forUserId) AND tn.trash IS NULL AND MATCH(s.name) AGAINST(search IN NATURAL LANGUAGE MODE); 
     SELECT COUNT(*) INTO totalResults FROM tempSheetGlobalSearch;
     
     IF os >= totalResults OR l = 0 THEN
@@ -1753,7 +2902,7 @@ BEGIN
     SET forUserRole = _permission_getRole(UNHEX(forUserId), UNHEX(projectId), UNHEX(forUserId));
     
     IF forUserRole IS NOT NULL THEN
-		INSERT INTO tempSheetProjectSearch (id, documentVersion, project, name, baseUrn, manifest, thumbnails, role) SELECT id, documentVersion, project, name, baseUrn, manifest, thumbnails, role FROM sheet WHERE project = UNHEX(projectId) AND MATCH(name) AGAINST(search IN NATURAL LANGUAGE MODE); 
+		INSERT INTO tempSheetProjectSearch (id, documentVersion, project, name, baseUrn, manifest, thumbnails, role) SELECT s.id, s.documentVersion, s.project, s.name, s.baseUrn, s.manifest, s.thumbnails, s.role FROM sheet AS s INNER JOIN documentVersion AS dv ON s.documentVersion = dv.id INNER JOIN treeNode AS tn ON dv.document = tn.id WHERE s.project = UNHEX(projectId) AND tn.trash IS NULL AND MATCH(s.name) AGAINST(search IN NATURAL LANGUAGE MODE); 
 		SELECT COUNT(*) INTO totalResults FROM tempSheetProjectSearch;
     
 		IF os >= totalResults OR l = 0 THEN
@@ -2019,6 +3168,109 @@ DELIMITER ;
 
 # END CLASH
 
+# START UPLOAD
+
+DROP PROCEDURE IF EXISTS uploadSessionCreate;
+DELIMITER $$
+CREATE PROCEDURE uploadSessionCreate(forUserId VARCHAR(32), uploadSessionId VARCHAR(32), parentId VARCHAR(32), fileName VARCHAR(250), fileType VARCHAR(50), size BIGINT)
+BEGIN
+	DECLARE projectId BINARY(16) DEFAULT (SELECT project FROM treeNode WHERE id = UNHEX(parentId) AND trash IS NULL AND nodeType IN ('folder', 'document'));
+    DECLARE forUserRole VARCHAR(50) DEFAULT _permission_getRole(UNHEX(forUserId), projectId, UNHEX(forUserId));
+    
+	IF forUserRole IN ('owner', 'admin', 'organiser', 'contributor') THEN
+		IF size >= 0 THEN
+			INSERT INTO uploadSession (id, project, parent, createdBy, fileName, fileType, size, received, chunkCount, status, created, updated)
+			VALUES (UNHEX(uploadSessionId), projectId, UNHEX(parentId), UNHEX(forUserId), fileName, fileType, size, 0, 0, 'uploading', UTC_TIMESTAMP(), UTC_TIMESTAMP());
+			SELECT lex(id) AS id, lex(project) AS project, lex(parent) AS parent, lex(createdBy) AS createdBy, fileName, fileType, size, received, chunkCount, status, created, updated FROM uploadSession WHERE id = UNHEX(uploadSessionId);
+		ELSE
+			SIGNAL SQLSTATE 
+				'45003'
+			SET
+				MESSAGE_TEXT = 'Invalid action: uploadSession create with negative size',
+				MYSQL_ERRNO = 45003;
+		END IF;
+	ELSE
+		SIGNAL SQLSTATE 
+			'45002'
+		SET
+			MESSAGE_TEXT = 'Unauthorized action: uploadSession create',
+			MYSQL_ERRNO = 45002;
+    END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS uploadSessionGet;
+DELIMITER $$
+CREATE PROCEDURE uploadSessionGet(forUserId VARCHAR(32), uploadSessionId VARCHAR(32))
+BEGIN
+	SELECT lex(id) AS id, lex(project) AS project, lex(parent) AS parent, lex(createdBy) AS createdBy, fileName, fileType, size, received, chunkCount, status, created, updated FROM uploadSession WHERE id = UNHEX(uploadSessionId) AND createdBy = UNHEX(forUserId);
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS uploadSessionAddChunk;
+DELIMITER $$
+CREATE PROCEDURE uploadSessionAddChunk(forUserId VARCHAR(32), uploadSessionId VARCHAR(32), chunkOffset BIGINT, chunkLength BIGINT, chunkId VARCHAR(32))
+BEGIN
+	DECLARE chunkIdx INT DEFAULT (SELECT chunkCount FROM uploadSession WHERE id = UNHEX(uploadSessionId));
+    
+	UPDATE uploadSession SET received = received + chunkLength, chunkCount = chunkCount + 1, updated = UTC_TIMESTAMP() WHERE id = UNHEX(uploadSessionId) AND createdBy = UNHEX(forUserId) AND status = 'uploading' AND received = chunkOffset AND chunkCount = chunkIdx AND received + chunkLength <= size;
+	IF ROW_COUNT() = 1 THEN
+		INSERT INTO uploadSessionChunk (uploadSession, chunkIndex, id) VALUES (UNHEX(uploadSessionId), chunkIdx, UNHEX(chunkId));
+		SELECT lex(id) AS id, lex(project) AS project, lex(parent) AS parent, lex(createdBy) AS createdBy, fileName, fileType, size, received, chunkCount, status, created, updated FROM uploadSession WHERE id = UNHEX(uploadSessionId);
+	ELSE
+		SIGNAL SQLSTATE 
+			'45003'
+		SET
+			MESSAGE_TEXT = 'Invalid action: uploadSession add chunk at unexpected offset',
+			MYSQL_ERRNO = 45003;
+    END IF;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS uploadSessionGetChunks;
+DELIMITER $$
+CREATE PROCEDURE uploadSessionGetChunks(forUserId VARCHAR(32), uploadSessionId VARCHAR(32))
+BEGIN
+	SELECT lex(c.id) AS id FROM uploadSessionChunk AS c INNER JOIN uploadSession AS s ON c.uploadSession = s.id WHERE s.id = UNHEX(uploadSessionId) AND s.createdBy = UNHEX(forUserId) ORDER BY c.chunkIndex;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS uploadSessionSetStatus;
+DELIMITER $$
+CREATE PROCEDURE uploadSessionSetStatus(forUserId VARCHAR(32), uploadSessionId VARCHAR(32), fromStatus VARCHAR(50), toStatus VARCHAR(50))
+BEGIN
+	UPDATE uploadSession SET status = toStatus, updated = UTC_TIMESTAMP() WHERE id = UNHEX(uploadSessionId) AND createdBy = UNHEX(forUserId) AND status = fromStatus;
+	SELECT ROW_COUNT() = 1 AS changed;
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS uploadSessionDelete;
+DELIMITER $$
+CREATE PROCEDURE uploadSessionDelete(forUserId VARCHAR(32), uploadSessionId VARCHAR(32))
+BEGIN
+	DELETE FROM uploadSession WHERE id = UNHEX(uploadSessionId) AND createdBy = UNHEX(forUserId);
+END$$
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS uploadSessionPurgeExpired;
+DELIMITER $$
+CREATE PROCEDURE uploadSessionPurgeExpired(updatedBefore DATETIME)
+BEGIN
+	DROP TEMPORARY TABLE IF EXISTS tempUploadSessionPurge;
+	CREATE TEMPORARY TABLE tempUploadSessionPurge(
+		id BINARY(16) NOT NULL,
+		project BINARY(16) NOT NULL,
+		PRIMARY KEY (id)
+	);
+	INSERT INTO tempUploadSessionPurge (id, project) SELECT id, project FROM uploadSession WHERE updated < updatedBefore;
+	SELECT lex(t.project) AS project, lex(t.id) AS uploadSession, lex(c.id) AS chunk FROM tempUploadSessionPurge AS t INNER JOIN uploadSessionChunk AS c ON t.id = c.uploadSession INNER JOIN uploadSession AS s ON t.id = s.id WHERE s.status <> 'completed';
+	DELETE s FROM uploadSession AS s INNER JOIN tempUploadSessionPurge AS t ON s.id = t.id;
+	DROP TEMPORARY TABLE IF EXISTS tempUploadSessionPurge;
+END$$
+DELIMITER ;
+
+# END UPLOAD
+
 # This username and password are for local testing purposes only, 
 # formally deployed environments should have cryptographically
 # strong usernames and passwords maintained by ops, developers
@@ -3,6 +3,9 @@ package core
 import (
 	"database/sql"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/modelhub/caca"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/clashtest"
 	"github.com/modelhub/core/documentversion"
 	"github.com/modelhub/core/helper"
 	"github.com/modelhub/core/project"
@@ -10,27 +13,34 @@ import (
 	"github.com/modelhub/core/sheet"
 	"github.com/modelhub/core/sheettransform"
 	"github.com/modelhub/core/treenode"
+	"github.com/modelhub/core/upload"
 	"github.com/modelhub/core/user"
+	"github.com/modelhub/core/util"
 	"github.com/modelhub/vada"
 	"github.com/robsix/golog"
-	"time"
-	"github.com/modelhub/core/clashtest"
-	"github.com/modelhub/caca"
 )
 
-func NewSqlCoreApi(mySqlConnection string, vada vada.VadaClient, caca caca.CacaClient, subTaskTimeout time.Duration, batchGetTimeout time.Duration, ossBucketPrefix string, ossBucketPolicy vada.BucketPolicy, log golog.Log) (CoreApi, error) {
+func NewSqlCoreApi(mySqlConnection string, blobStore blob.BlobStore, vada vada.VadaClient, caca caca.CacaClient, fileTypes util.FileTypeRegistry, settings Settings, translationCallbackSecret string, ossBucketPrefix string, log golog.Log) (CoreApi, error) {
+	settings = settings.withDefaults()
+	if fileTypes == nil {
+		fileTypes = util.NewFileTypeRegistry()
+	}
 	if db, err := sql.Open("mysql", mySqlConnection); err != nil {
 		return nil, err
 	} else {
 		us := user.NewSqlUserStore(db, log)
-		ps := project.NewSqlProjectStore(db, vada, ossBucketPrefix, ossBucketPolicy, log)
-		tns := treenode.NewSqlTreeNodeStore(db, subTaskTimeout, vada, caca, ossBucketPrefix, log)
-		dvs := documentversion.NewSqlDocumentVersionStore(db, subTaskTimeout, vada, ossBucketPrefix, log)
-		psvs := projectspaceversion.NewSqlProjectSpaceVersionStore(db, subTaskTimeout, vada, caca, ossBucketPrefix, log)
-		ss := sheet.NewSqlSheetStore(db, vada, log)
+		ps := project.NewSqlProjectStore(db, blobStore, ossBucketPrefix, log)
+		tns := treenode.NewSqlTreeNodeStore(db, settings.SubTaskTimeout, blobStore, vada, fileTypes, caca, settings.TrashRetention, ossBucketPrefix, log)
+		tp := treenode.NewSqlTrashPurger(db, blobStore, settings.TrashRetention, settings.TrashPurgeInterval, ossBucketPrefix, log)
+		dvs := documentversion.NewSqlDocumentVersionStore(db, blobStore, vada, fileTypes, ossBucketPrefix, translationCallbackSecret, log)
+		psvs := projectspaceversion.NewSqlProjectSpaceVersionStore(db, settings.SubTaskTimeout, blobStore, caca, ossBucketPrefix, log)
+		ss := sheet.NewSqlSheetStore(db, blobStore, vada, ossBucketPrefix, log)
 		sts := sheettransform.NewSqlSheetTransformStore(db, log)
 		cts := clashtest.NewSqlClashTestStore(db, caca, log)
-		h := helper.NewHelper(tns, dvs, psvs, ss, batchGetTimeout, log)
-		return newCoreApi(us, ps, tns, dvs, psvs, ss, sts, cts, h)
+		tm := documentversion.NewSqlTranslationMonitor(db, settings.TranslationPollInterval, settings.TranslationPollConcurrency, settings.SubTaskTimeout, blobStore, vada, ossBucketPrefix, log)
+		ups := upload.NewSqlUploadStore(db, tns, dvs, blobStore, ossBucketPrefix, log)
+		up := upload.NewSqlUploadPurger(db, blobStore, settings.UploadExpiry, settings.UploadPurgeInterval, ossBucketPrefix, log)
+		h := helper.NewHelper(tns, dvs, psvs, ss, settings.BatchGetTimeout, log)
+		return newCoreApi(us, ps, tns, tp, dvs, tm, psvs, ss, sts, cts, ups, up, h)
 	}
 }
@@ -1,26 +1,78 @@
 package treenode
 
 import (
+	"errors"
 	"strings"
 )
 
 const (
-	NameAsc  = sortBy("nameAsc")
-	NameDesc = sortBy("nameDesc")
+	NameAsc      = sortBy("nameAsc")
+	NameDesc     = sortBy("nameDesc")
+	CreatedAsc   = sortBy("createdAsc")
+	CreatedDesc  = sortBy("createdDesc")
+	ModifiedAsc  = sortBy("modifiedAsc")
+	ModifiedDesc = sortBy("modifiedDesc")
+	TypeAsc      = sortBy("typeAsc")
+	TypeDesc     = sortBy("typeDesc")
+	DeletedAsc   = sortBy("deletedAsc")   //used for trash listing only
+	DeletedDesc  = sortBy("deletedDesc")  //used for trash listing only
+	PropertyAsc  = sortBy("propertyAsc")  //used with PropertyQuery.Sort only
+	PropertyDesc = sortBy("propertyDesc") //used with PropertyQuery.Sort only
 
 	Any          = nodeType("any") //used for results filtering only
 	Folder       = nodeType("folder")
 	Document     = nodeType("document")
 	ProjectSpace = nodeType("projectSpace")
+
+	TextProperty    = propertyType("text")
+	NumberProperty  = propertyType("number")
+	DateProperty    = propertyType("date")
+	BooleanProperty = propertyType("boolean")
+
+	ArchiveFolderCreated   = archiveEntryAction("folderCreated")
+	ArchiveFolderExists    = archiveEntryAction("folderExists")
+	ArchiveDocumentCreated = archiveEntryAction("documentCreated")
+	ArchiveVersionCreated  = archiveEntryAction("versionCreated")
+	ArchiveVersionExists   = archiveEntryAction("versionExists")
+	ArchiveEntrySkipped    = archiveEntryAction("skipped")
+	ArchiveEntryFailed     = archiveEntryAction("failed")
+
+	documentVersionType     = "documentVersion"
+	projectSpaceVersionType = "projectSpaceVersion"
+	treeNodeType            = "treeNode"
 )
 
+var errDuplicateContent = errors.New("Invalid action: documentVersion create with the same content as the latest version")
+
 type sortBy string
 type nodeType string
+type propertyType string
+type archiveEntryAction string
 
 func SortBy(sb string) sortBy {
 	switch strings.ToLower(sb) {
 	case "namedesc":
 		return NameDesc
+	case "createdasc":
+		return CreatedAsc
+	case "createddesc":
+		return CreatedDesc
+	case "modifiedasc":
+		return ModifiedAsc
+	case "modifieddesc":
+		return ModifiedDesc
+	case "typeasc":
+		return TypeAsc
+	case "typedesc":
+		return TypeDesc
+	case "deletedasc":
+		return DeletedAsc
+	case "deleteddesc":
+		return DeletedDesc
+	case "propertyasc":
+		return PropertyAsc
+	case "propertydesc":
+		return PropertyDesc
 	default:
 		return NameAsc
 	}
@@ -38,3 +90,16 @@ func NodeType(nt string) nodeType {
 		return Any
 	}
 }
+
+func PropertyType(pt string) propertyType {
+	switch strings.ToLower(pt) {
+	case "number":
+		return NumberProperty
+	case "date":
+		return DateProperty
+	case "boolean":
+		return BooleanProperty
+	default:
+		return TextProperty
+	}
+}
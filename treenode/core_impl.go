@@ -1,49 +1,105 @@
 package treenode
 
 import (
+	"archive/zip"
+	encoding "encoding/json"
 	"errors"
+	"fmt"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/sheet"
 	"github.com/modelhub/core/sheettransform"
 	"github.com/modelhub/core/util"
 	"github.com/modelhub/vada"
 	"github.com/robsix/golog"
 	"github.com/robsix/json"
 	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func newTreeNodeStore(createFolder createFolder, createDocument createDocument, createProjectSpace createProjectSpace, saveSheetTransformsForProjectSpace sheettransform.SaveSheetTransformsForProjectSpace, setName setName, move move, get get, getChildren getChildren, getParents getParents, globalSearch globalSearch, projectSearch projectSearch, getRole util.GetRole, vada vada.VadaClient, ossBucketPrefix string, log golog.Log) TreeNodeStore {
+func newTreeNodeStore(createFolder createFolder, createDocument createDocument, createDocumentVersion createDocumentVersion, createProjectSpace createProjectSpace, saveSheetTransformsForProjectSpace sheettransform.SaveSheetTransformsForProjectSpace, saveSheets sheet.SaveSheets, getPdfThumbnailSuffixes sheet.GetPdfThumbnailSuffixes, setName setName, setPropertyDefinition setPropertyDefinition, removePropertyDefinition removePropertyDefinition, getPropertyDefinitions getPropertyDefinitions, setProperties setProperties, move move, moveAcrossProjects moveAcrossProjects, getBlobs getBlobs, copy copy, removeCopy removeCopy, resetTranslation resetTranslation, delete delete, listTrash listTrash, restore restore, purge purge, get get, getChildren getChildren, getDescendants getDescendants, getArchiveVersions getArchiveVersions, getParents getParents, resolvePath resolvePath, listPath listPath, globalSearch globalSearch, projectSearch projectSearch, getRole util.GetRole, blobStore blob.BlobStore, vada vada.VadaClient, fileTypes util.FileTypeRegistry, trashRetention time.Duration, ossBucketPrefix string, log golog.Log) TreeNodeStore {
 	return &treeNodeStore{
 		createFolder:                       createFolder,
 		createDocument:                     createDocument,
+		createDocumentVersion:              createDocumentVersion,
 		createProjectSpace:                 createProjectSpace,
 		saveSheetTransformsForProjectSpace: saveSheetTransformsForProjectSpace,
-		setName:         setName,
-		move:            move,
-		get:             get,
-		getChildren:     getChildren,
-		getParents:      getParents,
-		globalSearch:    globalSearch,
-		projectSearch:   projectSearch,
-		getRole:         getRole,
-		vada:            vada,
-		ossBucketPrefix: ossBucketPrefix,
-		log:             log,
+		saveSheets:                         saveSheets,
+		getPdfThumbnailSuffixes:            getPdfThumbnailSuffixes,
+		setName:                            setName,
+		setPropertyDefinition:              setPropertyDefinition,
+		removePropertyDefinition:           removePropertyDefinition,
+		getPropertyDefinitions:             getPropertyDefinitions,
+		setProperties:                      setProperties,
+		move:                               move,
+		moveAcrossProjects:                 moveAcrossProjects,
+		getBlobs:                           getBlobs,
+		copy:                               copy,
+		removeCopy:                         removeCopy,
+		resetTranslation:                   resetTranslation,
+		delete:                             delete,
+		listTrash:                          listTrash,
+		restore:                            restore,
+		purge:                              purge,
+		get:                                get,
+		getChildren:                        getChildren,
+		getDescendants:                     getDescendants,
+		getArchiveVersions:                 getArchiveVersions,
+		getParents:                         getParents,
+		resolvePath:                        resolvePath,
+		listPath:                           listPath,
+		globalSearch:                       globalSearch,
+		projectSearch:                      projectSearch,
+		getRole:                            getRole,
+		blobStore:                          blobStore,
+		vada:                               vada,
+		fileTypes:                          fileTypes,
+		trashRetention:                     trashRetention,
+		ossBucketPrefix:                    ossBucketPrefix,
+		log:                                log,
 	}
 }
 
 type treeNodeStore struct {
 	createFolder                       createFolder
 	createDocument                     createDocument
+	createDocumentVersion              createDocumentVersion
 	createProjectSpace                 createProjectSpace
 	saveSheetTransformsForProjectSpace sheettransform.SaveSheetTransformsForProjectSpace
+	saveSheets                         sheet.SaveSheets
+	getPdfThumbnailSuffixes            sheet.GetPdfThumbnailSuffixes
 	setName                            setName
+	setPropertyDefinition              setPropertyDefinition
+	removePropertyDefinition           removePropertyDefinition
+	getPropertyDefinitions             getPropertyDefinitions
+	setProperties                      setProperties
 	move                               move
+	moveAcrossProjects                 moveAcrossProjects
+	getBlobs                           getBlobs
+	copy                               copy
+	removeCopy                         removeCopy
+	resetTranslation                   resetTranslation
+	delete                             delete
+	listTrash                          listTrash
+	restore                            restore
+	purge                              purge
 	get                                get
 	getChildren                        getChildren
+	getDescendants                     getDescendants
+	getArchiveVersions                 getArchiveVersions
 	getParents                         getParents
+	resolvePath                        resolvePath
+	listPath                           listPath
 	globalSearch                       globalSearch
 	projectSearch                      projectSearch
 	getRole                            util.GetRole
+	blobStore                          blob.BlobStore
 	vada                               vada.VadaClient
+	fileTypes                          util.FileTypeRegistry
+	trashRetention                     time.Duration
 	ossBucketPrefix                    string
 	log                                golog.Log
 }
@@ -86,19 +142,397 @@ func (tns *treeNodeStore) CreateDocument(forUser string, parent string, name str
 		}
 	}
 
-	if newDocVerId, status, urn, fileExtension, fileType, thumbnailType, err := util.DocumentUploadHelper(fileName, fileType, file, thumbnailType, thumbnail, tns.ossBucketPrefix+projectId, tns.vada, tns.log); err != nil {
+	if newDocVerId, status, urn, fileExtension, fileType, thumbnailType, contentHash, mimeType, imageInfo, err := util.DocumentUploadHelper(fileName, fileType, file, thumbnailType, thumbnail, tns.ossBucketPrefix+projectId, tns.blobStore, tns.vada, tns.fileTypes, nil, tns.log); err != nil {
 		return nil, err
 	} else {
-		if treeNode, err := tns.createDocument(forUser, parent, name, newDocVerId, uploadComment, fileType, fileExtension, urn, status, thumbnailType); err != nil {
+		if treeNode, err := tns.createDocument(forUser, parent, name, newDocVerId, uploadComment, fileType, fileExtension, urn, status, thumbnailType, contentHash, mimeType, imageInfo); err != nil {
 			tns.log.Error("TreeNodeStore.CreateDocument error: forUser: %q parent: %q name: %q uploadComment: %q fileType: %q fileExtension: %q thumbnailType: %q error: %v", forUser, parent, name, uploadComment, fileType, fileExtension, thumbnailType, err)
 			return treeNode, err
 		} else {
+			if fileType == "pdf" {
+				tns.savePdfSheets(newDocVerId, projectId, fileExtension)
+			}
 			tns.log.Info("TreeNodeStore.CreateDocument success: forUser: %q parent: %q name: %q uploadComment: %q fileType: %q fileExtension: %q thumbnailType: %q treeNode: %v", forUser, parent, name, uploadComment, fileType, fileExtension, thumbnailType, treeNode)
 			return treeNode, nil
 		}
 	}
 }
 
+// ImportArchive recreates the folder hierarchy of archive under parent with a
+// document per file, files whose path is already a document become a new
+// version of it unless they match its latest version. Names are matched case
+// insensitively. Problems with single entries are reported in the results
+// rather than failing the whole import. Contributors can't create folders so
+// may only import archives without any.
+func (tns *treeNodeStore) ImportArchive(forUser string, parent string, archive *zip.Reader, uploadComment string) ([]*ArchiveEntryResult, error) {
+	if archive == nil {
+		err := errors.New("archive required")
+		tns.log.Error("TreeNodeStore.ImportArchive error: forUser: %q parent: %q error: %v", forUser, parent, err)
+		return nil, err
+	}
+	var projectId string
+	if treeNodes, err := tns.get(forUser, []string{parent}); err != nil || len(treeNodes) == 0 || treeNodes[0].NodeType != Folder {
+		if err == nil {
+			err = errors.New("Invalid action: import archive under a none folder parent")
+		}
+		tns.log.Error("TreeNodeStore.ImportArchive error: forUser: %q parent: %q error: %v", forUser, parent, err)
+		return nil, err
+	} else {
+		projectId = treeNodes[0].Project
+		if role, err := tns.getRole(forUser, projectId); err != nil {
+			tns.log.Error("TreeNodeStore.ImportArchive error: forUser: %q parent: %q error: %v", forUser, parent, err)
+			return nil, err
+		} else if !(role == "owner" || role == "admin" || role == "organiser" || role == "contributor") {
+			err := errors.New("Unauthorized Action: treeNode import archive")
+			tns.log.Error("TreeNodeStore.ImportArchive error: forUser: %q parent: %q error: %v", forUser, parent, err)
+			return nil, err
+		} else if role == "contributor" && archiveHasFolders(archive) {
+			//contributors can't create folders so would only get part of the archive imported
+			err := errors.New("Unauthorized Action: treeNode import archive with folders")
+			tns.log.Error("TreeNodeStore.ImportArchive error: forUser: %q parent: %q error: %v", forUser, parent, err)
+			return nil, err
+		}
+	}
+
+	latest, err := tns.getArchiveVersions(forUser, parent, false)
+	if err != nil {
+		tns.log.Error("TreeNodeStore.ImportArchive error: forUser: %q parent: %q error: %v", forUser, parent, err)
+		return nil, err
+	}
+	imp := &archiveImport{tns: tns, forUser: forUser, project: projectId, folders: map[string]string{"": parent}, children: map[string]map[string]*TreeNode{}, contentHashes: make(map[string]string, len(latest))}
+	for _, av := range latest {
+		imp.contentHashes[av.document] = av.contentHash
+	}
+	results := make([]*ArchiveEntryResult, 0, len(archive.File))
+	failed := 0
+	for _, entry := range archive.File {
+		res := imp.importEntry(entry, uploadComment)
+		if res.Action == ArchiveEntryFailed {
+			failed++
+		}
+		results = append(results, res)
+	}
+	tns.log.Info("TreeNodeStore.ImportArchive success: forUser: %q parent: %q entries: %d failed: %d", forUser, parent, len(results), failed)
+	return results, nil
+}
+
+// archiveHasFolders reports whether importing archive would create any folders.
+func archiveHasFolders(archive *zip.Reader) bool {
+	for _, entry := range archive.File {
+		if entryPath, skip, err := cleanArchivePath(entry.Name); err == nil && !skip && (entry.FileInfo().IsDir() || strings.Contains(entryPath, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+type archiveImport struct {
+	tns           *treeNodeStore
+	forUser       string
+	project       string
+	folders       map[string]string               //archive dir -> folder id
+	children      map[string]map[string]*TreeNode //folder id -> lower case name -> child, loaded on first use
+	contentHashes map[string]string               //document id -> contentHash of its latest version
+}
+
+func (imp *archiveImport) importEntry(entry *zip.File, uploadComment string) *ArchiveEntryResult {
+	res := &ArchiveEntryResult{Path: entry.Name}
+	fail := func(err error) *ArchiveEntryResult {
+		res.Action, res.Error = ArchiveEntryFailed, err.Error()
+		return res
+	}
+	entryPath, skip, err := cleanArchivePath(entry.Name)
+	if err != nil {
+		return fail(err)
+	} else if skip {
+		res.Action = ArchiveEntrySkipped
+		return res
+	}
+
+	if entry.FileInfo().IsDir() {
+		folder, created, err := imp.folder(entryPath)
+		if err != nil {
+			return fail(err)
+		}
+		res.Action, res.TreeNode = ArchiveFolderExists, folder
+		if created {
+			res.Action = ArchiveFolderCreated
+		}
+		return res
+	}
+
+	dir, name := path.Split(entryPath)
+	folder, _, err := imp.folder(strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return fail(err)
+	}
+	existing, err := imp.child(folder, name)
+	if err != nil {
+		return fail(err)
+	}
+	file, err := entry.Open()
+	if err != nil {
+		return fail(err)
+	}
+	if existing == nil {
+		tn, err := imp.tns.CreateDocument(imp.forUser, folder, name, uploadComment, "", name, file, "", nil)
+		if err != nil {
+			return fail(err)
+		}
+		imp.children[folder][strings.ToLower(name)] = tn
+		res.Action, res.TreeNode = ArchiveDocumentCreated, tn.Id
+	} else if existing.NodeType == Document {
+		contentHash, err := imp.tns.addDocumentVersion(imp.forUser, imp.project, existing.Id, uploadComment, name, file, imp.contentHashes[existing.Id])
+		if err == errDuplicateContent {
+			res.Action, res.TreeNode = ArchiveVersionExists, existing.Id
+			return res
+		} else if err != nil {
+			return fail(err)
+		}
+		imp.contentHashes[existing.Id] = contentHash
+		res.Action, res.TreeNode = ArchiveVersionCreated, existing.Id
+	} else {
+		file.Close()
+		return fail(fmt.Errorf("Invalid action: import archive file over a %s", existing.NodeType))
+	}
+	return res
+}
+
+// folder returns the folder for an archive dir, creating any that are missing
+// along the way, created is only set when the dir itself was created.
+func (imp *archiveImport) folder(dir string) (id string, created bool, err error) {
+	if id, exists := imp.folders[dir]; exists {
+		return id, false, nil
+	}
+	parentDir, name := path.Split(dir)
+	parent, _, err := imp.folder(strings.TrimSuffix(parentDir, "/"))
+	if err != nil {
+		return "", false, err
+	}
+	existing, err := imp.child(parent, name)
+	if err != nil {
+		return "", false, err
+	}
+	if existing == nil {
+		if existing, err = imp.tns.CreateFolder(imp.forUser, parent, name); err != nil {
+			return "", false, err
+		}
+		imp.children[parent][strings.ToLower(name)] = existing
+		created = true
+	} else if existing.NodeType != Folder {
+		return "", false, fmt.Errorf("Invalid action: import archive folder over a %s", existing.NodeType)
+	}
+	imp.folders[dir] = existing.Id
+	return existing.Id, created, nil
+}
+
+func (imp *archiveImport) child(folder string, name string) (*TreeNode, error) {
+	if _, loaded := imp.children[folder]; !loaded {
+		children := map[string]*TreeNode{}
+		for offset, totalResults := 0, 1; offset < totalResults; {
+			treeNodes, total, err := imp.tns.getChildren(imp.forUser, folder, Any, nil, offset, util.DefaultSqlOffsetQueryLimit, NameAsc)
+			if err != nil {
+				return nil, err
+			}
+			for _, tn := range treeNodes {
+				if _, exists := children[strings.ToLower(tn.Name)]; !exists {
+					children[strings.ToLower(tn.Name)] = tn
+				}
+			}
+			if len(treeNodes) == 0 {
+				break
+			}
+			offset, totalResults = offset+len(treeNodes), total
+		}
+		imp.children[folder] = children
+	}
+	return imp.children[folder][strings.ToLower(name)], nil
+}
+
+// cleanArchivePath normalises an entry name to a slash separated relative
+// path, skip is set for os metadata entries that aren't worth importing.
+func cleanArchivePath(name string) (entryPath string, skip bool, err error) {
+	entryPath = path.Clean(strings.Replace(name, "\\", "/", -1))
+	if strings.HasPrefix(entryPath, "/") || entryPath == ".." || strings.HasPrefix(entryPath, "../") {
+		return "", false, errors.New("Invalid action: import archive entry outside of the archive")
+	}
+	if entryPath == "." || entryPath == "__MACOSX" || strings.HasPrefix(entryPath, "__MACOSX/") {
+		return "", true, nil
+	}
+	if base := path.Base(entryPath); base == ".DS_Store" || base == "Thumbs.db" {
+		return "", true, nil
+	}
+	return entryPath, false, nil
+}
+
+// ExportArchive streams the folder id into w as a ZIP with a directory per
+// folder and a file per exported documentVersion, all under a directory named
+// after the folder, followed by manifest.json describing every entry. A file
+// that can't be read is left out and the error recorded on its manifest entry.
+func (tns *treeNodeStore) ExportArchive(forUser string, id string, w io.Writer, options *ExportOptions) error {
+	if options == nil {
+		options = &ExportOptions{}
+	}
+	var root *TreeNode
+	if treeNodes, err := tns.get(forUser, []string{id}); err != nil || len(treeNodes) == 0 || treeNodes[0].NodeType != Folder {
+		if err == nil {
+			err = errors.New("Invalid action: export archive of a none folder")
+		}
+		tns.log.Error("TreeNodeStore.ExportArchive error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	} else {
+		root = treeNodes[0]
+		if role, err := tns.getRole(forUser, root.Project); err != nil {
+			tns.log.Error("TreeNodeStore.ExportArchive error: forUser: %q id: %q error: %v", forUser, id, err)
+			return err
+		} else if !(role == "owner" || role == "admin" || role == "organiser" || role == "contributor") {
+			err := errors.New("Unauthorized Action: treeNode export archive")
+			tns.log.Error("TreeNodeStore.ExportArchive error: forUser: %q id: %q error: %v", forUser, id, err)
+			return err
+		}
+	}
+
+	descendants, err := tns.getDescendants(forUser, id, 0, Any)
+	if err != nil {
+		tns.log.Error("TreeNodeStore.ExportArchive error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	}
+	versions, err := tns.getArchiveVersions(forUser, id, options.AllVersions)
+	if err != nil {
+		tns.log.Error("TreeNodeStore.ExportArchive error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	}
+
+	exp := &archiveExport{
+		zw:       zip.NewWriter(w),
+		nodes:    map[string]*TreeNode{id: root},
+		paths:    map[string]string{},
+		used:     map[string]bool{},
+		manifest: &ArchiveManifest{Root: id, Exported: time.Now().UTC(), AllVersions: options.AllVersions, Entries: make([]*ArchiveManifestEntry, 0, len(descendants)+len(versions)+1)},
+	}
+	for _, tn := range descendants {
+		exp.nodes[tn.Id] = tn
+	}
+	if err := exp.writeFolders(id, descendants); err != nil {
+		tns.log.Error("TreeNodeStore.ExportArchive error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	}
+
+	bucket := tns.ossBucketPrefix + root.Project
+	for _, av := range versions {
+		doc, exists := exp.nodes[av.document]
+		if !exists || doc.NodeType != Document {
+			continue
+		}
+		parentPath, exists := exp.paths[doc.Parent]
+		if !exists {
+			continue
+		}
+		name, ext := archiveName(doc.Name), ""
+		if av.fileExtension != "" {
+			ext = "." + av.fileExtension
+			name = strings.TrimSuffix(name, ext)
+		}
+		if options.AllVersions {
+			name += ".v" + strconv.Itoa(av.version)
+		}
+		entryPath := exp.uniquePath(parentPath + "/" + name + ext)
+		uploaded := av.uploaded
+		entry := &ArchiveManifestEntry{
+			Path:            entryPath,
+			TreeNode:        doc.Id,
+			NodeType:        Document,
+			DocumentVersion: av.id,
+			Version:         av.version,
+			Uploaded:        &uploaded,
+			UploadComment:   av.uploadComment,
+			UploadedBy:      av.uploadedBy,
+			FileType:        av.fileType,
+			MimeType:        av.mimeType,
+			ContentHash:     av.contentHash,
+		}
+		exp.manifest.Entries = append(exp.manifest.Entries, entry)
+		//a blob that can't be read only loses that one file, the rest of the archive is still worth having
+		res, err := tns.blobStore.Get(bucket, av.id+ext)
+		if err != nil {
+			tns.log.Warning("TreeNodeStore.ExportArchive skipping documentVersion: forUser: %q id: %q documentVersion: %q error: %v", forUser, id, av.id, err)
+			entry.Error = err.Error()
+			continue
+		}
+		err = writeArchiveEntry(exp.zw, res.Body, entryPath, av.uploaded)
+		res.Body.Close()
+		if err != nil {
+			tns.log.Error("TreeNodeStore.ExportArchive error: forUser: %q id: %q documentVersion: %q error: %v", forUser, id, av.id, err)
+			return err
+		}
+	}
+
+	if mw, err := exp.zw.Create("manifest.json"); err != nil {
+		tns.log.Error("TreeNodeStore.ExportArchive error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	} else if err := encoding.NewEncoder(mw).Encode(exp.manifest); err != nil {
+		tns.log.Error("TreeNodeStore.ExportArchive error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	}
+	if err := exp.zw.Close(); err != nil {
+		tns.log.Error("TreeNodeStore.ExportArchive error: forUser: %q id: %q error: %v", forUser, id, err)
+		return err
+	}
+	tns.log.Info("TreeNodeStore.ExportArchive success: forUser: %q id: %q allVersions: %t documentVersions: %d", forUser, id, options.AllVersions, len(versions))
+	return nil
+}
+
+// writeArchiveEntry copies file into a new entry of zw without buffering it in memory.
+func writeArchiveEntry(zw *zip.Writer, file io.Reader, entryPath string, modified time.Time) error {
+	header := &zip.FileHeader{Name: entryPath, Method: zip.Deflate}
+	header.SetModTime(modified)
+	ew, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(ew, file)
+	return err
+}
+
+// addDocumentVersion uploads file as a new version of an existing document
+// through the same upload helper as CreateDocument, a file with the same
+// latestContentHash is removed again and errDuplicateContent returned.
+func (tns *treeNodeStore) addDocumentVersion(forUser string, projectId string, document string, uploadComment string, fileName string, file io.ReadCloser, latestContentHash string) (string, error) {
+	checkDuplicate := func(contentHash string) error {
+		if latestContentHash != "" && latestContentHash == contentHash {
+			return errDuplicateContent
+		}
+		return nil
+	}
+
+	if newDocVerId, status, urn, fileExtension, fileType, thumbnailType, contentHash, mimeType, imageInfo, err := util.DocumentUploadHelper(fileName, "", file, "", nil, tns.ossBucketPrefix+projectId, tns.blobStore, tns.vada, tns.fileTypes, checkDuplicate, tns.log); err == errDuplicateContent {
+		tns.log.Info("TreeNodeStore.addDocumentVersion success: forUser: %q document: %q fileName: %q unchanged contentHash: %q", forUser, document, fileName, contentHash)
+		return contentHash, err
+	} else if err != nil {
+		tns.log.Error("TreeNodeStore.addDocumentVersion error: forUser: %q document: %q fileName: %q error: %v", forUser, document, fileName, err)
+		return "", err
+	} else if err := tns.createDocumentVersion(forUser, document, newDocVerId, uploadComment, fileType, fileExtension, urn, status, thumbnailType, contentHash, mimeType, imageInfo); err != nil {
+		tns.log.Error("TreeNodeStore.addDocumentVersion error: forUser: %q document: %q fileName: %q error: %v", forUser, document, fileName, err)
+		return "", err
+	} else {
+		if fileType == "pdf" {
+			tns.savePdfSheets(newDocVerId, projectId, fileExtension)
+		}
+		tns.log.Info("TreeNodeStore.addDocumentVersion success: forUser: %q document: %q fileName: %q", forUser, document, fileName)
+		return contentHash, nil
+	}
+}
+
+// savePdfSheets creates the page sheets of a newly uploaded pdf, a pdf which
+// can't be read is still a valid document so failures are only logged.
+func (tns *treeNodeStore) savePdfSheets(documentVersion string, projectId string, fileExtension string) {
+	if count, err := sheet.SavePdfSheetsHelper(documentVersion, projectId, fileExtension, tns.ossBucketPrefix+projectId, tns.blobStore, tns.saveSheets); err != nil {
+		tns.log.Warning("TreeNodeStore.savePdfSheets error: documentVersion: %q error: %v", documentVersion, err)
+	} else {
+		tns.log.Info("TreeNodeStore.savePdfSheets success: documentVersion: %q sheets: %d", documentVersion, count)
+	}
+}
+
 func (tns *treeNodeStore) CreateProjectSpace(forUser string, parent string, name string, createComment string, sheetTransforms []*sheettransform.SheetTransform, camera *json.Json, thumbnailType string, thumbnail io.ReadCloser) (*TreeNode, error) {
 	var projectId string
 
@@ -131,7 +565,7 @@ func (tns *treeNodeStore) CreateProjectSpace(forUser string, parent string, name
 	}
 
 	newProjVerId := util.NewId()
-	thumbnailType, _ = util.ThumbnailUploadHelper(newProjVerId, thumbnailType, thumbnail, tns.ossBucketPrefix+projectId, tns.vada)
+	thumbnailType, _ = util.ThumbnailUploadHelper(newProjVerId, thumbnailType, thumbnail, tns.ossBucketPrefix+projectId, tns.blobStore)
 	if treeNode, err := tns.createProjectSpace(forUser, parent, name, newProjVerId, createComment, sheetTransformIds, camera, thumbnailType); err != nil {
 		tns.log.Error("TreeNodeStore.CreateProjectSpace error: forUser: %q parent: %q name: %q createComment: %q thumbnailType: %q error: %v", forUser, parent, name, createComment, thumbnailType, err)
 		return treeNode, err
@@ -150,7 +584,92 @@ func (tns *treeNodeStore) SetName(forUser string, id string, newName string) err
 	return nil
 }
 
+func (tns *treeNodeStore) SetPropertyDefinition(forUser string, project string, name string, propertyType propertyType) error {
+	if !propertyNameRegex.MatchString(name) {
+		err := errors.New("Invalid property name")
+		tns.log.Error("TreeNodeStore.SetPropertyDefinition error: forUser: %q project: %q name: %q propertyType: %q error: %v", forUser, project, name, propertyType, err)
+		return err
+	}
+	if err := tns.setPropertyDefinition(forUser, project, name, propertyType); err != nil {
+		tns.log.Error("TreeNodeStore.SetPropertyDefinition error: forUser: %q project: %q name: %q propertyType: %q error: %v", forUser, project, name, propertyType, err)
+		return err
+	}
+	tns.log.Info("TreeNodeStore.SetPropertyDefinition success: forUser: %q project: %q name: %q propertyType: %q", forUser, project, name, propertyType)
+	return nil
+}
+
+func (tns *treeNodeStore) RemovePropertyDefinition(forUser string, project string, name string) error {
+	if err := tns.removePropertyDefinition(forUser, project, name); err != nil {
+		tns.log.Error("TreeNodeStore.RemovePropertyDefinition error: forUser: %q project: %q name: %q error: %v", forUser, project, name, err)
+		return err
+	}
+	tns.log.Info("TreeNodeStore.RemovePropertyDefinition success: forUser: %q project: %q name: %q", forUser, project, name)
+	return nil
+}
+
+func (tns *treeNodeStore) GetPropertyDefinitions(forUser string, project string) ([]*PropertyDefinition, error) {
+	if propertyDefinitions, err := tns.getPropertyDefinitions(forUser, project); err != nil {
+		tns.log.Error("TreeNodeStore.GetPropertyDefinitions error: forUser: %q project: %q error: %v", forUser, project, err)
+		return nil, err
+	} else {
+		tns.log.Info("TreeNodeStore.GetPropertyDefinitions success: forUser: %q project: %q", forUser, project)
+		return propertyDefinitions, nil
+	}
+}
+
+// SetProperties merges the given values into the treeNode's properties, an
+// empty value removes that property. Values are checked against the project's
+// property definitions and stored in a normalised form so they filter and sort
+// consistently.
+func (tns *treeNodeStore) SetProperties(forUser string, id string, properties map[string]string) error {
+	treeNodes, err := tns.get(forUser, []string{id})
+	if err == nil && len(treeNodes) == 0 {
+		err = errors.New("treeNode not found")
+	}
+	if err != nil {
+		tns.log.Error("TreeNodeStore.SetProperties error: forUser: %q id: %q properties: %v error: %v", forUser, id, properties, err)
+		return err
+	}
+
+	propertyDefinitions, err := tns.getPropertyDefinitions(forUser, treeNodes[0].Project)
+	if err != nil {
+		tns.log.Error("TreeNodeStore.SetProperties error: forUser: %q id: %q properties: %v error: %v", forUser, id, properties, err)
+		return err
+	}
+	propertyTypes := make(map[string]propertyType, len(propertyDefinitions))
+	for _, pd := range propertyDefinitions {
+		propertyTypes[pd.Name] = pd.PropertyType
+	}
+
+	normalised := make(map[string]string, len(properties))
+	for name, value := range properties {
+		pt, exists := propertyTypes[name]
+		if !exists {
+			err := errors.New("Invalid property: " + name + " is not defined for this project")
+			tns.log.Error("TreeNodeStore.SetProperties error: forUser: %q id: %q properties: %v error: %v", forUser, id, properties, err)
+			return err
+		}
+		if normalised[name], err = normalisePropertyValue(pt, value); err != nil {
+			tns.log.Error("TreeNodeStore.SetProperties error: forUser: %q id: %q properties: %v error: %v", forUser, id, properties, err)
+			return err
+		}
+	}
+
+	if err := tns.setProperties(forUser, id, normalised); err != nil {
+		tns.log.Error("TreeNodeStore.SetProperties error: forUser: %q id: %q properties: %v error: %v", forUser, id, properties, err)
+		return err
+	}
+	tns.log.Info("TreeNodeStore.SetProperties success: forUser: %q id: %q properties: %v", forUser, id, normalised)
+	return nil
+}
+
 func (tns *treeNodeStore) Move(forUser string, newParent string, ids []string) error {
+	if treeNodes, err := tns.get(forUser, ids); err == nil && len(treeNodes) > 0 {
+		if parents, err := tns.get(forUser, []string{newParent}); err == nil && len(parents) > 0 && parents[0].Project != treeNodes[0].Project {
+			return tns.moveToProject(forUser, newParent, ids, treeNodes[0].Project, parents[0].Project)
+		}
+	}
+
 	if err := tns.move(forUser, newParent, ids); err != nil {
 		tns.log.Error("TreeNodeStore.Move error: forUser: %q newParent: %q ids: %v error: %v", forUser, newParent, ids, err)
 		return err
@@ -159,6 +678,241 @@ func (tns *treeNodeStore) Move(forUser string, newParent string, ids []string) e
 	return nil
 }
 
+// moveToProject copies the blobs of the moved treeNodes into the new project
+// bucket before the rows are moved and only removes the originals once the
+// rows have moved, so a failure at any point leaves every row pointing at a
+// bucket that still holds its blobs.
+func (tns *treeNodeStore) moveToProject(forUser string, newParent string, ids []string, fromProjectId string, toProjectId string) error {
+	fromBucket, toBucket := tns.ossBucketPrefix+fromProjectId, tns.ossBucketPrefix+toProjectId
+	copied := map[string]bool{}
+	undo := func() {
+		for blob := range copied {
+			if err := tns.blobStore.Delete(toBucket, blob); err != nil {
+				tns.log.Error("TreeNodeStore.Move error: forUser: %q newParent: %q ids: %v undo blob: %q error: %v", forUser, newParent, ids, blob, err)
+			}
+		}
+	}
+
+	if role, err := tns.getRole(forUser, toProjectId); err != nil || !(role == "owner" || role == "admin" || role == "organiser") {
+		if err == nil {
+			err = errors.New("Unauthorized action: treeNode move")
+		}
+		tns.log.Error("TreeNodeStore.Move error: forUser: %q newParent: %q ids: %v error: %v", forUser, newParent, ids, err)
+		return err
+	}
+
+	blobs, err := tns.getBlobs(forUser, ids)
+	if err != nil {
+		tns.log.Error("TreeNodeStore.Move error: forUser: %q newParent: %q ids: %v error: %v", forUser, newParent, ids, err)
+		return err
+	}
+	for _, blob := range blobs {
+		if _, err := tns.copyBlob(fromBucket, blob, toBucket, blob); err != nil {
+			tns.log.Error("TreeNodeStore.Move error: forUser: %q newParent: %q ids: %v blob: %q error: %v", forUser, newParent, ids, blob, err)
+			undo()
+			return err
+		}
+		copied[blob] = true
+	}
+
+	moved, err := tns.moveAcrossProjects(forUser, newParent, ids)
+	if err != nil {
+		tns.log.Error("TreeNodeStore.Move error: forUser: %q newParent: %q ids: %v error: %v", forUser, newParent, ids, err)
+		undo()
+		return err
+	}
+
+	var lastErr error
+	for _, blob := range moved {
+		if !copied[blob] {
+			//uploaded after the blobs were listed
+			if _, err := tns.copyBlob(fromBucket, blob, toBucket, blob); err != nil {
+				tns.log.Error("TreeNodeStore.Move error: forUser: %q newParent: %q ids: %v blob: %q left in bucket: %q error: %v", forUser, newParent, ids, blob, fromBucket, err)
+				lastErr = err
+				continue
+			}
+		}
+		if err := tns.blobStore.Delete(fromBucket, blob); err != nil {
+			tns.log.Error("TreeNodeStore.Move error: forUser: %q newParent: %q ids: %v blob: %q error: %v", forUser, newParent, ids, blob, err)
+		}
+	}
+
+	if lastErr != nil {
+		return lastErr
+	}
+	tns.log.Info("TreeNodeStore.Move success: forUser: %q newParent: %q ids: %v fromProject: %q toProject: %q", forUser, newParent, ids, fromProjectId, toProjectId)
+	return nil
+}
+
+func (tns *treeNodeStore) Copy(forUser string, newParent string, ids []string, includeAllVersions bool) error {
+	var fromProjectId, toProjectId string
+
+	if treeNodes, err := tns.get(forUser, ids); err != nil || len(treeNodes) == 0 {
+		if err == nil {
+			err = errors.New("treeNodes not found")
+		}
+		tns.log.Error("TreeNodeStore.Copy error: forUser: %q newParent: %q ids: %v includeAllVersions: %t error: %v", forUser, newParent, ids, includeAllVersions, err)
+		return err
+	} else {
+		fromProjectId = treeNodes[0].Project
+	}
+
+	if treeNodes, err := tns.get(forUser, []string{newParent}); err != nil || len(treeNodes) == 0 {
+		if err == nil {
+			err = errors.New("newParent not found")
+		}
+		tns.log.Error("TreeNodeStore.Copy error: forUser: %q newParent: %q ids: %v includeAllVersions: %t error: %v", forUser, newParent, ids, includeAllVersions, err)
+		return err
+	} else {
+		toProjectId = treeNodes[0].Project
+	}
+
+	versions, err := tns.copy(forUser, newParent, ids, includeAllVersions)
+	if err != nil {
+		tns.log.Error("TreeNodeStore.Copy error: forUser: %q newParent: %q ids: %v includeAllVersions: %t error: %v", forUser, newParent, ids, includeAllVersions, err)
+		return err
+	}
+
+	//the rows are already committed so a blob that can't be copied means the whole copy is removed again,
+	//straight away rather than through the trash as the purge would delete blobs the copy never wrote
+	fromBucket, toBucket := tns.ossBucketPrefix+fromProjectId, tns.ossBucketPrefix+toProjectId
+	roots := make([]string, 0, len(ids))
+	for _, v := range versions {
+		if v.versionType == treeNodeType {
+			roots = append(roots, v.to)
+		}
+	}
+	objectIds := make(map[string]string, len(versions))
+	undo := func() {
+		if err := tns.removeCopy(forUser, roots); err != nil {
+			tns.log.Error("TreeNodeStore.Copy error: forUser: %q newParent: %q ids: %v undo treeNodes: %v error: %v", forUser, newParent, ids, roots, err)
+		}
+		for blob := range objectIds {
+			if err := tns.blobStore.Delete(toBucket, blob); err != nil {
+				tns.log.Error("TreeNodeStore.Copy error: forUser: %q newParent: %q ids: %v undo blob: %q error: %v", forUser, newParent, ids, blob, err)
+			}
+		}
+	}
+	for _, v := range versions {
+		suffixes := make([]string, 0, 2)
+		if v.versionType == documentVersionType {
+			suffixes = append(suffixes, "."+v.fileExtension)
+		}
+		if v.versionType != treeNodeType && v.thumbnailType != "" {
+			suffixes = append(suffixes, ".tn.tn")
+		}
+		if v.versionType == documentVersionType && v.fileType == "pdf" {
+			pageSuffixes, err := tns.getPdfThumbnailSuffixes(v.from)
+			if err != nil {
+				tns.log.Error("TreeNodeStore.Copy error: forUser: %q newParent: %q ids: %v documentVersion: %q error: %v", forUser, newParent, ids, v.from, err)
+				undo()
+				return err
+			}
+			suffixes = append(suffixes, pageSuffixes...)
+		}
+		for _, suffix := range suffixes {
+			objectId, err := tns.copyBlob(fromBucket, v.from+suffix, toBucket, v.to+suffix)
+			if err != nil {
+				tns.log.Error("TreeNodeStore.Copy error: forUser: %q newParent: %q ids: %v blob: %q error: %v", forUser, newParent, ids, v.from+suffix, err)
+				undo()
+				return err
+			}
+			objectIds[v.to+suffix] = objectId
+		}
+	}
+
+	var lastErr error
+	for _, v := range versions {
+		//the copied sheets point at the source translation, only translate again if it can no longer
+		//be read, without a vada client it can't be checked so is left pointing there
+		if v.versionType == documentVersionType && v.fileType == "lmv" && v.urn != "" && tns.vada != nil {
+			if _, err := tns.vada.GetDocumentInfo(util.ToBase64(v.urn), ""); err != nil {
+				urn, err := util.TranslationUploadHelper(v.to+"."+v.fileExtension, objectIds[v.to+"."+v.fileExtension], toBucket, tns.blobStore, tns.vada)
+				if err == nil {
+					status := "registered"
+					if _, err := tns.vada.RegisterFile(util.ToBase64(urn)); err != nil {
+						status = "failed_to_register"
+					}
+					err = tns.resetTranslation(v.to, urn, status)
+				}
+				if err != nil {
+					tns.log.Error("TreeNodeStore.Copy error: forUser: %q newParent: %q ids: %v retranslating documentVersion: %q error: %v", forUser, newParent, ids, v.to, err)
+					lastErr = err
+				}
+			}
+		}
+	}
+
+	if lastErr != nil {
+		return lastErr
+	}
+	tns.log.Info("TreeNodeStore.Copy success: forUser: %q newParent: %q ids: %v includeAllVersions: %t", forUser, newParent, ids, includeAllVersions)
+	return nil
+}
+
+func (tns *treeNodeStore) Delete(forUser string, ids []string) error {
+	if err := tns.delete(forUser, ids); err != nil {
+		tns.log.Error("TreeNodeStore.Delete error: forUser: %q ids: %v error: %v", forUser, ids, err)
+		return err
+	}
+	tns.log.Info("TreeNodeStore.Delete success: forUser: %q ids: %v", forUser, ids)
+	return nil
+}
+
+func (tns *treeNodeStore) ListTrash(forUser string, project string, offset int, limit int, sortBy sortBy) ([]*TrashedTreeNode, int, error) {
+	if treeNodes, totalResults, err := tns.listTrash(forUser, project, offset, limit, sortBy); err != nil {
+		tns.log.Error("TreeNodeStore.ListTrash error: forUser: %q project: %q offset: %d limit: %d sortBy: %q error: %v", forUser, project, offset, limit, sortBy, err)
+		return treeNodes, totalResults, err
+	} else {
+		for _, tn := range treeNodes {
+			tn.Expires = tn.Deleted.Add(tns.trashRetention)
+		}
+		tns.log.Info("TreeNodeStore.ListTrash success: forUser: %q project: %q offset: %d limit: %d sortBy: %q totalResults: %d", forUser, project, offset, limit, sortBy, totalResults)
+		return treeNodes, totalResults, nil
+	}
+}
+
+func (tns *treeNodeStore) Restore(forUser string, ids []string) error {
+	if err := tns.restore(forUser, ids); err != nil {
+		tns.log.Error("TreeNodeStore.Restore error: forUser: %q ids: %v error: %v", forUser, ids, err)
+		return err
+	}
+	tns.log.Info("TreeNodeStore.Restore success: forUser: %q ids: %v", forUser, ids)
+	return nil
+}
+
+func (tns *treeNodeStore) Purge(forUser string, ids []string) error {
+	if blobs, err := tns.purge(forUser, ids); err != nil {
+		tns.log.Error("TreeNodeStore.Purge error: forUser: %q ids: %v error: %v", forUser, ids, err)
+		return err
+	} else {
+		deleteBlobs(blobs, tns.ossBucketPrefix, tns.blobStore, tns.log)
+	}
+	tns.log.Info("TreeNodeStore.Purge success: forUser: %q ids: %v", forUser, ids)
+	return nil
+}
+
+func (tns *treeNodeStore) copyBlob(fromBucket string, fromName string, toBucket string, toName string) (string, error) {
+	res, err := tns.blobStore.Get(fromBucket, fromName)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	return tns.blobStore.Put(toBucket, toName, res.Body)
+}
+
+// deleteBlobs removes the blobs of purged treeNodes, the rows are already gone
+// so failures are only logged.
+func deleteBlobs(blobs map[string][]string, ossBucketPrefix string, blobStore blob.BlobStore, log golog.Log) {
+	for projectId, names := range blobs {
+		for _, name := range names {
+			if err := blobStore.Delete(ossBucketPrefix+projectId, name); err != nil {
+				log.Error("TreeNodeStore deleteBlobs error: project: %q blob: %q error: %v", projectId, name, err)
+			}
+		}
+	}
+}
+
 func (tns *treeNodeStore) Get(forUser string, ids []string) ([]*TreeNode, error) {
 	if treeNodes, err := tns.get(forUser, ids); err != nil {
 		tns.log.Error("TreeNodeStore.Get error: forUser: %q ids: %v error: %v", forUser, ids, err)
@@ -169,16 +923,26 @@ func (tns *treeNodeStore) Get(forUser string, ids []string) ([]*TreeNode, error)
 	}
 }
 
-func (tns *treeNodeStore) GetChildren(forUser string, id string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
-	if treeNodes, totalResults, err := tns.getChildren(forUser, id, nodeType, offset, limit, sortBy); err != nil {
-		tns.log.Error("TreeNodeStore.GetChilren error: forUser: %q id: %q nodeType: %q offset: %d limit: %d sortBy: %q error: %v", forUser, id, nodeType, offset, limit, sortBy, err)
+func (tns *treeNodeStore) GetChildren(forUser string, id string, nodeType nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+	if treeNodes, totalResults, err := tns.getChildren(forUser, id, nodeType, query, offset, limit, sortBy); err != nil {
+		tns.log.Error("TreeNodeStore.GetChilren error: forUser: %q id: %q nodeType: %q query: %v offset: %d limit: %d sortBy: %q error: %v", forUser, id, nodeType, query, offset, limit, sortBy, err)
 		return treeNodes, totalResults, err
 	} else {
-		tns.log.Info("TreeNodeStore.GetChilren success: forUser: %q id: %q nodeType: %q offset: %d limit: %d sortBy: %q totalResults: %d", forUser, id, nodeType, offset, limit, sortBy, totalResults)
+		tns.log.Info("TreeNodeStore.GetChilren success: forUser: %q id: %q nodeType: %q query: %v offset: %d limit: %d sortBy: %q totalResults: %d", forUser, id, nodeType, query, offset, limit, sortBy, totalResults)
 		return treeNodes, totalResults, nil
 	}
 }
 
+func (tns *treeNodeStore) GetDescendants(forUser string, id string, maxDepth int, nodeType nodeType) ([]*TreeNode, error) {
+	if treeNodes, err := tns.getDescendants(forUser, id, maxDepth, nodeType); err != nil {
+		tns.log.Error("TreeNodeStore.GetDescendants error: forUser: %q id: %q maxDepth: %d nodeType: %q error: %v", forUser, id, maxDepth, nodeType, err)
+		return treeNodes, err
+	} else {
+		tns.log.Info("TreeNodeStore.GetDescendants success: forUser: %q id: %q maxDepth: %d nodeType: %q count: %d", forUser, id, maxDepth, nodeType, len(treeNodes))
+		return treeNodes, nil
+	}
+}
+
 func (tns *treeNodeStore) GetParents(forUser string, id string) ([]*TreeNode, error) {
 	if treeNodes, err := tns.getParents(forUser, id); err != nil {
 		tns.log.Error("TreeNodeStore.GetParents error: forUser: %q id: %q error: %v", forUser, id, err)
@@ -189,22 +953,146 @@ func (tns *treeNodeStore) GetParents(forUser string, id string) ([]*TreeNode, er
 	}
 }
 
-func (tns *treeNodeStore) GlobalSearch(forUser string, search string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
-	if treeNodes, totalResults, err := tns.globalSearch(forUser, search, nodeType, offset, limit, sortBy); err != nil {
-		tns.log.Error("TreeNodeStore.GlobalSearch error: forUser: %q search: %q nodeType: %q offset: %d limit: %d sortBy: %q error: %v", forUser, search, nodeType, offset, limit, sortBy, err)
+func (tns *treeNodeStore) ResolvePath(forUser string, project string, path string) (*TreeNode, error) {
+	if treeNode, err := tns.resolvePath(forUser, project, path); err != nil {
+		tns.log.Error("TreeNodeStore.ResolvePath error: forUser: %q project: %q path: %q error: %v", forUser, project, path, err)
+		return treeNode, err
+	} else {
+		tns.log.Info("TreeNodeStore.ResolvePath success: forUser: %q project: %q path: %q treeNode: %v", forUser, project, path, treeNode)
+		return treeNode, nil
+	}
+}
+
+func (tns *treeNodeStore) ListPath(forUser string, project string, path string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+	if treeNodes, totalResults, err := tns.listPath(forUser, project, path, nodeType, offset, limit, sortBy); err != nil {
+		tns.log.Error("TreeNodeStore.ListPath error: forUser: %q project: %q path: %q nodeType: %q offset: %d limit: %d sortBy: %q error: %v", forUser, project, path, nodeType, offset, limit, sortBy, err)
 		return treeNodes, totalResults, err
 	} else {
-		tns.log.Info("TreeNodeStore.GlobalSearch success: forUser: %q search: %q nodeType: %q offset: %d limit: %d sortBy: %q totalResults: %v", forUser, search, nodeType, offset, limit, sortBy, totalResults)
+		tns.log.Info("TreeNodeStore.ListPath success: forUser: %q project: %q path: %q nodeType: %q offset: %d limit: %d sortBy: %q totalResults: %d", forUser, project, path, nodeType, offset, limit, sortBy, totalResults)
 		return treeNodes, totalResults, nil
 	}
 }
 
-func (tns *treeNodeStore) ProjectSearch(forUser string, project string, search string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
-	if treeNodes, totalResults, err := tns.projectSearch(forUser, project, search, nodeType, offset, limit, sortBy); err != nil {
-		tns.log.Error("TreeNodeStore.ProjectSearch error: forUser: %q project: %q search: %q nodeType: %q offset: %d limit: %d sortBy: %q error: %v", forUser, project, search, nodeType, offset, limit, sortBy, err)
+func (tns *treeNodeStore) GlobalSearch(forUser string, search string, nodeType nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+	if treeNodes, totalResults, err := tns.globalSearch(forUser, search, nodeType, query, offset, limit, sortBy); err != nil {
+		tns.log.Error("TreeNodeStore.GlobalSearch error: forUser: %q search: %q nodeType: %q query: %v offset: %d limit: %d sortBy: %q error: %v", forUser, search, nodeType, query, offset, limit, sortBy, err)
 		return treeNodes, totalResults, err
 	} else {
-		tns.log.Info("TreeNodeStore.ProjectSearch success: forUser: %q project: %q search: %q nodeType: %q offset: %d limit: %d sortBy: %q totalResults: %d", forUser, project, search, nodeType, offset, limit, sortBy, totalResults)
+		tns.log.Info("TreeNodeStore.GlobalSearch success: forUser: %q search: %q nodeType: %q query: %v offset: %d limit: %d sortBy: %q totalResults: %v", forUser, search, nodeType, query, offset, limit, sortBy, totalResults)
 		return treeNodes, totalResults, nil
 	}
 }
+
+func (tns *treeNodeStore) ProjectSearch(forUser string, project string, search string, nodeType nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+	if treeNodes, totalResults, err := tns.projectSearch(forUser, project, search, nodeType, query, offset, limit, sortBy); err != nil {
+		tns.log.Error("TreeNodeStore.ProjectSearch error: forUser: %q project: %q search: %q nodeType: %q query: %v offset: %d limit: %d sortBy: %q error: %v", forUser, project, search, nodeType, query, offset, limit, sortBy, err)
+		return treeNodes, totalResults, err
+	} else {
+		tns.log.Info("TreeNodeStore.ProjectSearch success: forUser: %q project: %q search: %q nodeType: %q query: %v offset: %d limit: %d sortBy: %q totalResults: %d", forUser, project, search, nodeType, query, offset, limit, sortBy, totalResults)
+		return treeNodes, totalResults, nil
+	}
+}
+
+var propertyNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 _\-]{0,49}$`)
+
+// normalisePropertyValue checks a value against its property type and returns
+// it in the stored form, numbers in their shortest form, dates as UTC RFC3339
+// so they sort as text and booleans as true or false.
+func normalisePropertyValue(pt propertyType, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch pt {
+	case NumberProperty:
+		if f, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", errors.New("Invalid property value: " + value + " is not a number")
+		} else {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+	case DateProperty:
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t.UTC().Format(time.RFC3339), nil
+		} else if t, err := time.Parse("2006-01-02", value); err == nil {
+			return t.UTC().Format(time.RFC3339), nil
+		}
+		return "", errors.New("Invalid property value: " + value + " is not a date")
+	case BooleanProperty:
+		if b, err := strconv.ParseBool(value); err != nil {
+			return "", errors.New("Invalid property value: " + value + " is not a boolean")
+		} else {
+			return strconv.FormatBool(b), nil
+		}
+	default:
+		if len(value) > 1000 {
+			return "", errors.New("Invalid property value: text longer than 1000 characters")
+		}
+		return value, nil
+	}
+}
+
+// archiveExport tracks the entry paths handed out while writing an archive,
+// treeNode names needn't be unique amongst siblings but zip entry paths must be.
+type archiveExport struct {
+	zw       *zip.Writer
+	nodes    map[string]*TreeNode
+	paths    map[string]string
+	used     map[string]bool
+	manifest *ArchiveManifest
+}
+
+// writeFolders creates a directory entry for root and every folder in descendants.
+func (exp *archiveExport) writeFolders(root string, descendants []*TreeNode) error {
+	if _, err := exp.folderPath(root); err != nil {
+		return err
+	}
+	for _, tn := range descendants {
+		if tn.NodeType == Folder {
+			if _, err := exp.folderPath(tn.Id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (exp *archiveExport) folderPath(id string) (string, error) {
+	if p, exists := exp.paths[id]; exists {
+		return p, nil
+	}
+	tn := exp.nodes[id]
+	p := archiveName(tn.Name)
+	if parent, exists := exp.nodes[tn.Parent]; exists && id != exp.manifest.Root {
+		parentPath, err := exp.folderPath(parent.Id)
+		if err != nil {
+			return "", err
+		}
+		p = parentPath + "/" + p
+	}
+	p = exp.uniquePath(p)
+	exp.paths[id] = p
+	if _, err := exp.zw.Create(p + "/"); err != nil {
+		return "", err
+	}
+	exp.manifest.Entries = append(exp.manifest.Entries, &ArchiveManifestEntry{Path: p + "/", TreeNode: id, NodeType: Folder})
+	return p, nil
+}
+
+// uniquePath suffixes entryPath with " (n)" when it has already been used.
+func (exp *archiveExport) uniquePath(entryPath string) string {
+	candidate := entryPath
+	ext := path.Ext(entryPath)
+	for i := 2; exp.used[candidate]; i++ {
+		candidate = strings.TrimSuffix(entryPath, ext) + " (" + strconv.Itoa(i) + ")" + ext
+	}
+	exp.used[candidate] = true
+	return candidate
+}
+
+// archiveName makes a treeNode name safe to use as a single archive path segment.
+func archiveName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		name = "_"
+	}
+	return name
+}
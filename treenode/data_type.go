@@ -1,10 +1,109 @@
 package treenode
 
+import (
+	"time"
+)
+
 type TreeNode struct {
-	Id         string   `json:"id"`
-	Parent     string   `json:"parent"`
-	Project    string   `json:"project"`
-	NodeType   nodeType `json:"nodeType"`
-	Name       string   `json:"name"`
-	ChildCount int      `json:"childCount"`
+	Id         string            `json:"id"`
+	Parent     string            `json:"parent"`
+	Project    string            `json:"project"`
+	NodeType   nodeType          `json:"nodeType"`
+	Name       string            `json:"name"`
+	ChildCount int               `json:"childCount"`
+	Created    time.Time         `json:"created"`
+	CreatedBy  string            `json:"createdBy"`
+	Modified   time.Time         `json:"modified"`
+	ModifiedBy string            `json:"modifiedBy"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type PropertyDefinition struct {
+	Project      string       `json:"project"`
+	Name         string       `json:"name"`
+	PropertyType propertyType `json:"propertyType"`
+}
+
+// PropertyQuery narrows a listing to the treeNodes whose properties equal
+// every entry in Filters, Sort names the property ordered on by the
+// PropertyAsc and PropertyDesc sorts.
+type PropertyQuery struct {
+	Filters map[string]string `json:"filters"`
+	Sort    string            `json:"sort"`
+}
+
+type TrashedTreeNode struct {
+	TreeNode
+	Deleted   time.Time `json:"deleted"`
+	DeletedBy string    `json:"deletedBy"`
+	Expires   time.Time `json:"expires"`
+}
+
+// ArchiveEntryResult reports what ImportArchive did with one entry of the
+// archive, TreeNode is the folder or document the entry ended up as.
+type ArchiveEntryResult struct {
+	Path     string             `json:"path"`
+	Action   archiveEntryAction `json:"action"`
+	TreeNode string             `json:"treeNode,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// ExportOptions controls ExportArchive, by default only the latest version of
+// each document is exported.
+type ExportOptions struct {
+	AllVersions bool `json:"allVersions"`
+}
+
+// ArchiveManifest is written to manifest.json at the root of every exported archive.
+type ArchiveManifest struct {
+	Root        string                  `json:"root"`
+	Exported    time.Time               `json:"exported"`
+	AllVersions bool                    `json:"allVersions"`
+	Entries     []*ArchiveManifestEntry `json:"entries"`
+}
+
+// ArchiveManifestEntry describes one entry of an exported archive, Error is set
+// when the documentVersion's file couldn't be read and so isn't in the archive.
+type ArchiveManifestEntry struct {
+	Path            string     `json:"path"`
+	TreeNode        string     `json:"treeNode"`
+	NodeType        nodeType   `json:"nodeType"`
+	DocumentVersion string     `json:"documentVersion,omitempty"`
+	Version         int        `json:"version,omitempty"`
+	Uploaded        *time.Time `json:"uploaded,omitempty"`
+	UploadComment   string     `json:"uploadComment,omitempty"`
+	UploadedBy      string     `json:"uploadedBy,omitempty"`
+	FileType        string     `json:"fileType,omitempty"`
+	MimeType        string     `json:"mimeType,omitempty"`
+	ContentHash     string     `json:"contentHash,omitempty"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// archiveVersion is a documentVersion to be written into an exported archive.
+type archiveVersion struct {
+	id            string
+	document      string
+	version       int
+	uploaded      time.Time
+	uploadComment string
+	uploadedBy    string
+	fileType      string
+	fileExtension string
+	mimeType      string
+	contentHash   string
+}
+
+// copiedVersion pairs a source document or projectSpace version with the copy
+// made of it, the blobs still have to be copied across by the store. Each
+// copied root treeNode is listed too, as a treeNodeType, so a copy whose blobs
+// can't be copied can be removed again.
+type copiedVersion struct {
+	versionType   string
+	from          string
+	to            string
+	fileType      string
+	fileExtension string
+	urn           string
+	status        string
+	thumbnailType string
 }
@@ -1,31 +1,75 @@
 package treenode
 
 import (
+	"archive/zip"
 	"github.com/modelhub/core/sheettransform"
+	"github.com/modelhub/core/util"
 	"github.com/robsix/json"
 	"io"
+	"time"
 )
 
 type createFolder func(forUser string, parent string, name string) (*TreeNode, error)
-type createDocument func(forUser string, parent string, name string, documentVersion string, uploadComment string, fileType string, fileExtension string, urn string, status string, thumbnailType string) (*TreeNode, error)
+type createDocument func(forUser string, parent string, name string, documentVersion string, uploadComment string, fileType string, fileExtension string, urn string, status string, thumbnailType string, contentHash string, mimeType string, imageInfo *util.ImageInfo) (*TreeNode, error)
+type createDocumentVersion func(forUser string, document string, documentVersion string, uploadComment string, fileType string, fileExtension string, urn string, status string, thumbnailType string, contentHash string, mimeType string, imageInfo *util.ImageInfo) error
 type createProjectSpace func(forUser string, parent string, name string, projectSpaceVersion string, createComment string, sheetTransforms []string, camera *json.Json, thumbnailType string) (*TreeNode, error)
 type setName func(forUser string, id string, newName string) error
+type setPropertyDefinition func(forUser string, project string, name string, propertyType propertyType) error
+type removePropertyDefinition func(forUser string, project string, name string) error
+type getPropertyDefinitions func(forUser string, project string) ([]*PropertyDefinition, error)
+type setProperties func(forUser string, id string, properties map[string]string) error
 type move func(forUser string, newParent string, ids []string) error
+type moveAcrossProjects func(forUser string, newParent string, ids []string) ([]string, error)
+type getBlobs func(forUser string, ids []string) ([]string, error)
+type copy func(forUser string, newParent string, ids []string, includeAllVersions bool) ([]*copiedVersion, error)
+type removeCopy func(forUser string, ids []string) error
+type resetTranslation func(documentVersion string, urn string, status string) error
+type delete func(forUser string, ids []string) error
+type listTrash func(forUser string, project string, offset int, limit int, sortBy sortBy) ([]*TrashedTreeNode, int, error)
+type restore func(forUser string, ids []string) error
+type purge func(forUser string, ids []string) (map[string][]string, error)
+type purgeExpiredTrash func(deletedBefore time.Time) (map[string][]string, error)
 type get func(forUser string, ids []string) ([]*TreeNode, error)
-type getChildren func(forUser string, id string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
+type getChildren func(forUser string, id string, nodeType nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
+type resolvePath func(forUser string, project string, path string) (*TreeNode, error)
+type listPath func(forUser string, project string, path string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
+type getDescendants func(forUser string, id string, maxDepth int, nodeType nodeType) ([]*TreeNode, error)
+type getArchiveVersions func(forUser string, id string, includeAllVersions bool) ([]*archiveVersion, error)
 type getParents func(forUser string, id string) ([]*TreeNode, error)
-type globalSearch func(forUser string, search string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
-type projectSearch func(forUser string, project string, search string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
+type globalSearch func(forUser string, search string, nodeType nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
+type projectSearch func(forUser string, project string, search string, nodeType nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
 
 type TreeNodeStore interface {
 	CreateFolder(forUser string, parent string, name string) (*TreeNode, error)
 	CreateDocument(forUser string, parent string, name string, uploadComment string, fileType string, fileName string, file io.ReadCloser, thumbnailType string, thumbnail io.ReadCloser) (*TreeNode, error)
+	ImportArchive(forUser string, parent string, archive *zip.Reader, uploadComment string) ([]*ArchiveEntryResult, error)
+	ExportArchive(forUser string, id string, w io.Writer, options *ExportOptions) error
 	CreateProjectSpace(forUser string, parent string, name string, createComment string, sheetTransforms []*sheettransform.SheetTransform, camera *json.Json, thumbnailType string, thumbnail io.ReadCloser) (*TreeNode, error)
 	SetName(forUser string, id string, newName string) error
+	SetPropertyDefinition(forUser string, project string, name string, propertyType propertyType) error
+	RemovePropertyDefinition(forUser string, project string, name string) error
+	GetPropertyDefinitions(forUser string, project string) ([]*PropertyDefinition, error)
+	SetProperties(forUser string, id string, properties map[string]string) error
 	Move(forUser string, newParent string, ids []string) error
+	Copy(forUser string, newParent string, ids []string, includeAllVersions bool) error
+	Delete(forUser string, ids []string) error
+	ListTrash(forUser string, project string, offset int, limit int, sortBy sortBy) ([]*TrashedTreeNode, int, error)
+	Restore(forUser string, ids []string) error
+	Purge(forUser string, ids []string) error
 	Get(forUser string, ids []string) ([]*TreeNode, error)
-	GetChildren(forUser string, id string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
+	GetChildren(forUser string, id string, nodeType nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
+	GetDescendants(forUser string, id string, maxDepth int, nodeType nodeType) ([]*TreeNode, error)
 	GetParents(forUser string, id string) ([]*TreeNode, error)
-	GlobalSearch(forUser string, search string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
-	ProjectSearch(forUser string, project string, search string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
+	ResolvePath(forUser string, project string, path string) (*TreeNode, error)
+	ListPath(forUser string, project string, path string, nodeType nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
+	GlobalSearch(forUser string, search string, nodeType nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
+	ProjectSearch(forUser string, project string, search string, nodeType nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error)
+}
+
+// TrashPurger permanently removes treeNodes, and their blobs, once they have
+// been in the trash for longer than the retention period. Nothing is purged
+// until Start is called, which need only happen in one process.
+type TrashPurger interface {
+	Start()
+	Stop()
 }
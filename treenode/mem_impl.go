@@ -0,0 +1,1107 @@
+package treenode
+
+import (
+	"errors"
+	"github.com/modelhub/caca"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/sheet"
+	"github.com/modelhub/core/sheettransform"
+	"github.com/modelhub/core/util"
+	"github.com/modelhub/vada"
+	"github.com/robsix/golog"
+	"github.com/robsix/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func NewMemTreeNodeStore(db *util.MemDb, subTaskTimeout time.Duration, blobStore blob.BlobStore, vada vada.VadaClient, fileTypes util.FileTypeRegistry, caca caca.CacaClient, trashRetention time.Duration, ossBucketPrefix string, log golog.Log) TreeNodeStore {
+
+	toTreeNode := func(tn *util.MemTreeNode) *TreeNode {
+		var properties map[string]string
+		if values, exists := db.TreeNodeProperties[tn.Id]; exists {
+			properties = make(map[string]string, len(values))
+			for name, value := range values {
+				properties[name] = value
+			}
+		}
+		return &TreeNode{
+			Id:         tn.Id,
+			Parent:     tn.Parent,
+			Project:    tn.Project,
+			Name:       tn.Name,
+			NodeType:   nodeType(tn.NodeType),
+			ChildCount: db.TreeNodeChildCount(tn.Id),
+			Created:    tn.Created,
+			CreatedBy:  tn.CreatedBy,
+			Modified:   tn.Modified,
+			ModifiedBy: tn.ModifiedBy,
+			Properties: properties,
+		}
+	}
+
+	//lessProperty mirrors sorting on numberValue then value, nodes without the property sort first like NULLs
+	lessProperty := func(a *util.MemTreeNode, b *util.MemTreeNode, name string) (bool, bool) {
+		va, aExists := db.TreeNodeProperties[a.Id][name]
+		vb, bExists := db.TreeNodeProperties[b.Id][name]
+		if aExists != bExists {
+			return bExists, true
+		}
+		if va == vb {
+			return false, false
+		}
+		if db.TreeNodePropertyDefinitions[a.Project][name] == string(NumberProperty) && db.TreeNodePropertyDefinitions[b.Project][name] == string(NumberProperty) {
+			fa, errA := strconv.ParseFloat(va, 64)
+			fb, errB := strconv.ParseFloat(vb, 64)
+			if errA == nil && errB == nil && fa != fb {
+				return fa < fb, true
+			}
+		}
+		return va < vb, true
+	}
+
+	propertiesMatch := func(tn *util.MemTreeNode, query *PropertyQuery) bool {
+		if query == nil {
+			return true
+		}
+		for name, value := range query.Filters {
+			if v, exists := db.TreeNodeProperties[tn.Id][name]; !exists || v != value {
+				return false
+			}
+		}
+		return true
+	}
+
+	//less mirrors the ORDER BY used by the sql procs, ties and unknown sorts fall back to name ascending
+	less := func(a *util.MemTreeNode, b *util.MemTreeNode, sortBy sortBy, query *PropertyQuery) bool {
+		if (sortBy == PropertyAsc || sortBy == PropertyDesc) && query != nil {
+			if sortBy == PropertyDesc {
+				a, b = b, a
+			}
+			if isLess, ordered := lessProperty(a, b, query.Sort); ordered {
+				return isLess
+			}
+			if sortBy == PropertyDesc {
+				a, b = b, a
+			}
+		}
+		switch {
+		case sortBy == CreatedAsc && !a.Created.Equal(b.Created):
+			return a.Created.Before(b.Created)
+		case sortBy == CreatedDesc && !a.Created.Equal(b.Created):
+			return b.Created.Before(a.Created)
+		case sortBy == ModifiedAsc && !a.Modified.Equal(b.Modified):
+			return a.Modified.Before(b.Modified)
+		case sortBy == ModifiedDesc && !a.Modified.Equal(b.Modified):
+			return b.Modified.Before(a.Modified)
+		case sortBy == TypeAsc && a.NodeType != b.NodeType:
+			return a.NodeType < b.NodeType
+		case sortBy == TypeDesc && a.NodeType != b.NodeType:
+			return b.NodeType < a.NodeType
+		case sortBy == NameDesc:
+			return util.MemLessFold(b.Name, a.Name)
+		default:
+			return util.MemLessFold(a.Name, b.Name)
+		}
+	}
+
+	offsetTreeNodes := func(matches []*util.MemTreeNode, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int) {
+		sort.Slice(matches, func(i, j int) bool {
+			return less(matches[i], matches[j], sortBy, query)
+		})
+		start, end := util.MemOffsetLimit(len(matches), offset, limit)
+		tns := make([]*TreeNode, 0, end-start)
+		for _, tn := range matches[start:end] {
+			tns = append(tns, toTreeNode(tn))
+		}
+		return tns, len(matches)
+	}
+
+	nodeTypeMatches := func(tn *util.MemTreeNode, nt nodeType) bool {
+		return nt == "" || nt == Any || string(nt) == tn.NodeType
+	}
+
+	live := func(id string) (*util.MemTreeNode, bool) {
+		tn, exists := db.TreeNodes[id]
+		return tn, exists && tn.Trash == ""
+	}
+
+	subtree := func(id string) []*util.MemTreeNode {
+		return memSubtree(db, id)
+	}
+
+	collectBlobs := func(tns []*util.MemTreeNode) []string {
+		return memCollectBlobs(db, tns)
+	}
+
+	purgeNode := func(id string, blobs map[string][]string) {
+		memPurgeNode(db, id, blobs)
+	}
+
+	createNode := func(forUser string, parent string, name string, nt nodeType) (*util.MemTreeNode, error) {
+		p, exists := live(parent)
+		if !exists || p.NodeType != string(Folder) {
+			return nil, errors.New("Invalid action: place treeNodes under a none folder parent")
+		}
+		role, _ := db.Role(forUser, p.Project)
+		if !((nt == Folder && util.MemRoleIn(role, "owner", "admin", "organiser")) || (nt != Folder && util.MemRoleIn(role, "owner", "admin", "organiser", "contributor"))) {
+			return nil, errors.New("Unauthorized action: treeNode create node")
+		}
+		now := time.Now().UTC()
+		tn := &util.MemTreeNode{
+			Id:         util.NewId(),
+			Parent:     parent,
+			Project:    p.Project,
+			Name:       name,
+			NodeType:   string(nt),
+			Created:    now,
+			CreatedBy:  forUser,
+			Modified:   now,
+			ModifiedBy: forUser,
+		}
+		db.TreeNodes[tn.Id] = tn
+		return tn, nil
+	}
+
+	createFolder := func(forUser string, parent string, name string) (*TreeNode, error) {
+		db.Lock()
+		defer db.Unlock()
+		if tn, err := createNode(forUser, parent, name, Folder); err != nil {
+			return nil, err
+		} else {
+			return toTreeNode(tn), nil
+		}
+	}
+
+	createDocument := func(forUser string, parent string, name string, documentVersion string, uploadComment string, fileType string, fileExtension string, urn string, status string, thumbnailType string, contentHash string, mimeType string, imageInfo *util.ImageInfo) (*TreeNode, error) {
+		db.Lock()
+		defer db.Unlock()
+		tn, err := createNode(forUser, parent, name, Document)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := db.CreateDocumentVersion(forUser, tn.Id, documentVersion, uploadComment, fileType, fileExtension, urn, status, thumbnailType, contentHash, mimeType, imageInfo); err != nil {
+			db.DeleteTreeNode(tn.Id)
+			return nil, err
+		}
+		return toTreeNode(tn), nil
+	}
+
+	createDocumentVersion := func(forUser string, document string, documentVersion string, uploadComment string, fileType string, fileExtension string, urn string, status string, thumbnailType string, contentHash string, mimeType string, imageInfo *util.ImageInfo) error {
+		db.Lock()
+		defer db.Unlock()
+		_, err := db.CreateDocumentVersion(forUser, document, documentVersion, uploadComment, fileType, fileExtension, urn, status, thumbnailType, contentHash, mimeType, imageInfo)
+		return err
+	}
+
+	createProjectSpace := func(forUser string, parent string, name string, projectSpaceVersion string, createComment string, sheetTransforms []string, camera *json.Json, thumbnailType string) (*TreeNode, error) {
+		cameraStr, _ := camera.ToString()
+		db.Lock()
+		defer db.Unlock()
+		tn, err := createNode(forUser, parent, name, ProjectSpace)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := db.CreateProjectSpaceVersion(forUser, tn.Id, projectSpaceVersion, createComment, cameraStr, thumbnailType); err != nil {
+			db.DeleteTreeNode(tn.Id)
+			return nil, err
+		}
+		err = db.CreateProjectSpaceVersionSheetTransforms(projectSpaceVersion, sheetTransforms)
+		return toTreeNode(tn), err
+	}
+
+	setName := func(forUser string, id string, newName string) error {
+		db.Lock()
+		defer db.Unlock()
+		tn, exists := live(id)
+		if !exists {
+			return errors.New("Unauthorized action: treeNode set name")
+		}
+		if role, _ := db.Role(forUser, tn.Project); !util.MemRoleIn(role, "owner", "admin", "organiser") || tn.Id == tn.Project {
+			return errors.New("Unauthorized action: treeNode set name")
+		}
+		tn.Name = newName
+		tn.Modified = time.Now().UTC()
+		tn.ModifiedBy = forUser
+		return nil
+	}
+
+	setPropertyDefinition := func(forUser string, project string, name string, pt propertyType) error {
+		db.Lock()
+		defer db.Unlock()
+		if role, _ := db.Role(forUser, project); !util.MemRoleIn(role, "owner", "admin") {
+			return errors.New("Unauthorized action: treeNode set property definition")
+		}
+		if current, exists := db.TreeNodePropertyDefinitions[project][name]; exists && current != string(pt) {
+			db.DeleteTreeNodePropertyDefinition(project, name)
+		}
+		if db.TreeNodePropertyDefinitions[project] == nil {
+			db.TreeNodePropertyDefinitions[project] = map[string]string{}
+		}
+		db.TreeNodePropertyDefinitions[project][name] = string(pt)
+		return nil
+	}
+
+	removePropertyDefinition := func(forUser string, project string, name string) error {
+		db.Lock()
+		defer db.Unlock()
+		if role, _ := db.Role(forUser, project); !util.MemRoleIn(role, "owner", "admin") {
+			return errors.New("Unauthorized action: treeNode remove property definition")
+		}
+		db.DeleteTreeNodePropertyDefinition(project, name)
+		return nil
+	}
+
+	getPropertyDefinitions := func(forUser string, project string) ([]*PropertyDefinition, error) {
+		db.RLock()
+		defer db.RUnlock()
+		if _, err := db.Role(forUser, project); err != nil {
+			return nil, errors.New("Unauthorized action: treeNode get property definitions")
+		}
+		pds := make([]*PropertyDefinition, 0, len(db.TreeNodePropertyDefinitions[project]))
+		for name, pt := range db.TreeNodePropertyDefinitions[project] {
+			pds = append(pds, &PropertyDefinition{
+				Project:      project,
+				Name:         name,
+				PropertyType: propertyType(pt),
+			})
+		}
+		sort.Slice(pds, func(i, j int) bool {
+			return pds[i].Name < pds[j].Name
+		})
+		return pds, nil
+	}
+
+	setProperties := func(forUser string, id string, properties map[string]string) error {
+		db.Lock()
+		defer db.Unlock()
+		tn, exists := live(id)
+		projectId := ""
+		if exists {
+			projectId = tn.Project
+		}
+		if role, _ := db.Role(forUser, projectId); !util.MemRoleIn(role, "owner", "admin", "organiser", "contributor") {
+			return errors.New("Unauthorized action: treeNode set properties")
+		}
+		if tn.NodeType != string(Document) && tn.NodeType != string(ProjectSpace) {
+			return errors.New("Invalid action: set properties on a none document or projectSpace treeNode")
+		}
+		for name, value := range properties {
+			if _, defined := db.TreeNodePropertyDefinitions[projectId][name]; !defined {
+				continue
+			}
+			if value == "" {
+				db.DeleteTreeNodeProperty(id, name)
+			} else {
+				if db.TreeNodeProperties[id] == nil {
+					db.TreeNodeProperties[id] = map[string]string{}
+				}
+				db.TreeNodeProperties[id][name] = value
+			}
+		}
+		tn.Modified = time.Now().UTC()
+		tn.ModifiedBy = forUser
+		return nil
+	}
+
+	move := func(forUser string, newParent string, ids []string) error {
+		db.Lock()
+		defer db.Unlock()
+		p, exists := live(newParent)
+		if !exists {
+			return errors.New("Unauthorized action: treeNode move")
+		}
+		if role, _ := db.Role(forUser, p.Project); !util.MemRoleIn(role, "owner", "admin", "organiser") {
+			return errors.New("Unauthorized action: treeNode move")
+		}
+		if p.NodeType != string(Folder) {
+			return errors.New("Invalid action: place treeNodes under a none folder parent")
+		}
+		tns := make([]*util.MemTreeNode, 0, len(ids))
+		for _, id := range ids {
+			if tn, exists := live(id); !exists || tn.Project != p.Project {
+				return errors.New("Unauthorized action: treeNode cross project move")
+			} else if tn.Id == tn.Project {
+				return errors.New("Invalid action: treeNode move root folder")
+			} else {
+				tns = append(tns, tn)
+			}
+		}
+		for current := p; current != nil; current = db.TreeNodes[current.Parent] {
+			for _, tn := range tns {
+				if tn.Id == current.Id {
+					return errors.New("Invalid action: treeNode move would result in looping folder state")
+				}
+			}
+		}
+		now := time.Now().UTC()
+		for _, tn := range tns {
+			tn.Parent = newParent
+			tn.Modified = now
+			tn.ModifiedBy = forUser
+		}
+		return nil
+	}
+
+	getBlobs := func(forUser string, ids []string) ([]string, error) {
+		db.RLock()
+		defer db.RUnlock()
+		projectId := ""
+		if len(ids) > 0 {
+			if tn, exists := live(ids[0]); exists {
+				projectId = tn.Project
+			}
+		}
+		if role, _ := db.Role(forUser, projectId); !util.MemRoleIn(role, "owner", "admin", "organiser") {
+			return nil, errors.New("Unauthorized action: treeNode get blobs")
+		}
+		tns := make([]*util.MemTreeNode, 0, len(ids))
+		for _, id := range ids {
+			if tn, exists := live(id); !exists || tn.Project != projectId {
+				return nil, errors.New("Unauthorized action: treeNode cross project get blobs")
+			}
+			tns = append(tns, subtree(id)...)
+		}
+		return collectBlobs(tns), nil
+	}
+
+	moveAcrossProjects := func(forUser string, newParent string, ids []string) ([]string, error) {
+		db.Lock()
+		defer db.Unlock()
+		p, _ := live(newParent)
+		fromProjectId, toProjectId := "", ""
+		if p != nil {
+			toProjectId = p.Project
+		}
+		if len(ids) > 0 {
+			if tn, exists := live(ids[0]); exists {
+				fromProjectId = tn.Project
+			}
+		}
+		toRole, _ := db.Role(forUser, toProjectId)
+		fromRole, _ := db.Role(forUser, fromProjectId)
+		if !util.MemRoleIn(toRole, "owner", "admin", "organiser") || !util.MemRoleIn(fromRole, "owner", "admin", "organiser") {
+			return nil, errors.New("Unauthorized action: treeNode move")
+		}
+		if p.NodeType != string(Folder) {
+			return nil, errors.New("Invalid action: place treeNodes under a none folder parent")
+		}
+		moving := map[string]*util.MemTreeNode{}
+		for _, id := range ids {
+			if tn, exists := live(id); !exists || tn.Project != fromProjectId || fromProjectId == toProjectId {
+				return nil, errors.New("Unauthorized action: treeNode cross project move")
+			} else if tn.Id == tn.Project {
+				return nil, errors.New("Invalid action: treeNode move root folder")
+			}
+			for _, tn := range subtree(id) {
+				moving[tn.Id] = tn
+			}
+		}
+		for _, psv := range db.ProjectSpaceVersions {
+			if psv.Project != fromProjectId {
+				continue
+			}
+			_, psvMoving := moving[psv.ProjectSpace]
+			for _, stId := range db.ProjectSpaceVersionSheetTransforms[psv.Id] {
+				if st, exists := db.SheetTransforms[stId]; exists {
+					if s, exists := db.Sheets[st.Sheet]; exists {
+						if _, sheetMoving := moving[db.DocumentVersions[s.DocumentVersion].Document]; sheetMoving != psvMoving {
+							return nil, errors.New("Invalid action: treeNode cross project move would split a projectSpace from its sheets")
+						}
+					}
+				}
+			}
+		}
+		tns := make([]*util.MemTreeNode, 0, len(moving))
+		for _, tn := range moving {
+			tns = append(tns, tn)
+		}
+		blobs := collectBlobs(tns)
+		for _, tn := range moving {
+			for name := range db.TreeNodeProperties[tn.Id] {
+				if db.TreeNodePropertyDefinitions[toProjectId][name] != db.TreeNodePropertyDefinitions[fromProjectId][name] {
+					db.DeleteTreeNodeProperty(tn.Id, name)
+				}
+			}
+			tn.Project = toProjectId
+		}
+		now := time.Now().UTC()
+		for _, id := range ids {
+			db.TreeNodes[id].Parent = newParent
+			db.TreeNodes[id].Modified = now
+			db.TreeNodes[id].ModifiedBy = forUser
+		}
+		for _, dv := range db.DocumentVersions {
+			if _, exists := moving[dv.Document]; exists {
+				dv.Project = toProjectId
+				for _, s := range db.Sheets {
+					if s.DocumentVersion == dv.Id {
+						s.Project = toProjectId
+					}
+				}
+			}
+		}
+		for _, psv := range db.ProjectSpaceVersions {
+			if _, exists := moving[psv.ProjectSpace]; exists {
+				psv.Project = toProjectId
+			}
+		}
+		return blobs, nil
+	}
+
+	copy := func(forUser string, newParent string, ids []string, includeAllVersions bool) ([]*copiedVersion, error) {
+		db.Lock()
+		defer db.Unlock()
+		p, exists := live(newParent)
+		if !exists || p.NodeType != string(Folder) {
+			return nil, errors.New("Invalid action: place treeNodes under a none folder parent")
+		}
+		toProjectId := p.Project
+		if role, _ := db.Role(forUser, toProjectId); !util.MemRoleIn(role, "owner", "admin", "organiser") {
+			return nil, errors.New("Unauthorized action: treeNode copy")
+		}
+		fromProjectId := ""
+		if len(ids) > 0 {
+			if tn, exists := live(ids[0]); exists {
+				fromProjectId = tn.Project
+			}
+		}
+		//copies can be downloaded by their new owners so reading the source has to be allowed to download it too
+		if role, _ := db.Role(forUser, fromProjectId); !util.MemRoleIn(role, "owner", "admin", "organiser", "contributor") {
+			return nil, errors.New("Unauthorized action: treeNode copy")
+		}
+		for _, id := range ids {
+			if tn, exists := live(id); !exists || tn.Project != fromProjectId {
+				return nil, errors.New("Invalid action: treeNode copy from multiple projects")
+			} else if tn.Id == tn.Project {
+				return nil, errors.New("Invalid action: treeNode copy root folder")
+			}
+		}
+
+		//work out every new id before writing anything so a failed check leaves the db untouched
+		nodes := make([]*util.MemTreeNode, 0, len(ids))
+		nodeIds := map[string]string{}
+		for _, id := range ids {
+			if _, exists := nodeIds[id]; !exists {
+				for _, tn := range subtree(id) {
+					if _, exists := nodeIds[tn.Id]; !exists {
+						nodeIds[tn.Id] = util.NewId()
+						nodes = append(nodes, tn)
+					}
+				}
+			}
+		}
+		latestDvs := map[string]int{}
+		for _, dv := range db.DocumentVersions {
+			if dv.Version > latestDvs[dv.Document] {
+				latestDvs[dv.Document] = dv.Version
+			}
+		}
+		dvs := make([]*util.MemDocumentVersion, 0, len(nodes))
+		dvIds := map[string]string{}
+		for _, dv := range db.DocumentVersions {
+			if _, exists := nodeIds[dv.Document]; exists && (includeAllVersions || dv.Version == latestDvs[dv.Document]) {
+				dvIds[dv.Id] = util.NewId()
+				dvs = append(dvs, dv)
+			}
+		}
+		sheetIds := map[string]string{}
+		for _, s := range db.Sheets {
+			if _, exists := dvIds[s.DocumentVersion]; exists {
+				sheetIds[s.Id] = util.NewId()
+			}
+		}
+		latestPsvs := map[string]int{}
+		for _, psv := range db.ProjectSpaceVersions {
+			if psv.Version > latestPsvs[psv.ProjectSpace] {
+				latestPsvs[psv.ProjectSpace] = psv.Version
+			}
+		}
+		psvs := make([]*util.MemProjectSpaceVersion, 0, len(nodes))
+		psvIds := map[string]string{}
+		for _, psv := range db.ProjectSpaceVersions {
+			if _, exists := nodeIds[psv.ProjectSpace]; exists && (includeAllVersions || psv.Version == latestPsvs[psv.ProjectSpace]) {
+				psvIds[psv.Id] = util.NewId()
+				psvs = append(psvs, psv)
+			}
+		}
+		stIds := map[string]string{}
+		for _, psv := range psvs {
+			for _, stId := range db.ProjectSpaceVersionSheetTransforms[psv.Id] {
+				if st, exists := db.SheetTransforms[stId]; exists {
+					if _, exists := sheetIds[st.Sheet]; exists {
+						stIds[stId] = util.NewId()
+					} else if fromProjectId != toProjectId {
+						return nil, errors.New("Invalid action: treeNode cross project copy of projectSpace with sheets outside the copy")
+					}
+				}
+			}
+		}
+
+		now := time.Now().UTC()
+		for _, tn := range nodes {
+			parent := nodeIds[tn.Parent]
+			for _, id := range ids {
+				if id == tn.Id {
+					parent = newParent
+				}
+			}
+			db.TreeNodes[nodeIds[tn.Id]] = &util.MemTreeNode{
+				Id:         nodeIds[tn.Id],
+				Parent:     parent,
+				Project:    toProjectId,
+				Name:       tn.Name,
+				NodeType:   tn.NodeType,
+				Created:    now,
+				CreatedBy:  forUser,
+				Modified:   now,
+				ModifiedBy: forUser,
+			}
+			for name, value := range db.TreeNodeProperties[tn.Id] {
+				if pt, exists := db.TreeNodePropertyDefinitions[toProjectId][name]; exists && pt == db.TreeNodePropertyDefinitions[fromProjectId][name] {
+					if db.TreeNodeProperties[nodeIds[tn.Id]] == nil {
+						db.TreeNodeProperties[nodeIds[tn.Id]] = map[string]string{}
+					}
+					db.TreeNodeProperties[nodeIds[tn.Id]][name] = value
+				}
+			}
+		}
+		versions := make([]*copiedVersion, 0, len(dvs)+len(psvs))
+		for _, dv := range dvs {
+			newDv := *dv
+			newDv.Id = dvIds[dv.Id]
+			newDv.Document = nodeIds[dv.Document]
+			newDv.Project = toProjectId
+			if !includeAllVersions {
+				newDv.Version = 1
+			}
+			db.DocumentVersions[newDv.Id] = &newDv
+			versions = append(versions, &copiedVersion{
+				versionType:   documentVersionType,
+				from:          dv.Id,
+				to:            newDv.Id,
+				fileType:      dv.FileType,
+				fileExtension: dv.FileExtension,
+				urn:           dv.Urn,
+				status:        dv.Status,
+				thumbnailType: dv.ThumbnailType,
+			})
+		}
+		for oldId, newId := range sheetIds {
+			newS := *db.Sheets[oldId]
+			newS.Id = newId
+			newS.DocumentVersion = dvIds[newS.DocumentVersion]
+			newS.Project = toProjectId
+			db.Sheets[newId] = &newS
+		}
+		for oldId, newId := range stIds {
+			st := db.SheetTransforms[oldId]
+			db.SheetTransforms[newId] = &util.MemSheetTransform{
+				Id:                     newId,
+				Sheet:                  sheetIds[st.Sheet],
+				SheetTransformHashJson: strings.Replace(st.SheetTransformHashJson, st.Sheet, sheetIds[st.Sheet], -1),
+				ClashChangeRegId:       st.ClashChangeRegId,
+			}
+		}
+		for _, psv := range psvs {
+			newPsv := *psv
+			newPsv.Id = psvIds[psv.Id]
+			newPsv.ProjectSpace = nodeIds[psv.ProjectSpace]
+			newPsv.Project = toProjectId
+			if !includeAllVersions {
+				newPsv.Version = 1
+			}
+			db.ProjectSpaceVersions[newPsv.Id] = &newPsv
+			for _, stId := range db.ProjectSpaceVersionSheetTransforms[psv.Id] {
+				if newStId, exists := stIds[stId]; exists {
+					stId = newStId
+				}
+				db.ProjectSpaceVersionSheetTransforms[newPsv.Id] = append(db.ProjectSpaceVersionSheetTransforms[newPsv.Id], stId)
+			}
+			versions = append(versions, &copiedVersion{
+				versionType:   projectSpaceVersionType,
+				from:          psv.Id,
+				to:            newPsv.Id,
+				thumbnailType: psv.ThumbnailType,
+			})
+		}
+		roots := map[string]bool{}
+		for _, id := range ids {
+			if !roots[id] {
+				roots[id] = true
+				versions = append(versions, &copiedVersion{versionType: treeNodeType, from: id, to: nodeIds[id]})
+			}
+		}
+		return versions, nil
+	}
+
+	removeCopy := func(forUser string, ids []string) error {
+		db.Lock()
+		defer db.Unlock()
+		for _, id := range ids {
+			if tn, exists := db.TreeNodes[id]; exists {
+				if role, _ := db.Role(forUser, tn.Project); !util.MemRoleIn(role, "owner", "admin", "organiser") {
+					return errors.New("Unauthorized action: treeNode remove copy")
+				}
+			}
+		}
+		for _, id := range ids {
+			db.DeleteTreeNode(id)
+		}
+		return nil
+	}
+
+	resetTranslation := func(documentVersion string, urn string, status string) error {
+		db.Lock()
+		defer db.Unlock()
+		if dv, exists := db.DocumentVersions[documentVersion]; exists {
+			dv.Urn = urn
+			dv.Status = status
+			dv.RetryCount = 0
+			dv.LastError = ""
+			dv.NextRetry = nil
+			dv.Progress = ""
+			dv.TranslationMessages = "[]"
+			for sId, s := range db.Sheets {
+				if s.DocumentVersion == documentVersion {
+					db.DeleteSheet(sId)
+				}
+			}
+		}
+		return nil
+	}
+
+	delete := func(forUser string, ids []string) error {
+		db.Lock()
+		defer db.Unlock()
+		projectId := ""
+		if len(ids) > 0 {
+			if tn, exists := live(ids[0]); exists {
+				projectId = tn.Project
+			}
+		}
+		if role, _ := db.Role(forUser, projectId); !util.MemRoleIn(role, "owner", "admin", "organiser", "contributor") {
+			return errors.New("Unauthorized action: treeNode delete")
+		}
+		for _, id := range ids {
+			if tn, exists := live(id); !exists || tn.Project != projectId {
+				return errors.New("Unauthorized action: treeNode cross project delete")
+			} else if tn.Id == tn.Project {
+				return errors.New("Invalid action: treeNode delete root folder")
+			}
+		}
+		deleted := time.Now().UTC()
+		for _, id := range ids {
+			if tn, exists := live(id); exists {
+				db.TreeNodeTrash[id] = &util.MemTreeNodeTrash{
+					Id:        id,
+					Project:   projectId,
+					Parent:    tn.Parent,
+					Deleted:   deleted,
+					DeletedBy: forUser,
+				}
+				tn.Parent = ""
+				for _, desc := range subtree(id) {
+					desc.Trash = id
+				}
+			}
+		}
+		return nil
+	}
+
+	listTrash := func(forUser string, project string, offset int, limit int, sortBy sortBy) ([]*TrashedTreeNode, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		if _, err := db.Role(forUser, project); err != nil {
+			return nil, 0, errors.New("Unauthorized action: treeNode list trash")
+		}
+		matches := make([]*util.MemTreeNodeTrash, 0, util.DefaultSqlOffsetQueryLimit)
+		for _, t := range db.TreeNodeTrash {
+			if t.Project == project {
+				matches = append(matches, t)
+			}
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			switch sortBy {
+			case NameAsc, NameDesc, CreatedAsc, CreatedDesc, ModifiedAsc, ModifiedDesc, TypeAsc, TypeDesc:
+				return less(db.TreeNodes[matches[i].Id], db.TreeNodes[matches[j].Id], sortBy, nil)
+			case DeletedAsc:
+				return matches[i].Deleted.Before(matches[j].Deleted)
+			default:
+				return matches[j].Deleted.Before(matches[i].Deleted)
+			}
+		})
+		start, end := util.MemOffsetLimit(len(matches), offset, limit)
+		tns := make([]*TrashedTreeNode, 0, end-start)
+		for _, t := range matches[start:end] {
+			tn := toTreeNode(db.TreeNodes[t.Id])
+			tn.Parent = t.Parent
+			tns = append(tns, &TrashedTreeNode{
+				TreeNode:  *tn,
+				Deleted:   t.Deleted,
+				DeletedBy: t.DeletedBy,
+			})
+		}
+		return tns, len(matches), nil
+	}
+
+	restore := func(forUser string, ids []string) error {
+		db.Lock()
+		defer db.Unlock()
+		projectId := ""
+		if len(ids) > 0 {
+			if t, exists := db.TreeNodeTrash[ids[0]]; exists {
+				projectId = t.Project
+			}
+		}
+		if role, _ := db.Role(forUser, projectId); !util.MemRoleIn(role, "owner", "admin", "organiser", "contributor") {
+			return errors.New("Unauthorized action: treeNode restore")
+		}
+		ts := make([]*util.MemTreeNodeTrash, 0, len(ids))
+		for _, id := range ids {
+			if t, exists := db.TreeNodeTrash[id]; !exists || t.Project != projectId {
+				return errors.New("Unauthorized action: treeNode cross project restore")
+			} else {
+				ts = append(ts, t)
+			}
+		}
+		//restore the most recently deleted first so earlier deletions can find their parents again
+		sort.Slice(ts, func(i, j int) bool {
+			return ts[j].Deleted.Before(ts[i].Deleted)
+		})
+		for _, t := range ts {
+			newParent := projectId
+			if p, exists := live(t.Parent); exists && p.Project == projectId && p.NodeType == string(Folder) {
+				newParent = p.Id
+			}
+			for _, tn := range db.TreeNodes {
+				if tn.Trash == t.Id {
+					tn.Trash = ""
+				}
+			}
+			db.TreeNodes[t.Id].Parent = newParent
+			db.TreeNodes[t.Id].Modified = time.Now().UTC()
+			db.TreeNodes[t.Id].ModifiedBy = forUser
+			db.DeleteTreeNodeTrash(t.Id)
+		}
+		return nil
+	}
+
+	purge := func(forUser string, ids []string) (map[string][]string, error) {
+		db.Lock()
+		defer db.Unlock()
+		projectId := ""
+		if len(ids) > 0 {
+			if t, exists := db.TreeNodeTrash[ids[0]]; exists {
+				projectId = t.Project
+			}
+		}
+		if role, _ := db.Role(forUser, projectId); !util.MemRoleIn(role, "owner", "admin", "organiser") {
+			return nil, errors.New("Unauthorized action: treeNode purge")
+		}
+		for _, id := range ids {
+			if t, exists := db.TreeNodeTrash[id]; !exists || t.Project != projectId {
+				return nil, errors.New("Unauthorized action: treeNode cross project purge")
+			}
+		}
+		blobs := map[string][]string{}
+		for _, id := range ids {
+			if _, exists := db.TreeNodeTrash[id]; exists {
+				purgeNode(id, blobs)
+			}
+		}
+		return blobs, nil
+	}
+
+	get := func(forUser string, ids []string) ([]*TreeNode, error) {
+		db.RLock()
+		defer db.RUnlock()
+		projectId := ""
+		tns := make([]*TreeNode, 0, len(ids))
+		for _, id := range ids {
+			if tn, exists := live(id); exists {
+				if projectId != "" && projectId != tn.Project {
+					return nil, errors.New("Unauthorized action: treeNode get cross project")
+				}
+				projectId = tn.Project
+				tns = append(tns, toTreeNode(tn))
+			}
+		}
+		if _, err := db.Role(forUser, projectId); projectId == "" || err != nil {
+			return nil, errors.New("Unauthorized action: treeNode get cross project")
+		}
+		return tns, nil
+	}
+
+	getChildren := func(forUser string, id string, nt nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		p, exists := live(id)
+		if !exists || p.NodeType != string(Folder) {
+			return nil, 0, errors.New("Invalid action: get treeNodes from a none folder parent")
+		}
+		if _, err := db.Role(forUser, p.Project); err != nil {
+			return nil, 0, errors.New("Unauthorized action: treeNode get children")
+		}
+		matches := make([]*util.MemTreeNode, 0, util.DefaultSqlOffsetQueryLimit)
+		for _, tn := range db.TreeNodes {
+			if tn.Parent == id && nodeTypeMatches(tn, nt) && propertiesMatch(tn, query) {
+				matches = append(matches, tn)
+			}
+		}
+		tns, totalResults := offsetTreeNodes(matches, query, offset, limit, sortBy)
+		return tns, totalResults, nil
+	}
+
+	getArchiveVersions := func(forUser string, id string, includeAllVersions bool) ([]*archiveVersion, error) {
+		db.RLock()
+		defer db.RUnlock()
+		p, exists := live(id)
+		if !exists || p.NodeType != string(Folder) {
+			return nil, errors.New("Invalid action: export archive of a none folder")
+		}
+		if role, err := db.Role(forUser, p.Project); err != nil || !util.MemRoleIn(role, "owner", "admin", "organiser", "contributor") {
+			return nil, errors.New("Unauthorized action: treeNode get archive versions")
+		}
+		latest := map[string]int{}
+		dvs := make([]*util.MemDocumentVersion, 0, util.DefaultSqlOffsetQueryLimit)
+		for _, tn := range subtree(id)[1:] {
+			for _, dv := range db.DocumentVersions {
+				if dv.Document == tn.Id {
+					dvs = append(dvs, dv)
+					if dv.Version > latest[dv.Document] {
+						latest[dv.Document] = dv.Version
+					}
+				}
+			}
+		}
+		sort.Slice(dvs, func(i, j int) bool {
+			if dvs[i].Document != dvs[j].Document {
+				return dvs[i].Document < dvs[j].Document
+			}
+			return dvs[i].Version < dvs[j].Version
+		})
+		avs := make([]*archiveVersion, 0, len(dvs))
+		for _, dv := range dvs {
+			if includeAllVersions || dv.Version == latest[dv.Document] {
+				avs = append(avs, &archiveVersion{
+					id:            dv.Id,
+					document:      dv.Document,
+					version:       dv.Version,
+					uploaded:      dv.Uploaded,
+					uploadComment: dv.UploadComment,
+					uploadedBy:    dv.UploadedBy,
+					fileType:      dv.FileType,
+					fileExtension: dv.FileExtension,
+					mimeType:      dv.MimeType,
+					contentHash:   dv.ContentHash,
+				})
+			}
+		}
+		return avs, nil
+	}
+
+	getDescendants := func(forUser string, id string, maxDepth int, nt nodeType) ([]*TreeNode, error) {
+		db.RLock()
+		defer db.RUnlock()
+		p, exists := live(id)
+		if !exists || p.NodeType != string(Folder) {
+			return nil, errors.New("Invalid action: get treeNodes from a none folder parent")
+		}
+		if _, err := db.Role(forUser, p.Project); err != nil {
+			return nil, errors.New("Unauthorized action: treeNode get descendants")
+		}
+		tns := make([]*TreeNode, 0, util.DefaultSqlOffsetQueryLimit)
+		level := []string{id}
+		for depth := 1; len(level) > 0 && (maxDepth <= 0 || depth <= maxDepth); depth++ {
+			children := make([]*util.MemTreeNode, 0, len(level))
+			for _, tn := range db.TreeNodes {
+				for _, parent := range level {
+					if tn.Parent == parent {
+						children = append(children, tn)
+						break
+					}
+				}
+			}
+			sort.Slice(children, func(i, j int) bool {
+				return util.MemLessFold(children[i].Name, children[j].Name)
+			})
+			level = make([]string, 0, len(children))
+			for _, tn := range children {
+				level = append(level, tn.Id)
+				if nodeTypeMatches(tn, nt) {
+					tns = append(tns, toTreeNode(tn))
+				}
+			}
+		}
+		return tns, nil
+	}
+
+	getParents := func(forUser string, id string) ([]*TreeNode, error) {
+		db.RLock()
+		defer db.RUnlock()
+		tn, exists := live(id)
+		if !exists {
+			return nil, errors.New("Unauthorized action: treeNode get parents")
+		}
+		if _, err := db.Role(forUser, tn.Project); err != nil {
+			return nil, errors.New("Unauthorized action: treeNode get parents")
+		}
+		tns := make([]*TreeNode, 0, util.DefaultSqlOffsetQueryLimit)
+		for current := db.TreeNodes[tn.Parent]; current != nil; current = db.TreeNodes[current.Parent] {
+			tns = append([]*TreeNode{{
+				Id:       current.Id,
+				Parent:   current.Parent,
+				Project:  tn.Project,
+				Name:     current.Name,
+				NodeType: Folder,
+			}}, tns...)
+		}
+		return tns, nil
+	}
+
+	resolve := func(project string, path string) (*util.MemTreeNode, error) {
+		current, exists := live(project)
+		if !exists {
+			return nil, errors.New("Invalid action: treeNode path not found")
+		}
+		for _, segment := range strings.Split(path, "/") {
+			if segment == "" {
+				continue
+			}
+			var match *util.MemTreeNode
+			for _, tn := range db.TreeNodes {
+				if tn.Parent == current.Id && strings.EqualFold(tn.Name, segment) {
+					if match != nil {
+						return nil, errors.New("Invalid action: treeNode path is ambiguous")
+					}
+					match = tn
+				}
+			}
+			if match == nil {
+				return nil, errors.New("Invalid action: treeNode path not found")
+			}
+			current = match
+		}
+		return current, nil
+	}
+
+	resolvePath := func(forUser string, project string, path string) (*TreeNode, error) {
+		db.RLock()
+		defer db.RUnlock()
+		if _, err := db.Role(forUser, project); err != nil {
+			return nil, errors.New("Unauthorized action: treeNode resolve path")
+		}
+		if tn, err := resolve(project, path); err != nil {
+			return nil, err
+		} else {
+			return toTreeNode(tn), nil
+		}
+	}
+
+	listPath := func(forUser string, project string, path string, nt nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+		db.RLock()
+		if _, err := db.Role(forUser, project); err != nil {
+			db.RUnlock()
+			return nil, 0, errors.New("Unauthorized action: treeNode list path")
+		}
+		tn, err := resolve(project, path)
+		db.RUnlock()
+		if err != nil {
+			return nil, 0, err
+		}
+		return getChildren(forUser, tn.Id, nt, nil, offset, limit, sortBy)
+	}
+
+	globalSearch := func(forUser string, search string, nt nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		matches := make([]*util.MemTreeNode, 0, util.DefaultSqlOffsetQueryLimit)
+		for _, tn := range db.TreeNodes {
+			if _, isMember := db.Permissions[tn.Project][forUser]; isMember && tn.Trash == "" && nodeTypeMatches(tn, nt) && propertiesMatch(tn, query) && util.MemMatch(search, tn.Name) {
+				matches = append(matches, tn)
+			}
+		}
+		tns, totalResults := offsetTreeNodes(matches, query, offset, limit, sortBy)
+		return tns, totalResults, nil
+	}
+
+	projectSearch := func(forUser string, project string, search string, nt nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		matches := make([]*util.MemTreeNode, 0, util.DefaultSqlOffsetQueryLimit)
+		if _, err := db.Role(forUser, project); err == nil {
+			for _, tn := range db.TreeNodes {
+				if tn.Project == project && tn.Trash == "" && nodeTypeMatches(tn, nt) && propertiesMatch(tn, query) && util.MemMatch(search, tn.Name) {
+					matches = append(matches, tn)
+				}
+			}
+		}
+		tns, totalResults := offsetTreeNodes(matches, query, offset, limit, sortBy)
+		return tns, totalResults, nil
+	}
+
+	return newTreeNodeStore(createFolder, createDocument, createDocumentVersion, createProjectSpace, sheettransform.NewMemSaveSheetTransformsFunc(subTaskTimeout, db, caca, log), sheet.NewMemSaveSheetsFunc(db), sheet.NewMemGetPdfThumbnailSuffixesFunc(db), setName, setPropertyDefinition, removePropertyDefinition, getPropertyDefinitions, setProperties, move, moveAcrossProjects, getBlobs, copy, removeCopy, resetTranslation, delete, listTrash, restore, purge, get, getChildren, getDescendants, getArchiveVersions, getParents, resolvePath, listPath, globalSearch, projectSearch, util.GetMemRoleFunc(db), blobStore, vada, fileTypes, trashRetention, ossBucketPrefix, log)
+}
+
+func NewMemTrashPurger(db *util.MemDb, blobStore blob.BlobStore, trashRetention time.Duration, trashPurgeInterval time.Duration, ossBucketPrefix string, log golog.Log) TrashPurger {
+
+	purgeExpiredTrash := func(deletedBefore time.Time) (map[string][]string, error) {
+		db.Lock()
+		defer db.Unlock()
+		blobs := map[string][]string{}
+		for id, t := range db.TreeNodeTrash {
+			if t.Deleted.Before(deletedBefore) {
+				memPurgeNode(db, id, blobs)
+			}
+		}
+		return blobs, nil
+	}
+
+	return newTrashPurger(purgeExpiredTrash, blobStore, trashRetention, trashPurgeInterval, ossBucketPrefix, log)
+}
+
+func memSubtree(db *util.MemDb, id string) []*util.MemTreeNode {
+	tns := []*util.MemTreeNode{db.TreeNodes[id]}
+	for _, tn := range db.TreeNodes {
+		if tn.Parent == id {
+			tns = append(tns, memSubtree(db, tn.Id)...)
+		}
+	}
+	return tns
+}
+
+func memCollectBlobs(db *util.MemDb, tns []*util.MemTreeNode) []string {
+	blobs := make([]string, 0, len(tns))
+	for _, tn := range tns {
+		for _, dv := range db.DocumentVersions {
+			if dv.Document == tn.Id {
+				blobs = append(blobs, dv.Id+"."+dv.FileExtension)
+				if dv.ThumbnailType != "" {
+					blobs = append(blobs, dv.Id+".tn.tn")
+				}
+				for _, s := range db.Sheets {
+					if s.DocumentVersion == dv.Id && s.Role == sheet.PdfRole && s.Thumbnails != "" {
+						if suffix := sheet.PdfThumbnailSuffix(s.Manifest); suffix != "" {
+							blobs = append(blobs, dv.Id+suffix)
+						}
+					}
+				}
+			}
+		}
+		for _, psv := range db.ProjectSpaceVersions {
+			if psv.ProjectSpace == tn.Id && psv.ThumbnailType != "" {
+				blobs = append(blobs, psv.Id+".tn.tn")
+			}
+		}
+	}
+	return blobs
+}
+
+func memPurgeNode(db *util.MemDb, id string, blobs map[string][]string) {
+	tns := memSubtree(db, id)
+	projectId := tns[0].Project
+	blobs[projectId] = append(blobs[projectId], memCollectBlobs(db, tns)...)
+	db.DeleteTreeNode(id)
+}
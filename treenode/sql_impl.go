@@ -2,27 +2,48 @@ package treenode
 
 import (
 	"database/sql"
+	"github.com/modelhub/caca"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/sheet"
 	"github.com/modelhub/core/sheettransform"
 	"github.com/modelhub/core/util"
 	"github.com/modelhub/vada"
 	"github.com/robsix/golog"
 	"github.com/robsix/json"
 	"strings"
-	"github.com/modelhub/caca"
 	"time"
 )
 
-func NewSqlTreeNodeStore(db *sql.DB, subTaskTimeout time.Duration, vada vada.VadaClient, caca caca.CacaClient, ossBucketPrefix string, log golog.Log) TreeNodeStore {
+func NewSqlTreeNodeStore(db *sql.DB, subTaskTimeout time.Duration, blobStore blob.BlobStore, vada vada.VadaClient, fileTypes util.FileTypeRegistry, caca caca.CacaClient, trashRetention time.Duration, ossBucketPrefix string, log golog.Log) TreeNodeStore {
+
+	toProperties := func(propertiesJson sql.NullString) map[string]string {
+		if !propertiesJson.Valid {
+			return nil
+		}
+		js, err := json.FromString(propertiesJson.String)
+		if err != nil {
+			return nil
+		}
+		properties := map[string]string{}
+		for name, value := range js.MustMap(nil) {
+			if str, ok := value.(string); ok {
+				properties[name] = str
+			}
+		}
+		return properties
+	}
 
 	getter := func(query string, colLen int, args ...interface{}) ([]*TreeNode, error) {
 		tns := make([]*TreeNode, 0, colLen)
 		rowsScan := func(rows *sql.Rows) error {
 			tn := TreeNode{}
 			scanNodeType := ""
-			if err := rows.Scan(&tn.Id, &tn.Parent, &tn.Project, &tn.Name, &scanNodeType, &tn.ChildCount); err != nil {
+			scanProperties := sql.NullString{}
+			if err := rows.Scan(&tn.Id, &tn.Parent, &tn.Project, &tn.Name, &scanNodeType, &tn.ChildCount, &tn.Created, &tn.CreatedBy, &tn.Modified, &tn.ModifiedBy, &scanProperties); err != nil {
 				return err
 			}
 			tn.NodeType = nodeType(scanNodeType)
+			tn.Properties = toProperties(scanProperties)
 			tns = append(tns, &tn)
 			return nil
 		}
@@ -38,10 +59,12 @@ func NewSqlTreeNodeStore(db *sql.DB, subTaskTimeout time.Duration, vada vada.Vad
 			}
 			tn := TreeNode{}
 			scanNodeType := ""
-			if err := rows.Scan(&totalResults, &tn.Id, &tn.Parent, &tn.Project, &tn.Name, &scanNodeType, &tn.ChildCount); err != nil {
+			scanProperties := sql.NullString{}
+			if err := rows.Scan(&totalResults, &tn.Id, &tn.Parent, &tn.Project, &tn.Name, &scanNodeType, &tn.ChildCount, &tn.Created, &tn.CreatedBy, &tn.Modified, &tn.ModifiedBy, &scanProperties); err != nil {
 				return err
 			}
 			tn.NodeType = nodeType(scanNodeType)
+			tn.Properties = toProperties(scanProperties)
 			tns = append(tns, &tn)
 			return nil
 		}
@@ -56,14 +79,18 @@ func NewSqlTreeNodeStore(db *sql.DB, subTaskTimeout time.Duration, vada vada.Vad
 		}
 	}
 
-	createDocument := func(forUser string, parent string, name string, documentVersion string, uploadComment string, fileType string, fileExtension string, urn string, status string, thumbnailType string) (*TreeNode, error) {
-		if tns, err := getter("CALL treeNodeCreateDocument(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", 1, forUser, parent, name, documentVersion, uploadComment, fileType, fileExtension, urn, status, thumbnailType); len(tns) == 1 {
+	createDocument := func(forUser string, parent string, name string, documentVersion string, uploadComment string, fileType string, fileExtension string, urn string, status string, thumbnailType string, contentHash string, mimeType string, imageInfo *util.ImageInfo) (*TreeNode, error) {
+		if tns, err := getter("CALL treeNodeCreateDocument(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", 1, forUser, parent, name, documentVersion, uploadComment, fileType, fileExtension, urn, status, thumbnailType, contentHash, mimeType, util.ToImageInfoJson(imageInfo)); len(tns) == 1 {
 			return tns[0], err
 		} else {
 			return nil, err
 		}
 	}
 
+	createDocumentVersion := func(forUser string, document string, documentVersion string, uploadComment string, fileType string, fileExtension string, urn string, status string, thumbnailType string, contentHash string, mimeType string, imageInfo *util.ImageInfo) error {
+		return util.SqlQuery(db, func(*sql.Rows) error { return nil }, "CALL documentVersionCreate(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", forUser, document, documentVersion, uploadComment, fileType, fileExtension, urn, status, thumbnailType, contentHash, mimeType, util.ToImageInfoJson(imageInfo))
+	}
+
 	createProjectSpace := func(forUser string, parent string, name string, projectSpaceVersion string, createComment string, sheetTransforms []string, camera *json.Json, thumbnailType string) (*TreeNode, error) {
 		cameraStr, _ := camera.ToString()
 		if tns, err := getter("CALL treeNodeCreateProjectSpace(?, ?, ?, ?, ?, ?, ?)", 1, forUser, parent, name, projectSpaceVersion, createComment, cameraStr, thumbnailType); len(tns) == 1 {
@@ -79,29 +106,215 @@ func NewSqlTreeNodeStore(db *sql.DB, subTaskTimeout time.Duration, vada vada.Vad
 		return util.SqlExec(db, "CALL treeNodeSetName(?, ?, ?)", forUser, id, newName)
 	}
 
+	toPropertiesJson := func(properties map[string]string) string {
+		if len(properties) == 0 {
+			return ""
+		}
+		js := json.New()
+		for name, value := range properties {
+			js.Set(value, name)
+		}
+		str, _ := js.ToString()
+		return str
+	}
+
+	setPropertyDefinition := func(forUser string, project string, name string, propertyType propertyType) error {
+		return util.SqlExec(db, "CALL treeNodeSetPropertyDefinition(?, ?, ?, ?)", forUser, project, name, string(propertyType))
+	}
+
+	removePropertyDefinition := func(forUser string, project string, name string) error {
+		return util.SqlExec(db, "CALL treeNodeRemovePropertyDefinition(?, ?, ?)", forUser, project, name)
+	}
+
+	getPropertyDefinitions := func(forUser string, project string) ([]*PropertyDefinition, error) {
+		pds := make([]*PropertyDefinition, 0, util.DefaultSqlOffsetQueryLimit)
+		rowsScan := func(rows *sql.Rows) error {
+			pd := PropertyDefinition{}
+			scanPropertyType := ""
+			if err := rows.Scan(&pd.Project, &pd.Name, &scanPropertyType); err != nil {
+				return err
+			}
+			pd.PropertyType = propertyType(scanPropertyType)
+			pds = append(pds, &pd)
+			return nil
+		}
+		return pds, util.SqlQuery(db, rowsScan, "CALL treeNodeGetPropertyDefinitions(?, ?)", forUser, project)
+	}
+
+	setProperties := func(forUser string, id string, properties map[string]string) error {
+		return util.SqlExec(db, "CALL treeNodeSetProperties(?, ?, ?)", forUser, id, toPropertiesJson(properties))
+	}
+
+	queryArgs := func(query *PropertyQuery) (string, string) {
+		if query == nil {
+			return "", ""
+		}
+		return toPropertiesJson(query.Filters), query.Sort
+	}
+
+	namesGetter := func(query string, args ...interface{}) ([]string, error) {
+		names := make([]string, 0, util.DefaultSqlOffsetQueryLimit)
+		rowsScan := func(rows *sql.Rows) error {
+			name := ""
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			names = append(names, name)
+			return nil
+		}
+		return names, util.SqlQuery(db, rowsScan, query, args...)
+	}
+
 	move := func(forUser string, newParent string, ids []string) error {
 		return util.SqlExec(db, "CALL treeNodeMove(?, ?, ?)", forUser, newParent, strings.Join(ids, ","))
 	}
 
+	moveAcrossProjects := func(forUser string, newParent string, ids []string) ([]string, error) {
+		return namesGetter("CALL treeNodeMoveAcrossProjects(?, ?, ?)", forUser, newParent, strings.Join(ids, ","))
+	}
+
+	getBlobs := func(forUser string, ids []string) ([]string, error) {
+		return namesGetter("CALL treeNodeGetBlobs(?, ?)", forUser, strings.Join(ids, ","))
+	}
+
+	copy := func(forUser string, newParent string, ids []string, includeAllVersions bool) ([]*copiedVersion, error) {
+		versions := make([]*copiedVersion, 0, len(ids))
+		rowsScan := func(rows *sql.Rows) error {
+			v := copiedVersion{}
+			if err := rows.Scan(&v.versionType, &v.from, &v.to, &v.fileType, &v.fileExtension, &v.urn, &v.status, &v.thumbnailType); err != nil {
+				return err
+			}
+			versions = append(versions, &v)
+			return nil
+		}
+		return versions, util.SqlQuery(db, rowsScan, "CALL treeNodeCopy(?, ?, ?, ?)", forUser, newParent, strings.Join(ids, ","), includeAllVersions)
+	}
+
+	removeCopy := func(forUser string, ids []string) error {
+		return util.SqlExec(db, "CALL treeNodeRemoveCopy(?, ?)", forUser, strings.Join(ids, ","))
+	}
+
+	resetTranslation := func(documentVersion string, urn string, status string) error {
+		return util.SqlExec(db, "CALL documentVersionResetTranslation(?, ?, ?)", documentVersion, urn, status)
+	}
+
+	blobsGetter := func(query string, args ...interface{}) (map[string][]string, error) {
+		blobs := map[string][]string{}
+		rowsScan := func(rows *sql.Rows) error {
+			project := ""
+			blob := ""
+			if err := rows.Scan(&project, &blob); err != nil {
+				return err
+			}
+			blobs[project] = append(blobs[project], blob)
+			return nil
+		}
+		return blobs, util.SqlQuery(db, rowsScan, query, args...)
+	}
+
+	delete := func(forUser string, ids []string) error {
+		return util.SqlExec(db, "CALL treeNodeDelete(?, ?)", forUser, strings.Join(ids, ","))
+	}
+
+	listTrash := func(forUser string, project string, offset int, limit int, sortBy sortBy) ([]*TrashedTreeNode, int, error) {
+		tns := make([]*TrashedTreeNode, 0, util.DefaultSqlOffsetQueryLimit)
+		totalResults := 0
+		rowsScan := func(rows *sql.Rows) error {
+			if util.RowsContainsOnlyTotalResults(&totalResults, rows) {
+				return nil
+			}
+			tn := TrashedTreeNode{}
+			scanNodeType := ""
+			scanProperties := sql.NullString{}
+			if err := rows.Scan(&totalResults, &tn.Id, &tn.Parent, &tn.Project, &tn.Name, &scanNodeType, &tn.ChildCount, &tn.Created, &tn.CreatedBy, &tn.Modified, &tn.ModifiedBy, &scanProperties, &tn.Deleted, &tn.DeletedBy); err != nil {
+				return err
+			}
+			tn.NodeType = nodeType(scanNodeType)
+			tn.Properties = toProperties(scanProperties)
+			tns = append(tns, &tn)
+			return nil
+		}
+		return tns, totalResults, util.SqlQuery(db, rowsScan, "CALL treeNodeListTrash(?, ?, ?, ?, ?)", forUser, project, offset, limit, string(sortBy))
+	}
+
+	restore := func(forUser string, ids []string) error {
+		return util.SqlExec(db, "CALL treeNodeRestore(?, ?)", forUser, strings.Join(ids, ","))
+	}
+
+	purge := func(forUser string, ids []string) (map[string][]string, error) {
+		return blobsGetter("CALL treeNodePurge(?, ?)", forUser, strings.Join(ids, ","))
+	}
+
 	get := func(forUser string, ids []string) ([]*TreeNode, error) {
 		return getter("CALL treeNodeGet(?, ?)", len(ids), forUser, strings.Join(ids, ","))
 	}
 
-	getChildren := func(forUser string, id string, nt nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
-		return offsetGetter("CALL treeNodeGetChildren(?, ?, ?, ?, ?, ?)", forUser, id, string(nt), offset, limit, string(sortBy))
+	getChildren := func(forUser string, id string, nt nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+		filters, sortProperty := queryArgs(query)
+		return offsetGetter("CALL treeNodeGetChildren(?, ?, ?, ?, ?, ?, ?, ?)", forUser, id, string(nt), filters, sortProperty, offset, limit, string(sortBy))
+	}
+
+	getArchiveVersions := func(forUser string, id string, includeAllVersions bool) ([]*archiveVersion, error) {
+		avs := make([]*archiveVersion, 0, util.DefaultSqlOffsetQueryLimit)
+		rowsScan := func(rows *sql.Rows) error {
+			av := archiveVersion{}
+			if err := rows.Scan(&av.id, &av.document, &av.version, &av.uploaded, &av.uploadComment, &av.uploadedBy, &av.fileType, &av.fileExtension, &av.mimeType, &av.contentHash); err != nil {
+				return err
+			}
+			avs = append(avs, &av)
+			return nil
+		}
+		return avs, util.SqlQuery(db, rowsScan, "CALL treeNodeGetArchiveVersions(?, ?, ?)", forUser, id, includeAllVersions)
+	}
+
+	getDescendants := func(forUser string, id string, maxDepth int, nt nodeType) ([]*TreeNode, error) {
+		return getter("CALL treeNodeGetDescendants(?, ?, ?, ?)", util.DefaultSqlOffsetQueryLimit, forUser, id, maxDepth, string(nt))
 	}
 
 	getParents := func(forUser string, id string) ([]*TreeNode, error) {
 		return getter("CALL treeNodeGetParents(?, ?)", util.DefaultSqlOffsetQueryLimit, forUser, id)
 	}
 
-	globalSearch := func(forUser string, search string, nt nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
-		return offsetGetter("CALL treeNodeGlobalSearch(?, ?, ?, ?, ?, ?)", forUser, search, string(nt), offset, limit, string(sortBy))
+	resolvePath := func(forUser string, project string, path string) (*TreeNode, error) {
+		if tns, err := getter("CALL treeNodeResolvePath(?, ?, ?)", 1, forUser, project, path); len(tns) == 1 {
+			return tns[0], err
+		} else {
+			return nil, err
+		}
 	}
 
-	projectSearch := func(forUser string, project string, search string, nt nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
-		return offsetGetter("CALL treeNodeProjectSearch(?, ?, ?, ?, ?, ?, ?)", forUser, project, search, string(nt), offset, limit, string(sortBy))
+	listPath := func(forUser string, project string, path string, nt nodeType, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+		return offsetGetter("CALL treeNodeListPath(?, ?, ?, ?, ?, ?, ?)", forUser, project, path, string(nt), offset, limit, string(sortBy))
+	}
+
+	globalSearch := func(forUser string, search string, nt nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+		filters, sortProperty := queryArgs(query)
+		return offsetGetter("CALL treeNodeGlobalSearch(?, ?, ?, ?, ?, ?, ?, ?)", forUser, search, string(nt), filters, sortProperty, offset, limit, string(sortBy))
+	}
+
+	projectSearch := func(forUser string, project string, search string, nt nodeType, query *PropertyQuery, offset int, limit int, sortBy sortBy) ([]*TreeNode, int, error) {
+		filters, sortProperty := queryArgs(query)
+		return offsetGetter("CALL treeNodeProjectSearch(?, ?, ?, ?, ?, ?, ?, ?, ?)", forUser, project, search, string(nt), filters, sortProperty, offset, limit, string(sortBy))
+	}
+
+	return newTreeNodeStore(createFolder, createDocument, createDocumentVersion, createProjectSpace, sheettransform.NewSqlSaveSheetTransformsFunc(subTaskTimeout, db, caca, log), sheet.NewSqlSaveSheetsFunc(db), sheet.NewSqlGetPdfThumbnailSuffixesFunc(db), setName, setPropertyDefinition, removePropertyDefinition, getPropertyDefinitions, setProperties, move, moveAcrossProjects, getBlobs, copy, removeCopy, resetTranslation, delete, listTrash, restore, purge, get, getChildren, getDescendants, getArchiveVersions, getParents, resolvePath, listPath, globalSearch, projectSearch, util.GetRoleFunc(db), blobStore, vada, fileTypes, trashRetention, ossBucketPrefix, log)
+}
+
+func NewSqlTrashPurger(db *sql.DB, blobStore blob.BlobStore, trashRetention time.Duration, trashPurgeInterval time.Duration, ossBucketPrefix string, log golog.Log) TrashPurger {
+
+	purgeExpiredTrash := func(deletedBefore time.Time) (map[string][]string, error) {
+		blobs := map[string][]string{}
+		rowsScan := func(rows *sql.Rows) error {
+			project := ""
+			blob := ""
+			if err := rows.Scan(&project, &blob); err != nil {
+				return err
+			}
+			blobs[project] = append(blobs[project], blob)
+			return nil
+		}
+		return blobs, util.SqlQuery(db, rowsScan, "CALL treeNodePurgeExpiredTrash(?)", deletedBefore)
 	}
 
-	return newTreeNodeStore(createFolder, createDocument, createProjectSpace, sheettransform.NewSqlSaveSheetTransformsFunc(subTaskTimeout, db, caca, log), setName, move, get, getChildren, getParents, globalSearch, projectSearch, util.GetRoleFunc(db), vada, ossBucketPrefix, log)
+	return newTrashPurger(purgeExpiredTrash, blobStore, trashRetention, trashPurgeInterval, ossBucketPrefix, log)
 }
@@ -0,0 +1,84 @@
+package treenode
+
+import (
+	"github.com/modelhub/core/blob"
+	"github.com/robsix/golog"
+	"sync"
+	"time"
+)
+
+func newTrashPurger(purgeExpiredTrash purgeExpiredTrash, blobStore blob.BlobStore, retention time.Duration, interval time.Duration, ossBucketPrefix string, log golog.Log) TrashPurger {
+	return &trashPurger{
+		purgeExpiredTrash: purgeExpiredTrash,
+		blobStore:         blobStore,
+		retention:         retention,
+		interval:          interval,
+		ossBucketPrefix:   ossBucketPrefix,
+		log:               log,
+	}
+}
+
+type trashPurger struct {
+	purgeExpiredTrash purgeExpiredTrash
+	blobStore         blob.BlobStore
+	retention         time.Duration
+	interval          time.Duration
+	ossBucketPrefix   string
+	log               golog.Log
+	mtx               sync.Mutex
+	stop              chan struct{}
+	stopped           chan struct{}
+}
+
+func (tp *trashPurger) Start() {
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+	if tp.stop != nil {
+		return
+	}
+	if tp.retention <= 0 || tp.interval <= 0 {
+		tp.log.Warning("TrashPurger.Start not started: retention: %v interval: %v", tp.retention, tp.interval)
+		return
+	}
+	tp.stop = make(chan struct{})
+	tp.stopped = make(chan struct{})
+	go tp.run(tp.stop, tp.stopped)
+	tp.log.Info("TrashPurger.Start success: retention: %v interval: %v", tp.retention, tp.interval)
+}
+
+func (tp *trashPurger) Stop() {
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+	if tp.stop == nil {
+		return
+	}
+	close(tp.stop)
+	<-tp.stopped
+	tp.stop = nil
+	tp.stopped = nil
+	tp.log.Info("TrashPurger.Stop success")
+}
+
+func (tp *trashPurger) run(stop chan struct{}, stopped chan struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(tp.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			tp.purge()
+		}
+	}
+}
+
+func (tp *trashPurger) purge() {
+	deletedBefore := time.Now().UTC().Add(-tp.retention)
+	if blobs, err := tp.purgeExpiredTrash(deletedBefore); err != nil {
+		tp.log.Error("TrashPurger purge error: deletedBefore: %v error: %v", deletedBefore, err)
+	} else {
+		deleteBlobs(blobs, tp.ossBucketPrefix, tp.blobStore, tp.log)
+		tp.log.Info("TrashPurger purge success: deletedBefore: %v", deletedBefore)
+	}
+}
@@ -0,0 +1,17 @@
+package upload
+
+import (
+	"errors"
+)
+
+const (
+	chunkBlobInfix = ".upload."
+	// a session is uploading until it is claimed by CompleteUpload or
+	// AbortUpload, only an uploading session accepts chunks.
+	statusUploading  = "uploading"
+	statusCompleting = "completing"
+	statusCompleted  = "completed"
+	statusAborting   = "aborting"
+)
+
+var ErrUploadCompleted = errors.New("Invalid action: upload session already completed")
@@ -0,0 +1,288 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/documentversion"
+	"github.com/modelhub/core/treenode"
+	"github.com/modelhub/core/util"
+	"github.com/robsix/golog"
+	"io"
+)
+
+func newUploadStore(create create, get get, addChunk addChunk, getChunks getChunks, setStatus setStatus, delete delete, tns treenode.TreeNodeStore, dvs documentversion.DocumentVersionStore, blobStore blob.BlobStore, ossBucketPrefix string, log golog.Log) UploadStore {
+	return &uploadStore{
+		create:          create,
+		get:             get,
+		addChunk:        addChunk,
+		getChunks:       getChunks,
+		setStatus:       setStatus,
+		delete:          delete,
+		tns:             tns,
+		dvs:             dvs,
+		blobStore:       blobStore,
+		ossBucketPrefix: ossBucketPrefix,
+		log:             log,
+	}
+}
+
+type uploadStore struct {
+	create          create
+	get             get
+	addChunk        addChunk
+	getChunks       getChunks
+	setStatus       setStatus
+	delete          delete
+	tns             treenode.TreeNodeStore
+	dvs             documentversion.DocumentVersionStore
+	blobStore       blob.BlobStore
+	ossBucketPrefix string
+	log             golog.Log
+}
+
+func (ups *uploadStore) BeginUpload(forUser string, parent string, fileName string, fileType string, size int64) (*UploadSession, error) {
+	if fileName == "" {
+		err := errors.New("fileName required")
+		ups.log.Error("UploadStore.BeginUpload error: forUser: %q parent: %q fileName: %q fileType: %q size: %d error: %v", forUser, parent, fileName, fileType, size, err)
+		return nil, err
+	}
+	if us, err := ups.create(forUser, util.NewId(), parent, fileName, fileType, size); err != nil {
+		ups.log.Error("UploadStore.BeginUpload error: forUser: %q parent: %q fileName: %q fileType: %q size: %d error: %v", forUser, parent, fileName, fileType, size, err)
+		return nil, err
+	} else {
+		ups.log.Info("UploadStore.BeginUpload success: forUser: %q parent: %q fileName: %q fileType: %q size: %d session: %q", forUser, parent, fileName, fileType, size, us.Id)
+		return us, nil
+	}
+}
+
+func (ups *uploadStore) UploadChunk(forUser string, session string, offset int64, chunk io.Reader) (*UploadSession, error) {
+	us, err := ups.getSession(forUser, session)
+	if err != nil {
+		ups.log.Error("UploadStore.UploadChunk error: forUser: %q session: %q offset: %d error: %v", forUser, session, offset, err)
+		return nil, err
+	}
+	if offset != us.Received {
+		err := fmt.Errorf("Invalid action: upload chunk at offset %d expected offset %d", offset, us.Received)
+		ups.log.Error("UploadStore.UploadChunk error: forUser: %q session: %q offset: %d error: %v", forUser, session, offset, err)
+		return us, err
+	}
+
+	//every attempt writes its own blob and only the one addChunk records is ever read back, so concurrent retries of a chunk can't overwrite each other
+	remaining := us.Size - us.Received
+	counter := &countingReader{r: io.LimitReader(chunk, remaining+1)}
+	chunkId := util.NewId()
+	name := chunkBlobName(us.Id, chunkId)
+	if _, err := ups.blobStore.Put(ups.ossBucketPrefix+us.Project, name, counter); err != nil {
+		ups.log.Error("UploadStore.UploadChunk error: forUser: %q session: %q offset: %d error: %v", forUser, session, offset, err)
+		return us, err
+	}
+	if counter.n > remaining {
+		ups.blobStore.Delete(ups.ossBucketPrefix+us.Project, name)
+		err := fmt.Errorf("Invalid action: upload chunk exceeds declared size %d", us.Size)
+		ups.log.Error("UploadStore.UploadChunk error: forUser: %q session: %q offset: %d error: %v", forUser, session, offset, err)
+		return us, err
+	}
+	//another attempt at this offset may have been recorded first, in which case this blob is never read
+	updated, err := ups.addChunk(forUser, session, offset, counter.n, chunkId)
+	if err != nil {
+		ups.blobStore.Delete(ups.ossBucketPrefix+us.Project, name)
+		ups.log.Error("UploadStore.UploadChunk error: forUser: %q session: %q offset: %d length: %d error: %v", forUser, session, offset, counter.n, err)
+		return nil, err
+	}
+	ups.log.Info("UploadStore.UploadChunk success: forUser: %q session: %q offset: %d length: %d", forUser, session, offset, counter.n)
+	return updated, nil
+}
+
+func (ups *uploadStore) CompleteUpload(forUser string, session string, name string, comment string) (*UploadResult, error) {
+	us, err := ups.getSession(forUser, session)
+	if err != nil {
+		ups.log.Error("UploadStore.CompleteUpload error: forUser: %q session: %q name: %q error: %v", forUser, session, name, err)
+		return nil, err
+	}
+	if us.Status != statusUploading {
+		ups.log.Error("UploadStore.CompleteUpload error: forUser: %q session: %q name: %q error: %v", forUser, session, name, ErrUploadCompleted)
+		return nil, ErrUploadCompleted
+	}
+	if us.Received != us.Size {
+		err := fmt.Errorf("Invalid action: upload complete with %d of %d bytes received", us.Received, us.Size)
+		ups.log.Error("UploadStore.CompleteUpload error: forUser: %q session: %q name: %q error: %v", forUser, session, name, err)
+		return nil, err
+	}
+	parents, err := ups.tns.Get(forUser, []string{us.Parent})
+	if err == nil && len(parents) == 0 {
+		err = errors.New("upload parent not found")
+	}
+	if err != nil {
+		ups.log.Error("UploadStore.CompleteUpload error: forUser: %q session: %q name: %q error: %v", forUser, session, name, err)
+		return nil, err
+	}
+
+	//claiming the session is what stops concurrent or retried calls creating the file twice
+	if claimed, err := ups.setStatus(forUser, us.Id, statusUploading, statusCompleting); err != nil || !claimed {
+		if err == nil {
+			err = ErrUploadCompleted
+		}
+		ups.log.Error("UploadStore.CompleteUpload error: forUser: %q session: %q name: %q error: %v", forUser, session, name, err)
+		return nil, err
+	}
+	res, chunks, err := ups.complete(forUser, us, parents[0].NodeType == treenode.Document, name, comment)
+	if err != nil {
+		if _, releaseErr := ups.setStatus(forUser, us.Id, statusCompleting, statusUploading); releaseErr != nil {
+			ups.log.Warning("UploadStore.CompleteUpload failed to release session: forUser: %q session: %q error: %v", forUser, session, releaseErr)
+		}
+		ups.log.Error("UploadStore.CompleteUpload error: forUser: %q session: %q name: %q error: %v", forUser, session, name, err)
+		return nil, err
+	}
+
+	//the session is kept, without its chunks, until it expires so a retry finds it completed
+	if _, err := ups.setStatus(forUser, us.Id, statusCompleting, statusCompleted); err != nil {
+		ups.log.Warning("UploadStore.CompleteUpload failed to mark session completed: forUser: %q session: %q error: %v", forUser, session, err)
+	} else {
+		ups.deleteChunks(us, chunks)
+	}
+	ups.log.Info("UploadStore.CompleteUpload success: forUser: %q session: %q name: %q", forUser, session, name)
+	return res, nil
+}
+
+// complete creates the document, or the document version when the parent is a
+// document, from the chunks of a claimed session returning the chunks it read.
+func (ups *uploadStore) complete(forUser string, us *UploadSession, toDocument bool, name string, comment string) (*UploadResult, []string, error) {
+	chunks, err := ups.getChunks(forUser, us.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	file := &chunkReader{blobStore: ups.blobStore, bucket: ups.ossBucketPrefix + us.Project, session: us.Id, chunks: chunks}
+	res := &UploadResult{}
+	if toDocument {
+		res.DocumentVersion, err = ups.dvs.Create(forUser, us.Parent, comment, us.FileType, us.FileName, file, "", nil, documentversion.ReturnExisting)
+	} else {
+		if name == "" {
+			name = us.FileName
+		}
+		res.Document, err = ups.tns.CreateDocument(forUser, us.Parent, name, comment, us.FileType, us.FileName, file, "", nil)
+	}
+	return res, chunks, err
+}
+
+func (ups *uploadStore) GetUpload(forUser string, session string) (*UploadSession, error) {
+	if us, err := ups.getSession(forUser, session); err != nil {
+		ups.log.Error("UploadStore.GetUpload error: forUser: %q session: %q error: %v", forUser, session, err)
+		return nil, err
+	} else {
+		ups.log.Info("UploadStore.GetUpload success: forUser: %q session: %q", forUser, session)
+		return us, nil
+	}
+}
+
+func (ups *uploadStore) AbortUpload(forUser string, session string) error {
+	us, err := ups.getSession(forUser, session)
+	if err != nil {
+		ups.log.Error("UploadStore.AbortUpload error: forUser: %q session: %q error: %v", forUser, session, err)
+		return err
+	}
+	if claimed, err := ups.setStatus(forUser, us.Id, statusUploading, statusAborting); err != nil || !claimed {
+		if err == nil {
+			err = ErrUploadCompleted
+		}
+		ups.log.Error("UploadStore.AbortUpload error: forUser: %q session: %q error: %v", forUser, session, err)
+		return err
+	}
+	if err := ups.cleanUp(forUser, us); err != nil {
+		ups.log.Error("UploadStore.AbortUpload error: forUser: %q session: %q error: %v", forUser, session, err)
+		return err
+	}
+	ups.log.Info("UploadStore.AbortUpload success: forUser: %q session: %q", forUser, session)
+	return nil
+}
+
+func (ups *uploadStore) getSession(forUser string, session string) (*UploadSession, error) {
+	us, err := ups.get(forUser, session)
+	if err == nil && us == nil {
+		err = errors.New("upload session not found")
+	}
+	return us, err
+}
+
+// cleanUp removes the session before its chunks so a failed blob delete can
+// only leave unreferenced blobs behind.
+func (ups *uploadStore) cleanUp(forUser string, us *UploadSession) error {
+	chunks, err := ups.getChunks(forUser, us.Id)
+	if err != nil {
+		return err
+	}
+	if err := ups.delete(forUser, us.Id); err != nil {
+		return err
+	}
+	ups.deleteChunks(us, chunks)
+	return nil
+}
+
+func (ups *uploadStore) deleteChunks(us *UploadSession, chunks []string) {
+	for _, chunk := range chunks {
+		if err := ups.blobStore.Delete(ups.ossBucketPrefix+us.Project, chunkBlobName(us.Id, chunk)); err != nil {
+			ups.log.Warning("UploadStore deleteChunks failed to delete chunk blob: session: %q chunk: %q error: %v", us.Id, chunk, err)
+		}
+	}
+}
+
+func chunkBlobName(session string, chunk string) string {
+	return session + chunkBlobInfix + chunk
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// chunkReader reads the chunk blobs of a session back in order as one file,
+// only holding a single blob open at a time.
+type chunkReader struct {
+	blobStore blob.BlobStore
+	bucket    string
+	session   string
+	chunks    []string
+	next      int
+	current   io.ReadCloser
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if cr.current == nil {
+			if cr.next >= len(cr.chunks) {
+				return 0, io.EOF
+			}
+			res, err := cr.blobStore.Get(cr.bucket, chunkBlobName(cr.session, cr.chunks[cr.next]))
+			if err != nil {
+				return 0, err
+			}
+			cr.current = res.Body
+			cr.next++
+		}
+		n, err := cr.current.Read(p)
+		if err == io.EOF {
+			cr.current.Close()
+			cr.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (cr *chunkReader) Close() error {
+	if cr.current != nil {
+		err := cr.current.Close()
+		cr.current = nil
+		return err
+	}
+	return nil
+}
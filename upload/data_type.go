@@ -0,0 +1,27 @@
+package upload
+
+import (
+	"github.com/modelhub/core/documentversion"
+	"github.com/modelhub/core/treenode"
+	"time"
+)
+
+type UploadSession struct {
+	Id         string    `json:"id"`
+	Project    string    `json:"project"`
+	Parent     string    `json:"parent"`
+	CreatedBy  string    `json:"createdBy"`
+	FileName   string    `json:"fileName"`
+	FileType   string    `json:"fileType"`
+	Size       int64     `json:"size"`
+	Received   int64     `json:"received"`
+	ChunkCount int       `json:"chunkCount"`
+	Status     string    `json:"status"`
+	Created    time.Time `json:"created"`
+	Updated    time.Time `json:"updated"`
+}
+
+type UploadResult struct {
+	Document        *treenode.TreeNode               `json:"document,omitempty"`
+	DocumentVersion *documentversion.DocumentVersion `json:"documentVersion,omitempty"`
+}
@@ -0,0 +1,36 @@
+package upload
+
+import (
+	"io"
+	"time"
+)
+
+type create func(forUser string, id string, parent string, fileName string, fileType string, size int64) (*UploadSession, error)
+type get func(forUser string, id string) (*UploadSession, error)
+type addChunk func(forUser string, id string, offset int64, length int64, chunk string) (*UploadSession, error)
+type getChunks func(forUser string, id string) ([]string, error)
+type setStatus func(forUser string, id string, from string, to string) (bool, error)
+type delete func(forUser string, id string) error
+type purgeExpired func(updatedBefore time.Time) (map[string][]string, error)
+
+// UploadStore receives large files in chunks, persisting each chunk and the
+// session state as it goes so an upload can be resumed from GetUpload(..).Received
+// after a dropped connection or a restart, CompleteUpload then creates a new
+// document under a folder parent or a new version of a document parent. A
+// session is only ever completed once, it is kept as completed until it expires
+// so retrying CompleteUpload gets ErrUploadCompleted rather than another copy.
+type UploadStore interface {
+	BeginUpload(forUser string, parent string, fileName string, fileType string, size int64) (*UploadSession, error)
+	UploadChunk(forUser string, session string, offset int64, chunk io.Reader) (*UploadSession, error)
+	CompleteUpload(forUser string, session string, name string, comment string) (*UploadResult, error)
+	GetUpload(forUser string, session string) (*UploadSession, error)
+	AbortUpload(forUser string, session string) error
+}
+
+// UploadPurger removes upload sessions that have not been updated for longer
+// than the expiry period, along with the chunk blobs of those never completed. Nothing is purged until
+// Start is called, which need only happen in one process.
+type UploadPurger interface {
+	Start()
+	Stop()
+}
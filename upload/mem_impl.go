@@ -0,0 +1,139 @@
+package upload
+
+import (
+	"errors"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/documentversion"
+	"github.com/modelhub/core/treenode"
+	"github.com/modelhub/core/util"
+	"github.com/robsix/golog"
+	"time"
+)
+
+func NewMemUploadStore(db *util.MemDb, tns treenode.TreeNodeStore, dvs documentversion.DocumentVersionStore, blobStore blob.BlobStore, ossBucketPrefix string, log golog.Log) UploadStore {
+
+	toUploadSession := func(us *util.MemUploadSession) *UploadSession {
+		return &UploadSession{
+			Id:         us.Id,
+			Project:    us.Project,
+			Parent:     us.Parent,
+			CreatedBy:  us.CreatedBy,
+			FileName:   us.FileName,
+			FileType:   us.FileType,
+			Size:       us.Size,
+			Received:   us.Received,
+			ChunkCount: us.ChunkCount,
+			Status:     us.Status,
+			Created:    us.Created,
+			Updated:    us.Updated,
+		}
+	}
+
+	create := func(forUser string, id string, parent string, fileName string, fileType string, size int64) (*UploadSession, error) {
+		db.Lock()
+		defer db.Unlock()
+		tn, exists := db.TreeNodes[parent]
+		if !exists || tn.Trash != "" || !(tn.NodeType == "folder" || tn.NodeType == "document") {
+			return nil, errors.New("Unauthorized action: uploadSession create")
+		}
+		if role, err := db.Role(forUser, tn.Project); err != nil || !util.MemRoleIn(role, "owner", "admin", "organiser", "contributor") {
+			return nil, errors.New("Unauthorized action: uploadSession create")
+		}
+		if size < 0 {
+			return nil, errors.New("Invalid action: uploadSession create with negative size")
+		}
+		now := time.Now().UTC()
+		us := &util.MemUploadSession{
+			Id:        id,
+			Project:   tn.Project,
+			Parent:    parent,
+			CreatedBy: forUser,
+			FileName:  fileName,
+			FileType:  fileType,
+			Size:      size,
+			Status:    statusUploading,
+			Created:   now,
+			Updated:   now,
+		}
+		db.UploadSessions[id] = us
+		return toUploadSession(us), nil
+	}
+
+	get := func(forUser string, id string) (*UploadSession, error) {
+		db.RLock()
+		defer db.RUnlock()
+		if us, exists := db.UploadSessions[id]; exists && us.CreatedBy == forUser {
+			return toUploadSession(us), nil
+		}
+		return nil, nil
+	}
+
+	addChunk := func(forUser string, id string, offset int64, length int64, chunk string) (*UploadSession, error) {
+		db.Lock()
+		defer db.Unlock()
+		us, exists := db.UploadSessions[id]
+		if !exists || us.CreatedBy != forUser || us.Status != statusUploading || us.Received != offset || us.Received+length > us.Size {
+			return nil, errors.New("Invalid action: uploadSession add chunk at unexpected offset")
+		}
+		us.Received += length
+		us.ChunkCount++
+		us.Chunks = append(us.Chunks, chunk)
+		us.Updated = time.Now().UTC()
+		return toUploadSession(us), nil
+	}
+
+	getChunks := func(forUser string, id string) ([]string, error) {
+		db.RLock()
+		defer db.RUnlock()
+		if us, exists := db.UploadSessions[id]; exists && us.CreatedBy == forUser {
+			return append([]string{}, us.Chunks...), nil
+		}
+		return nil, nil
+	}
+
+	setStatus := func(forUser string, id string, from string, to string) (bool, error) {
+		db.Lock()
+		defer db.Unlock()
+		us, exists := db.UploadSessions[id]
+		if !exists || us.CreatedBy != forUser || us.Status != from {
+			return false, nil
+		}
+		us.Status = to
+		us.Updated = time.Now().UTC()
+		return true, nil
+	}
+
+	delete := func(forUser string, id string) error {
+		db.Lock()
+		defer db.Unlock()
+		if us, exists := db.UploadSessions[id]; exists && us.CreatedBy == forUser {
+			db.DeleteUploadSession(id)
+		}
+		return nil
+	}
+
+	return newUploadStore(create, get, addChunk, getChunks, setStatus, delete, tns, dvs, blobStore, ossBucketPrefix, log)
+}
+
+func NewMemUploadPurger(db *util.MemDb, blobStore blob.BlobStore, uploadExpiry time.Duration, uploadPurgeInterval time.Duration, ossBucketPrefix string, log golog.Log) UploadPurger {
+
+	purgeExpired := func(updatedBefore time.Time) (map[string][]string, error) {
+		db.Lock()
+		defer db.Unlock()
+		blobs := map[string][]string{}
+		for id, us := range db.UploadSessions {
+			if us.Updated.Before(updatedBefore) {
+				//a completed session's chunk blobs were deleted when it completed
+				if us.Status != statusCompleted {
+					for _, chunk := range us.Chunks {
+						blobs[us.Project] = append(blobs[us.Project], chunkBlobName(id, chunk))
+					}
+				}
+				db.DeleteUploadSession(id)
+			}
+		}
+		return blobs, nil
+	}
+
+	return newUploadPurger(purgeExpired, blobStore, uploadExpiry, uploadPurgeInterval, ossBucketPrefix, log)
+}
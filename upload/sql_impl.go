@@ -0,0 +1,82 @@
+package upload
+
+import (
+	"database/sql"
+	"github.com/modelhub/core/blob"
+	"github.com/modelhub/core/documentversion"
+	"github.com/modelhub/core/treenode"
+	"github.com/modelhub/core/util"
+	"github.com/robsix/golog"
+	"time"
+)
+
+func NewSqlUploadStore(db *sql.DB, tns treenode.TreeNodeStore, dvs documentversion.DocumentVersionStore, blobStore blob.BlobStore, ossBucketPrefix string, log golog.Log) UploadStore {
+
+	getter := func(query string, args ...interface{}) (*UploadSession, error) {
+		var us *UploadSession
+		rowsScan := func(rows *sql.Rows) error {
+			us = &UploadSession{}
+			return rows.Scan(&us.Id, &us.Project, &us.Parent, &us.CreatedBy, &us.FileName, &us.FileType, &us.Size, &us.Received, &us.ChunkCount, &us.Status, &us.Created, &us.Updated)
+		}
+		return us, util.SqlQuery(db, rowsScan, query, args...)
+	}
+
+	create := func(forUser string, id string, parent string, fileName string, fileType string, size int64) (*UploadSession, error) {
+		return getter("CALL uploadSessionCreate(?, ?, ?, ?, ?, ?)", forUser, id, parent, fileName, fileType, size)
+	}
+
+	get := func(forUser string, id string) (*UploadSession, error) {
+		return getter("CALL uploadSessionGet(?, ?)", forUser, id)
+	}
+
+	addChunk := func(forUser string, id string, offset int64, length int64, chunk string) (*UploadSession, error) {
+		return getter("CALL uploadSessionAddChunk(?, ?, ?, ?, ?)", forUser, id, offset, length, chunk)
+	}
+
+	getChunks := func(forUser string, id string) ([]string, error) {
+		chunks := []string{}
+		rowsScan := func(rows *sql.Rows) error {
+			chunk := ""
+			if err := rows.Scan(&chunk); err != nil {
+				return err
+			}
+			chunks = append(chunks, chunk)
+			return nil
+		}
+		return chunks, util.SqlQuery(db, rowsScan, "CALL uploadSessionGetChunks(?, ?)", forUser, id)
+	}
+
+	setStatus := func(forUser string, id string, from string, to string) (bool, error) {
+		changed := false
+		rowsScan := func(rows *sql.Rows) error {
+			return rows.Scan(&changed)
+		}
+		return changed, util.SqlQuery(db, rowsScan, "CALL uploadSessionSetStatus(?, ?, ?, ?)", forUser, id, from, to)
+	}
+
+	delete := func(forUser string, id string) error {
+		return util.SqlExec(db, "CALL uploadSessionDelete(?, ?)", forUser, id)
+	}
+
+	return newUploadStore(create, get, addChunk, getChunks, setStatus, delete, tns, dvs, blobStore, ossBucketPrefix, log)
+}
+
+func NewSqlUploadPurger(db *sql.DB, blobStore blob.BlobStore, uploadExpiry time.Duration, uploadPurgeInterval time.Duration, ossBucketPrefix string, log golog.Log) UploadPurger {
+
+	purgeExpired := func(updatedBefore time.Time) (map[string][]string, error) {
+		blobs := map[string][]string{}
+		rowsScan := func(rows *sql.Rows) error {
+			project := ""
+			session := ""
+			chunk := ""
+			if err := rows.Scan(&project, &session, &chunk); err != nil {
+				return err
+			}
+			blobs[project] = append(blobs[project], chunkBlobName(session, chunk))
+			return nil
+		}
+		return blobs, util.SqlQuery(db, rowsScan, "CALL uploadSessionPurgeExpired(?)", updatedBefore)
+	}
+
+	return newUploadPurger(purgeExpired, blobStore, uploadExpiry, uploadPurgeInterval, ossBucketPrefix, log)
+}
@@ -0,0 +1,91 @@
+package upload
+
+import (
+	"github.com/modelhub/core/blob"
+	"github.com/robsix/golog"
+	"sync"
+	"time"
+)
+
+func newUploadPurger(purgeExpired purgeExpired, blobStore blob.BlobStore, expiry time.Duration, interval time.Duration, ossBucketPrefix string, log golog.Log) UploadPurger {
+	return &uploadPurger{
+		purgeExpired:    purgeExpired,
+		blobStore:       blobStore,
+		expiry:          expiry,
+		interval:        interval,
+		ossBucketPrefix: ossBucketPrefix,
+		log:             log,
+	}
+}
+
+type uploadPurger struct {
+	purgeExpired    purgeExpired
+	blobStore       blob.BlobStore
+	expiry          time.Duration
+	interval        time.Duration
+	ossBucketPrefix string
+	log             golog.Log
+	mtx             sync.Mutex
+	stop            chan struct{}
+	stopped         chan struct{}
+}
+
+func (up *uploadPurger) Start() {
+	up.mtx.Lock()
+	defer up.mtx.Unlock()
+	if up.stop != nil {
+		return
+	}
+	if up.expiry <= 0 || up.interval <= 0 {
+		up.log.Warning("UploadPurger.Start not started: expiry: %v interval: %v", up.expiry, up.interval)
+		return
+	}
+	up.stop = make(chan struct{})
+	up.stopped = make(chan struct{})
+	go up.run(up.stop, up.stopped)
+	up.log.Info("UploadPurger.Start success: expiry: %v interval: %v", up.expiry, up.interval)
+}
+
+func (up *uploadPurger) Stop() {
+	up.mtx.Lock()
+	defer up.mtx.Unlock()
+	if up.stop == nil {
+		return
+	}
+	close(up.stop)
+	<-up.stopped
+	up.stop = nil
+	up.stopped = nil
+	up.log.Info("UploadPurger.Stop success")
+}
+
+func (up *uploadPurger) run(stop chan struct{}, stopped chan struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(up.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			up.purge()
+		}
+	}
+}
+
+func (up *uploadPurger) purge() {
+	updatedBefore := time.Now().UTC().Add(-up.expiry)
+	blobs, err := up.purgeExpired(updatedBefore)
+	if err != nil {
+		up.log.Error("UploadPurger purge error: updatedBefore: %v error: %v", updatedBefore, err)
+		return
+	}
+	for projectId, names := range blobs {
+		for _, name := range names {
+			if err := up.blobStore.Delete(up.ossBucketPrefix+projectId, name); err != nil {
+				up.log.Error("UploadPurger purge error: project: %q blob: %q error: %v", projectId, name, err)
+			}
+		}
+	}
+	up.log.Info("UploadPurger purge success: updatedBefore: %v", updatedBefore)
+}
@@ -0,0 +1,125 @@
+package user
+
+import (
+	"errors"
+	"github.com/modelhub/core/util"
+	"github.com/robsix/golog"
+	"sort"
+	"time"
+)
+
+func NewMemUserStore(db *util.MemDb, log golog.Log) UserStore {
+
+	toUser := func(u *util.MemUser) *User {
+		return &User{
+			Id:       u.Id,
+			Avatar:   u.Avatar,
+			FullName: u.FullName,
+		}
+	}
+
+	login := func(autodeskId string, openId string, username string, avatar string, fullName string, email string) (string, error) {
+		db.Lock()
+		defer db.Unlock()
+		for _, u := range db.Users {
+			if u.AutodeskId == autodeskId {
+				u.OpenId = openId
+				u.Username = username
+				u.Avatar = avatar
+				u.FullName = fullName
+				u.Email = email
+				u.LastLogin = time.Now().UTC()
+				return u.Id, nil
+			}
+		}
+		u := &util.MemUser{
+			Id:         util.NewId(),
+			AutodeskId: autodeskId,
+			OpenId:     openId,
+			Username:   username,
+			Avatar:     avatar,
+			FullName:   fullName,
+			Email:      email,
+			LastLogin:  time.Now().UTC(),
+			UILanguage: "en",
+			UITheme:    "dark",
+			TimeFormat: "llll",
+		}
+		db.Users[u.Id] = u
+		return u.Id, nil
+	}
+
+	getCurrent := func(id string) (*CurrentUser, error) {
+		db.RLock()
+		defer db.RUnlock()
+		cu := CurrentUser{}
+		if u, exists := db.Users[id]; exists {
+			cu.User = *toUser(u)
+			cu.SuperUser = u.SuperUser
+			cu.UILanguage = u.UILanguage
+			cu.UITheme = u.UITheme
+			cu.TimeFormat = u.TimeFormat
+		}
+		return &cu, nil
+	}
+
+	setProperty := func(forUser string, property property, value string) error {
+		db.Lock()
+		defer db.Unlock()
+		u, exists := db.Users[forUser]
+		if !exists {
+			return nil
+		}
+		switch property {
+		case Description:
+			u.Description = value
+		case UILanguage:
+			u.UILanguage = value
+		case UITheme:
+			u.UITheme = value
+		case TimeFormat:
+			u.TimeFormat = value
+		default:
+			err := errors.New("invalid property name")
+			return err
+		}
+		return nil
+	}
+
+	get := func(ids []string) ([]*User, error) {
+		db.RLock()
+		defer db.RUnlock()
+		us := make([]*User, 0, len(ids))
+		for _, id := range ids {
+			if u, exists := db.Users[id]; exists {
+				us = append(us, toUser(u))
+			}
+		}
+		return us, nil
+	}
+
+	search := func(search string, offset int, limit int, sortBy sortBy) ([]*User, int, error) {
+		db.RLock()
+		defer db.RUnlock()
+		matches := make([]*util.MemUser, 0, util.DefaultSqlOffsetQueryLimit)
+		for _, u := range db.Users {
+			if util.MemMatch(search, u.Username, u.FullName, u.Email) {
+				matches = append(matches, u)
+			}
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			if sortBy == FullNameDesc {
+				return util.MemLessFold(matches[j].FullName, matches[i].FullName)
+			}
+			return util.MemLessFold(matches[i].FullName, matches[j].FullName)
+		})
+		start, end := util.MemOffsetLimit(len(matches), offset, limit)
+		us := make([]*User, 0, end-start)
+		for _, u := range matches[start:end] {
+			us = append(us, toUser(u))
+		}
+		return us, len(matches), nil
+	}
+
+	return newUserStore(login, getCurrent, setProperty, get, search, log)
+}
@@ -1,69 +1,182 @@
 package util
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"github.com/modelhub/core/blob"
 	"github.com/modelhub/vada"
 	"github.com/robsix/golog"
 	"io"
-	"path/filepath"
 	"strings"
 )
 
-func DocumentUploadHelper(fileName string, fileType string, file io.ReadCloser, thumbnailType string, thumbnail io.ReadCloser, ossBucket string, vada vada.VadaClient, log golog.Log) (newDocVerId string, status string, urn string, fExt string, fType string, tnType string, err error) {
+// translation copies are only read by vada while it translates, the seed file
+// itself is kept in the blob store.
+const translationBucketPolicy = vada.Transient
+
+// ErrNoVada is returned for anything needing translation when the stores were
+// created without a vada client, as the mem stores used in tests may be.
+var ErrNoVada = errors.New("no vada client to translate with")
+
+// DocumentUploadHelper stores the seed file and thumbnail then registers lmv
+// files for translation. The file type is detected by fileTypes from the name
+// and leading bytes of the file, contentHash is the hex SHA-256 of it. If
+// checkDuplicate is given it is called with the contentHash before anything
+// but the seed file is saved, an error from it removes the seed file again
+// and is returned as is. Images uploaded without a thumbnail get one generated
+// from the seed file and have their imageInfo read from it, pdfs get the
+// embedded thumbnail of their first page if it has one. Once the seed file
+// is stored a failure to register it only shows in the failed_to_register status.
+func DocumentUploadHelper(fileName string, fileType string, file io.ReadCloser, thumbnailType string, thumbnail io.ReadCloser, ossBucket string, blobStore blob.BlobStore, vada vada.VadaClient, fileTypes FileTypeRegistry, checkDuplicate func(contentHash string) error, log golog.Log) (newDocVerId string, status string, urn string, fExt string, fType string, tnType string, contentHash string, mimeType string, imageInfo *ImageInfo, err error) {
 	if file == nil {
 		err := errors.New("file required")
 		log.Error("DocumentUploadHelper error: %v", err)
-		return "", "", "", "", fileType, "", err
+		return "", "", "", "", fileType, "", "", "", nil, err
 	}
 	defer file.Close()
 
-	fileExtension := filepath.Ext(fileName)
-	if len(fileExtension) >= 1 {
-		fileExtension = fileExtension[1:] //cut of the .
+	if fileTypes == nil {
+		fileTypes = NewFileTypeRegistry()
+	}
+	head := make([]byte, fileTypes.SniffLength())
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", "", "", "", fileType, "", "", "", nil, err
 	}
-	fExt = fileExtension
+	head, err = head[:n], nil
+	detected := fileTypes.Detect(fileName, head)
+	fileExtension := detected.Extension
+	fExt, mimeType = fileExtension, detected.MimeType
 
-	fType, _ = getFileType(fileExtension)
+	fType = detected.Category
 	if fType == "image" || fType == "video" || fType == "audio" || fType == "" {
 		fType = fileType
+		if fType == "" {
+			fType = mimeType
+		}
+	}
+	if fType == "lmv" && vada == nil {
+		log.Error("DocumentUploadHelper error: %v", ErrNoVada)
+		return "", "", "", fExt, fType, "", "", mimeType, nil, ErrNoVada
 	}
 	newDocVerId = NewId()
 
-	log.Info("DocumentUploadHelper starting upload of file: %q to bucket: %q", newDocVerId+"."+fileExtension, ossBucket)
-	uploadResp, err := vada.UploadFile(newDocVerId+"."+fileExtension, ossBucket, file)
+	seedName := newDocVerId + "." + fileExtension
+	log.Info("DocumentUploadHelper starting upload of file: %q to bucket: %q", seedName, ossBucket)
+	hash := sha256.New()
+	seed := io.TeeReader(io.MultiReader(bytes.NewReader(head), file), hash)
+	//images, and pdfs arriving without a thumbnail, are kept as they upload so
+	//nothing needs to download them again
+	var imageSeed, pdfSeed *seedBuffer
+	if detected.Category == "image" {
+		imageSeed = &seedBuffer{max: thumbnailMaxSourceSize}
+		seed = io.TeeReader(seed, imageSeed)
+	} else if detected.Extension == "pdf" && thumbnail == nil {
+		pdfSeed = &seedBuffer{max: pdfMaxParseSize}
+		seed = io.TeeReader(seed, pdfSeed)
+	}
+	objectId, err := blobStore.Put(ossBucket, seedName, seed)
 	if err != nil {
-		return "", "", "", fExt, fType, "", err
+		return "", "", "", fExt, fType, "", "", mimeType, nil, err
 	}
+	contentHash = hex.EncodeToString(hash.Sum(nil))
 
-	tnType, err = ThumbnailUploadHelper(newDocVerId, thumbnailType, thumbnail, ossBucket, vada)
+	if checkDuplicate != nil {
+		if err = checkDuplicate(contentHash); err != nil {
+			if delErr := blobStore.Delete(ossBucket, seedName); delErr != nil {
+				log.Warning("DocumentUploadHelper failed to remove duplicate file: %q error: %v", seedName, delErr)
+			}
+			return "", "", "", fExt, fType, "", contentHash, mimeType, nil, err
+		}
+	}
 
-	urn, err = uploadResp.String("objectId")
-	if err != nil {
-		return newDocVerId, "", urn, fExt, fType, tnType, err
+	if tnType, err = ThumbnailUploadHelper(newDocVerId, thumbnailType, thumbnail, ossBucket, blobStore); err != nil {
+		log.Warning("DocumentUploadHelper failed to upload thumbnail for file: %q error: %v", seedName, err)
+		tnType, err = "", nil
+	}
+	if tnType == "" && imageSeed != nil {
+		if imageSeed.truncated {
+			err = ErrImageTooLarge
+		} else {
+			tnType, err = ThumbnailGenerateHelper(newDocVerId, imageSeed.data, ossBucket, blobStore)
+		}
+		if err != nil {
+			log.Warning("DocumentUploadHelper failed to generate thumbnail for file: %q error: %v", seedName, err)
+			tnType, err = "", nil
+		}
+	}
+	if tnType == "" && pdfSeed != nil && !pdfSeed.truncated {
+		if tnType, err = PdfThumbnailGenerateHelper(newDocVerId, pdfSeed.data, ossBucket, blobStore); err != nil {
+			log.Warning("DocumentUploadHelper failed to generate thumbnail for file: %q error: %v", seedName, err)
+			tnType, err = "", nil
+		}
+	}
+	if imageSeed != nil {
+		var infoErr error
+		if imageInfo, infoErr = ReadImageInfo(imageSeed.data); infoErr != nil {
+			log.Warning("DocumentUploadHelper failed to read image info for file: %q error: %v", seedName, infoErr)
+		}
 	}
 
+	//the seed file is safely stored by now so a registration failure is recorded
+	//on the version, for the TranslationMonitor to retry, rather than returned
+	status = "wont_register"
 	if fType == "lmv" {
-		log.Info("DocumentUploadHelper registering file: %q", newDocVerId+"."+fileExtension)
-		b64Urn := ToBase64(urn)
-		_, err = vada.RegisterFile(b64Urn)
+		log.Info("DocumentUploadHelper registering file: %q", seedName)
+		status = "registered"
+		if urn, err = TranslationUploadHelper(seedName, objectId, ossBucket, blobStore, vada); err == nil {
+			_, err = vada.RegisterFile(ToBase64(urn))
+		}
 		if err != nil {
-			status = "failed_to_register"
-		} else {
-			status = "registered"
+			log.Warning("DocumentUploadHelper failed to register file: %q error: %v", seedName, err)
+			status, err = "failed_to_register", nil
 		}
-	} else {
-		status = "wont_register"
 	}
 
-	return newDocVerId, status, urn, fExt, fType, tnType, err
+	return newDocVerId, status, urn, fExt, fType, tnType, contentHash, mimeType, imageInfo, nil
 }
 
-func ThumbnailUploadHelper(id string, thumbnailType string, thumbnail io.ReadCloser, ossBucket string, vada vada.VadaClient) (tnType string, err error) {
+// TranslationUploadHelper returns the urn vada translates seedName from. A
+// seed file whose Put returned an objectId is already in vada and is used as
+// is, anything else is copied out of the blob store into the vada bucket of
+// the same name, which is created on demand.
+func TranslationUploadHelper(seedName string, objectId string, ossBucket string, blobStore blob.BlobStore, vada vada.VadaClient) (urn string, err error) {
+	if objectId != "" {
+		return objectId, nil
+	}
+	if vada == nil {
+		return "", ErrNoVada
+	}
+
+	upload := func() (string, error) {
+		res, err := blobStore.Get(ossBucket, seedName)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		uploadResp, err := vada.UploadFile(seedName, ossBucket, res.Body)
+		if err != nil {
+			return "", err
+		}
+		return uploadResp.String("objectId")
+	}
+
+	if urn, err = upload(); err != nil {
+		if _, createErr := vada.CreateBucket(ossBucket, translationBucketPolicy); createErr == nil {
+			urn, err = upload()
+		}
+	}
+	return urn, err
+}
+
+func ThumbnailUploadHelper(id string, thumbnailType string, thumbnail io.ReadCloser, ossBucket string, blobStore blob.BlobStore) (tnType string, err error) {
 	if thumbnail != nil {
 		defer thumbnail.Close()
 		if thumbnail != nil && strings.HasPrefix(thumbnailType, "image/") {
-			if _, err = vada.UploadFile(id+".tn.tn", ossBucket, thumbnail); err != nil {
+			if _, err = blobStore.Put(ossBucket, id+".tn.tn", thumbnail); err != nil {
 				return "", err
 			} else {
 				return thumbnailType, nil
@@ -76,3 +189,16 @@ func ThumbnailUploadHelper(id string, thumbnailType string, thumbnail io.ReadClo
 func ToBase64(str string) string {
 	return base64.StdEncoding.EncodeToString([]byte(str))
 }
+
+// FromBase64 reverses ToBase64, vada also hands out url safe unpadded urns so those are accepted too.
+func FromBase64(str string) (string, error) {
+	var lastErr error
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if bytes, err := enc.DecodeString(str); err == nil {
+			return string(bytes), nil
+		} else {
+			lastErr = err
+		}
+	}
+	return "", lastErr
+}
@@ -1,11 +1,20 @@
 package util
 
 import (
-	"errors"
+	"bytes"
+	"mime"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
-var fileTypes = map[string]string{
+const (
+	defaultMimeType = "application/octet-stream"
+	//enough to cover every default signature, including the mimetype entry of open document zips
+	defaultSniffLength = 512
+)
+
+var defaultFileTypes = map[string]string{
 	//open document format
 	"odt":  "od",
 	"ods":  "od",
@@ -52,6 +61,7 @@ var fileTypes = map[string]string{
 	"catproduct":    "lmv",
 	"cgr":           "lmv",
 	"collaboration": "lmv",
+	"dgn":           "lmv",
 	"dlv3":          "lmv",
 	"dwf":           "lmv",
 	"dwfx":          "lmv",
@@ -65,6 +75,7 @@ var fileTypes = map[string]string{
 	"iam":           "lmv",
 	"idw":           "lmv",
 	"ifc":           "lmv",
+	"ifczip":        "lmv",
 	"ige":           "lmv",
 	"iges":          "lmv",
 	"igs":           "lmv",
@@ -74,8 +85,11 @@ var fileTypes = map[string]string{
 	"neu":           "lmv",
 	"nwc":           "lmv",
 	"nwd":           "lmv",
+	"nwf":           "lmv",
+	"obj":           "lmv",
 	"prt":           "lmv",
 	"rcp":           "lmv",
+	"rfa":           "lmv",
 	"rvt":           "lmv",
 	"sab":           "lmv",
 	"sat":           "lmv",
@@ -100,10 +114,177 @@ var fileTypes = map[string]string{
 	"xpr":           "lmv",
 }
 
-func getFileType(fileExtension string) (string, error) {
-	if fileType, exists := fileTypes[strings.ToLower(fileExtension)]; exists {
-		return fileType, nil
+var defaultMimeTypes = map[string]string{
+	"odt":  "application/vnd.oasis.opendocument.text",
+	"ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	"odp":  "application/vnd.oasis.opendocument.presentation",
+	"odg":  "application/vnd.oasis.opendocument.graphics",
+	"odf":  "application/vnd.oasis.opendocument.formula",
+	"pdf":  "application/pdf",
+	"csv":  "text/csv",
+	"txt":  "text/plain",
+	"md":   "text/markdown",
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"jpg":  "image/jpeg",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"mp4":  "video/mp4",
+	"ogg":  "video/ogg",
+	"ogv":  "video/ogg",
+	"webm": "video/webm",
+	"aac":  "audio/aac",
+	"mp3":  "audio/mpeg",
+	"oga":  "audio/ogg",
+	"wav":  "audio/wav",
+	"dwg":  "image/vnd.dwg",
+	"dxf":  "image/vnd.dxf",
+	"ifc":  "application/x-step",
+	"step": "application/step",
+	"stp":  "application/step",
+	"stl":  "model/stl",
+	"obj":  "model/obj",
+}
+
+// FileSignature identifies a file type from the magic bytes at Offset.
+// Extension is used in place of the uploaded file's extension when a sniffed
+// signature disagrees with it, so it must be registered as well. Aliases are
+// the other extensions of files that start with the same magic bytes, a file
+// named with one of them keeps its own extension.
+type FileSignature struct {
+	Offset    int
+	Magic     []byte
+	Extension string
+	Aliases   []string
+}
+
+var defaultFileSignatures = []*FileSignature{
+	{Offset: 0, Magic: []byte("%PDF-"), Extension: "pdf"},
+	{Offset: 0, Magic: []byte("\x89PNG\r\n\x1a\n"), Extension: "png"},
+	{Offset: 0, Magic: []byte("\xff\xd8\xff"), Extension: "jpg", Aliases: []string{"jpeg"}},
+	{Offset: 0, Magic: []byte("GIF87a"), Extension: "gif"},
+	{Offset: 0, Magic: []byte("GIF89a"), Extension: "gif"},
+	{Offset: 8, Magic: []byte("WEBP"), Extension: "webp"},
+	{Offset: 0, Magic: []byte("AC10"), Extension: "dwg"},
+	{Offset: 0, Magic: []byte("ISO-10303-21;"), Extension: "ifc", Aliases: []string{"ste", "step", "stp"}},
+	//open document zips store their mimetype uncompressed as the first entry
+	{Offset: 30, Magic: []byte("mimetypeapplication/vnd.oasis.opendocument.text"), Extension: "odt"},
+	{Offset: 30, Magic: []byte("mimetypeapplication/vnd.oasis.opendocument.spreadsheet"), Extension: "ods"},
+	{Offset: 30, Magic: []byte("mimetypeapplication/vnd.oasis.opendocument.presentation"), Extension: "odp"},
+	{Offset: 30, Magic: []byte("mimetypeapplication/vnd.oasis.opendocument.graphics"), Extension: "odg"},
+}
+
+// FileType is what a FileTypeRegistry detected for an upload, Category is one
+// of the registered categories such as "lmv", "pdf" or "image" and is empty
+// when neither the extension nor the content are known.
+type FileType struct {
+	Extension string
+	Category  string
+	MimeType  string
+}
+
+type FileTypeRegistry interface {
+	Register(extension string, category string, mimeType string)
+	RegisterSignature(signature *FileSignature)
+	SniffLength() int
+	Detect(fileName string, head []byte) *FileType
+}
+
+// NewFileTypeRegistry returns a registry preloaded with the default extensions and signatures.
+func NewFileTypeRegistry() FileTypeRegistry {
+	ftr := &fileTypeRegistry{
+		categories:  make(map[string]string, len(defaultFileTypes)),
+		mimeTypes:   make(map[string]string, len(defaultMimeTypes)),
+		signatures:  make([]*FileSignature, 0, len(defaultFileSignatures)),
+		sniffLength: defaultSniffLength,
+	}
+	for ext, category := range defaultFileTypes {
+		ftr.Register(ext, category, defaultMimeTypes[ext])
+	}
+	for _, signature := range defaultFileSignatures {
+		ftr.RegisterSignature(signature)
+	}
+	return ftr
+}
+
+type fileTypeRegistry struct {
+	mtx         sync.RWMutex
+	categories  map[string]string
+	mimeTypes   map[string]string
+	signatures  []*FileSignature
+	sniffLength int
+}
+
+func (ftr *fileTypeRegistry) Register(extension string, category string, mimeType string) {
+	ftr.mtx.Lock()
+	defer ftr.mtx.Unlock()
+	extension = strings.ToLower(strings.TrimPrefix(extension, "."))
+	ftr.categories[extension] = category
+	if mimeType != "" {
+		ftr.mimeTypes[extension] = mimeType
 	} else {
-		return "", errors.New("unkonwn file type")
+		delete(ftr.mimeTypes, extension)
+	}
+}
+
+// RegisterSignature adds a signature ahead of the existing ones so later
+// registrations can refine the defaults.
+func (ftr *fileTypeRegistry) RegisterSignature(signature *FileSignature) {
+	ftr.mtx.Lock()
+	defer ftr.mtx.Unlock()
+	ftr.signatures = append([]*FileSignature{signature}, ftr.signatures...)
+	if end := signature.Offset + len(signature.Magic); end > ftr.sniffLength {
+		ftr.sniffLength = end
+	}
+}
+
+func (ftr *fileTypeRegistry) SniffLength() int {
+	ftr.mtx.RLock()
+	defer ftr.mtx.RUnlock()
+	return ftr.sniffLength
+}
+
+// Detect classifies a file by its extension, unless head matches a signature
+// for a different extension in which case the sniffed type wins.
+func (ftr *fileTypeRegistry) Detect(fileName string, head []byte) *FileType {
+	ftr.mtx.RLock()
+	defer ftr.mtx.RUnlock()
+	ft := ftr.fileType(strings.TrimPrefix(filepath.Ext(fileName), "."))
+	for _, signature := range ftr.signatures {
+		end := signature.Offset + len(signature.Magic)
+		if end <= len(head) && bytes.Equal(head[signature.Offset:end], signature.Magic) {
+			if !signature.matches(ft.Extension) {
+				ft = ftr.fileType(signature.Extension)
+			}
+			break
+		}
+	}
+	return ft
+}
+
+func (ftr *fileTypeRegistry) fileType(extension string) *FileType {
+	ft := &FileType{
+		Extension: extension,
+		Category:  ftr.categories[strings.ToLower(extension)],
+		MimeType:  ftr.mimeTypes[strings.ToLower(extension)],
+	}
+	if ft.MimeType == "" && extension != "" {
+		ft.MimeType = mime.TypeByExtension("." + strings.ToLower(extension))
+	}
+	if ft.MimeType == "" {
+		ft.MimeType = defaultMimeType
+	}
+	return ft
+}
+
+func (fs *FileSignature) matches(extension string) bool {
+	if strings.EqualFold(extension, fs.Extension) {
+		return true
+	}
+	for _, alias := range fs.Aliases {
+		if strings.EqualFold(extension, alias) {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,33 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestDetectPrefersSniffedExtension(t *testing.T) {
+	ftr := NewFileTypeRegistry()
+	png := []byte("\x89PNG\r\n\x1a\n")
+	jpg := []byte("\xff\xd8\xff\xe0")
+	step := []byte("ISO-10303-21;")
+
+	cases := []struct {
+		fileName  string
+		head      []byte
+		extension string
+		mimeType  string
+	}{
+		{"photo.jpg", png, "png", "image/png"},
+		{"photo.jpeg", jpg, "jpeg", "image/jpeg"},
+		{"photo.JPG", jpg, "JPG", "image/jpeg"},
+		{"model.stp", step, "stp", "application/step"},
+		{"model.ifc", step, "ifc", "application/x-step"},
+		{"model.dwg", step, "ifc", "application/x-step"},
+		{"notes.txt", []byte("plain text"), "txt", "text/plain"},
+	}
+	for _, c := range cases {
+		ft := ftr.Detect(c.fileName, c.head)
+		if ft.Extension != c.extension || ft.MimeType != c.mimeType {
+			t.Errorf("Detect(%q) expected %s %s got %s %s", c.fileName, c.extension, c.mimeType, ft.Extension, ft.MimeType)
+		}
+	}
+}
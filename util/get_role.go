@@ -24,3 +24,11 @@ func GetRoleFunc(db *sql.DB) GetRole {
 		return "", err
 	}
 }
+
+func GetMemRoleFunc(db *MemDb) GetRole {
+	return func(forUser string, projectId string) (string, error) {
+		db.RLock()
+		defer db.RUnlock()
+		return db.Role(forUser, projectId)
+	}
+}
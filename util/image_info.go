@@ -0,0 +1,305 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	encoding "encoding/json"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// exif is expected in the leading segments/chunks of an image so only this
+	// much of the file is searched for it.
+	imageInfoExifSearchLength = 256 * 1024
+	imageInfoMaxStringLength  = 100
+	exifTimeFormat            = "2006:01:02 15:04:05"
+)
+
+type ImageInfo struct {
+	Width       int            `json:"width"`
+	Height      int            `json:"height"`
+	ColorModel  string         `json:"colorModel"`
+	Captured    *time.Time     `json:"captured,omitempty"`
+	CameraMake  string         `json:"cameraMake,omitempty"`
+	CameraModel string         `json:"cameraModel,omitempty"`
+	Location    *ImageLocation `json:"location,omitempty"`
+}
+
+// ImageLocation is a WGS84 position in decimal degrees, north and east positive.
+type ImageLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// ReadImageInfo reads the dimensions and colour model of the image in seed
+// along with the capture time, camera and GPS position from any exif data it
+// carries, exif is read from jpeg, png and webp files. Only the headers are
+// read so seed may be just the leading part of the image. Capture times
+// without an exif offset are taken to be UTC.
+func ReadImageInfo(seed []byte) (*ImageInfo, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(seed))
+	if err != nil {
+		return nil, err
+	}
+	info := &ImageInfo{
+		Width:      config.Width,
+		Height:     config.Height,
+		ColorModel: colorModelName(config.ColorModel),
+	}
+	head := seed
+	if len(head) > imageInfoExifSearchLength {
+		head = head[:imageInfoExifSearchLength]
+	}
+	if exif := findExif(format, head); exif != nil {
+		parseExif(exif, info)
+	}
+	return info, nil
+}
+
+// ToImageInfoJson is the form an ImageInfo is persisted in, nil is stored as an empty string.
+func ToImageInfoJson(info *ImageInfo) string {
+	if info == nil {
+		return ""
+	}
+	infoJson, _ := encoding.Marshal(info)
+	return string(infoJson)
+}
+
+func ToImageInfo(infoJson string) *ImageInfo {
+	if infoJson == "" {
+		return nil
+	}
+	info := &ImageInfo{}
+	if err := encoding.Unmarshal([]byte(infoJson), info); err != nil {
+		return nil
+	}
+	return info
+}
+
+func colorModelName(model color.Model) string {
+	if _, isPalette := model.(color.Palette); isPalette {
+		return "paletted"
+	}
+	switch model {
+	case color.RGBAModel:
+		return "rgba"
+	case color.RGBA64Model:
+		return "rgba64"
+	case color.NRGBAModel:
+		return "nrgba"
+	case color.NRGBA64Model:
+		return "nrgba64"
+	case color.AlphaModel:
+		return "alpha"
+	case color.Alpha16Model:
+		return "alpha16"
+	case color.GrayModel:
+		return "gray"
+	case color.Gray16Model:
+		return "gray16"
+	case color.YCbCrModel:
+		return "ycbcr"
+	case color.NYCbCrAModel:
+		return "nycbcra"
+	case color.CMYKModel:
+		return "cmyk"
+	}
+	return "unknown"
+}
+
+// findExif returns the raw exif block embedded in head, a jpeg APP1 segment,
+// a png eXIf chunk or a webp EXIF chunk, or nil if there isn't one.
+func findExif(format string, head []byte) []byte {
+	switch format {
+	case "jpeg":
+		for i := 2; i+4 <= len(head) && head[i] == 0xff; {
+			marker, length := head[i+1], int(binary.BigEndian.Uint16(head[i+2:]))
+			if marker == 0xda || length < 2 || i+2+length > len(head) {
+				return nil
+			}
+			segment := head[i+4 : i+2+length]
+			if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+				return segment
+			}
+			i += 2 + length
+		}
+	case "png":
+		for i := 8; i+12 <= len(head); {
+			length := int(binary.BigEndian.Uint32(head[i:]))
+			if length < 0 || i+12+length > len(head) {
+				return nil
+			}
+			if string(head[i+4:i+8]) == "eXIf" {
+				return head[i+8 : i+8+length]
+			}
+			if string(head[i+4:i+8]) == "IDAT" {
+				return nil
+			}
+			i += 12 + length
+		}
+	case "webp":
+		for i := 12; i+8 <= len(head); {
+			length := int(binary.LittleEndian.Uint32(head[i+4:]))
+			if length < 0 || i+8+length > len(head) {
+				return nil
+			}
+			if string(head[i:i+4]) == "EXIF" {
+				return head[i+8 : i+8+length]
+			}
+			i += 8 + length + length%2
+		}
+	}
+	return nil
+}
+
+// parseExif fills in what it can from the tiff structure in exif, anything
+// malformed is skipped rather than failing the upload.
+func parseExif(exif []byte, info *ImageInfo) {
+	exif = bytes.TrimPrefix(exif, []byte("Exif\x00\x00"))
+	if len(exif) < 8 {
+		return
+	}
+	t := &tiff{data: exif}
+	switch string(exif[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return
+	}
+	if t.order.Uint16(exif[2:]) != 42 {
+		return
+	}
+
+	ifd0 := t.ifd(t.order.Uint32(exif[4:]))
+	info.CameraMake = ifd0.ascii(0x010f)
+	info.CameraModel = ifd0.ascii(0x0110)
+	captured := ifd0.ascii(0x0132)
+	offset := ""
+	if exifIfdOffset, exists := ifd0.long(0x8769); exists {
+		exifIfd := t.ifd(exifIfdOffset)
+		if original := exifIfd.ascii(0x9003); original != "" {
+			captured, offset = original, exifIfd.ascii(0x9011)
+		}
+	}
+	if captured != "" {
+		loc := time.UTC
+		if offset != "" {
+			if zone, err := time.Parse("-07:00", offset); err == nil {
+				_, secs := zone.Zone()
+				loc = time.FixedZone("", secs)
+			}
+		}
+		if c, err := time.ParseInLocation(exifTimeFormat, captured, loc); err == nil {
+			utc := c.UTC()
+			info.Captured = &utc
+		}
+	}
+	if gpsIfdOffset, exists := ifd0.long(0x8825); exists {
+		gpsIfd := t.ifd(gpsIfdOffset)
+		lat, latOk := gpsIfd.degrees(0x0002, gpsIfd.ascii(0x0001), "S")
+		lng, lngOk := gpsIfd.degrees(0x0004, gpsIfd.ascii(0x0003), "W")
+		if latOk && lngOk && math.Abs(lat) <= 90 && math.Abs(lng) <= 180 {
+			info.Location = &ImageLocation{Latitude: lat, Longitude: lng}
+		}
+	}
+}
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+type tiffIfd struct {
+	t       *tiff
+	entries map[uint16]*tiffEntry
+}
+
+var tiffTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func (t *tiff) ifd(offset uint32) *tiffIfd {
+	ifd := &tiffIfd{t: t, entries: map[uint16]*tiffEntry{}}
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return ifd
+	}
+	count := uint32(t.order.Uint16(t.data[offset:]))
+	for i := uint32(0); i < count; i++ {
+		start := uint64(offset) + 2 + uint64(i)*12
+		if start+12 > uint64(len(t.data)) {
+			break
+		}
+		entry := t.data[start : start+12]
+		e := &tiffEntry{typ: t.order.Uint16(entry[2:]), count: t.order.Uint32(entry[4:])}
+		size, known := tiffTypeSizes[e.typ]
+		if !known {
+			continue
+		}
+		length := uint64(size) * uint64(e.count)
+		if length <= 4 {
+			e.value = entry[8 : 8+length]
+		} else if valueOffset := uint64(t.order.Uint32(entry[8:])); valueOffset+length <= uint64(len(t.data)) {
+			e.value = t.data[valueOffset : valueOffset+length]
+		} else {
+			continue
+		}
+		ifd.entries[t.order.Uint16(entry)] = e
+	}
+	return ifd
+}
+
+func (ifd *tiffIfd) ascii(tag uint16) string {
+	e, exists := ifd.entries[tag]
+	if !exists || e.typ != 2 {
+		return ""
+	}
+	s := strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+	if len(s) > imageInfoMaxStringLength {
+		s = s[:imageInfoMaxStringLength]
+	}
+	return s
+}
+
+func (ifd *tiffIfd) long(tag uint16) (uint32, bool) {
+	e, exists := ifd.entries[tag]
+	if !exists || e.count != 1 {
+		return 0, false
+	}
+	switch e.typ {
+	case 3:
+		return uint32(ifd.t.order.Uint16(e.value)), true
+	case 4:
+		return ifd.t.order.Uint32(e.value), true
+	}
+	return 0, false
+}
+
+// degrees reads a gps degrees, minutes, seconds triple negating it when ref is negativeRef.
+func (ifd *tiffIfd) degrees(tag uint16, ref string, negativeRef string) (float64, bool) {
+	e, exists := ifd.entries[tag]
+	if !exists || e.typ != 5 || e.count != 3 || ref == "" {
+		return 0, false
+	}
+	deg := 0.0
+	for i, scale := range []float64{1, 60, 3600} {
+		num, den := ifd.t.order.Uint32(e.value[i*8:]), ifd.t.order.Uint32(e.value[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		deg += float64(num) / float64(den) / scale
+	}
+	if strings.EqualFold(ref, negativeRef) {
+		deg = -deg
+	}
+	return deg, true
+}
@@ -0,0 +1,468 @@
+package util
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// MemDb is an in process stand in for the tables defined in sql/db.sql, the
+// mem store implementations read and write it directly while holding its lock.
+type MemDb struct {
+	sync.RWMutex
+	Users                              map[string]*MemUser
+	Projects                           map[string]*MemProject
+	Permissions                        map[string]map[string]string //project -> user -> role
+	Invitations                        map[string]map[string]string //project -> user -> role
+	TreeNodes                          map[string]*MemTreeNode
+	TreeNodeTrash                      map[string]*MemTreeNodeTrash
+	TreeNodePropertyDefinitions        map[string]map[string]string //project -> name -> propertyType
+	TreeNodeProperties                 map[string]map[string]string //treeNode -> name -> value
+	DocumentVersions                   map[string]*MemDocumentVersion
+	DeletedDocumentVersions            map[string]int //document -> highest deleted version
+	ProjectSpaceVersions               map[string]*MemProjectSpaceVersion
+	Sheets                             map[string]*MemSheet
+	SheetTransforms                    map[string]*MemSheetTransform
+	ProjectSpaceVersionSheetTransforms map[string][]string //projectSpaceVersion -> sheetTransforms
+	ClashTests                         map[string]*MemClashTest
+	UploadSessions                     map[string]*MemUploadSession
+}
+
+type MemUser struct {
+	Id          string
+	AutodeskId  string
+	OpenId      string
+	Username    string
+	Avatar      string
+	FullName    string
+	Email       string
+	SuperUser   bool
+	LastLogin   time.Time
+	Description string
+	UILanguage  string
+	UITheme     string
+	TimeFormat  string
+}
+
+type MemProject struct {
+	Id            string
+	Name          string
+	Description   string
+	Created       time.Time
+	ThumbnailType string
+}
+
+type MemTreeNode struct {
+	Id         string
+	Parent     string
+	Project    string
+	Name       string
+	NodeType   string
+	Trash      string //id of the trashed root this node was deleted with, empty while live
+	Created    time.Time
+	CreatedBy  string
+	Modified   time.Time
+	ModifiedBy string
+}
+
+type MemTreeNodeTrash struct {
+	Id        string
+	Project   string
+	Parent    string
+	Deleted   time.Time
+	DeletedBy string
+}
+
+type MemDocumentVersion struct {
+	Id                  string
+	Document            string
+	Version             int
+	Project             string
+	Uploaded            time.Time
+	UploadComment       string
+	UploadedBy          string
+	FileType            string
+	FileExtension       string
+	Urn                 string
+	Status              string
+	ThumbnailType       string
+	RetryCount          int
+	LastError           string
+	NextRetry           *time.Time
+	Progress            string
+	TranslationMessages string
+	ContentHash         string
+	MimeType            string
+	ImageInfo           *ImageInfo
+}
+
+type MemProjectSpaceVersion struct {
+	Id            string
+	ProjectSpace  string
+	Version       int
+	Project       string
+	Created       time.Time
+	CreateComment string
+	CreatedBy     string
+	ThumbnailType string
+	CameraJson    string
+}
+
+type MemSheet struct {
+	Id              string
+	DocumentVersion string
+	Project         string
+	Name            string
+	BaseUrn         string
+	Manifest        string
+	Thumbnails      string
+	Role            string
+}
+
+type MemSheetTransform struct {
+	Id                     string
+	Sheet                  string
+	SheetTransformHashJson string
+	ClashChangeRegId       string
+}
+
+type MemClashTest struct {
+	Id                  string
+	LeftSheetTransform  string
+	RightSheetTransform string
+}
+
+type MemUploadSession struct {
+	Id         string
+	Project    string
+	Parent     string
+	CreatedBy  string
+	FileName   string
+	FileType   string
+	Size       int64
+	Received   int64
+	ChunkCount int
+	Chunks     []string
+	Status     string
+	Created    time.Time
+	Updated    time.Time
+}
+
+func NewMemDb() *MemDb {
+	return &MemDb{
+		Users:                              map[string]*MemUser{},
+		Projects:                           map[string]*MemProject{},
+		Permissions:                        map[string]map[string]string{},
+		Invitations:                        map[string]map[string]string{},
+		TreeNodes:                          map[string]*MemTreeNode{},
+		TreeNodeTrash:                      map[string]*MemTreeNodeTrash{},
+		TreeNodePropertyDefinitions:        map[string]map[string]string{},
+		TreeNodeProperties:                 map[string]map[string]string{},
+		DocumentVersions:                   map[string]*MemDocumentVersion{},
+		DeletedDocumentVersions:            map[string]int{},
+		ProjectSpaceVersions:               map[string]*MemProjectSpaceVersion{},
+		Sheets:                             map[string]*MemSheet{},
+		SheetTransforms:                    map[string]*MemSheetTransform{},
+		ProjectSpaceVersionSheetTransforms: map[string][]string{},
+		ClashTests:                         map[string]*MemClashTest{},
+		UploadSessions:                     map[string]*MemUploadSession{},
+	}
+}
+
+// Role mirrors _permission_getRole, callers must hold the lock.
+func (db *MemDb) Role(forUser string, project string) (string, error) {
+	if role, exists := db.Permissions[project][forUser]; exists {
+		return role, nil
+	}
+	return "", errors.New("Unauthorized action: get role")
+}
+
+// DocumentVersionTrashed reports whether the document owning a documentVersion is in the trash, callers must hold the lock.
+func (db *MemDb) DocumentVersionTrashed(id string) bool {
+	if dv, exists := db.DocumentVersions[id]; exists {
+		if tn, exists := db.TreeNodes[dv.Document]; exists {
+			return tn.Trash != ""
+		}
+	}
+	return false
+}
+
+// TreeNodeChildCount mirrors the childCount column returned by the treeNode procedures, callers must hold the lock.
+func (db *MemDb) TreeNodeChildCount(id string) int {
+	count := 0
+	for _, tn := range db.TreeNodes {
+		if tn.Parent == id {
+			count++
+		}
+	}
+	for _, dv := range db.DocumentVersions {
+		if dv.Document == id {
+			count++
+		}
+	}
+	for _, psv := range db.ProjectSpaceVersions {
+		if psv.ProjectSpace == id {
+			count++
+		}
+	}
+	return count
+}
+
+// DocumentVersionSheetCount mirrors the sheetCount column, callers must hold the lock.
+func (db *MemDb) DocumentVersionSheetCount(id string) int {
+	count := 0
+	for _, s := range db.Sheets {
+		if s.DocumentVersion == id {
+			count++
+		}
+	}
+	return count
+}
+
+// SheetTransformProject resolves the project of a sheetTransform through its sheet, callers must hold the lock.
+func (db *MemDb) SheetTransformProject(id string) string {
+	if st, exists := db.SheetTransforms[id]; exists {
+		if s, exists := db.Sheets[st.Sheet]; exists {
+			return s.Project
+		}
+	}
+	return ""
+}
+
+// ClashTestId mirrors _clashTest_getForSheetTransforms, callers must hold the lock.
+func (db *MemDb) ClashTestId(leftSheetTransform string, rightSheetTransform string) string {
+	if rightSheetTransform < leftSheetTransform {
+		leftSheetTransform, rightSheetTransform = rightSheetTransform, leftSheetTransform
+	}
+	for _, ct := range db.ClashTests {
+		if ct.LeftSheetTransform == leftSheetTransform && ct.RightSheetTransform == rightSheetTransform {
+			return ct.Id
+		}
+	}
+	return ""
+}
+
+// CreateDocumentVersion mirrors documentVersionCreate, callers must hold the lock.
+func (db *MemDb) CreateDocumentVersion(forUser string, document string, documentVersion string, uploadComment string, fileType string, fileExtension string, urn string, status string, thumbnailType string, contentHash string, mimeType string, imageInfo *ImageInfo) (*MemDocumentVersion, error) {
+	projectId := ""
+	tn, exists := db.TreeNodes[document]
+	if exists && tn.Trash == "" {
+		projectId = tn.Project
+	}
+	if role, err := db.Role(forUser, projectId); err != nil {
+		return nil, err
+	} else if !MemRoleIn(role, "owner", "admin", "organiser", "contributor") {
+		return nil, errors.New("Unauthorized action: documentVersion create")
+	}
+	version := db.NextDocumentVersion(document)
+	dv := &MemDocumentVersion{
+		Id:                  documentVersion,
+		Document:            document,
+		Version:             version,
+		Project:             projectId,
+		Uploaded:            time.Now().UTC(),
+		UploadComment:       uploadComment,
+		UploadedBy:          forUser,
+		FileType:            fileType,
+		FileExtension:       fileExtension,
+		Urn:                 urn,
+		Status:              status,
+		ThumbnailType:       thumbnailType,
+		TranslationMessages: "[]",
+		ContentHash:         contentHash,
+		MimeType:            mimeType,
+		ImageInfo:           imageInfo,
+	}
+	db.DocumentVersions[dv.Id] = dv
+	tn.Modified = dv.Uploaded
+	tn.ModifiedBy = forUser
+	return dv, nil
+}
+
+// NextDocumentVersion mirrors _documentVersion_nextVersion, callers must hold the lock.
+func (db *MemDb) NextDocumentVersion(document string) int {
+	version := db.DeletedDocumentVersions[document]
+	for _, dv := range db.DocumentVersions {
+		if dv.Document == document && dv.Version > version {
+			version = dv.Version
+		}
+	}
+	return version + 1
+}
+
+// CreateProjectSpaceVersion mirrors projectSpaceVersionCreate, callers must hold the lock.
+func (db *MemDb) CreateProjectSpaceVersion(forUser string, projectSpace string, projectSpaceVersion string, createComment string, cameraJson string, thumbnailType string) (*MemProjectSpaceVersion, error) {
+	projectId := ""
+	tn, exists := db.TreeNodes[projectSpace]
+	if exists && tn.Trash == "" {
+		projectId = tn.Project
+	}
+	if role, err := db.Role(forUser, projectId); err != nil {
+		return nil, err
+	} else if !MemRoleIn(role, "owner", "admin", "organiser", "contributor") {
+		return nil, errors.New("Unauthorized action: projectSpaceVersion create")
+	}
+	version := 1
+	for _, psv := range db.ProjectSpaceVersions {
+		if psv.ProjectSpace == projectSpace {
+			version++
+		}
+	}
+	psv := &MemProjectSpaceVersion{
+		Id:            projectSpaceVersion,
+		ProjectSpace:  projectSpace,
+		Version:       version,
+		Project:       projectId,
+		Created:       time.Now().UTC(),
+		CreateComment: createComment,
+		CreatedBy:     forUser,
+		ThumbnailType: thumbnailType,
+		CameraJson:    cameraJson,
+	}
+	db.ProjectSpaceVersions[psv.Id] = psv
+	tn.Modified = psv.Created
+	tn.ModifiedBy = forUser
+	return psv, nil
+}
+
+// CreateProjectSpaceVersionSheetTransforms mirrors projectSpaceVersionSheetTransformCreate, callers must hold the lock.
+func (db *MemDb) CreateProjectSpaceVersionSheetTransforms(projectSpaceVersion string, sheetTransforms []string) error {
+	if len(sheetTransforms) == 0 {
+		return errors.New("Invalid ids argument")
+	}
+	if psv, exists := db.ProjectSpaceVersions[projectSpaceVersion]; exists && psv.Project == db.SheetTransformProject(sheetTransforms[0]) {
+		db.ProjectSpaceVersionSheetTransforms[projectSpaceVersion] = append(db.ProjectSpaceVersionSheetTransforms[projectSpaceVersion], sheetTransforms...)
+	}
+	return nil
+}
+
+// The Delete* functions follow the ON DELETE CASCADE foreign keys in sql/db.sql, callers must hold the lock.
+
+func (db *MemDb) DeleteProject(id string) {
+	for tnId, tn := range db.TreeNodes {
+		if tn.Project == id {
+			db.DeleteTreeNode(tnId)
+		}
+	}
+	for sId, s := range db.Sheets {
+		if s.Project == id {
+			db.DeleteSheet(sId)
+		}
+	}
+	for usId, us := range db.UploadSessions {
+		if us.Project == id {
+			delete(db.UploadSessions, usId)
+		}
+	}
+	delete(db.Permissions, id)
+	delete(db.Invitations, id)
+	delete(db.TreeNodePropertyDefinitions, id)
+	delete(db.Projects, id)
+}
+
+func (db *MemDb) DeletePermission(project string, user string) {
+	delete(db.Permissions[project], user)
+}
+
+func (db *MemDb) DeleteInvitation(project string, user string) {
+	delete(db.Invitations[project], user)
+}
+
+func (db *MemDb) DeleteTreeNode(id string) {
+	if _, exists := db.TreeNodes[id]; !exists {
+		return
+	}
+	delete(db.TreeNodes, id)
+	delete(db.TreeNodeTrash, id)
+	delete(db.TreeNodeProperties, id)
+	delete(db.DeletedDocumentVersions, id)
+	for usId, us := range db.UploadSessions {
+		if us.Parent == id {
+			delete(db.UploadSessions, usId)
+		}
+	}
+	for tnId, tn := range db.TreeNodes {
+		if tn.Parent == id {
+			db.DeleteTreeNode(tnId)
+		}
+	}
+	for dvId, dv := range db.DocumentVersions {
+		if dv.Document == id {
+			db.DeleteDocumentVersion(dvId)
+		}
+	}
+	for psvId, psv := range db.ProjectSpaceVersions {
+		if psv.ProjectSpace == id {
+			db.DeleteProjectSpaceVersion(psvId)
+		}
+	}
+}
+
+// DeleteTreeNodeTrash removes the trash row of a restored treeNode, callers must hold the lock.
+func (db *MemDb) DeleteTreeNodeTrash(id string) {
+	delete(db.TreeNodeTrash, id)
+}
+
+// DeleteTreeNodeProperty removes one property value from a treeNode, callers must hold the lock.
+func (db *MemDb) DeleteTreeNodeProperty(id string, name string) {
+	delete(db.TreeNodeProperties[id], name)
+	if len(db.TreeNodeProperties[id]) == 0 {
+		delete(db.TreeNodeProperties, id)
+	}
+}
+
+// DeleteTreeNodePropertyDefinition removes a project's property definition and every value set for it, callers must hold the lock.
+func (db *MemDb) DeleteTreeNodePropertyDefinition(project string, name string) {
+	for id, tn := range db.TreeNodes {
+		if tn.Project == project {
+			db.DeleteTreeNodeProperty(id, name)
+		}
+	}
+	delete(db.TreeNodePropertyDefinitions[project], name)
+}
+
+func (db *MemDb) DeleteDocumentVersion(id string) {
+	delete(db.DocumentVersions, id)
+	for sId, s := range db.Sheets {
+		if s.DocumentVersion == id {
+			db.DeleteSheet(sId)
+		}
+	}
+}
+
+func (db *MemDb) DeleteProjectSpaceVersion(id string) {
+	delete(db.ProjectSpaceVersions, id)
+	delete(db.ProjectSpaceVersionSheetTransforms, id)
+}
+
+func (db *MemDb) DeleteSheet(id string) {
+	delete(db.Sheets, id)
+	for stId, st := range db.SheetTransforms {
+		if st.Sheet == id {
+			db.DeleteSheetTransform(stId)
+		}
+	}
+}
+
+func (db *MemDb) DeleteSheetTransform(id string) {
+	delete(db.SheetTransforms, id)
+	for psvId, sts := range db.ProjectSpaceVersionSheetTransforms {
+		remaining := make([]string, 0, len(sts))
+		for _, st := range sts {
+			if st != id {
+				remaining = append(remaining, st)
+			}
+		}
+		db.ProjectSpaceVersionSheetTransforms[psvId] = remaining
+	}
+	for ctId, ct := range db.ClashTests {
+		if ct.LeftSheetTransform == id || ct.RightSheetTransform == id {
+			delete(db.ClashTests, ctId)
+		}
+	}
+}
+
+// DeleteUploadSession removes a finished or aborted upload session, callers must hold the lock.
+func (db *MemDb) DeleteUploadSession(id string) {
+	delete(db.UploadSessions, id)
+}
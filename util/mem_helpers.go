@@ -0,0 +1,54 @@
+package util
+
+import (
+	"strings"
+)
+
+// MemOffsetLimit clamps offset and limit the same way the sql procedures do
+// and returns the slice bounds of the requested page.
+func MemOffsetLimit(totalResults int, offset int, limit int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	if limit > DefaultSqlOffsetQueryLimit {
+		limit = DefaultSqlOffsetQueryLimit
+	}
+	if offset >= totalResults || limit == 0 {
+		return 0, 0
+	}
+	end := offset + limit
+	if end > totalResults {
+		end = totalResults
+	}
+	return offset, end
+}
+
+// MemMatch approximates a natural language FULLTEXT match, any search word
+// contained in any of the fields is a match.
+func MemMatch(search string, fields ...string) bool {
+	for _, word := range strings.Fields(strings.ToLower(search)) {
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func MemRoleIn(role string, roles ...string) bool {
+	for _, r := range roles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// MemLessFold compares strings case insensitively to match the default mysql collation.
+func MemLessFold(a string, b string) bool {
+	return strings.ToLower(a) < strings.ToLower(b)
+}
@@ -0,0 +1,1189 @@
+package util
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"github.com/modelhub/core/blob"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// this is only as much of a pdf reader as is needed to enumerate pages, their
+// labels, outline titles and embedded thumbnails, page content is never
+// interpreted so pages can't be rendered.
+
+const (
+	pdfMaxDepth       = 64
+	pdfMaxNameLength  = 250
+	pdfStartXrefSpan  = 1024
+	pdfKeywordStream  = "stream"
+	pdfMaxXrefEntries = 8 * 1024 * 1024
+	// pdfs are parsed in memory so larger ones are refused.
+	pdfMaxParseSize = 256 * 1024 * 1024
+	// a few kilobytes of deflated zeros can inflate to gigabytes, no stream
+	// this reader decodes comes near this legitimately.
+	pdfMaxStreamSize = 64 * 1024 * 1024
+)
+
+var (
+	ErrPdfMalformed      = errors.New("malformed pdf")
+	ErrPdfEncrypted      = errors.New("encrypted pdf")
+	ErrPdfTooLarge       = errors.New("pdf too large to parse")
+	ErrPdfStreamTooLarge = errors.New("pdf stream too large to decode")
+	ErrPdfNoThumbnail    = errors.New("pdf first page has no thumbnail")
+
+	pdfObjHeader = regexp.MustCompile(`(?m)(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+)
+
+// PdfPage describes a single page, Number is 1 based, Label comes from the
+// document page labels and Title from the first outline entry targeting it.
+type PdfPage struct {
+	Number       int
+	Label        string
+	Title        string
+	HasThumbnail bool
+}
+
+type pdfName string
+type pdfString string
+type pdfArray []interface{}
+type pdfDict map[pdfName]interface{}
+
+type pdfRef struct {
+	num int
+	gen int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+type pdfXrefEntry struct {
+	offset     int
+	stream     int
+	compressed bool
+}
+
+type pdfFile struct {
+	data      []byte
+	xref      map[int]*pdfXrefEntry
+	trailer   pdfDict
+	objects   map[int]interface{}
+	resolving map[int]bool
+	encrypted bool
+}
+
+// PdfPagesHelper lists the pages of the pdf seed file seedName.
+func PdfPagesHelper(seedName string, ossBucket string, blobStore blob.BlobStore) ([]*PdfPage, error) {
+	data, err := readPdfSeed(seedName, ossBucket, blobStore)
+	if err != nil {
+		return nil, err
+	}
+	return ReadPdfPages(data)
+}
+
+// PdfPageThumbnailsHelper lists the pages of the pdf seed file seedName along
+// with the embedded thumbnail of every page that has a readable one, keyed by
+// page number, as a png no larger than ThumbnailMaxSize on either side.
+func PdfPageThumbnailsHelper(seedName string, ossBucket string, blobStore blob.BlobStore) ([]*PdfPage, map[int][]byte, error) {
+	data, err := readPdfSeed(seedName, ossBucket, blobStore)
+	if err != nil {
+		return nil, nil, err
+	}
+	pages, err := ReadPdfPages(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	//the pages of an encrypted pdf can still be listed, only their thumbnails are lost
+	imgs, err := ReadPdfPageThumbnails(data)
+	if err != nil && err != ErrPdfEncrypted {
+		return nil, nil, err
+	}
+	pngs := make(map[int][]byte, len(imgs))
+	for page, img := range imgs {
+		buf := &bytes.Buffer{}
+		if err := png.Encode(buf, shrinkImage(img, ThumbnailMaxSize)); err == nil {
+			pngs[page] = buf.Bytes()
+		}
+	}
+	return pages, pngs, nil
+}
+
+// PdfThumbnailGenerateHelper stores the embedded thumbnail of the first page
+// of the pdf seed as a png no larger than ThumbnailMaxSize on either side, as
+// the thumbnail for id. A first page without a thumbnail gives ErrPdfNoThumbnail.
+func PdfThumbnailGenerateHelper(id string, seed []byte, ossBucket string, blobStore blob.BlobStore) (tnType string, err error) {
+	f, err := openPdf(seed)
+	if err != nil {
+		return "", err
+	}
+	if f.encrypted {
+		return "", ErrPdfEncrypted
+	}
+	_, dicts, err := f.pages()
+	if err != nil {
+		return "", err
+	}
+	thumb, isStream := f.resolve(dicts[0]["Thumb"]).(*pdfStream)
+	if !isStream {
+		return "", ErrPdfNoThumbnail
+	}
+	img, err := f.decodeImage(thumb)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err = png.Encode(buf, shrinkImage(img, ThumbnailMaxSize)); err != nil {
+		return "", err
+	}
+	if _, err = blobStore.Put(ossBucket, id+".tn.tn", buf); err != nil {
+		return "", err
+	}
+	return generatedThumbnailType, nil
+}
+
+func readPdfSeed(seedName string, ossBucket string, blobStore blob.BlobStore) ([]byte, error) {
+	res, err := blobStore.Get(ossBucket, seedName)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, pdfMaxParseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > pdfMaxParseSize {
+		return nil, ErrPdfTooLarge
+	}
+	return data, nil
+}
+
+// ReadPdfPages lists the pages of the pdf in data.
+func ReadPdfPages(data []byte) ([]*PdfPage, error) {
+	f, err := openPdf(data)
+	if err != nil {
+		return nil, err
+	}
+	refs, dicts, err := f.pages()
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]*PdfPage, 0, len(dicts))
+	for i, page := range dicts {
+		_, hasThumb := f.resolve(page["Thumb"]).(*pdfStream)
+		pages = append(pages, &PdfPage{Number: i + 1, HasThumbnail: hasThumb && !f.encrypted})
+	}
+	if f.encrypted {
+		//strings are encrypted along with streams so labels and titles can't be read
+		return pages, nil
+	}
+	catalog, _ := f.resolve(f.trailer["Root"]).(pdfDict)
+	for i, label := range f.pageLabels(catalog, len(pages)) {
+		pages[i].Label = label
+	}
+	indexes := make(map[pdfRef]int, len(refs))
+	for i, ref := range refs {
+		indexes[ref] = i
+	}
+	for i, title := range f.outlineTitles(catalog, indexes) {
+		pages[i].Title = title
+	}
+	return pages, nil
+}
+
+// ReadPdfPageThumbnails decodes the embedded thumbnails of the pdf in data,
+// keyed by 1 based page number, pages whose thumbnail can't be decoded are
+// left out.
+func ReadPdfPageThumbnails(data []byte) (map[int]image.Image, error) {
+	f, err := openPdf(data)
+	if err != nil {
+		return nil, err
+	}
+	if f.encrypted {
+		return nil, ErrPdfEncrypted
+	}
+	_, dicts, err := f.pages()
+	if err != nil {
+		return nil, err
+	}
+	imgs := map[int]image.Image{}
+	for i, page := range dicts {
+		if thumb, isStream := f.resolve(page["Thumb"]).(*pdfStream); isStream {
+			if img, err := f.decodeImage(thumb); err == nil {
+				imgs[i+1] = img
+			}
+		}
+	}
+	return imgs, nil
+}
+
+func openPdf(data []byte) (*pdfFile, error) {
+	if !bytes.Contains(data[:minInt(len(data), 1024)], []byte("%PDF-")) {
+		return nil, ErrPdfMalformed
+	}
+	f := &pdfFile{data: data, xref: map[int]*pdfXrefEntry{}, objects: map[int]interface{}{}, resolving: map[int]bool{}}
+	if err := f.readXref(); err != nil || f.trailer["Root"] == nil {
+		//damaged or incrementally mangled files are common enough to be worth rebuilding the xref for
+		f.xref, f.trailer, f.objects = map[int]*pdfXrefEntry{}, nil, map[int]interface{}{}
+		if err := f.rebuildXref(); err != nil {
+			return nil, err
+		}
+	}
+	f.encrypted = f.trailer["Encrypt"] != nil
+	return f, nil
+}
+
+func (f *pdfFile) readXref() error {
+	idx := bytes.LastIndex(f.data[maxInt(0, len(f.data)-pdfStartXrefSpan):], []byte("startxref"))
+	if idx < 0 {
+		return ErrPdfMalformed
+	}
+	p := &pdfParser{data: f.data, pos: maxInt(0, len(f.data)-pdfStartXrefSpan) + idx + len("startxref")}
+	offset, isNumber := p.object().(float64)
+	visited := map[int]bool{}
+	for isNumber && offset > 0 && int(offset) < len(f.data) && !visited[int(offset)] {
+		visited[int(offset)] = true
+		trailer, err := f.readXrefSection(int(offset))
+		if err != nil {
+			return err
+		}
+		if f.trailer == nil {
+			f.trailer = trailer
+		}
+		if xrefStm, exists := trailer["XRefStm"].(float64); exists {
+			if _, err := f.readXrefSection(int(xrefStm)); err != nil {
+				return err
+			}
+		}
+		offset, isNumber = trailer["Prev"].(float64)
+	}
+	if f.trailer == nil {
+		return ErrPdfMalformed
+	}
+	return nil
+}
+
+// readXrefSection reads a classic xref table or an xref stream at offset,
+// entries already known from a newer section are kept.
+func (f *pdfFile) readXrefSection(offset int) (pdfDict, error) {
+	p := &pdfParser{data: f.data, pos: offset}
+	p.skipSpace()
+	if p.hasKeyword("xref") {
+		p.pos += len("xref")
+		for {
+			p.skipSpace()
+			if p.hasKeyword("trailer") {
+				p.pos += len("trailer")
+				if trailer, isDict := p.object().(pdfDict); isDict {
+					return trailer, nil
+				}
+				return nil, ErrPdfMalformed
+			}
+			start, startOk := p.object().(float64)
+			count, countOk := p.object().(float64)
+			if !startOk || !countOk || count < 0 || count > pdfMaxXrefEntries {
+				return nil, ErrPdfMalformed
+			}
+			for i := 0; i < int(count); i++ {
+				entryOffset, offsetOk := p.object().(float64)
+				_, genOk := p.object().(float64)
+				p.skipSpace()
+				if !offsetOk || !genOk || p.pos >= len(f.data) {
+					return nil, ErrPdfMalformed
+				}
+				inUse := f.data[p.pos] == 'n'
+				p.pos++
+				num := int(start) + i
+				if _, exists := f.xref[num]; !exists && inUse {
+					f.xref[num] = &pdfXrefEntry{offset: int(entryOffset)}
+				} else if !exists {
+					f.xref[num] = nil
+				}
+			}
+		}
+	}
+
+	_, obj, err := f.objectAt(offset)
+	if err != nil {
+		return nil, err
+	}
+	stream, isStream := obj.(*pdfStream)
+	if !isStream || stream.dict["Type"] != pdfName("XRef") {
+		return nil, ErrPdfMalformed
+	}
+	data, err := f.decodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	widths, _ := stream.dict["W"].(pdfArray)
+	if len(widths) != 3 {
+		return nil, ErrPdfMalformed
+	}
+	w := make([]int, 3)
+	rowLen := 0
+	for i := range widths {
+		n, _ := widths[i].(float64)
+		if n < 0 || n > 8 {
+			return nil, ErrPdfMalformed
+		}
+		w[i] = int(n)
+		rowLen += w[i]
+	}
+	if rowLen == 0 {
+		return nil, ErrPdfMalformed
+	}
+	index, _ := stream.dict["Index"].(pdfArray)
+	if index == nil {
+		size, _ := stream.dict["Size"].(float64)
+		index = pdfArray{float64(0), size}
+	}
+	row := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(float64)
+		count, _ := index[i+1].(float64)
+		for j := 0; j < int(count) && (row+1)*rowLen <= len(data); j, row = j+1, row+1 {
+			fields := make([]int, 3)
+			pos := row * rowLen
+			for k := 0; k < 3; k++ {
+				for b := 0; b < w[k]; b++ {
+					fields[k] = fields[k]<<8 | int(data[pos])
+					pos++
+				}
+			}
+			if w[0] == 0 {
+				fields[0] = 1
+			}
+			num := int(start) + j
+			if _, exists := f.xref[num]; exists {
+				continue
+			}
+			switch fields[0] {
+			case 1:
+				f.xref[num] = &pdfXrefEntry{offset: fields[1]}
+			case 2:
+				f.xref[num] = &pdfXrefEntry{stream: fields[1], compressed: true}
+			default:
+				f.xref[num] = nil
+			}
+		}
+	}
+	return stream.dict, nil
+}
+
+// rebuildXref scans the whole file for object headers, later definitions win
+// as they would with incremental updates.
+func (f *pdfFile) rebuildXref() error {
+	for _, match := range pdfObjHeader.FindAllSubmatchIndex(f.data, -1) {
+		if match[0] > 0 && !isPdfSpace(f.data[match[0]-1]) && !isPdfDelimiter(f.data[match[0]-1]) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(f.data[match[2]:match[3]]))
+		f.xref[num] = &pdfXrefEntry{offset: match[0]}
+	}
+	compressed := map[int]*pdfXrefEntry{}
+	for num := range f.xref {
+		if stream, isStream := f.resolve(pdfRef{num: num}).(*pdfStream); isStream && stream.dict["Type"] == pdfName("ObjStm") {
+			if data, err := f.decodeStream(stream); err == nil {
+				_, offsets := objectStreamOffsets(stream, data)
+				for objNum := range offsets {
+					compressed[objNum] = &pdfXrefEntry{stream: num, compressed: true}
+				}
+			}
+		}
+	}
+	for num, entry := range compressed {
+		if _, exists := f.xref[num]; !exists {
+			f.xref[num] = entry
+		}
+	}
+	for num := range f.xref {
+		obj := f.resolve(pdfRef{num: num})
+		if dict, isDict := obj.(pdfDict); isDict && dict["Type"] == pdfName("Catalog") {
+			f.trailer = pdfDict{"Root": pdfRef{num: num}}
+		} else if stream, isStream := obj.(*pdfStream); isStream && stream.dict["Type"] == pdfName("XRef") && stream.dict["Root"] != nil && f.trailer == nil {
+			f.trailer = stream.dict
+		}
+	}
+	if f.trailer == nil {
+		return ErrPdfMalformed
+	}
+	if i := bytes.LastIndex(f.data, []byte("trailer")); i >= 0 {
+		p := &pdfParser{data: f.data, pos: i + len("trailer")}
+		if trailer, isDict := p.object().(pdfDict); isDict && trailer["Encrypt"] != nil {
+			f.trailer["Encrypt"] = trailer["Encrypt"]
+		}
+	}
+	return nil
+}
+
+func (f *pdfFile) objectAt(offset int) (int, interface{}, error) {
+	if offset < 0 || offset >= len(f.data) {
+		return 0, nil, ErrPdfMalformed
+	}
+	p := &pdfParser{data: f.data, pos: offset, file: f}
+	num, numOk := p.object().(float64)
+	_, genOk := p.object().(float64)
+	p.skipSpace()
+	if !numOk || !genOk || !p.hasKeyword("obj") {
+		return 0, nil, ErrPdfMalformed
+	}
+	p.pos += len("obj")
+	return int(num), p.object(), nil
+}
+
+// resolve follows references until it reaches a direct object, anything
+// missing or broken resolves to nil.
+func (f *pdfFile) resolve(obj interface{}) interface{} {
+	for depth := 0; depth < pdfMaxDepth; depth++ {
+		ref, isRef := obj.(pdfRef)
+		if !isRef {
+			return obj
+		}
+		if cached, exists := f.objects[ref.num]; exists {
+			obj = cached
+			continue
+		}
+		if f.resolving[ref.num] {
+			return nil
+		}
+		f.resolving[ref.num] = true
+		obj = f.load(ref.num)
+		delete(f.resolving, ref.num)
+		f.objects[ref.num] = obj
+	}
+	return nil
+}
+
+func (f *pdfFile) load(num int) interface{} {
+	entry := f.xref[num]
+	if entry == nil {
+		return nil
+	}
+	if !entry.compressed {
+		if _, obj, err := f.objectAt(entry.offset); err == nil {
+			return obj
+		}
+		return nil
+	}
+	stream, isStream := f.resolve(pdfRef{num: entry.stream}).(*pdfStream)
+	if !isStream || f.encrypted {
+		return nil
+	}
+	data, err := f.decodeStream(stream)
+	if err != nil {
+		return nil
+	}
+	first, offsets := objectStreamOffsets(stream, data)
+	if offset, exists := offsets[num]; exists {
+		p := &pdfParser{data: data, pos: first + offset, file: f}
+		return p.object()
+	}
+	return nil
+}
+
+// objectStreamOffsets reads the header of a decoded object stream mapping
+// object numbers to offsets relative to first.
+func objectStreamOffsets(stream *pdfStream, data []byte) (int, map[int]int) {
+	first, _ := stream.dict["First"].(float64)
+	count, _ := stream.dict["N"].(float64)
+	offsets := map[int]int{}
+	header := &pdfParser{data: data}
+	for i := 0; i < int(count); i++ {
+		num, numOk := header.object().(float64)
+		offset, offsetOk := header.object().(float64)
+		if !numOk || !offsetOk {
+			break
+		}
+		offsets[int(num)] = int(offset)
+	}
+	return int(first), offsets
+}
+
+func (f *pdfFile) decodeStream(stream *pdfStream) ([]byte, error) {
+	filters, parms := f.resolve(stream.dict["Filter"]), f.resolve(stream.dict["DecodeParms"])
+	if name, isName := filters.(pdfName); isName {
+		filters, parms = pdfArray{name}, pdfArray{parms}
+	}
+	filterList, _ := filters.(pdfArray)
+	parmList, _ := parms.(pdfArray)
+	data := stream.raw
+	for i, filter := range filterList {
+		var parm pdfDict
+		if i < len(parmList) {
+			parm, _ = f.resolve(parmList[i]).(pdfDict)
+		}
+		switch f.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			decoded, err := ioutil.ReadAll(io.LimitReader(r, pdfMaxStreamSize+1))
+			if len(decoded) > pdfMaxStreamSize {
+				return nil, ErrPdfStreamTooLarge
+			}
+			if err != nil && len(decoded) == 0 {
+				return nil, err
+			}
+			if data, err = pdfUnpredict(decoded, parm); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported pdf filter: %v", filter)
+		}
+	}
+	return data, nil
+}
+
+// pdfUnpredict reverses png predictors, the only ones seen in practice in
+// xref and object streams.
+func pdfUnpredict(data []byte, parm pdfDict) ([]byte, error) {
+	predictor, _ := parm["Predictor"].(float64)
+	if predictor < 10 {
+		if predictor > 1 {
+			return nil, fmt.Errorf("unsupported pdf predictor: %v", predictor)
+		}
+		return data, nil
+	}
+	columns, colors, bpc := 1.0, 1.0, 8.0
+	if v, exists := parm["Columns"].(float64); exists {
+		columns = v
+	}
+	if v, exists := parm["Colors"].(float64); exists {
+		colors = v
+	}
+	if v, exists := parm["BitsPerComponent"].(float64); exists {
+		bpc = v
+	}
+	bpp := maxInt(1, int(colors*bpc+7)/8)
+	rowLen := int(columns*colors*bpc+7) / 8
+	if rowLen <= 0 {
+		return nil, ErrPdfMalformed
+	}
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+rowLen+1 <= len(data); pos += rowLen + 1 {
+		filter, row := data[pos], append([]byte{}, data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			switch filter {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += prev[i]
+			case 3:
+				row[i] += byte((int(left) + int(prev[i])) / 2)
+			case 4:
+				row[i] += paeth(left, prev[i], upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+	return c
+}
+
+// pages walks the page tree returning each page reference and its dictionary in order.
+func (f *pdfFile) pages() ([]pdfRef, []pdfDict, error) {
+	catalog, _ := f.resolve(f.trailer["Root"]).(pdfDict)
+	if catalog == nil {
+		return nil, nil, ErrPdfMalformed
+	}
+	refs := []pdfRef{}
+	dicts := []pdfDict{}
+	visited := map[pdfRef]bool{}
+	var walk func(node interface{}, depth int)
+	walk = func(node interface{}, depth int) {
+		ref, _ := node.(pdfRef)
+		if depth > pdfMaxDepth || visited[ref] && ref.num != 0 {
+			return
+		}
+		visited[ref] = true
+		dict, _ := f.resolve(node).(pdfDict)
+		if dict == nil {
+			return
+		}
+		if kids, hasKids := f.resolve(dict["Kids"]).(pdfArray); hasKids && dict["Type"] != pdfName("Page") {
+			for _, kid := range kids {
+				walk(kid, depth+1)
+			}
+		} else {
+			refs = append(refs, ref)
+			dicts = append(dicts, dict)
+		}
+	}
+	walk(catalog["Pages"], 0)
+	if len(dicts) == 0 {
+		return nil, nil, ErrPdfMalformed
+	}
+	return refs, dicts, nil
+}
+
+// pageLabels applies the catalog's PageLabels number tree to count pages.
+func (f *pdfFile) pageLabels(catalog pdfDict, count int) []string {
+	ranges := map[int]pdfDict{}
+	f.walkTree(catalog["PageLabels"], "Nums", 0, func(key interface{}, value interface{}) {
+		if start, isNumber := key.(float64); isNumber {
+			if dict, isDict := f.resolve(value).(pdfDict); isDict {
+				ranges[int(start)] = dict
+			}
+		}
+	})
+	if len(ranges) == 0 {
+		return nil
+	}
+	labels := make([]string, count)
+	var current pdfDict
+	start := 0
+	for i := 0; i < count; i++ {
+		if dict, exists := ranges[i]; exists {
+			current, start = dict, i
+		}
+		if current == nil {
+			continue
+		}
+		prefix, _ := f.resolve(current["P"]).(pdfString)
+		first := 1
+		if st, isNumber := f.resolve(current["St"]).(float64); isNumber {
+			first = int(st)
+		}
+		n := first + i - start
+		label := pdfText(prefix)
+		switch f.resolve(current["S"]) {
+		case pdfName("D"):
+			label += strconv.Itoa(n)
+		case pdfName("R"):
+			label += strings.ToUpper(toRoman(n))
+		case pdfName("r"):
+			label += toRoman(n)
+		case pdfName("A"):
+			label += toLetters(n)
+		case pdfName("a"):
+			label += strings.ToLower(toLetters(n))
+		}
+		labels[i] = label
+	}
+	return labels
+}
+
+// outlineTitles maps page indexes to the title of the first outline entry
+// pointing at them, in reading order of the outline.
+func (f *pdfFile) outlineTitles(catalog pdfDict, indexes map[pdfRef]int) map[int]string {
+	titles := map[int]string{}
+	outlines, _ := f.resolve(catalog["Outlines"]).(pdfDict)
+	if outlines == nil {
+		return titles
+	}
+	var names map[string]interface{}
+	visited := map[pdfRef]bool{}
+	var walk func(item interface{}, depth int)
+	walk = func(item interface{}, depth int) {
+		for depth < pdfMaxDepth {
+			ref, isRef := item.(pdfRef)
+			if !isRef || visited[ref] {
+				return
+			}
+			visited[ref] = true
+			dict, _ := f.resolve(ref).(pdfDict)
+			if dict == nil {
+				return
+			}
+			dest := dict["Dest"]
+			if action, isDict := f.resolve(dict["A"]).(pdfDict); isDict && action["S"] == pdfName("GoTo") {
+				dest = action["D"]
+			}
+			dest = f.resolve(dest)
+			switch named := dest.(type) {
+			case pdfName, pdfString:
+				if names == nil {
+					names = f.namedDests(catalog)
+				}
+				dest = f.resolve(names[fmt.Sprint(named)])
+			}
+			if destDict, isDict := dest.(pdfDict); isDict {
+				dest = f.resolve(destDict["D"])
+			}
+			if arr, isArray := dest.(pdfArray); isArray && len(arr) > 0 {
+				if pageRef, isRef := arr[0].(pdfRef); isRef {
+					if i, exists := indexes[pageRef]; exists {
+						if _, taken := titles[i]; !taken {
+							if title, isString := f.resolve(dict["Title"]).(pdfString); isString && pdfText(title) != "" {
+								titles[i] = pdfText(title)
+							}
+						}
+					}
+				}
+			}
+			walk(dict["First"], depth+1)
+			item = dict["Next"]
+		}
+	}
+	walk(outlines["First"], 0)
+	return titles
+}
+
+func (f *pdfFile) namedDests(catalog pdfDict) map[string]interface{} {
+	names := map[string]interface{}{}
+	if dests, isDict := f.resolve(catalog["Dests"]).(pdfDict); isDict {
+		for name, dest := range dests {
+			names[string(name)] = dest
+		}
+	}
+	if nameDict, isDict := f.resolve(catalog["Names"]).(pdfDict); isDict {
+		f.walkTree(nameDict["Dests"], "Names", 0, func(key interface{}, value interface{}) {
+			if name, isString := key.(pdfString); isString {
+				names[string(name)] = value
+			}
+		})
+	}
+	return names
+}
+
+// walkTree visits the key value pairs of a name or number tree.
+func (f *pdfFile) walkTree(node interface{}, leafKey pdfName, depth int, visit func(key interface{}, value interface{})) {
+	dict, _ := f.resolve(node).(pdfDict)
+	if dict == nil || depth > pdfMaxDepth {
+		return
+	}
+	if pairs, isArray := f.resolve(dict[leafKey]).(pdfArray); isArray {
+		for i := 0; i+1 < len(pairs); i += 2 {
+			visit(f.resolve(pairs[i]), pairs[i+1])
+		}
+	}
+	if kids, isArray := f.resolve(dict["Kids"]).(pdfArray); isArray {
+		for _, kid := range kids {
+			f.walkTree(kid, leafKey, depth+1, visit)
+		}
+	}
+}
+
+// decodeImage handles the image xobjects thumbnails are made of: jpeg, or 8
+// bit gray, rgb or indexed samples optionally flate compressed.
+func (f *pdfFile) decodeImage(stream *pdfStream) (image.Image, error) {
+	filters := f.resolve(stream.dict["Filter"])
+	if arr, isArray := filters.(pdfArray); isArray && len(arr) == 1 {
+		filters = f.resolve(arr[0])
+	}
+	if filters == pdfName("DCTDecode") || filters == pdfName("DCT") {
+		return jpeg.Decode(bytes.NewReader(stream.raw))
+	}
+	data, err := f.decodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	width, _ := f.resolve(stream.dict["Width"]).(float64)
+	height, _ := f.resolve(stream.dict["Height"]).(float64)
+	bpc, _ := f.resolve(stream.dict["BitsPerComponent"]).(float64)
+	w, h := int(width), int(height)
+	if w <= 0 || h <= 0 || w*h > thumbnailMaxSourcePixels || bpc != 8 {
+		return nil, fmt.Errorf("unsupported pdf thumbnail: %vx%v %v bits per component", width, height, bpc)
+	}
+
+	var palette []color.Color
+	components := 0
+	colorSpace := f.resolve(stream.dict["ColorSpace"])
+	if arr, isArray := colorSpace.(pdfArray); isArray && len(arr) == 4 && f.resolve(arr[0]) == pdfName("Indexed") {
+		base := f.resolve(arr[1])
+		baseComponents := map[interface{}]int{pdfName("DeviceRGB"): 3, pdfName("DeviceGray"): 1}[base]
+		var lookup []byte
+		switch l := f.resolve(arr[3]).(type) {
+		case pdfString:
+			lookup = []byte(l)
+		case *pdfStream:
+			if lookup, err = f.decodeStream(l); err != nil {
+				return nil, err
+			}
+		}
+		if baseComponents == 0 {
+			return nil, fmt.Errorf("unsupported pdf thumbnail indexed base: %v", base)
+		}
+		for i := 0; i+baseComponents <= len(lookup) && len(palette) < 256; i += baseComponents {
+			if baseComponents == 3 {
+				palette = append(palette, color.RGBA{lookup[i], lookup[i+1], lookup[i+2], 0xff})
+			} else {
+				palette = append(palette, color.Gray{lookup[i]})
+			}
+		}
+		components = 1
+	} else {
+		components = map[interface{}]int{pdfName("DeviceRGB"): 3, pdfName("DeviceGray"): 1}[colorSpace]
+	}
+	if components == 0 || len(data) < w*h*components {
+		return nil, fmt.Errorf("unsupported pdf thumbnail color space: %v", colorSpace)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < w*h; i++ {
+		var c color.RGBA
+		switch {
+		case palette != nil:
+			if int(data[i]) < len(palette) {
+				c = color.RGBAModel.Convert(palette[data[i]]).(color.RGBA)
+			}
+		case components == 3:
+			c = color.RGBA{data[i*3], data[i*3+1], data[i*3+2], 0xff}
+		default:
+			c = color.RGBA{data[i], data[i], data[i], 0xff}
+		}
+		img.SetRGBA(i%w, i/w, c)
+	}
+	return img, nil
+}
+
+// pdfText decodes a text string, utf-16 when it carries a byte order mark
+// otherwise pdf doc encoding approximated as latin-1, and tidies it up for
+// use as a name.
+func pdfText(s pdfString) string {
+	var text string
+	b := []byte(s)
+	switch {
+	case len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff:
+		units := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		text = string(utf16.Decode(units))
+	case len(b) >= 3 && b[0] == 0xef && b[1] == 0xbb && b[2] == 0xbf:
+		text = string(b[3:])
+	default:
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		text = string(runes)
+	}
+	text = strings.Join(strings.FieldsFunc(text, func(r rune) bool { return r < 0x20 || r == 0x7f || r == ' ' }), " ")
+	if runes := []rune(text); len(runes) > pdfMaxNameLength {
+		text = string(runes[:pdfMaxNameLength])
+	}
+	return text
+}
+
+func toRoman(n int) string {
+	if n <= 0 || n >= 4000 {
+		return strconv.Itoa(n)
+	}
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"m", "cm", "d", "cd", "c", "xc", "l", "xl", "x", "ix", "v", "iv", "i"}
+	roman := ""
+	for i, v := range values {
+		for n >= v {
+			roman += symbols[i]
+			n -= v
+		}
+	}
+	return roman
+}
+
+// toLetters follows the pdf scheme of A to Z, then AA to ZZ and so on.
+func toLetters(n int) string {
+	if n <= 0 {
+		return strconv.Itoa(n)
+	}
+	return strings.Repeat(string(rune('A'+(n-1)%26)), (n-1)/26+1)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func isPdfSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPdfDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+type pdfParser struct {
+	data []byte
+	pos  int
+	file *pdfFile
+}
+
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.data) {
+		if c := p.data[p.pos]; isPdfSpace(c) {
+			p.pos++
+		} else if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\r' && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+func (p *pdfParser) hasKeyword(keyword string) bool {
+	end := p.pos + len(keyword)
+	return end <= len(p.data) && string(p.data[p.pos:end]) == keyword && (end == len(p.data) || isPdfSpace(p.data[end]) || isPdfDelimiter(p.data[end]))
+}
+
+func (p *pdfParser) token() string {
+	start := p.pos
+	for p.pos < len(p.data) && !isPdfSpace(p.data[p.pos]) && !isPdfDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// object parses the next object, returning nil at the end of the data or on
+// anything it doesn't understand.
+func (p *pdfParser) object() interface{} {
+	return p.objectDepth(0)
+}
+
+func (p *pdfParser) objectDepth(depth int) interface{} {
+	p.skipSpace()
+	if p.pos >= len(p.data) || depth > pdfMaxDepth {
+		return nil
+	}
+	switch c := p.data[p.pos]; {
+	case c == '/':
+		p.pos++
+		token := p.token()
+		name := make([]byte, 0, len(token))
+		for i := 0; i < len(token); i++ {
+			if token[i] == '#' && i+3 <= len(token) {
+				if b, err := strconv.ParseUint(token[i+1:i+3], 16, 8); err == nil {
+					name = append(name, byte(b))
+					i += 2
+					continue
+				}
+			}
+			name = append(name, token[i])
+		}
+		return pdfName(name)
+	case c == '(':
+		return p.literalString()
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		p.pos += 2
+		dict := pdfDict{}
+		for {
+			p.skipSpace()
+			if p.pos+1 >= len(p.data) {
+				return dict
+			}
+			if p.data[p.pos] == '>' && p.data[p.pos+1] == '>' {
+				p.pos += 2
+				break
+			}
+			key, isName := p.objectDepth(depth + 1).(pdfName)
+			if !isName {
+				return dict
+			}
+			dict[key] = p.objectDepth(depth + 1)
+		}
+		save := p.pos
+		p.skipSpace()
+		if p.hasKeyword(pdfKeywordStream) {
+			return p.stream(dict)
+		}
+		p.pos = save
+		return dict
+	case c == '<':
+		p.pos++
+		end := bytes.IndexByte(p.data[p.pos:], '>')
+		if end < 0 {
+			p.pos = len(p.data)
+			return nil
+		}
+		hex := strings.Map(func(r rune) rune {
+			if isPdfSpace(byte(r)) {
+				return -1
+			}
+			return r
+		}, string(p.data[p.pos:p.pos+end]))
+		p.pos += end + 1
+		if len(hex)%2 == 1 {
+			hex += "0"
+		}
+		b := make([]byte, 0, len(hex)/2)
+		for i := 0; i+1 < len(hex); i += 2 {
+			v, _ := strconv.ParseUint(hex[i:i+2], 16, 8)
+			b = append(b, byte(v))
+		}
+		return pdfString(b)
+	case c == '[':
+		p.pos++
+		arr := pdfArray{}
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.data) {
+				return arr
+			}
+			if p.data[p.pos] == ']' {
+				p.pos++
+				return arr
+			}
+			start := p.pos
+			arr = append(arr, p.objectDepth(depth+1))
+			if p.pos == start {
+				p.pos++
+			}
+		}
+	case c == '+' || c == '-' || c == '.' || c >= '0' && c <= '9':
+		n, err := strconv.ParseFloat(p.token(), 64)
+		if err != nil {
+			return nil
+		}
+		//an integer followed by another and R is a reference
+		save := p.pos
+		p.skipSpace()
+		if n == float64(int(n)) && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+			if gen, err := strconv.Atoi(p.token()); err == nil {
+				p.skipSpace()
+				if p.hasKeyword("R") {
+					p.pos++
+					return pdfRef{num: int(n), gen: gen}
+				}
+			}
+		}
+		p.pos = save
+		return n
+	default:
+		switch keyword := p.token(); keyword {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "":
+			p.pos++
+		}
+		return nil
+	}
+}
+
+func (p *pdfParser) literalString() pdfString {
+	p.pos++
+	b := make([]byte, 0, 32)
+	for nesting := 1; p.pos < len(p.data); p.pos++ {
+		c := p.data[p.pos]
+		switch c {
+		case '(':
+			nesting++
+		case ')':
+			if nesting--; nesting == 0 {
+				p.pos++
+				return pdfString(b)
+			}
+		case '\\':
+			p.pos++
+			if p.pos >= len(p.data) {
+				return pdfString(b)
+			}
+			c = p.data[p.pos]
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos+1 < len(p.data) && p.data[p.pos+1] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := 0
+					for i := 0; i < 3 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					p.pos--
+					c = byte(v)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfString(b)
+}
+
+func (p *pdfParser) stream(dict pdfDict) *pdfStream {
+	p.pos += len(pdfKeywordStream)
+	if p.pos < len(p.data) && p.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+	length := -1
+	if n, isNumber := dict["Length"].(float64); isNumber {
+		length = int(n)
+	} else if ref, isRef := dict["Length"].(pdfRef); isRef && p.file != nil {
+		if n, isNumber := p.file.resolve(ref).(float64); isNumber {
+			length = int(n)
+		}
+	}
+	end := start + length
+	if length < 0 || end > len(p.data) || !bytes.HasPrefix(bytes.TrimLeft(p.data[end:minInt(len(p.data), end+32)], " \t\r\n\f\x00"), []byte("endstream")) {
+		//the declared length can't be trusted, fall back to the keyword
+		i := bytes.Index(p.data[start:], []byte("endstream"))
+		if i < 0 {
+			p.pos = len(p.data)
+			return &pdfStream{dict: dict, raw: p.data[start:]}
+		}
+		end = start + i
+		for end > start && (p.data[end-1] == '\n' || p.data[end-1] == '\r') {
+			end--
+		}
+	}
+	p.pos = end
+	if i := bytes.Index(p.data[end:], []byte("endstream")); i >= 0 {
+		p.pos = end + i + len("endstream")
+	}
+	return &pdfStream{dict: dict, raw: p.data[start:end]}
+}
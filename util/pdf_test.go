@@ -0,0 +1,91 @@
+package util
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"github.com/modelhub/core/blob"
+	"github.com/robsix/golog"
+	"image/png"
+	"testing"
+)
+
+func deflated(t *testing.T, size int) []byte {
+	buf := &bytes.Buffer{}
+	w := zlib.NewWriter(buf)
+	if _, err := w.Write(make([]byte, size)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeStreamCapsInflatedSize(t *testing.T) {
+	f := &pdfFile{xref: map[int]*pdfXrefEntry{}, objects: map[int]interface{}{}, resolving: map[int]bool{}}
+	dict := pdfDict{"Filter": pdfName("FlateDecode")}
+
+	data, err := f.decodeStream(&pdfStream{dict: dict, raw: deflated(t, 1024)})
+	if err != nil || len(data) != 1024 {
+		t.Fatalf("expected 1024 bytes got %d error: %v", len(data), err)
+	}
+	if _, err := f.decodeStream(&pdfStream{dict: dict, raw: deflated(t, pdfMaxStreamSize+1)}); err != ErrPdfStreamTooLarge {
+		t.Fatalf("expected %v got %v", ErrPdfStreamTooLarge, err)
+	}
+}
+
+// testPdf builds a one page pdf whose page has a 2x1 DeviceGray thumbnail when withThumb is set.
+func testPdf(withThumb bool) []byte {
+	thumb := ""
+	if withThumb {
+		thumb = " /Thumb 4 0 R"
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 10 10]" + thumb + " >>",
+		"<< /Width 2 /Height 1 /BitsPerComponent 8 /ColorSpace /DeviceGray /Length 2 >>\nstream\n\x00\xff\nendstream",
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("%PDF-1.4\n")
+	offsets := []int{}
+	for i, obj := range objects {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestPdfThumbnailGenerateHelperUsesFirstPageThumbnail(t *testing.T) {
+	blobStore := blob.NewFsBlobStore(t.TempDir(), golog.NewConsoleLog(0))
+	if err := blobStore.CreateBucket("bucket"); err != nil {
+		t.Fatal(err)
+	}
+
+	if tnType, err := PdfThumbnailGenerateHelper("id", testPdf(true), "bucket", blobStore); err != nil || tnType != generatedThumbnailType {
+		t.Fatalf("expected %q got %q error: %v", generatedThumbnailType, tnType, err)
+	}
+	res, err := blobStore.Get("bucket", "id.tn.tn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	img, err := png.Decode(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 2 || b.Dy() != 1 {
+		t.Fatalf("expected a 2x1 thumbnail got %dx%d", b.Dx(), b.Dy())
+	}
+
+	if _, err := PdfThumbnailGenerateHelper("other", testPdf(false), "bucket", blobStore); err != ErrPdfNoThumbnail {
+		t.Fatalf("expected %v got %v", ErrPdfNoThumbnail, err)
+	}
+}
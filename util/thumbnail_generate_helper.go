@@ -0,0 +1,121 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"github.com/modelhub/core/blob"
+	_ "golang.org/x/image/webp"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+)
+
+const (
+	// ThumbnailMaxSize bounds the width and height of generated thumbnails.
+	ThumbnailMaxSize = 256
+	// images are fully decoded before being shrunk so very large ones are
+	// refused rather than risk exhausting memory.
+	thumbnailMaxSourcePixels = 32 * 1024 * 1024
+	// images are decoded from a copy kept in memory while they upload, those
+	// larger than this aren't kept in full so aren't thumbnailed.
+	thumbnailMaxSourceSize = 64 * 1024 * 1024
+	generatedThumbnailType = "image/png"
+)
+
+var ErrImageTooLarge = errors.New("image too large to thumbnail")
+
+// ThumbnailGenerateHelper decodes the png, jpeg, gif or webp image seed and
+// stores a png no larger than ThumbnailMaxSize on either side as the thumbnail
+// for id. Pdf files aren't rasterized, there is no pure Go rasterizer we can
+// depend on, PdfThumbnailGenerateHelper uses the thumbnail they embed instead.
+func ThumbnailGenerateHelper(id string, seed []byte, ossBucket string, blobStore blob.BlobStore) (tnType string, err error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(seed))
+	if err != nil {
+		return "", err
+	}
+	if config.Width*config.Height > thumbnailMaxSourcePixels {
+		return "", ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(seed))
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	if err = png.Encode(buf, shrinkImage(img, ThumbnailMaxSize)); err != nil {
+		return "", err
+	}
+	if _, err = blobStore.Put(ossBucket, id+".tn.tn", buf); err != nil {
+		return "", err
+	}
+	return generatedThumbnailType, nil
+}
+
+// seedBuffer keeps the first max bytes written to it, it never fails a write
+// so it can tee a seed file as it uploads without holding up the upload.
+type seedBuffer struct {
+	data      []byte
+	max       int
+	truncated bool
+}
+
+func (sb *seedBuffer) Write(p []byte) (int, error) {
+	if room := sb.max - len(sb.data); room < len(p) {
+		sb.data = append(sb.data, p[:room]...)
+		sb.truncated = true
+	} else {
+		sb.data = append(sb.data, p...)
+	}
+	return len(p), nil
+}
+
+// shrinkImage scales img down by area averaging to fit within maxSize x maxSize
+// keeping its aspect ratio, images which already fit are returned as is.
+func shrinkImage(img image.Image, maxSize int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSize && h <= maxSize {
+		return img
+	}
+	tw, th := maxSize, maxSize
+	if w > h {
+		th = h * maxSize / w
+	} else {
+		tw = w * maxSize / h
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	//averaging premultiplied values stops transparent pixels bleeding their colour into the edges
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, (y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, (x+1)*w/tw
+			var sum [4]uint64
+			n := uint64((y1 - y0) * (x1 - x0))
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += uint64(row[i])
+					sum[1] += uint64(row[i+1])
+					sum[2] += uint64(row[i+2])
+					sum[3] += uint64(row[i+3])
+				}
+			}
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}